@@ -5,14 +5,29 @@ import (
 	"io/ioutil"
 	"os"
 
-	"github.com/google/go-tpm/tpm2"
 	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
 )
 
 // activateCred activates a credential.
-func activateCred() error {
-	err := ensureAllPassed(fActivateSet, credInFlagName, secretInFlagName,
-		handleFlagName, protectorFlagName)
+func activateCred() (err error) {
+	err = ensureAllPassed(fActivateSet, credInFlagName, secretInFlagName, protectorFlagName)
+	if err != nil {
+		return err
+	}
+
+	err = ensureExactlyOnePassed(fActivateSet, contextFlagName, handleFlagName)
+	if err != nil {
+		return err
+	}
+
+	keyAuth, err := newEntityAuth(*fActivatePassword, *fActivatePolicy)
+	if err != nil {
+		return err
+	}
+
+	protectorAuth, err := newEntityAuth(*fActivateProtectorPassword, *fActivateProtectorPolicy)
 	if err != nil {
 		return err
 	}
@@ -35,15 +50,43 @@ func activateCred() error {
 	}
 	defer t.Close()
 
-	cred, err = tpm2.ActivateCredential(t, tpmutil.Handle(fActivateHandle),
-		tpmutil.Handle(fActivateProtector), *fActivatePassword,
-		*fActivateProtectorPassword, cred, secret)
+	handle, release, err := contextHandle(t, fActivateHandle, *fActivateContext)
+	if err != nil {
+		return err
+	}
+	defer release(&err)
+
+	keyAuthz, err := keyAuth.authorize(t, pgtpm.TPM2_CC_ActivateCredential)
+	if err != nil {
+		return fmt.Errorf("failed to authorize key: %v", err)
+	}
+	defer closeAuthorization(t, keyAuthz, &err)
+
+	protectorAuthz, err := protectorAuth.authorize(t, pgtpm.TPM2_CC_ActivateCredential)
+	if err != nil {
+		return fmt.Errorf("failed to authorize protecting key: %v", err)
+	}
+	defer closeAuthorization(t, protectorAuthz, &err)
+
+	params, err := tpmutil.Pack(tpmutil.U16Bytes(cred), tpmutil.U16Bytes(secret))
+	if err != nil {
+		return err
+	}
+
+	_, resp, err := runAuthCommand(t, pgtpm.TPM2_CC_ActivateCredential,
+		[]tpmutil.Handle{handle, tpmutil.Handle(fActivateProtector)},
+		[]authorization{keyAuthz, protectorAuthz}, 0, params)
 	if err != nil {
 		return fmt.Errorf("failed to activate credential: %v", err)
 	}
 
+	var certInfo tpmutil.U16Bytes
+	if _, err := tpmutil.Unpack(resp, &certInfo); err != nil {
+		return fmt.Errorf("failed to decode credential: %v", err)
+	}
+
 	// Output the credential.
-	os.Stdout.Write(cred)
+	os.Stdout.Write(certInfo)
 
 	return nil
 }
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// Attestation structure constants.
+const (
+	attestMagic           = 0xff544347
+	attestCommandAuditTag = 0x8015
+	attestSessionAuditTag = 0x8016
+	attestTimeTag         = 0x8019
+)
+
+// attestFieldWidth is the width of the field names output with attestations.
+const attestFieldWidth = 18
+
+// attestation is a decoded TPMS_ATTEST structure for a session or command
+// audit digest, or for the current time.
+type attestation struct {
+	Type            uint16
+	QualifiedSigner []byte
+	ExtraData       []byte
+	Clock           uint64
+	ResetCount      uint32
+	RestartCount    uint32
+	Safe            bool
+	FirmwareVersion uint64
+
+	// Session audit information.
+	ExclusiveSession bool
+	SessionDigest    []byte
+
+	// Command audit information.
+	AuditCounter  uint64
+	DigestAlg     tpm2.Algorithm
+	AuditDigest   []byte
+	CommandDigest []byte
+
+	// Time information. Unlike the clock information and firmware version
+	// above, this is not obfuscated when the signing key is not in the
+	// endorsement or platform hierarchy.
+	Time                timeInfo
+	TimeFirmwareVersion uint64
+}
+
+// timeInfo is a decoded TPMS_TIME_INFO structure.
+type timeInfo struct {
+	Time         uint64
+	Clock        uint64
+	ResetCount   uint32
+	RestartCount uint32
+	Safe         bool
+}
+
+// getAttestation runs TPM2_GetCommandAuditDigest, TPM2_GetSessionAuditDigest
+// or TPM2_GetTime, authorized by the endorsement hierarchy as the privacy
+// administrator, and returns the attestation and signature. The session
+// handle is used only for session audit digests.
+func getAttestation(rw io.ReadWriter, cc pgtpm.Command, privacyAuth, keyAuth authorization,
+	key tpmutil.Handle, pub tpm2.Public, sess tpmutil.Handle, qualifyingData []byte) ([]byte, []byte, error) {
+	scheme, err := signingScheme(pub, 0, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	handles := []tpmutil.Handle{tpm2.HandleEndorsement, key}
+	if cc == pgtpm.TPM2_CC_GetSessionAuditDigest {
+		handles = append(handles, sess)
+	}
+
+	params, err := tpmutil.Pack(tpmutil.U16Bytes(qualifyingData), scheme.Alg, scheme.Hash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, resp, err := runAuthCommand(rw, cc, handles, []authorization{privacyAuth, keyAuth}, 0, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var attest tpmutil.U16Bytes
+	buf := bytes.NewBuffer(resp)
+	if err := tpmutil.UnpackBuf(buf, &attest); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode attestation: %v", err)
+	}
+
+	return attest, buf.Bytes(), nil
+}
+
+// signedAttestation gets a session or command audit digest, or the current
+// time, signed with a TPM key, and returns the attestation and signature
+// after verifying the signature and the qualifying data.
+func signedAttestation(rw io.ReadWriter, cc pgtpm.Command, key tpmutil.Handle, keyAuth entityAuth,
+	endorsementPassword string, sess tpmutil.Handle, qualifyingData []byte) (_ *attestation, _, _ []byte, err error) {
+	pub, _, _, err := tpm2.ReadPublic(rw, key)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read public area: %v", err)
+	}
+
+	authz, err := keyAuth.authorize(rw, cc)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to authorize key: %v", err)
+	}
+	defer closeAuthorization(rw, authz, &err)
+
+	attest, signature, err := getAttestation(rw, cc, authorization{password: endorsementPassword},
+		authz, key, pub, sess, qualifyingData)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get attestation: %v", err)
+	}
+
+	if err := verifyAttestation(pub, attest, signature); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to verify attestation: %v", err)
+	}
+
+	a, err := decodeAttestation(attest)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if !bytes.Equal(a.ExtraData, qualifyingData) {
+		return nil, nil, nil, errors.New("attestation extra data does not match qualifying data")
+	}
+
+	return a, attest, signature, nil
+}
+
+// decodeAttestation decodes a TPMS_ATTEST structure containing session or
+// command audit information, or time information.
+func decodeAttestation(data []byte) (*attestation, error) {
+	buf := bytes.NewBuffer(data)
+
+	var magic uint32
+	var a attestation
+	var signer, extra tpmutil.U16Bytes
+	var safe uint8
+	if err := tpmutil.UnpackBuf(buf, &magic, &a.Type, &signer, &extra, &a.Clock,
+		&a.ResetCount, &a.RestartCount, &safe, &a.FirmwareVersion); err != nil {
+		return nil, fmt.Errorf("failed to decode attestation: %v", err)
+	}
+
+	if magic != attestMagic {
+		return nil, fmt.Errorf("invalid attestation magic value: 0x%08x", magic)
+	}
+
+	a.QualifiedSigner = signer
+	a.ExtraData = extra
+	a.Safe = safe != 0
+
+	switch a.Type {
+	case attestSessionAuditTag:
+		var exclusive uint8
+		var digest tpmutil.U16Bytes
+		if err := tpmutil.UnpackBuf(buf, &exclusive, &digest); err != nil {
+			return nil, fmt.Errorf("failed to decode session audit information: %v", err)
+		}
+		a.ExclusiveSession = exclusive != 0
+		a.SessionDigest = digest
+
+	case attestCommandAuditTag:
+		var auditDigest, commandDigest tpmutil.U16Bytes
+		if err := tpmutil.UnpackBuf(buf, &a.AuditCounter, &a.DigestAlg, &auditDigest, &commandDigest); err != nil {
+			return nil, fmt.Errorf("failed to decode command audit information: %v", err)
+		}
+		a.AuditDigest = auditDigest
+		a.CommandDigest = commandDigest
+
+	case attestTimeTag:
+		t, err := decodeTimeInfo(buf)
+		if err == nil {
+			err = tpmutil.UnpackBuf(buf, &a.TimeFirmwareVersion)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode time information: %v", err)
+		}
+		a.Time = t
+
+	default:
+		return nil, fmt.Errorf("unexpected attestation type: 0x%04x", a.Type)
+	}
+
+	return &a, nil
+}
+
+// decodeTimeInfo decodes a TPMS_TIME_INFO structure.
+func decodeTimeInfo(buf *bytes.Buffer) (timeInfo, error) {
+	var t timeInfo
+	var safe uint8
+	if err := tpmutil.UnpackBuf(buf, &t.Time, &t.Clock, &t.ResetCount, &t.RestartCount, &safe); err != nil {
+		return timeInfo{}, err
+	}
+	t.Safe = safe != 0
+
+	return t, nil
+}
+
+// verifyAttestation verifies a TPMT_SIGNATURE over an attestation with the
+// public key of the signing key.
+func verifyAttestation(pub tpm2.Public, attest, signature []byte) error {
+	sig, err := tpm2.DecodeSignature(bytes.NewBuffer(signature))
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %v", err)
+	}
+
+	key, err := pub.Key()
+	if err != nil {
+		return fmt.Errorf("failed to get public key: %v", err)
+	}
+
+	var hashAlg tpm2.Algorithm
+	switch {
+	case sig.RSA != nil:
+		hashAlg = sig.RSA.HashAlg
+	case sig.ECC != nil:
+		hashAlg = sig.ECC.HashAlg
+	}
+
+	h, err := hashAlg.Hash()
+	if err != nil {
+		return fmt.Errorf("unsupported signature hash algorithm: %v", pgtpm.Algorithm(hashAlg))
+	}
+	digest := hashConcat(h, attest)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if sig.RSA == nil {
+			return errors.New("signature does not match key type")
+		}
+
+		if sig.Alg == tpm2.AlgRSAPSS {
+			err = rsa.VerifyPSS(k, h, digest, sig.RSA.Signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+		} else {
+			err = rsa.VerifyPKCS1v15(k, h, digest, sig.RSA.Signature)
+		}
+		if err != nil {
+			return errors.New("signature verification failed")
+		}
+
+	case *ecdsa.PublicKey:
+		if sig.ECC == nil {
+			return errors.New("signature does not match key type")
+		}
+
+		if !ecdsa.Verify(k, digest, sig.ECC.R, sig.ECC.S) {
+			return errors.New("signature verification failed")
+		}
+
+	default:
+		return fmt.Errorf("unsupported key type: %T", key)
+	}
+
+	return nil
+}
+
+// outputAttestation outputs the fields of an attestation.
+func outputAttestation(a *attestation) {
+	const fw = attestFieldWidth
+
+	fmt.Printf("%-*s: %s\n", fw, "qualified signer", hexEncodeBytes(a.QualifiedSigner))
+	if len(a.ExtraData) > 0 {
+		fmt.Printf("%-*s: %s\n", fw, "extra data", hexEncodeBytes(a.ExtraData))
+	}
+	fmt.Printf("%-*s: %d\n", fw, "clock", a.Clock)
+	fmt.Printf("%-*s: %d\n", fw, "reset count", a.ResetCount)
+	fmt.Printf("%-*s: %d\n", fw, "restart count", a.RestartCount)
+	fmt.Printf("%-*s: %t\n", fw, "safe", a.Safe)
+	fmt.Printf("%-*s: 0x%016x\n", fw, "firmware version", a.FirmwareVersion)
+
+	switch a.Type {
+	case attestSessionAuditTag:
+		fmt.Printf("%-*s: %t\n", fw, "exclusive session", a.ExclusiveSession)
+		fmt.Printf("%-*s: %s\n", fw, "session digest", hexEncodeBytes(a.SessionDigest))
+
+	case attestCommandAuditTag:
+		fmt.Printf("%-*s: %d\n", fw, "audit counter", a.AuditCounter)
+		fmt.Printf("%-*s: %s\n", fw, "digest algorithm", pgtpm.Algorithm(a.DigestAlg))
+		fmt.Printf("%-*s: %s\n", fw, "audit digest", hexEncodeBytes(a.AuditDigest))
+		fmt.Printf("%-*s: %s\n", fw, "command digest", hexEncodeBytes(a.CommandDigest))
+
+	case attestTimeTag:
+		fmt.Printf("%-*s: %d\n", fw, "time", a.Time.Time)
+		fmt.Printf("%-*s: %d\n", fw, "time clock", a.Time.Clock)
+		fmt.Printf("%-*s: %d\n", fw, "time reset count", a.Time.ResetCount)
+		fmt.Printf("%-*s: %d\n", fw, "time restart count", a.Time.RestartCount)
+		fmt.Printf("%-*s: %t\n", fw, "time safe", a.Time.Safe)
+		fmt.Printf("%-*s: 0x%016x\n", fw, "time firmware", a.TimeFirmwareVersion)
+	}
+}
+
+// writeAttestOutputs writes an attestation and its signature to the files
+// named, if any.
+func writeAttestOutputs(attest, signature []byte, attestOut, sigOut string) error {
+	if attestOut != "" {
+		if err := ioutil.WriteFile(attestOut, attest, 0644); err != nil {
+			return fmt.Errorf("failed to write attestation: %v", err)
+		}
+	}
+
+	if sigOut != "" {
+		if err := ioutil.WriteFile(sigOut, signature, 0644); err != nil {
+			return fmt.Errorf("failed to write signature: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// auditLogHash is the hash algorithm of new audit logs.
+const auditLogHash = tpm2.AlgSHA256
+
+// auditLog is a local log of the commands run in an audit session, from
+// which session and command audit digests can be recomputed in software.
+type auditLog struct {
+	HashAlg pgtpm.Algorithm    `json:"hash_alg"`
+	Session *auditSessionState `json:"session,omitempty"`
+
+	// CommandAuditStart is the index of the first entry recorded since the
+	// command audit digest was last cleared.
+	CommandAuditStart int          `json:"command_audit_start"`
+	Entries           []auditEntry `json:"entries"`
+
+	path string
+	sess *session
+}
+
+// auditSessionState is the state of an audit session which must be kept
+// between invocations to continue using it.
+type auditSessionState struct {
+	Handle   policyHandle `json:"handle"`
+	NonceTPM hexBytes     `json:"nonce_tpm"`
+
+	// First is the index of the first entry recorded in the session.
+	First int `json:"first_entry"`
+}
+
+// auditEntry records the command and response parameter hashes of a command
+// run in an audit session.
+type auditEntry struct {
+	Command pgtpm.Command `json:"command"`
+	CPHash  hexBytes      `json:"cp_hash"`
+	RPHash  hexBytes      `json:"rp_hash"`
+}
+
+// globalAuditLog is the audit log named by the global -audit option, once
+// loaded.
+var globalAuditLog *auditLog
+
+// loadAuditLog loads an audit log from the named file, or returns a new, empty
+// log if the file does not exist.
+func loadAuditLog(name string) (*auditLog, error) {
+	l := &auditLog{HashAlg: pgtpm.Algorithm(auditLogHash), path: name}
+
+	data, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return l, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %v", err)
+	}
+
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("failed to parse audit log: %v", err)
+	}
+
+	if l.CommandAuditStart < 0 || l.CommandAuditStart > len(l.Entries) ||
+		(l.Session != nil && (l.Session.First < 0 || l.Session.First > len(l.Entries))) {
+		return nil, errors.New("invalid audit log entry index")
+	}
+
+	return l, nil
+}
+
+// save writes the audit log to its file.
+func (l *auditLog) save() error {
+	data, err := json.MarshalIndent(l, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit log: %v", err)
+	}
+
+	if err := ioutil.WriteFile(l.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write audit log: %v", err)
+	}
+
+	return nil
+}
+
+// hash returns the hash function of the audit log.
+func (l *auditLog) hash() (crypto.Hash, error) {
+	h, err := tpm2.Algorithm(l.HashAlg).Hash()
+	if err != nil {
+		return 0, fmt.Errorf("unsupported audit log hash algorithm: %v", l.HashAlg)
+	}
+
+	return h, nil
+}
+
+// currentAuditLog returns the audit log named by the global -audit option,
+// or nil if the option was not provided.
+func currentAuditLog() (*auditLog, error) {
+	if *fGlobalAudit == "" || globalAuditLog != nil {
+		return globalAuditLog, nil
+	}
+
+	l, err := loadAuditLog(*fGlobalAudit)
+	if err != nil {
+		return nil, err
+	}
+	globalAuditLog = l
+
+	return l, nil
+}
+
+// session returns the log's audit session. The session recorded in the log
+// is continued if there is one, otherwise a new session is started and its
+// handle and nonce recorded so that later invocations may continue it. The
+// session is not flushed, so it survives only if the TPM is not accessed
+// through a resource manager, which getTPM ensures.
+func (l *auditLog) session(rw io.ReadWriter) (*session, error) {
+	if l.sess != nil {
+		return l.sess, nil
+	}
+
+	h, err := l.hash()
+	if err != nil {
+		return nil, err
+	}
+
+	if l.Session != nil {
+		l.sess = &session{
+			handle:   tpmutil.Handle(l.Session.Handle),
+			hash:     h,
+			nonceTPM: l.Session.NonceTPM,
+			hmac:     true,
+			audit:    true,
+		}
+
+		return l.sess, nil
+	}
+
+	s, err := startSession(rw, tpm2.SessionHMAC, tpm2.Algorithm(l.HashAlg))
+	if err != nil {
+		return nil, err
+	}
+
+	// The audit session authorizes no entity, so no authValue is included
+	// in its HMAC key.
+	s.authValue = false
+	s.audit = true
+
+	l.sess = s
+	l.Session = &auditSessionState{
+		Handle:   policyHandle(s.handle),
+		NonceTPM: s.nonceTPM,
+		First:    len(l.Entries),
+	}
+
+	if err := l.save(); err != nil {
+		s.close(rw)
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// record appends a command run in the audit session to the log, together
+// with the session's latest TPM nonce, and saves the log.
+func (l *auditLog) record(cc pgtpm.Command, cpHash, rpHash []byte) error {
+	l.Session.NonceTPM = l.sess.nonceTPM
+	l.Entries = append(l.Entries, auditEntry{Command: cc, CPHash: cpHash, RPHash: rpHash})
+
+	return l.save()
+}
+
+// sessionDigest recomputes the audit digest of the log's audit session.
+func (l *auditLog) sessionDigest() ([]byte, int, error) {
+	if l.Session == nil {
+		return nil, 0, errors.New("audit log has no audit session")
+	}
+
+	h, err := l.hash()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries := l.Entries[l.Session.First:]
+
+	return replayAudit(h, entries), len(entries), nil
+}
+
+// commandDigest recomputes the command audit digest from the entries
+// starting at the specified index, for those commands which are audited. The
+// TPM extends the digest with the audited commands of every client, so the
+// result matches only if the log was the only client to run audited commands
+// since the digest was cleared. A mismatch therefore shows that the log is
+// incomplete or has been tampered with, not which.
+func (l *auditLog) commandDigest(start int, audited []pgtpm.Command) ([]byte, int, error) {
+	h, err := l.hash()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	isAudited := make(map[pgtpm.Command]bool)
+	for _, cc := range audited {
+		isAudited[cc] = true
+	}
+
+	var entries []auditEntry
+	for _, e := range l.Entries[start:] {
+		if isAudited[e.Command] {
+			entries = append(entries, e)
+		}
+	}
+
+	// The TPM reports an empty digest if no audited command has been run
+	// since the digest was cleared.
+	if len(entries) == 0 {
+		return nil, 0, nil
+	}
+
+	return replayAudit(h, entries), len(entries), nil
+}
+
+// replayAudit computes an audit digest by extending a zero digest with the
+// command and response parameter hashes of each entry, per TPM 2.0 Part 1
+// section 19.6.
+func replayAudit(h crypto.Hash, entries []auditEntry) []byte {
+	digest := make([]byte, h.Size())
+	for _, e := range entries {
+		digest = hashConcat(h, digest, e.CPHash, e.RPHash)
+	}
+
+	return digest
+}
+
+// auditedCommands returns the command codes which are audited by the TPM.
+func auditedCommands(rw io.ReadWriter) ([]pgtpm.Command, error) {
+	ccs, err := capabilityCommands(rw, pgtpm.TPM2_CAP_AUDIT_COMMANDS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audited commands: %v", err)
+	}
+
+	return ccs, nil
+}
+
+// commandListDigest computes the digest of a list of command codes, as
+// reported in command audit attestations.
+func commandListDigest(h crypto.Hash, ccs []pgtpm.Command) []byte {
+	sorted := append([]pgtpm.Command{}, ccs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	data := make([]byte, 0, 4*len(sorted))
+	for _, cc := range sorted {
+		data = append(data, byte(cc>>24), byte(cc>>16), byte(cc>>8), byte(cc))
+	}
+
+	return hashConcat(h, data)
+}
+
+// parseCommandCode parses a command code, either as a name with or without
+// the TPM2_CC_ prefix, or as an integer.
+func parseCommandCode(s string) (pgtpm.Command, error) {
+	if n, err := strconv.ParseUint(s, 0, 32); err == nil {
+		return pgtpm.Command(n), nil
+	}
+
+	if !strings.HasPrefix(s, "TPM2_CC_") {
+		s = "TPM2_CC_" + s
+	}
+
+	quoted, err := json.Marshal(s)
+	if err != nil {
+		return 0, err
+	}
+
+	var cc pgtpm.Command
+	if err := json.Unmarshal(quoted, &cc); err != nil {
+		return 0, fmt.Errorf("invalid command code: %s", strings.TrimPrefix(s, "TPM2_CC_"))
+	}
+
+	return cc, nil
+}
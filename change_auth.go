@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// changeAuth changes the authorization value of a hierarchy, or of a loaded
+// object, in which case the new private area of the object is output.
+func changeAuth() (err error) {
+	err = ensureExactlyOnePassed(fChangeAuthSet, contextFlagName, endorsementFlagName,
+		handleFlagName, lockoutFlagName, ownerFlagName, platformFlagName)
+	if err != nil {
+		return err
+	}
+
+	err = ensureAllPassed(fChangeAuthSet, newPasswordFlagName)
+	if err != nil {
+		return err
+	}
+
+	isObject := isFlagPassed(fChangeAuthSet, handleFlagName) || isFlagPassed(fChangeAuthSet, contextFlagName)
+	if n := countFlagsPassed(fChangeAuthSet, parentFlagName, privOutFlagName); isObject && n != 2 {
+		return fmt.Errorf("-%s and -%s must be provided with -%s or -%s",
+			parentFlagName, privOutFlagName, handleFlagName, contextFlagName)
+	} else if !isObject && n != 0 {
+		return fmt.Errorf("-%s and -%s may only be provided with -%s or -%s",
+			parentFlagName, privOutFlagName, handleFlagName, contextFlagName)
+	}
+
+	auth, err := newEntityAuth(*fChangeAuthPassword, *fChangeAuthPolicy)
+	if err != nil {
+		return err
+	}
+
+	t, err := getTPM(*fChangeAuthTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	newAuth, err := tpmutil.Pack(tpmutil.U16Bytes(*fChangeAuthNewPassword))
+	if err != nil {
+		return err
+	}
+
+	if !isObject {
+		hierarchy := tpm2.HandleOwner
+		switch {
+		case *fChangeAuthEndorsement:
+			hierarchy = tpm2.HandleEndorsement
+		case *fChangeAuthLockout:
+			hierarchy = tpm2.HandleLockout
+		case *fChangeAuthPlatform:
+			hierarchy = tpm2.HandlePlatform
+		}
+
+		authz, err := auth.authorize(t, pgtpm.TPM2_CC_HierarchyChangeAuth)
+		if err != nil {
+			return fmt.Errorf("failed to authorize hierarchy: %v", err)
+		}
+		defer closeAuthorization(t, authz, &err)
+
+		_, _, err = runAuthCommand(t, pgtpm.TPM2_CC_HierarchyChangeAuth,
+			[]tpmutil.Handle{hierarchy}, []authorization{authz}, 0, newAuth)
+		if err != nil {
+			return fmt.Errorf("failed to change hierarchy authorization: %v", err)
+		}
+
+		return nil
+	}
+
+	handle, release, err := contextHandle(t, fChangeAuthHandle, *fChangeAuthContext)
+	if err != nil {
+		return err
+	}
+	defer release(&err)
+
+	authz, err := auth.authorize(t, pgtpm.TPM2_CC_ObjectChangeAuth)
+	if err != nil {
+		return fmt.Errorf("failed to authorize object: %v", err)
+	}
+	defer closeAuthorization(t, authz, &err)
+
+	// Only the object requires authorization. The parent is used to
+	// protect the new private area, which must be loaded under it before
+	// the new authorization value can be used.
+	_, resp, err := runAuthCommand(t, pgtpm.TPM2_CC_ObjectChangeAuth,
+		[]tpmutil.Handle{handle, tpmutil.Handle(fChangeAuthParent)}, []authorization{authz}, 0, newAuth)
+	if err != nil {
+		return fmt.Errorf("failed to change object authorization: %v", err)
+	}
+
+	var private tpmutil.U16Bytes
+	if _, err := tpmutil.Unpack(resp, &private); err != nil {
+		return fmt.Errorf("failed to decode private area: %v", err)
+	}
+
+	if err := ioutil.WriteFile(*fChangeAuthPrivateOut, private, 0600); err != nil {
+		return fmt.Errorf("failed to write private area: %v", err)
+	}
+
+	return nil
+}
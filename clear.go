@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// errNotConfirmed is returned when a destructive command is not confirmed.
+var errNotConfirmed = errors.New("operation not confirmed")
+
+// clearTPM removes all TPM context associated with the owner and endorsement
+// hierarchies, including persistent objects and owner NV indices.
+func clearTPM() (err error) {
+	auth, err := newEntityAuth(*fClearPassword, *fClearPolicy)
+	if err != nil {
+		return err
+	}
+
+	if !*fClearForce {
+		if err := confirm("This will delete all keys, persistent objects and NV indices in the\n" +
+			"owner and endorsement hierarchies, and reset their authorization values."); err != nil {
+			return err
+		}
+	}
+
+	t, err := getTPM(*fClearTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	authz, err := auth.authorize(t, pgtpm.TPM2_CC_Clear)
+	if err != nil {
+		return fmt.Errorf("failed to authorize hierarchy: %v", err)
+	}
+	defer closeAuthorization(t, authz, &err)
+
+	_, _, err = runAuthCommand(t, pgtpm.TPM2_CC_Clear,
+		[]tpmutil.Handle{clearAuthHandle(*fClearPlatform)}, []authorization{authz}, 0, nil)
+	if err != nil {
+		return fmt.Errorf("failed to clear TPM: %v", err)
+	}
+
+	return nil
+}
+
+// clearAuthHandle returns the handle of the hierarchy authorizing TPM2_Clear
+// and TPM2_ClearControl, which is the lockout hierarchy unless platform is
+// true.
+func clearAuthHandle(platform bool) tpmutil.Handle {
+	if platform {
+		return tpm2.HandlePlatform
+	}
+
+	return tpm2.HandleLockout
+}
+
+// confirm outputs a warning and asks the user to confirm a destructive
+// operation by entering "yes", returning errNotConfirmed if they do not.
+func confirm(warning string) error {
+	fmt.Fprintf(os.Stderr, "%s\n", warning)
+	fmt.Fprint(os.Stderr, "Type \"yes\" to continue: ")
+
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && !(err == io.EOF && line != "") {
+		fmt.Fprintln(os.Stderr)
+		if err == io.EOF {
+			return errNotConfirmed
+		}
+
+		return fmt.Errorf("failed to read confirmation: %v", err)
+	}
+
+	if strings.TrimSpace(line) != "yes" {
+		return errNotConfirmed
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// clearControl enables or disables the execution of TPM2_Clear.
+func clearControl() (err error) {
+	err = ensureExactlyOnePassed(fClearControlSet, disableFlagName, enableFlagName)
+	if err != nil {
+		return err
+	}
+
+	// The TPM treats an attempt to enable TPM2_Clear with lockout
+	// authorization as an authorization failure, which would put the
+	// lockout hierarchy into lockout.
+	if *fClearControlEnable && !*fClearControlPlatform {
+		return fmt.Errorf("-%s must be provided with -%s", platformFlagName, enableFlagName)
+	}
+
+	auth, err := newEntityAuth(*fClearControlPassword, *fClearControlPolicy)
+	if err != nil {
+		return err
+	}
+
+	if *fClearControlDisable && !*fClearControlForce {
+		if err := confirm("This will prevent the TPM from being cleared until clearing is enabled\n" +
+			"again with platform authorization."); err != nil {
+			return err
+		}
+	}
+
+	t, err := getTPM(*fClearControlTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	var disable byte
+	if *fClearControlDisable {
+		disable = 1
+	}
+
+	params, err := tpmutil.Pack(disable)
+	if err != nil {
+		return err
+	}
+
+	authz, err := auth.authorize(t, pgtpm.TPM2_CC_ClearControl)
+	if err != nil {
+		return fmt.Errorf("failed to authorize hierarchy: %v", err)
+	}
+	defer closeAuthorization(t, authz, &err)
+
+	_, _, err = runAuthCommand(t, pgtpm.TPM2_CC_ClearControl,
+		[]tpmutil.Handle{clearAuthHandle(*fClearControlPlatform)}, []authorization{authz}, 0, params)
+	if err != nil {
+		return fmt.Errorf("failed to change clear control state: %v", err)
+	}
+
+	return nil
+}
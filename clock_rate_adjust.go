@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// clockAdjustments maps names to TPM_CLOCK_ADJUST values.
+var clockAdjustments = map[string]int8{
+	"coarse-slower": -3,
+	"medium-slower": -2,
+	"fine-slower":   -1,
+	"none":          0,
+	"fine-faster":   1,
+	"medium-faster": 2,
+	"coarse-faster": 3,
+}
+
+// clockRateAdjust adjusts the rate at which the TPM clock advances.
+func clockRateAdjust() (err error) {
+	err = ensureAllPassed(fClockRateAdjustSet, adjustFlagName)
+	if err != nil {
+		return err
+	}
+
+	adjust, ok := clockAdjustments[*fClockRateAdjustAdjust]
+	if !ok {
+		return fmt.Errorf("unsupported clock rate adjustment: %s", *fClockRateAdjustAdjust)
+	}
+
+	ownerAuth, err := newEntityAuth(*fClockRateAdjustOwnerPassword, *fClockRateAdjustPolicy)
+	if err != nil {
+		return err
+	}
+
+	t, err := getTPM(*fClockRateAdjustTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	params, err := tpmutil.Pack(adjust)
+	if err != nil {
+		return err
+	}
+
+	authz, err := ownerAuth.authorize(t, pgtpm.TPM2_CC_ClockRateAdjust)
+	if err != nil {
+		return fmt.Errorf("failed to authorize owner: %v", err)
+	}
+	defer closeAuthorization(t, authz, &err)
+
+	_, _, err = runAuthCommand(t, pgtpm.TPM2_CC_ClockRateAdjust,
+		[]tpmutil.Handle{tpm2.HandleOwner}, []authorization{authz}, 0, params)
+	if err != nil {
+		return fmt.Errorf("failed to adjust clock rate: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/tpmtool/tpmkey"
+)
+
+// contextLoad loads a saved context from a file, and outputs the handle of
+// the loaded object or session.
+func contextLoad() error {
+	err := ensureAllPassed(fContextLoadSet, inFlagName)
+	if err != nil {
+		return err
+	}
+
+	t, err := getTPM(*fContextLoadTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	handle, err := loadContextFile(t, *fContextLoadIn)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("0x%08x\n", uint32(handle))
+
+	return nil
+}
+
+// loadContextFile reads a saved context from the named file and loads it
+// into the TPM.
+func loadContextFile(rw io.ReadWriter, name string) (tpmutil.Handle, error) {
+	context, err := ioutil.ReadFile(name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read context file: %v", err)
+	}
+
+	handle, err := tpm2.ContextLoad(rw, context)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load context: %v", err)
+	}
+
+	return handle, nil
+}
+
+// contextHandle returns the handle passed with a command's -handle option,
+// or loads the context file passed with its -context option and returns the
+// handle of the loaded object. The returned function flushes a loaded object,
+// reporting any error as with closeAuthorization, and should be deferred.
+func contextHandle(rw io.ReadWriter, h handleFlag, contextFile string) (tpmutil.Handle, func(*error), error) {
+	if contextFile == "" {
+		return tpmutil.Handle(h), func(*error) {}, nil
+	}
+
+	handle, err := loadContextFile(rw, contextFile)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	release := func(errp *error) {
+		if err := tpm2.FlushContext(rw, handle); err != nil {
+			err = fmt.Errorf("failed to flush object: %v", err)
+			if *errp == nil {
+				*errp = err
+			} else {
+				log.Printf("%v", err)
+			}
+		}
+	}
+
+	return handle, release, nil
+}
+
+// contextKey returns the key with the handle passed with a command's -handle
+// option, or loads the key from the context file passed with its -context
+// option. The key should be closed when no longer needed.
+func contextKey(rw io.ReadWriter, h handleFlag, contextFile, password string) (*tpmkey.Key, error) {
+	if contextFile == "" {
+		return tpmkey.New(rw, tpmutil.Handle(h), password)
+	}
+
+	return tpmkey.LoadContextFile(rw, contextFile, password)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// contextSave saves the context of a transient object or session to a file.
+func contextSave() error {
+	err := ensureAllPassed(fContextSaveSet, handleFlagName)
+	if err != nil {
+		return err
+	}
+
+	handle := tpmutil.Handle(fContextSaveHandle)
+
+	// Saving a session's context unloads it, but the TPM continues to track
+	// it, and flushing it would invalidate the saved context.
+	switch pgtpm.Handle(handle).HandleType() {
+	case pgtpm.TPM2_HT_HMAC_SESSION, pgtpm.TPM2_HT_POLICY_SESSION:
+		if *fContextSaveFlush {
+			return fmt.Errorf("-%s may not be provided for a session", flushFlagName)
+		}
+	}
+
+	t, err := getTPM(*fContextSaveTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	context, err := tpm2.ContextSave(t, handle)
+	if err != nil {
+		return fmt.Errorf("failed to save context: %v", err)
+	}
+
+	if *fContextSaveOut != "" {
+		if err := ioutil.WriteFile(*fContextSaveOut, context, 0600); err != nil {
+			return fmt.Errorf("failed to write output file: %v", err)
+		}
+	} else {
+		os.Stdout.Write(context)
+	}
+
+	if *fContextSaveFlush {
+		if err := tpm2.FlushContext(t, handle); err != nil {
+			return fmt.Errorf("failed to flush object: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// saveContextFile saves the context of a transient object to the named file.
+func saveContextFile(rw io.ReadWriter, handle tpmutil.Handle, name string) error {
+	context, err := tpm2.ContextSave(rw, handle)
+	if err != nil {
+		return fmt.Errorf("failed to save context: %v", err)
+	}
+
+	if err := ioutil.WriteFile(name, context, 0600); err != nil {
+		return fmt.Errorf("failed to write context file: %v", err)
+	}
+
+	return nil
+}
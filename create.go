@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -15,20 +14,24 @@ import (
 
 // createObject creates an object.
 func createObject() (err error) {
-	err = ensureAllPassed(fCreateSet, templateFlagName, parentFlagName)
+	err = ensureAllPassed(fCreateSet, parentFlagName)
 	if err != nil {
 		return err
 	}
 
-	// Read template.
-	data, err := ioutil.ReadFile(*fCreateTemplate)
+	// Read or generate template.
+	tmpl, err := commandTemplate(fCreateSet, *fCreateTemplate, *fCreateAlg, *fCreateAttrs, *fCreateNameAlg)
 	if err != nil {
-		return fmt.Errorf("failed to read template: %v", err)
+		return err
 	}
 
-	var tmpl pgtpm.PublicTemplate
-	if err := json.Unmarshal(data, &tmpl); err != nil {
-		return fmt.Errorf("failed to unmarshal template: %v", err)
+	// Read data to seal, if provided.
+	var data []byte
+	if *fCreateData != "" {
+		data, err = ioutil.ReadFile(*fCreateData)
+		if err != nil {
+			return fmt.Errorf("failed to read data file: %v", err)
+		}
 	}
 
 	// Create object.
@@ -38,20 +41,43 @@ func createObject() (err error) {
 	}
 	defer t.Close()
 
+	if err := checkTemplate(t, tmpl); err != nil {
+		return err
+	}
+
 	parentHandle := tpmutil.Handle(fCreateParent)
 
-	private, public, _, _, _, err := tpm2.CreateKey(t, parentHandle, tpm2.PCRSelection{},
-		*fCreateParentPassword, *fCreatePassword, tmpl.ToPublic())
+	params, err := createParams(tmpl, *fCreatePassword, data)
+	if err != nil {
+		return err
+	}
+
+	_, resp, err := runAuthCommand(t, pgtpm.TPM2_CC_Create, []tpmutil.Handle{parentHandle},
+		[]authorization{{password: *fCreateParentPassword}}, 0, params)
 	if err != nil {
 		return fmt.Errorf("failed to create object: %v", err)
 	}
 
-	// Make object persistent, if requested.
-	if fCreatePersistent != 0 {
-		handle, _, err := tpm2.Load(t, parentHandle, *fCreateParentPassword, public, private)
+	var private, public tpmutil.U16Bytes
+	if _, err := tpmutil.Unpack(resp, &private, &public); err != nil {
+		return fmt.Errorf("failed to decode created object: %v", err)
+	}
+
+	// Load the object to make it persistent or save its context, if
+	// requested.
+	if fCreatePersistent != 0 || *fCreateContextOut != "" {
+		params, err := tpmutil.Pack(private, public)
+		if err != nil {
+			return err
+		}
+
+		rhandles, _, err := runAuthCommand(t, pgtpm.TPM2_CC_Load, []tpmutil.Handle{parentHandle},
+			[]authorization{{password: *fCreateParentPassword}}, 1, params)
 		if err != nil {
 			return fmt.Errorf("failed to load object: %v", err)
 		}
+		handle := rhandles[0]
+
 		defer func() {
 			if ferr := tpm2.FlushContext(t, handle); ferr != nil {
 				if err == nil {
@@ -62,10 +88,18 @@ func createObject() (err error) {
 			}
 		}()
 
-		err = tpm2.EvictControl(t, *fCreateOwnerPassword, tpm2.HandleOwner,
-			handle, tpmutil.Handle(fCreatePersistent))
-		if err != nil {
-			return fmt.Errorf("failed to evict object: %v", err)
+		if fCreatePersistent != 0 {
+			err = evictControl(t, authorization{password: *fCreateOwnerPassword},
+				handle, tpmutil.Handle(fCreatePersistent))
+			if err != nil {
+				return fmt.Errorf("failed to evict object: %v", err)
+			}
+		}
+
+		if *fCreateContextOut != "" {
+			if err := saveContextFile(t, handle, *fCreateContextOut); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -97,3 +131,20 @@ func createObject() (err error) {
 
 	return nil
 }
+
+// createParams returns the parameters for TPM2_Create and TPM2_CreatePrimary,
+// which begin with the sensitive area so that it may be encrypted. No
+// creation data is requested.
+func createParams(public tpm2.Public, password string, data []byte) ([]byte, error) {
+	pub, err := public.Encode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public area: %v", err)
+	}
+
+	sensitive, err := tpmutil.Pack(tpmutil.U16Bytes(password), tpmutil.U16Bytes(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return tpmutil.Pack(tpmutil.U16Bytes(sensitive), tpmutil.U16Bytes(pub), tpmutil.U16Bytes(nil), uint32(0))
+}
@@ -1,9 +1,7 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 
 	"github.com/google/go-tpm/tpm2"
@@ -14,20 +12,16 @@ import (
 
 // createPrimary creates a primary object.
 func createPrimary() (err error) {
-	err = ensureAllPassed(fCreatePrimarySet, templateFlagName, persistentFlagName)
-	if err != nil {
-		return err
+	if countFlagsPassed(fCreatePrimarySet, contextOutFlagName, persistentFlagName) == 0 {
+		return fmt.Errorf("at least one of %s must be provided",
+			listifyFlagNames(contextOutFlagName, persistentFlagName))
 	}
 
-	// Read template.
-	data, err := ioutil.ReadFile(*fCreatePrimaryTemplate)
+	// Read or generate template.
+	tmpl, err := commandTemplate(fCreatePrimarySet, *fCreatePrimaryTemplate,
+		*fCreatePrimaryAlg, *fCreatePrimaryAttrs, *fCreatePrimaryNameAlg)
 	if err != nil {
-		return fmt.Errorf("failed to read template: %v", err)
-	}
-
-	var tmpl pgtpm.PublicTemplate
-	if err := json.Unmarshal(data, &tmpl); err != nil {
-		return fmt.Errorf("failed to unmarshal template: %v", err)
+		return err
 	}
 
 	// Create primary object.
@@ -37,6 +31,10 @@ func createPrimary() (err error) {
 	}
 	defer t.Close()
 
+	if err := checkTemplate(t, tmpl); err != nil {
+		return err
+	}
+
 	owner := tpm2.HandleOwner
 	if *fCreatePrimaryEndorsement {
 		owner = tpm2.HandleEndorsement
@@ -44,11 +42,18 @@ func createPrimary() (err error) {
 		owner = tpm2.HandlePlatform
 	}
 
-	handle, _, err := tpm2.CreatePrimary(t, owner, tpm2.PCRSelection{},
-		*fCreatePrimaryOwnerPassword, *fCreatePrimaryPassword, tmpl.ToPublic())
+	params, err := createParams(tmpl, *fCreatePrimaryPassword, nil)
+	if err != nil {
+		return err
+	}
+
+	rhandles, _, err := runAuthCommand(t, pgtpm.TPM2_CC_CreatePrimary, []tpmutil.Handle{owner},
+		[]authorization{{password: *fCreatePrimaryOwnerPassword}}, 1, params)
 	if err != nil {
 		return fmt.Errorf("failed to create primary object: %v", err)
 	}
+	handle := rhandles[0]
+
 	defer func() {
 		if ferr := tpm2.FlushContext(t, handle); ferr != nil {
 			if err == nil {
@@ -59,11 +64,20 @@ func createPrimary() (err error) {
 		}
 	}()
 
-	// Make primary object persistent.
-	err = tpm2.EvictControl(t, *fCreatePrimaryOwnerPassword, tpm2.HandleOwner,
-		handle, tpmutil.Handle(fCreatePrimaryPersistent))
-	if err != nil {
-		return fmt.Errorf("failed to evict primary object: %v", err)
+	// Make primary object persistent, if requested.
+	if fCreatePrimaryPersistent != 0 {
+		err = evictControl(t, authorization{password: *fCreatePrimaryOwnerPassword},
+			handle, tpmutil.Handle(fCreatePrimaryPersistent))
+		if err != nil {
+			return fmt.Errorf("failed to evict primary object: %v", err)
+		}
+	}
+
+	// Save primary object context, if requested.
+	if *fCreatePrimaryContextOut != "" {
+		if err := saveContextFile(t, handle, *fCreatePrimaryContextOut); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// daLockReset resets the dictionary attack lockout counter, taking the TPM
+// out of lockout.
+func daLockReset() (err error) {
+	auth, err := newEntityAuth(*fDALockResetPassword, *fDALockResetPolicy)
+	if err != nil {
+		return err
+	}
+
+	t, err := getTPM(*fDALockResetTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	authz, err := auth.authorize(t, pgtpm.TPM2_CC_DictionaryAttackLockReset)
+	if err != nil {
+		return fmt.Errorf("failed to authorize lockout: %v", err)
+	}
+	defer closeAuthorization(t, authz, &err)
+
+	_, _, err = runAuthCommand(t, pgtpm.TPM2_CC_DictionaryAttackLockReset,
+		[]tpmutil.Handle{tpm2.HandleLockout}, []authorization{authz}, 0, nil)
+	if err != nil {
+		return fmt.Errorf("failed to reset dictionary attack lockout: %v", err)
+	}
+
+	return nil
+}
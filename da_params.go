@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// daStatus is the dictionary attack protection state of the TPM. The JSON
+// field names are part of the output format of the daparams command, and
+// should not be changed.
+type daStatus struct {
+	InLockout       bool   `json:"in_lockout"`
+	LockoutCounter  uint32 `json:"lockout_counter"`
+	MaxTries        uint32 `json:"max_tries"`
+	RecoveryTime    uint32 `json:"recovery_time"`
+	LockoutRecovery uint32 `json:"lockout_recovery"`
+}
+
+// daParams changes the dictionary attack protection parameters of the TPM
+// or, if no new parameters are provided, outputs them along with the current
+// lockout state.
+func daParams() (err error) {
+	switch *fDAParamsFormat {
+	case textFormat, jsonFormat:
+	default:
+		return fmt.Errorf("unsupported output format: %s", *fDAParamsFormat)
+	}
+
+	for _, v := range []struct {
+		name  string
+		value uint
+	}{
+		{lockoutRecoveryFlagName, *fDAParamsLockoutRecovery},
+		{maxTriesFlagName, *fDAParamsMaxTries},
+		{recoveryTimeFlagName, *fDAParamsRecoveryTime},
+	} {
+		if v.value > math.MaxUint32 {
+			return fmt.Errorf("-%s must not be greater than %d", v.name, uint32(math.MaxUint32))
+		}
+	}
+
+	auth, err := newEntityAuth(*fDAParamsPassword, *fDAParamsPolicy)
+	if err != nil {
+		return err
+	}
+
+	t, err := getTPM(*fDAParamsTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	status, err := getDAStatus(t)
+	if err != nil {
+		return err
+	}
+
+	if countFlagsPassed(fDAParamsSet, lockoutRecoveryFlagName, maxTriesFlagName, recoveryTimeFlagName) == 0 {
+		return outputDAStatus(status)
+	}
+
+	// TPM2_DictionaryAttackParameters sets all the parameters at once, so
+	// any which were not provided keep their current values.
+	if isFlagPassed(fDAParamsSet, maxTriesFlagName) {
+		status.MaxTries = uint32(*fDAParamsMaxTries)
+	}
+	if isFlagPassed(fDAParamsSet, recoveryTimeFlagName) {
+		status.RecoveryTime = uint32(*fDAParamsRecoveryTime)
+	}
+	if isFlagPassed(fDAParamsSet, lockoutRecoveryFlagName) {
+		status.LockoutRecovery = uint32(*fDAParamsLockoutRecovery)
+	}
+
+	params, err := tpmutil.Pack(status.MaxTries, status.RecoveryTime, status.LockoutRecovery)
+	if err != nil {
+		return err
+	}
+
+	authz, err := auth.authorize(t, pgtpm.TPM2_CC_DictionaryAttackParameters)
+	if err != nil {
+		return fmt.Errorf("failed to authorize lockout: %v", err)
+	}
+	defer closeAuthorization(t, authz, &err)
+
+	_, _, err = runAuthCommand(t, pgtpm.TPM2_CC_DictionaryAttackParameters,
+		[]tpmutil.Handle{tpm2.HandleLockout}, []authorization{authz}, 0, params)
+	if err != nil {
+		return fmt.Errorf("failed to set dictionary attack parameters: %v", err)
+	}
+
+	return nil
+}
+
+// getDAStatus returns the dictionary attack protection state of the TPM.
+func getDAStatus(rw io.ReadWriter) (daStatus, error) {
+	props, err := tpmProperties(rw)
+	if err != nil {
+		return daStatus{}, err
+	}
+
+	var status daStatus
+	for _, p := range props {
+		switch p.Property {
+		case ptPermanent:
+			status.InLockout = p.Value&permInLockout != 0
+		case ptLockoutCounter:
+			status.LockoutCounter = p.Value
+		case ptMaxAuthFail:
+			status.MaxTries = p.Value
+		case ptLockoutInterval:
+			status.RecoveryTime = p.Value
+		case ptLockoutRecovery:
+			status.LockoutRecovery = p.Value
+		}
+	}
+
+	return status, nil
+}
+
+// outputDAStatus outputs the dictionary attack protection state of the TPM
+// in the format selected with the -format option.
+func outputDAStatus(status daStatus) error {
+	if *fDAParamsFormat == jsonFormat {
+		data, err := json.MarshalIndent(status, "", "    ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal dictionary attack parameters: %v", err)
+		}
+
+		fmt.Printf("%s\n", data)
+
+		return nil
+	}
+
+	const fw = 22
+
+	fmt.Printf("%-*s: %s\n", fw, "In lockout", yesNoString(status.InLockout))
+	fmt.Printf("%-*s: %d\n", fw, "Auth failures", status.LockoutCounter)
+	fmt.Printf("%-*s: %d\n", fw, "Max tries", status.MaxTries)
+	fmt.Printf("%-*s: %d seconds\n", fw, "Recovery time", status.RecoveryTime)
+	fmt.Printf("%-*s: %d seconds\n", fw, "Lockout recovery", status.LockoutRecovery)
+
+	return nil
+}
@@ -2,14 +2,22 @@ package main
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/google/go-tpm/tpm2"
 	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
 )
 
 // evictObject evicts an object from persistent storage.
-func evictObject() error {
-	err := ensureAllPassed(fEvictSet, handleFlagName)
+func evictObject() (err error) {
+	err = ensureAllPassed(fEvictSet, handleFlagName)
+	if err != nil {
+		return err
+	}
+
+	ownerAuth, err := newEntityAuth(*fEvictOwnerPassword, *fEvictPolicy)
 	if err != nil {
 		return err
 	}
@@ -22,10 +30,30 @@ func evictObject() error {
 
 	handle := tpmutil.Handle(fEvictHandle)
 
-	err = tpm2.EvictControl(t, *fEvictOwnerPassword, tpm2.HandleOwner, handle, handle)
+	authz, err := ownerAuth.authorize(t, pgtpm.TPM2_CC_EvictControl)
 	if err != nil {
+		return fmt.Errorf("failed to authorize owner: %v", err)
+	}
+	defer closeAuthorization(t, authz, &err)
+
+	if err := evictControl(t, authz, handle, handle); err != nil {
 		return fmt.Errorf("failed to evict object: %v", err)
 	}
 
 	return nil
 }
+
+// evictControl runs TPM2_EvictControl with owner authorization, either
+// making a transient object persistent at the specified handle, or evicting
+// a persistent object if object and persistent are the same.
+func evictControl(rw io.ReadWriter, ownerAuth authorization, object, persistent tpmutil.Handle) error {
+	params, err := tpmutil.Pack(persistent)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = runAuthCommand(rw, pgtpm.TPM2_CC_EvictControl,
+		[]tpmutil.Handle{tpm2.HandleOwner, object}, []authorization{ownerAuth}, 0, params)
+
+	return err
+}
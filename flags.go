@@ -17,16 +17,29 @@ type command struct {
 	flagSet   *flag.FlagSet
 	cmdFunc   func() error
 	usageFunc func()
+
+	// sessions indicates that the command supports the global -session
+	// option.
+	sessions bool
 }
 
 // handleFlag implments flag.Value and contains a TPM handle.
 type handleFlag pgtpm.Handle
 
+// handlesFlag implements flag.Value and contains a list of TPM handles, one
+// for each time the flag is passed.
+type handlesFlag []handleFlag
+
+// stringsFlag implements flag.Value and contains a list of strings, one for
+// each time the flag is passed.
+type stringsFlag []string
+
 // Global constants.
 const (
 	appName                = "tpmtool"
 	defaultTPMDeviceGlobal = "/dev/tpmrm0"
 	defaultTPMEnv          = "TPMTOOL_DEFAULT_TPM"
+	defaultSaltKey         = 0x81000001
 )
 
 // Global variables
@@ -34,49 +47,171 @@ var (
 	defaultTPMDevice = defaultTPMDeviceGlobal
 )
 
+// Output format constants.
+const (
+	base64Format = "base64"
+	derFormat    = "der"
+	hexFormat    = "hex"
+	jsonFormat   = "json"
+	jwkFormat    = "jwk"
+	pemFormat    = "pem"
+	sshFormat    = "ssh"
+	textFormat   = "text"
+	tpmtFormat   = "tpmt"
+	tssFormat    = "tss"
+	yamlFormat   = "yaml"
+)
+
+// Session mode constants.
+const (
+	hmacSessionMode   = "hmac"
+	saltedSessionMode = "salted"
+)
+
 // Command name constants.
 const (
-	activateCommand      = "activate"
-	capsCommand          = "caps"
-	createCommand        = "create"
-	createPrimaryCommand = "createprimary"
-	evictCommand         = "evict"
-	flushCommand         = "flush"
-	helpCommand          = "help"
-	makeCredCommand      = "makecred"
-	nvReadCommand        = "nvread"
-	readPublicCommand    = "readpublic"
+	activateCommand            = "activate"
+	capsCommand                = "caps"
+	changeAuthCommand          = "changeauth"
+	clearCommand               = "clear"
+	clearControlCommand        = "clearcontrol"
+	clockRateAdjustCommand     = "clockrateadjust"
+	contextLoadCommand         = "contextload"
+	contextSaveCommand         = "contextsave"
+	createCommand              = "create"
+	createPrimaryCommand       = "createprimary"
+	daLockResetCommand         = "dalockreset"
+	daParamsCommand            = "daparams"
+	evictCommand               = "evict"
+	flushCommand               = "flush"
+	genCSRCommand              = "gencsr"
+	getCommandAuditCommand     = "getcommandauditdigest"
+	getSessionAuditCommand     = "getsessionauditdigest"
+	getTestStatusCommand       = "getteststatus"
+	getTimeCommand             = "gettime"
+	helpCommand                = "help"
+	hierarchyControlCommand    = "hierarchycontrol"
+	incrementalSelfTestCommand = "incrementalselftest"
+	infoCommand                = "info"
+	makeCredCommand            = "makecred"
+	nvReadCommand              = "nvread"
+	policyCommand              = "policy"
+	readClockCommand           = "readclock"
+	readPublicCommand          = "readpublic"
+	selfSignCommand            = "selfsign"
+	selfTestCommand            = "selftest"
+	setClockCommand            = "setclock"
+	setCommandAuditCommand     = "setcommandcodeauditstatus"
+	signCommand                = "sign"
+	sshAgentCommand            = "ssh-agent"
+	templatesCommand           = "templates"
+	testParmsCommand           = "testparms"
+	tlsProxyCommand            = "tlsproxy"
+	unsealCommand              = "unseal"
+)
+
+// Policy subcommand name constants.
+const (
+	policyComputeCommand = "compute"
+	policySignCommand    = "sign"
+	policyTrialCommand   = "trial"
+)
+
+// Templates subcommand name constants.
+const (
+	templatesGenCommand    = "gen"
+	templatesListCommand   = "list"
+	templatesSchemaCommand = "schema"
+	templatesShowCommand   = "show"
 )
 
 // Flag name constants.
 const (
-	algsFlagName              = "algorithms"
-	allFlagName               = "all"
-	credInFlagName            = "credin"
-	credOutFlagName           = "credout"
-	endorsementFlagName       = "endorsement"
-	handleFlagName            = "handle"
-	handlesFlagName           = "handles"
-	helpFlagName              = "help"
-	inFlagName                = "in"
-	outFlagName               = "out"
-	ownerFlagName             = "owner"
-	ownerPasswordFlagName     = "ownerpass"
-	parentFlagName            = "parent"
-	parentPasswordFlagName    = "parentpass"
-	passwordFlagName          = "pass"
-	persistentFlagName        = "persistent"
-	platformFlagName          = "platform"
-	privOutFlagName           = "privout"
-	protectorFlagName         = "protector"
-	protectorPasswordFlagName = "protectorpass"
-	publicAreaFlagName        = "publicarea"
-	pubOutFlagName            = "pubout"
-	secretInFlagName          = "secretin"
-	secretOutFlagName         = "secretout"
-	templateFlagName          = "template"
-	textFlagName              = "text"
-	tpmFlagName               = "tpm"
+	adjustFlagName              = "adjust"
+	algFlagName                 = "alg"
+	algsFlagName                = "algorithms"
+	allFlagName                 = "all"
+	attrsFlagName               = "attrs"
+	auditFlagName               = "audit"
+	auditCommandsFlagName       = "auditcommands"
+	authPoliciesFlagName        = "authpolicies"
+	caFlagName                  = "ca"
+	caCertFlagName              = "cacert"
+	certFlagName                = "cert"
+	clearFlagName               = "clear"
+	commandsFlagName            = "commands"
+	compareFlagName             = "compare"
+	contextFlagName             = "context"
+	contextOutFlagName          = "contextout"
+	credInFlagName              = "credin"
+	credOutFlagName             = "credout"
+	curvesFlagName              = "curves"
+	dataFlagName                = "data"
+	daysFlagName                = "days"
+	detailsFlagName             = "details"
+	disableFlagName             = "disable"
+	enableFlagName              = "enable"
+	endorsementFlagName         = "endorsement"
+	endorsementPasswordFlagName = "endorsementpass"
+	flushFlagName               = "flush"
+	forceFlagName               = "force"
+	formatFlagName              = "format"
+	fullFlagName                = "full"
+	handleFlagName              = "handle"
+	handlesFlagName             = "handles"
+	hashFlagName                = "hash"
+	helpFlagName                = "help"
+	inFlagName                  = "in"
+	keyFlagName                 = "key"
+	keyFileFlagName             = "keyfile"
+	keyOutFlagName              = "keyout"
+	listenFlagName              = "listen"
+	lockoutFlagName             = "lockout"
+	lockoutRecoveryFlagName     = "lockoutrecovery"
+	logFlagName                 = "log"
+	maxTriesFlagName            = "maxtries"
+	nameAlgFlagName             = "namealg"
+	newPasswordFlagName         = "newpass"
+	nonceFlagName               = "nonce"
+	outFlagName                 = "out"
+	ownerFlagName               = "owner"
+	ownerPasswordFlagName       = "ownerpass"
+	parentFlagName              = "parent"
+	parentPasswordFlagName      = "parentpass"
+	pcrPropertiesFlagName       = "pcrproperties"
+	pcrsFlagName                = "pcrs"
+	passwordFlagName            = "pass"
+	persistentFlagName          = "persistent"
+	platformFlagName            = "platform"
+	platformNVFlagName          = "platformnv"
+	policyFlagName              = "policy"
+	policyRefFlagName           = "policyref"
+	ppCommandsFlagName          = "ppcommands"
+	privOutFlagName             = "privout"
+	propertiesFlagName          = "properties"
+	protectorFlagName           = "protector"
+	protectorPasswordFlagName   = "protectorpass"
+	protectorPolicyFlagName     = "protectorpolicy"
+	pssFlagName                 = "pss"
+	publicAreaFlagName          = "publicarea"
+	pubFormatFlagName           = "pubformat"
+	pubOutFlagName              = "pubout"
+	recoveryTimeFlagName        = "recoverytime"
+	saltKeyFlagName             = "saltkey"
+	sanFlagName                 = "san"
+	secretInFlagName            = "secretin"
+	secretOutFlagName           = "secretout"
+	serverNameFlagName          = "servername"
+	sessionFlagName             = "session"
+	setFlagName                 = "set"
+	sigOutFlagName              = "sigout"
+	socketFlagName              = "socket"
+	subjectFlagName             = "subject"
+	templateFlagName            = "template"
+	textFlagName                = "text"
+	timeFlagName                = "time"
+	tpmFlagName                 = "tpm"
+	upstreamFlagName            = "upstream"
 )
 
 // commands are the application commands.
@@ -90,6 +225,7 @@ var commands = []command{
 		flagSet:   fActivateSet,
 		cmdFunc:   activateCred,
 		usageFunc: usageActivate,
+		sessions:  true,
 	},
 	{
 		name:      capsCommand,
@@ -97,23 +233,80 @@ var commands = []command{
 		cmdFunc:   outputCaps,
 		usageFunc: usageCaps,
 	},
+	{
+		name:      changeAuthCommand,
+		flagSet:   fChangeAuthSet,
+		cmdFunc:   changeAuth,
+		usageFunc: usageChangeAuth,
+		sessions:  true,
+	},
+	{
+		name:      clearCommand,
+		flagSet:   fClearSet,
+		cmdFunc:   clearTPM,
+		usageFunc: usageClear,
+		sessions:  true,
+	},
+	{
+		name:      clearControlCommand,
+		flagSet:   fClearControlSet,
+		cmdFunc:   clearControl,
+		usageFunc: usageClearControl,
+		sessions:  true,
+	},
+	{
+		name:      clockRateAdjustCommand,
+		flagSet:   fClockRateAdjustSet,
+		cmdFunc:   clockRateAdjust,
+		usageFunc: usageClockRateAdjust,
+		sessions:  true,
+	},
+	{
+		name:      contextLoadCommand,
+		flagSet:   fContextLoadSet,
+		cmdFunc:   contextLoad,
+		usageFunc: usageContextLoad,
+	},
+	{
+		name:      contextSaveCommand,
+		flagSet:   fContextSaveSet,
+		cmdFunc:   contextSave,
+		usageFunc: usageContextSave,
+	},
 	{
 		name:      createCommand,
 		flagSet:   fCreateSet,
 		cmdFunc:   createObject,
 		usageFunc: usageCreate,
+		sessions:  true,
 	},
 	{
 		name:      createPrimaryCommand,
 		flagSet:   fCreatePrimarySet,
 		cmdFunc:   createPrimary,
 		usageFunc: usageCreatePrimary,
+		sessions:  true,
+	},
+	{
+		name:      daLockResetCommand,
+		flagSet:   fDALockResetSet,
+		cmdFunc:   daLockReset,
+		usageFunc: usageDALockReset,
+		sessions:  true,
+	},
+	{
+		name:      daParamsCommand,
+		flagSet:   fDAParamsSet,
+		cmdFunc:   daParams,
+		usageFunc: usageDAParams,
+		sessions:  true,
 	},
 	{
 		name:      evictCommand,
 		flagSet:   fEvictSet,
 		cmdFunc:   evictObject,
 		usageFunc: usageEvict,
+		sessions:  true,
 	},
 	{
 		name:      flushCommand,
@@ -121,6 +314,58 @@ var commands = []command{
 		cmdFunc:   flushContext,
 		usageFunc: usageFlush,
 	},
+	{
+		name:      genCSRCommand,
+		flagSet:   fGenCSRSet,
+		cmdFunc:   genCSR,
+		usageFunc: usageGenCSR,
+	},
+	{
+		name:      getCommandAuditCommand,
+		flagSet:   fGetCommandAuditSet,
+		cmdFunc:   getCommandAuditDigest,
+		usageFunc: usageGetCommandAudit,
+		sessions:  true,
+	},
+	{
+		name:      getSessionAuditCommand,
+		flagSet:   fGetSessionAuditSet,
+		cmdFunc:   getSessionAuditDigest,
+		usageFunc: usageGetSessionAudit,
+		sessions:  true,
+	},
+	{
+		name:      getTestStatusCommand,
+		flagSet:   fGetTestStatusSet,
+		cmdFunc:   getTestStatus,
+		usageFunc: usageGetTestStatus,
+	},
+	{
+		name:      getTimeCommand,
+		flagSet:   fGetTimeSet,
+		cmdFunc:   getTime,
+		usageFunc: usageGetTime,
+		sessions:  true,
+	},
+	{
+		name:      hierarchyControlCommand,
+		flagSet:   fHierarchyControlSet,
+		cmdFunc:   hierarchyControl,
+		usageFunc: usageHierarchyControl,
+		sessions:  true,
+	},
+	{
+		name:      incrementalSelfTestCommand,
+		flagSet:   fIncrementalSelfTestSet,
+		cmdFunc:   incrementalSelfTest,
+		usageFunc: usageIncrementalSelfTest,
+	},
+	{
+		name:      infoCommand,
+		flagSet:   fInfoSet,
+		cmdFunc:   outputInfo,
+		usageFunc: usageInfo,
+	},
 	{
 		name:      makeCredCommand,
 		flagSet:   fMakeCredSet,
@@ -132,6 +377,18 @@ var commands = []command{
 		flagSet:   fNVReadSet,
 		cmdFunc:   nvRead,
 		usageFunc: usageNVRead,
+		sessions:  true,
+	},
+	{
+		name:      policyCommand,
+		cmdFunc:   policyCmd,
+		usageFunc: usagePolicy,
+	},
+	{
+		name:      readClockCommand,
+		flagSet:   fReadClockSet,
+		cmdFunc:   readClock,
+		usageFunc: usageReadClock,
 	},
 	{
 		name:      readPublicCommand,
@@ -139,16 +396,90 @@ var commands = []command{
 		cmdFunc:   readPublic,
 		usageFunc: usageReadPublic,
 	},
+	{
+		name:      selfSignCommand,
+		flagSet:   fSelfSignSet,
+		cmdFunc:   selfSign,
+		usageFunc: usageSelfSign,
+	},
+	{
+		name:      selfTestCommand,
+		flagSet:   fSelfTestSet,
+		cmdFunc:   selfTest,
+		usageFunc: usageSelfTest,
+	},
+	{
+		name:      setClockCommand,
+		flagSet:   fSetClockSet,
+		cmdFunc:   setClock,
+		usageFunc: usageSetClock,
+		sessions:  true,
+	},
+	{
+		name:      setCommandAuditCommand,
+		flagSet:   fSetCommandAuditSet,
+		cmdFunc:   setCommandAuditStatus,
+		usageFunc: usageSetCommandAudit,
+		sessions:  true,
+	},
+	{
+		name:      signCommand,
+		flagSet:   fSignSet,
+		cmdFunc:   signData,
+		usageFunc: usageSign,
+		sessions:  true,
+	},
+	{
+		name:      sshAgentCommand,
+		flagSet:   fSSHAgentSet,
+		cmdFunc:   sshAgent,
+		usageFunc: usageSSHAgent,
+	},
+	{
+		name:      templatesCommand,
+		cmdFunc:   templatesCmd,
+		usageFunc: usageTemplates,
+	},
+	{
+		name:      testParmsCommand,
+		flagSet:   fTestParmsSet,
+		cmdFunc:   testParms,
+		usageFunc: usageTestParms,
+	},
+	{
+		name:      tlsProxyCommand,
+		flagSet:   fTLSProxySet,
+		cmdFunc:   tlsProxy,
+		usageFunc: usageTLSProxy,
+	},
+	{
+		name:      unsealCommand,
+		flagSet:   fUnsealSet,
+		cmdFunc:   unseal,
+		usageFunc: usageUnseal,
+		sessions:  true,
+	},
 }
 
+// Global flag set.
+var (
+	fGlobalSet     = flag.NewFlagSet(appName, flag.ExitOnError)
+	fGlobalAudit   = fGlobalSet.String(auditFlagName, "", "")
+	fGlobalSaltKey = handleFlag(defaultSaltKey)
+	fGlobalSession = fGlobalSet.String(sessionFlagName, "", "")
+)
+
 // activate command flag set.
 var (
 	fActivateSet               = flag.NewFlagSet(activateCommand, flag.ExitOnError)
+	fActivateContext           = fActivateSet.String(contextFlagName, "", "")
 	fActivateCredIn            = fActivateSet.String(credInFlagName, "", "")
 	fActivateHandle            handleFlag
 	fActivatePassword          = fActivateSet.String(passwordFlagName, "", "")
+	fActivatePolicy            = fActivateSet.String(policyFlagName, "", "")
 	fActivateProtector         handleFlag
 	fActivateProtectorPassword = fActivateSet.String(protectorPasswordFlagName, "", "")
+	fActivateProtectorPolicy   = fActivateSet.String(protectorPolicyFlagName, "", "")
 	fActivateHelp              = fActivateSet.Bool(helpFlagName, false, "")
 	fActivateSecretIn          = fActivateSet.String(secretInFlagName, "", "")
 	fActivateTPM               = fActivateSet.String(tpmFlagName, "", "")
@@ -156,19 +487,103 @@ var (
 
 // caps command flag set.
 var (
-	fCapsSet     = flag.NewFlagSet(capsCommand, flag.ExitOnError)
-	fCapsAlgs    = fCapsSet.Bool(algsFlagName, false, "")
-	fCapsAll     = fCapsSet.Bool(allFlagName, false, "")
-	fCapsHandles = fCapsSet.Bool(handlesFlagName, false, "")
-	fCapsHelp    = fCapsSet.Bool(helpFlagName, false, "")
-	fCapsTPM     = fCapsSet.String(tpmFlagName, "", "")
+	fCapsSet           = flag.NewFlagSet(capsCommand, flag.ExitOnError)
+	fCapsAlgs          = fCapsSet.Bool(algsFlagName, false, "")
+	fCapsAll           = fCapsSet.Bool(allFlagName, false, "")
+	fCapsAuditCommands = fCapsSet.Bool(auditCommandsFlagName, false, "")
+	fCapsAuthPolicies  = fCapsSet.Bool(authPoliciesFlagName, false, "")
+	fCapsCommands      = fCapsSet.Bool(commandsFlagName, false, "")
+	fCapsCurves        = fCapsSet.Bool(curvesFlagName, false, "")
+	fCapsDetails       = fCapsSet.Bool(detailsFlagName, false, "")
+	fCapsFormat        = fCapsSet.String(formatFlagName, textFormat, "")
+	fCapsHandles       = fCapsSet.Bool(handlesFlagName, false, "")
+	fCapsHelp          = fCapsSet.Bool(helpFlagName, false, "")
+	fCapsPCRProperties = fCapsSet.Bool(pcrPropertiesFlagName, false, "")
+	fCapsPCRs          = fCapsSet.Bool(pcrsFlagName, false, "")
+	fCapsPPCommands    = fCapsSet.Bool(ppCommandsFlagName, false, "")
+	fCapsProperties    = fCapsSet.Bool(propertiesFlagName, false, "")
+	fCapsTPM           = fCapsSet.String(tpmFlagName, "", "")
+)
+
+// changeauth command flag set.
+var (
+	fChangeAuthSet         = flag.NewFlagSet(changeAuthCommand, flag.ExitOnError)
+	fChangeAuthContext     = fChangeAuthSet.String(contextFlagName, "", "")
+	fChangeAuthEndorsement = fChangeAuthSet.Bool(endorsementFlagName, false, "")
+	fChangeAuthHandle      handleFlag
+	fChangeAuthHelp        = fChangeAuthSet.Bool(helpFlagName, false, "")
+	fChangeAuthLockout     = fChangeAuthSet.Bool(lockoutFlagName, false, "")
+	fChangeAuthNewPassword = fChangeAuthSet.String(newPasswordFlagName, "", "")
+	fChangeAuthOwner       = fChangeAuthSet.Bool(ownerFlagName, false, "")
+	fChangeAuthParent      handleFlag
+	fChangeAuthPassword    = fChangeAuthSet.String(passwordFlagName, "", "")
+	fChangeAuthPlatform    = fChangeAuthSet.Bool(platformFlagName, false, "")
+	fChangeAuthPolicy      = fChangeAuthSet.String(policyFlagName, "", "")
+	fChangeAuthPrivateOut  = fChangeAuthSet.String(privOutFlagName, "", "")
+	fChangeAuthTPM         = fChangeAuthSet.String(tpmFlagName, "", "")
+)
+
+// clear command flag set.
+var (
+	fClearSet      = flag.NewFlagSet(clearCommand, flag.ExitOnError)
+	fClearForce    = fClearSet.Bool(forceFlagName, false, "")
+	fClearHelp     = fClearSet.Bool(helpFlagName, false, "")
+	fClearPassword = fClearSet.String(passwordFlagName, "", "")
+	fClearPlatform = fClearSet.Bool(platformFlagName, false, "")
+	fClearPolicy   = fClearSet.String(policyFlagName, "", "")
+	fClearTPM      = fClearSet.String(tpmFlagName, "", "")
+)
+
+// clearcontrol command flag set.
+var (
+	fClearControlSet      = flag.NewFlagSet(clearControlCommand, flag.ExitOnError)
+	fClearControlDisable  = fClearControlSet.Bool(disableFlagName, false, "")
+	fClearControlEnable   = fClearControlSet.Bool(enableFlagName, false, "")
+	fClearControlForce    = fClearControlSet.Bool(forceFlagName, false, "")
+	fClearControlHelp     = fClearControlSet.Bool(helpFlagName, false, "")
+	fClearControlPassword = fClearControlSet.String(passwordFlagName, "", "")
+	fClearControlPlatform = fClearControlSet.Bool(platformFlagName, false, "")
+	fClearControlPolicy   = fClearControlSet.String(policyFlagName, "", "")
+	fClearControlTPM      = fClearControlSet.String(tpmFlagName, "", "")
+)
+
+// clockrateadjust command flag set.
+var (
+	fClockRateAdjustSet           = flag.NewFlagSet(clockRateAdjustCommand, flag.ExitOnError)
+	fClockRateAdjustAdjust        = fClockRateAdjustSet.String(adjustFlagName, "", "")
+	fClockRateAdjustHelp          = fClockRateAdjustSet.Bool(helpFlagName, false, "")
+	fClockRateAdjustOwnerPassword = fClockRateAdjustSet.String(ownerPasswordFlagName, "", "")
+	fClockRateAdjustPolicy        = fClockRateAdjustSet.String(policyFlagName, "", "")
+	fClockRateAdjustTPM           = fClockRateAdjustSet.String(tpmFlagName, "", "")
+)
+
+// contextload command flag set.
+var (
+	fContextLoadSet  = flag.NewFlagSet(contextLoadCommand, flag.ExitOnError)
+	fContextLoadHelp = fContextLoadSet.Bool(helpFlagName, false, "")
+	fContextLoadIn   = fContextLoadSet.String(inFlagName, "", "")
+	fContextLoadTPM  = fContextLoadSet.String(tpmFlagName, "", "")
+)
+
+// contextsave command flag set.
+var (
+	fContextSaveSet    = flag.NewFlagSet(contextSaveCommand, flag.ExitOnError)
+	fContextSaveFlush  = fContextSaveSet.Bool(flushFlagName, false, "")
+	fContextSaveHandle handleFlag
+	fContextSaveHelp   = fContextSaveSet.Bool(helpFlagName, false, "")
+	fContextSaveOut    = fContextSaveSet.String(outFlagName, "", "")
+	fContextSaveTPM    = fContextSaveSet.String(tpmFlagName, "", "")
 )
 
 // createprimary command flag set.
 var (
 	fCreatePrimarySet           = flag.NewFlagSet(createPrimaryCommand, flag.ExitOnError)
+	fCreatePrimaryAlg           = fCreatePrimarySet.String(algFlagName, "", "")
+	fCreatePrimaryAttrs         = fCreatePrimarySet.String(attrsFlagName, "", "")
+	fCreatePrimaryContextOut    = fCreatePrimarySet.String(contextOutFlagName, "", "")
 	fCreatePrimaryEndorsement   = fCreatePrimarySet.Bool(endorsementFlagName, false, "")
 	fCreatePrimaryHelp          = fCreatePrimarySet.Bool(helpFlagName, false, "")
+	fCreatePrimaryNameAlg       = fCreatePrimarySet.String(nameAlgFlagName, "", "")
 	fCreatePrimaryOwnerPassword = fCreatePrimarySet.String(ownerPasswordFlagName, "", "")
 	fCreatePrimaryPassword      = fCreatePrimarySet.String(passwordFlagName, "", "")
 	fCreatePrimaryPersistent    handleFlag
@@ -180,7 +595,12 @@ var (
 // create command flag set.
 var (
 	fCreateSet            = flag.NewFlagSet(createCommand, flag.ExitOnError)
+	fCreateAlg            = fCreateSet.String(algFlagName, "", "")
+	fCreateAttrs          = fCreateSet.String(attrsFlagName, "", "")
+	fCreateContextOut     = fCreateSet.String(contextOutFlagName, "", "")
+	fCreateData           = fCreateSet.String(dataFlagName, "", "")
 	fCreateHelp           = fCreateSet.Bool(helpFlagName, false, "")
+	fCreateNameAlg        = fCreateSet.String(nameAlgFlagName, "", "")
 	fCreateOwnerPassword  = fCreateSet.String(ownerPasswordFlagName, "", "")
 	fCreateParent         handleFlag
 	fCreateParentPassword = fCreateSet.String(parentPasswordFlagName, "", "")
@@ -192,26 +612,151 @@ var (
 	fCreateTPM            = fCreateSet.String(tpmFlagName, "", "")
 )
 
+// dalockreset command flag set.
+var (
+	fDALockResetSet      = flag.NewFlagSet(daLockResetCommand, flag.ExitOnError)
+	fDALockResetHelp     = fDALockResetSet.Bool(helpFlagName, false, "")
+	fDALockResetPassword = fDALockResetSet.String(passwordFlagName, "", "")
+	fDALockResetPolicy   = fDALockResetSet.String(policyFlagName, "", "")
+	fDALockResetTPM      = fDALockResetSet.String(tpmFlagName, "", "")
+)
+
+// daparams command flag set.
+var (
+	fDAParamsSet             = flag.NewFlagSet(daParamsCommand, flag.ExitOnError)
+	fDAParamsFormat          = fDAParamsSet.String(formatFlagName, textFormat, "")
+	fDAParamsHelp            = fDAParamsSet.Bool(helpFlagName, false, "")
+	fDAParamsLockoutRecovery = fDAParamsSet.Uint(lockoutRecoveryFlagName, 0, "")
+	fDAParamsMaxTries        = fDAParamsSet.Uint(maxTriesFlagName, 0, "")
+	fDAParamsPassword        = fDAParamsSet.String(passwordFlagName, "", "")
+	fDAParamsPolicy          = fDAParamsSet.String(policyFlagName, "", "")
+	fDAParamsRecoveryTime    = fDAParamsSet.Uint(recoveryTimeFlagName, 0, "")
+	fDAParamsTPM             = fDAParamsSet.String(tpmFlagName, "", "")
+)
+
 // evict command flag set.
 var (
 	fEvictSet           = flag.NewFlagSet(evictCommand, flag.ExitOnError)
 	fEvictHandle        handleFlag
 	fEvictHelp          = fEvictSet.Bool(helpFlagName, false, "")
 	fEvictOwnerPassword = fEvictSet.String(ownerPasswordFlagName, "", "")
+	fEvictPolicy        = fEvictSet.String(policyFlagName, "", "")
 	fEvictTPM           = fEvictSet.String(tpmFlagName, "", "")
 )
 
 // flush command flag set.
 var (
-	fFlushSet    = flag.NewFlagSet(flushCommand, flag.ExitOnError)
-	fFlushHandle handleFlag
-	fFlushHelp   = fFlushSet.Bool(helpFlagName, false, "")
-	fFlushTPM    = fFlushSet.String(tpmFlagName, "", "")
+	fFlushSet     = flag.NewFlagSet(flushCommand, flag.ExitOnError)
+	fFlushContext = fFlushSet.String(contextFlagName, "", "")
+	fFlushHandle  handleFlag
+	fFlushHelp    = fFlushSet.Bool(helpFlagName, false, "")
+	fFlushTPM     = fFlushSet.String(tpmFlagName, "", "")
+)
+
+// gencsr command flag set.
+var (
+	fGenCSRSet      = flag.NewFlagSet(genCSRCommand, flag.ExitOnError)
+	fGenCSRContext  = fGenCSRSet.String(contextFlagName, "", "")
+	fGenCSRHandle   handleFlag
+	fGenCSRHash     = fGenCSRSet.String(hashFlagName, "", "")
+	fGenCSRHelp     = fGenCSRSet.Bool(helpFlagName, false, "")
+	fGenCSROut      = fGenCSRSet.String(outFlagName, "", "")
+	fGenCSRPassword = fGenCSRSet.String(passwordFlagName, "", "")
+	fGenCSRPSS      = fGenCSRSet.Bool(pssFlagName, false, "")
+	fGenCSRSANs     stringsFlag
+	fGenCSRSubject  = fGenCSRSet.String(subjectFlagName, "", "")
+	fGenCSRTPM      = fGenCSRSet.String(tpmFlagName, "", "")
+)
+
+// getcommandauditdigest command flag set.
+var (
+	fGetCommandAuditSet                 = flag.NewFlagSet(getCommandAuditCommand, flag.ExitOnError)
+	fGetCommandAuditContext             = fGetCommandAuditSet.String(contextFlagName, "", "")
+	fGetCommandAuditEndorsementPassword = fGetCommandAuditSet.String(endorsementPasswordFlagName, "", "")
+	fGetCommandAuditHandle              handleFlag
+	fGetCommandAuditHelp                = fGetCommandAuditSet.Bool(helpFlagName, false, "")
+	fGetCommandAuditLog                 = fGetCommandAuditSet.String(logFlagName, "", "")
+	fGetCommandAuditNonce               = fGetCommandAuditSet.String(nonceFlagName, "", "")
+	fGetCommandAuditOut                 = fGetCommandAuditSet.String(outFlagName, "", "")
+	fGetCommandAuditPassword            = fGetCommandAuditSet.String(passwordFlagName, "", "")
+	fGetCommandAuditPolicy              = fGetCommandAuditSet.String(policyFlagName, "", "")
+	fGetCommandAuditSigOut              = fGetCommandAuditSet.String(sigOutFlagName, "", "")
+	fGetCommandAuditTPM                 = fGetCommandAuditSet.String(tpmFlagName, "", "")
+)
+
+// getsessionauditdigest command flag set.
+var (
+	fGetSessionAuditSet                 = flag.NewFlagSet(getSessionAuditCommand, flag.ExitOnError)
+	fGetSessionAuditContext             = fGetSessionAuditSet.String(contextFlagName, "", "")
+	fGetSessionAuditEndorsementPassword = fGetSessionAuditSet.String(endorsementPasswordFlagName, "", "")
+	fGetSessionAuditHandle              handleFlag
+	fGetSessionAuditHelp                = fGetSessionAuditSet.Bool(helpFlagName, false, "")
+	fGetSessionAuditLog                 = fGetSessionAuditSet.String(logFlagName, "", "")
+	fGetSessionAuditNonce               = fGetSessionAuditSet.String(nonceFlagName, "", "")
+	fGetSessionAuditOut                 = fGetSessionAuditSet.String(outFlagName, "", "")
+	fGetSessionAuditPassword            = fGetSessionAuditSet.String(passwordFlagName, "", "")
+	fGetSessionAuditPolicy              = fGetSessionAuditSet.String(policyFlagName, "", "")
+	fGetSessionAuditSigOut              = fGetSessionAuditSet.String(sigOutFlagName, "", "")
+	fGetSessionAuditTPM                 = fGetSessionAuditSet.String(tpmFlagName, "", "")
+)
+
+// getteststatus command flag set.
+var (
+	fGetTestStatusSet    = flag.NewFlagSet(getTestStatusCommand, flag.ExitOnError)
+	fGetTestStatusFormat = fGetTestStatusSet.String(formatFlagName, textFormat, "")
+	fGetTestStatusHelp   = fGetTestStatusSet.Bool(helpFlagName, false, "")
+	fGetTestStatusTPM    = fGetTestStatusSet.String(tpmFlagName, "", "")
+)
+
+// gettime command flag set.
+var (
+	fGetTimeSet                 = flag.NewFlagSet(getTimeCommand, flag.ExitOnError)
+	fGetTimeContext             = fGetTimeSet.String(contextFlagName, "", "")
+	fGetTimeEndorsementPassword = fGetTimeSet.String(endorsementPasswordFlagName, "", "")
+	fGetTimeHandle              handleFlag
+	fGetTimeHelp                = fGetTimeSet.Bool(helpFlagName, false, "")
+	fGetTimeNonce               = fGetTimeSet.String(nonceFlagName, "", "")
+	fGetTimeOut                 = fGetTimeSet.String(outFlagName, "", "")
+	fGetTimePassword            = fGetTimeSet.String(passwordFlagName, "", "")
+	fGetTimePolicy              = fGetTimeSet.String(policyFlagName, "", "")
+	fGetTimeSigOut              = fGetTimeSet.String(sigOutFlagName, "", "")
+	fGetTimeTPM                 = fGetTimeSet.String(tpmFlagName, "", "")
+)
+
+// hierarchycontrol command flag set.
+var (
+	fHierarchyControlSet         = flag.NewFlagSet(hierarchyControlCommand, flag.ExitOnError)
+	fHierarchyControlDisable     = fHierarchyControlSet.Bool(disableFlagName, false, "")
+	fHierarchyControlEnable      = fHierarchyControlSet.Bool(enableFlagName, false, "")
+	fHierarchyControlEndorsement = fHierarchyControlSet.Bool(endorsementFlagName, false, "")
+	fHierarchyControlHelp        = fHierarchyControlSet.Bool(helpFlagName, false, "")
+	fHierarchyControlOwner       = fHierarchyControlSet.Bool(ownerFlagName, false, "")
+	fHierarchyControlPassword    = fHierarchyControlSet.String(passwordFlagName, "", "")
+	fHierarchyControlPlatform    = fHierarchyControlSet.Bool(platformFlagName, false, "")
+	fHierarchyControlPlatformNV  = fHierarchyControlSet.Bool(platformNVFlagName, false, "")
+	fHierarchyControlPolicy      = fHierarchyControlSet.String(policyFlagName, "", "")
+	fHierarchyControlTPM         = fHierarchyControlSet.String(tpmFlagName, "", "")
+)
+
+// incrementalselftest command flag set.
+var (
+	fIncrementalSelfTestSet  = flag.NewFlagSet(incrementalSelfTestCommand, flag.ExitOnError)
+	fIncrementalSelfTestAlgs stringsFlag
+	fIncrementalSelfTestHelp = fIncrementalSelfTestSet.Bool(helpFlagName, false, "")
+	fIncrementalSelfTestTPM  = fIncrementalSelfTestSet.String(tpmFlagName, "", "")
+)
+
+// info command flag set.
+var (
+	fInfoSet  = flag.NewFlagSet(infoCommand, flag.ExitOnError)
+	fInfoHelp = fInfoSet.Bool(helpFlagName, false, "")
+	fInfoTPM  = fInfoSet.String(tpmFlagName, "", "")
 )
 
 // makecred command flag set.
 var (
 	fMakeCredSet        = flag.NewFlagSet(makeCredCommand, flag.ExitOnError)
+	fMakeCredContext    = fMakeCredSet.String(contextFlagName, "", "")
 	fMakeCredHandle     handleFlag
 	fMakeCredHelp       = fMakeCredSet.Bool(helpFlagName, false, "")
 	fMakeCredIn         = fMakeCredSet.String(inFlagName, "", "")
@@ -228,32 +773,245 @@ var (
 	fNVReadHelp     = fNVReadSet.Bool(helpFlagName, false, "")
 	fNVReadOut      = fNVReadSet.String(outFlagName, "", "")
 	fNVReadPassword = fNVReadSet.String(passwordFlagName, "", "")
+	fNVReadPolicy   = fNVReadSet.String(policyFlagName, "", "")
 	fNVReadTPM      = fNVReadSet.String(tpmFlagName, "", "")
 )
 
+// policy compute command flag set.
+var (
+	fPolicyComputeSet    = flag.NewFlagSet(policyComputeCommand, flag.ExitOnError)
+	fPolicyComputeFormat = fPolicyComputeSet.String(formatFlagName, "", "")
+	fPolicyComputeHelp   = fPolicyComputeSet.Bool(helpFlagName, false, "")
+	fPolicyComputeIn     = fPolicyComputeSet.String(inFlagName, "", "")
+	fPolicyComputeOut    = fPolicyComputeSet.String(outFlagName, "", "")
+)
+
+// policy sign command flag set.
+var (
+	fPolicySignSet       = flag.NewFlagSet(policySignCommand, flag.ExitOnError)
+	fPolicySignHash      = fPolicySignSet.String(hashFlagName, "", "")
+	fPolicySignHelp      = fPolicySignSet.Bool(helpFlagName, false, "")
+	fPolicySignIn        = fPolicySignSet.String(inFlagName, "", "")
+	fPolicySignKey       = fPolicySignSet.String(keyFlagName, "", "")
+	fPolicySignOut       = fPolicySignSet.String(outFlagName, "", "")
+	fPolicySignPolicy    = fPolicySignSet.String(policyFlagName, "", "")
+	fPolicySignPolicyRef = fPolicySignSet.String(policyRefFlagName, "", "")
+)
+
+// policy trial command flag set.
+var (
+	fPolicyTrialSet     = flag.NewFlagSet(policyTrialCommand, flag.ExitOnError)
+	fPolicyTrialCompare = fPolicyTrialSet.Bool(compareFlagName, false, "")
+	fPolicyTrialFormat  = fPolicyTrialSet.String(formatFlagName, "", "")
+	fPolicyTrialHelp    = fPolicyTrialSet.Bool(helpFlagName, false, "")
+	fPolicyTrialIn      = fPolicyTrialSet.String(inFlagName, "", "")
+	fPolicyTrialOut     = fPolicyTrialSet.String(outFlagName, "", "")
+	fPolicyTrialTPM     = fPolicyTrialSet.String(tpmFlagName, "", "")
+)
+
+// readclock command flag set.
+var (
+	fReadClockSet  = flag.NewFlagSet(readClockCommand, flag.ExitOnError)
+	fReadClockHelp = fReadClockSet.Bool(helpFlagName, false, "")
+	fReadClockTPM  = fReadClockSet.String(tpmFlagName, "", "")
+)
+
 // readpublic command flag set.
 var (
-	fReadPublicSet    = flag.NewFlagSet(readPublicCommand, flag.ExitOnError)
-	fReadPublicHandle handleFlag
-	fReadPublicHelp   = fReadPublicSet.Bool(helpFlagName, false, "")
-	fReadPublicIn     = fReadPublicSet.String(inFlagName, "", "")
-	fReadPublicOut    = fReadPublicSet.String(outFlagName, "", "")
-	fReadPublicPubOut = fReadPublicSet.Bool(pubOutFlagName, false, "")
-	fReadPublicText   = fReadPublicSet.Bool(textFlagName, false, "")
-	fReadPublicTPM    = fReadPublicSet.String(tpmFlagName, "", "")
+	fReadPublicSet       = flag.NewFlagSet(readPublicCommand, flag.ExitOnError)
+	fReadPublicContext   = fReadPublicSet.String(contextFlagName, "", "")
+	fReadPublicFormat    = fReadPublicSet.String(formatFlagName, "", "")
+	fReadPublicHandle    handleFlag
+	fReadPublicHelp      = fReadPublicSet.Bool(helpFlagName, false, "")
+	fReadPublicIn        = fReadPublicSet.String(inFlagName, "", "")
+	fReadPublicKeyOut    = fReadPublicSet.String(keyOutFlagName, "", "")
+	fReadPublicOut       = fReadPublicSet.String(outFlagName, "", "")
+	fReadPublicPubFormat = fReadPublicSet.String(pubFormatFlagName, pemFormat, "")
+	fReadPublicPubOut    = fReadPublicSet.Bool(pubOutFlagName, false, "")
+	fReadPublicText      = fReadPublicSet.Bool(textFlagName, false, "")
+	fReadPublicTPM       = fReadPublicSet.String(tpmFlagName, "", "")
+)
+
+// selfsign command flag set.
+var (
+	fSelfSignSet      = flag.NewFlagSet(selfSignCommand, flag.ExitOnError)
+	fSelfSignCA       = fSelfSignSet.Bool(caFlagName, false, "")
+	fSelfSignContext  = fSelfSignSet.String(contextFlagName, "", "")
+	fSelfSignDays     = fSelfSignSet.Int(daysFlagName, 365, "")
+	fSelfSignHandle   handleFlag
+	fSelfSignHash     = fSelfSignSet.String(hashFlagName, "", "")
+	fSelfSignHelp     = fSelfSignSet.Bool(helpFlagName, false, "")
+	fSelfSignOut      = fSelfSignSet.String(outFlagName, "", "")
+	fSelfSignPassword = fSelfSignSet.String(passwordFlagName, "", "")
+	fSelfSignPSS      = fSelfSignSet.Bool(pssFlagName, false, "")
+	fSelfSignSANs     stringsFlag
+	fSelfSignSubject  = fSelfSignSet.String(subjectFlagName, "", "")
+	fSelfSignTPM      = fSelfSignSet.String(tpmFlagName, "", "")
+)
+
+// selftest command flag set.
+var (
+	fSelfTestSet  = flag.NewFlagSet(selfTestCommand, flag.ExitOnError)
+	fSelfTestFull = fSelfTestSet.Bool(fullFlagName, false, "")
+	fSelfTestHelp = fSelfTestSet.Bool(helpFlagName, false, "")
+	fSelfTestTPM  = fSelfTestSet.String(tpmFlagName, "", "")
+)
+
+// setclock command flag set.
+var (
+	fSetClockSet           = flag.NewFlagSet(setClockCommand, flag.ExitOnError)
+	fSetClockHelp          = fSetClockSet.Bool(helpFlagName, false, "")
+	fSetClockOwnerPassword = fSetClockSet.String(ownerPasswordFlagName, "", "")
+	fSetClockPolicy        = fSetClockSet.String(policyFlagName, "", "")
+	fSetClockTime          = fSetClockSet.Uint64(timeFlagName, 0, "")
+	fSetClockTPM           = fSetClockSet.String(tpmFlagName, "", "")
+)
+
+// setcommandcodeauditstatus command flag set.
+var (
+	fSetCommandAuditSet           = flag.NewFlagSet(setCommandAuditCommand, flag.ExitOnError)
+	fSetCommandAuditClearCCs      stringsFlag
+	fSetCommandAuditHash          = fSetCommandAuditSet.String(hashFlagName, "", "")
+	fSetCommandAuditHelp          = fSetCommandAuditSet.Bool(helpFlagName, false, "")
+	fSetCommandAuditOwnerPassword = fSetCommandAuditSet.String(ownerPasswordFlagName, "", "")
+	fSetCommandAuditPolicy        = fSetCommandAuditSet.String(policyFlagName, "", "")
+	fSetCommandAuditSetCCs        stringsFlag
+	fSetCommandAuditTPM           = fSetCommandAuditSet.String(tpmFlagName, "", "")
+)
+
+// sign command flag set.
+var (
+	fSignSet      = flag.NewFlagSet(signCommand, flag.ExitOnError)
+	fSignContext  = fSignSet.String(contextFlagName, "", "")
+	fSignHandle   handleFlag
+	fSignHash     = fSignSet.String(hashFlagName, "", "")
+	fSignHelp     = fSignSet.Bool(helpFlagName, false, "")
+	fSignIn       = fSignSet.String(inFlagName, "", "")
+	fSignOut      = fSignSet.String(outFlagName, "", "")
+	fSignPassword = fSignSet.String(passwordFlagName, "", "")
+	fSignPolicy   = fSignSet.String(policyFlagName, "", "")
+	fSignPSS      = fSignSet.Bool(pssFlagName, false, "")
+	fSignTPM      = fSignSet.String(tpmFlagName, "", "")
+)
+
+// ssh-agent command flag set.
+var (
+	fSSHAgentSet            = flag.NewFlagSet(sshAgentCommand, flag.ExitOnError)
+	fSSHAgentContexts       stringsFlag
+	fSSHAgentHandles        handlesFlag
+	fSSHAgentHelp           = fSSHAgentSet.Bool(helpFlagName, false, "")
+	fSSHAgentKeyFiles       stringsFlag
+	fSSHAgentParent         handleFlag
+	fSSHAgentParentPassword = fSSHAgentSet.String(parentPasswordFlagName, "", "")
+	fSSHAgentPassword       = fSSHAgentSet.String(passwordFlagName, "", "")
+	fSSHAgentPrivateOut     = fSSHAgentSet.String(privOutFlagName, "", "")
+	fSSHAgentPublicOut      = fSSHAgentSet.String(pubOutFlagName, "", "")
+	fSSHAgentSocket         = fSSHAgentSet.String(socketFlagName, "", "")
+	fSSHAgentTemplate       = fSSHAgentSet.String(templateFlagName, "", "")
+	fSSHAgentTPM            = fSSHAgentSet.String(tpmFlagName, "", "")
+)
+
+// templates gen command flag set.
+var (
+	fTemplatesGenSet     = flag.NewFlagSet(templatesGenCommand, flag.ExitOnError)
+	fTemplatesGenAlg     = fTemplatesGenSet.String(algFlagName, "", "")
+	fTemplatesGenAttrs   = fTemplatesGenSet.String(attrsFlagName, "", "")
+	fTemplatesGenHelp    = fTemplatesGenSet.Bool(helpFlagName, false, "")
+	fTemplatesGenNameAlg = fTemplatesGenSet.String(nameAlgFlagName, "", "")
+	fTemplatesGenOut     = fTemplatesGenSet.String(outFlagName, "", "")
+)
+
+// templates list command flag set.
+var (
+	fTemplatesListSet  = flag.NewFlagSet(templatesListCommand, flag.ExitOnError)
+	fTemplatesListHelp = fTemplatesListSet.Bool(helpFlagName, false, "")
+)
+
+// templates schema command flag set.
+var (
+	fTemplatesSchemaSet  = flag.NewFlagSet(templatesSchemaCommand, flag.ExitOnError)
+	fTemplatesSchemaHelp = fTemplatesSchemaSet.Bool(helpFlagName, false, "")
+	fTemplatesSchemaOut  = fTemplatesSchemaSet.String(outFlagName, "", "")
+)
+
+// templates show command flag set.
+var (
+	fTemplatesShowSet  = flag.NewFlagSet(templatesShowCommand, flag.ExitOnError)
+	fTemplatesShowHelp = fTemplatesShowSet.Bool(helpFlagName, false, "")
+)
+
+// testparms command flag set.
+var (
+	fTestParmsSet      = flag.NewFlagSet(testParmsCommand, flag.ExitOnError)
+	fTestParmsHelp     = fTestParmsSet.Bool(helpFlagName, false, "")
+	fTestParmsTemplate = fTestParmsSet.String(templateFlagName, "", "")
+	fTestParmsTPM      = fTestParmsSet.String(tpmFlagName, "", "")
+)
+
+// tlsproxy command flag set.
+var (
+	fTLSProxySet            = flag.NewFlagSet(tlsProxyCommand, flag.ExitOnError)
+	fTLSProxyCACert         = fTLSProxySet.String(caCertFlagName, "", "")
+	fTLSProxyCert           = fTLSProxySet.String(certFlagName, "", "")
+	fTLSProxyContext        = fTLSProxySet.String(contextFlagName, "", "")
+	fTLSProxyHandle         handleFlag
+	fTLSProxyHelp           = fTLSProxySet.Bool(helpFlagName, false, "")
+	fTLSProxyKeyFile        = fTLSProxySet.String(keyFileFlagName, "", "")
+	fTLSProxyListen         = fTLSProxySet.String(listenFlagName, "", "")
+	fTLSProxyParent         handleFlag
+	fTLSProxyParentPassword = fTLSProxySet.String(parentPasswordFlagName, "", "")
+	fTLSProxyPassword       = fTLSProxySet.String(passwordFlagName, "", "")
+	fTLSProxyServerName     = fTLSProxySet.String(serverNameFlagName, "", "")
+	fTLSProxyTPM            = fTLSProxySet.String(tpmFlagName, "", "")
+	fTLSProxyUpstream       = fTLSProxySet.String(upstreamFlagName, "", "")
+)
+
+// unseal command flag set.
+var (
+	fUnsealSet      = flag.NewFlagSet(unsealCommand, flag.ExitOnError)
+	fUnsealContext  = fUnsealSet.String(contextFlagName, "", "")
+	fUnsealHandle   handleFlag
+	fUnsealHelp     = fUnsealSet.Bool(helpFlagName, false, "")
+	fUnsealOut      = fUnsealSet.String(outFlagName, "", "")
+	fUnsealPassword = fUnsealSet.String(passwordFlagName, "", "")
+	fUnsealPolicy   = fUnsealSet.String(policyFlagName, "", "")
+	fUnsealTPM      = fUnsealSet.String(tpmFlagName, "", "")
 )
 
 func init() {
+	fGlobalSet.Var(&fGlobalSaltKey, saltKeyFlagName, "")
+	fGlobalSet.Usage = usageError
 	fActivateSet.Var(&fActivateHandle, handleFlagName, "")
 	fActivateSet.Var(&fActivateProtector, protectorFlagName, "")
+	fChangeAuthSet.Var(&fChangeAuthHandle, handleFlagName, "")
+	fChangeAuthSet.Var(&fChangeAuthParent, parentFlagName, "")
+	fContextSaveSet.Var(&fContextSaveHandle, handleFlagName, "")
 	fCreateSet.Var(&fCreateParent, parentFlagName, "")
 	fCreateSet.Var(&fCreatePersistent, persistentFlagName, "")
 	fCreatePrimarySet.Var(&fCreatePrimaryPersistent, persistentFlagName, "")
 	fEvictSet.Var(&fEvictHandle, handleFlagName, "")
 	fFlushSet.Var(&fFlushHandle, handleFlagName, "")
+	fGenCSRSet.Var(&fGenCSRHandle, handleFlagName, "")
+	fGenCSRSet.Var(&fGenCSRSANs, sanFlagName, "")
+	fGetCommandAuditSet.Var(&fGetCommandAuditHandle, handleFlagName, "")
+	fGetSessionAuditSet.Var(&fGetSessionAuditHandle, handleFlagName, "")
+	fGetTimeSet.Var(&fGetTimeHandle, handleFlagName, "")
+	fIncrementalSelfTestSet.Var(&fIncrementalSelfTestAlgs, algFlagName, "")
 	fMakeCredSet.Var(&fMakeCredHandle, handleFlagName, "")
 	fNVReadSet.Var(&fNVReadHandle, handleFlagName, "")
 	fReadPublicSet.Var(&fReadPublicHandle, handleFlagName, "")
+	fSelfSignSet.Var(&fSelfSignHandle, handleFlagName, "")
+	fSelfSignSet.Var(&fSelfSignSANs, sanFlagName, "")
+	fSetCommandAuditSet.Var(&fSetCommandAuditClearCCs, clearFlagName, "")
+	fSetCommandAuditSet.Var(&fSetCommandAuditSetCCs, setFlagName, "")
+	fSignSet.Var(&fSignHandle, handleFlagName, "")
+	fSSHAgentSet.Var(&fSSHAgentContexts, contextFlagName, "")
+	fSSHAgentSet.Var(&fSSHAgentHandles, handleFlagName, "")
+	fSSHAgentSet.Var(&fSSHAgentKeyFiles, keyFileFlagName, "")
+	fSSHAgentSet.Var(&fSSHAgentParent, parentFlagName, "")
+	fTLSProxySet.Var(&fTLSProxyHandle, handleFlagName, "")
+	fTLSProxySet.Var(&fTLSProxyParent, parentFlagName, "")
+	fUnsealSet.Var(&fUnsealHandle, handleFlagName, "")
 
 	for _, cmd := range commands {
 		if cmd.flagSet != nil {
@@ -261,6 +1019,14 @@ func init() {
 		}
 	}
 
+	for _, cmd := range policyCommands {
+		cmd.flagSet.Usage = cmd.usageFunc
+	}
+
+	for _, cmd := range templatesCommands {
+		cmd.flagSet.Usage = cmd.usageFunc
+	}
+
 	if v := os.Getenv(defaultTPMEnv); v != "" {
 		defaultTPMDevice = v
 	}
@@ -291,6 +1057,48 @@ func (f *handleFlag) Set(s string) error {
 	return nil
 }
 
+// String returns a string representation of the flag value.
+func (f *handlesFlag) String() string {
+	if f == nil {
+		return ""
+	}
+
+	var s []string
+	for i := range *f {
+		s = append(s, (*f)[i].String())
+	}
+
+	return strings.Join(s, ", ")
+}
+
+// Set appends a value to the flag.
+func (f *handlesFlag) Set(s string) error {
+	var h handleFlag
+	if err := h.Set(s); err != nil {
+		return err
+	}
+
+	*f = append(*f, h)
+
+	return nil
+}
+
+// String returns a string representation of the flag value.
+func (f *stringsFlag) String() string {
+	if f == nil {
+		return ""
+	}
+
+	return strings.Join(*f, ", ")
+}
+
+// Set appends a value to the flag.
+func (f *stringsFlag) Set(s string) error {
+	*f = append(*f, s)
+
+	return nil
+}
+
 // isFlagPassed checked if the named flag was passed.
 func isFlagPassed(set *flag.FlagSet, name string) bool {
 	if set == nil {
@@ -404,24 +1212,62 @@ func usageError() {
 
 // usageMain outputs a full usage message for the application.
 func usageMain() error {
-	fmt.Printf("usage: %s <command> [options]\n", appName)
+	fmt.Printf("usage: %s [global options] <command> [options]\n", appName)
 	fmt.Println()
 
 	fmt.Printf("%s is a TPM2.0 command line client.\n", appName)
 	fmt.Println()
 
-	const fw = 16
+	const ow = 20
+	fmt.Println("Global options:")
+	fmt.Printf("    -%-*s audit log file\n", ow, auditFlagName+" <path>")
+	fmt.Printf("    -%-*s persistent handle of salt key (default: 0x%08x)\n", ow,
+		saltKeyFlagName+" <integer>", defaultSaltKey)
+	fmt.Printf("    -%-*s session mode, %s or %s\n", ow,
+		sessionFlagName+" <mode>", hmacSessionMode, saltedSessionMode)
+	fmt.Println()
+
+	const fw = 25
+
 	fmt.Println("Commands:")
 	fmt.Printf("    %-*s activate a credential\n", fw, activateCommand)
 	fmt.Printf("    %-*s output selected TPM capabilities\n", fw, capsCommand)
+	fmt.Printf("    %-*s change the authorization value of a hierarchy or object\n", fw, changeAuthCommand)
+	fmt.Printf("    %-*s clear the owner and endorsement hierarchies\n", fw, clearCommand)
+	fmt.Printf("    %-*s enable or disable clearing the TPM\n", fw, clearControlCommand)
+	fmt.Printf("    %-*s adjust the rate at which the TPM clock advances\n", fw, clockRateAdjustCommand)
+	fmt.Printf("    %-*s load a saved object or session context\n", fw, contextLoadCommand)
+	fmt.Printf("    %-*s save an object or session context\n", fw, contextSaveCommand)
 	fmt.Printf("    %-*s create an object\n", fw, createCommand)
 	fmt.Printf("    %-*s create a primary object\n", fw, createPrimaryCommand)
+	fmt.Printf("    %-*s reset the dictionary attack lockout\n", fw, daLockResetCommand)
+	fmt.Printf("    %-*s output or change dictionary attack parameters\n", fw, daParamsCommand)
 	fmt.Printf("    %-*s evict a persistent object\n", fw, evictCommand)
 	fmt.Printf("    %-*s flush a transient object\n", fw, flushCommand)
+	fmt.Printf("    %-*s generate a certificate signing request\n", fw, genCSRCommand)
+	fmt.Printf("    %-*s get the signed command audit digest\n", fw, getCommandAuditCommand)
+	fmt.Printf("    %-*s get the signed audit digest of an audit session\n", fw, getSessionAuditCommand)
+	fmt.Printf("    %-*s output the result of the TPM self tests\n", fw, getTestStatusCommand)
+	fmt.Printf("    %-*s get the signed current time and clock values\n", fw, getTimeCommand)
 	fmt.Printf("    %-*s show this usage information\n", fw, helpCommand)
+	fmt.Printf("    %-*s enable or disable a hierarchy\n", fw, hierarchyControlCommand)
+	fmt.Printf("    %-*s test selected algorithms\n", fw, incrementalSelfTestCommand)
+	fmt.Printf("    %-*s output a summary of the TPM's identity and state\n", fw, infoCommand)
 	fmt.Printf("    %-*s make an activation credential\n", fw, makeCredCommand)
 	fmt.Printf("    %-*s read a value from an area in NV memory\n", fw, nvReadCommand)
+	fmt.Printf("    %-*s compute and manage authorization policies\n", fw, policyCommand)
+	fmt.Printf("    %-*s read the current time and clock values\n", fw, readClockCommand)
 	fmt.Printf("    %-*s read a TPM object's public area\n", fw, readPublicCommand)
+	fmt.Printf("    %-*s generate a self-signed certificate\n", fw, selfSignCommand)
+	fmt.Printf("    %-*s run the TPM self tests\n", fw, selfTestCommand)
+	fmt.Printf("    %-*s advance the TPM clock\n", fw, setClockCommand)
+	fmt.Printf("    %-*s change the commands audited by the TPM\n", fw, setCommandAuditCommand)
+	fmt.Printf("    %-*s sign data with a TPM key\n", fw, signCommand)
+	fmt.Printf("    %-*s run an SSH agent serving TPM keys\n", fw, sshAgentCommand)
+	fmt.Printf("    %-*s list and output built-in templates\n", fw, templatesCommand)
+	fmt.Printf("    %-*s check whether the TPM supports a template\n", fw, testParmsCommand)
+	fmt.Printf("    %-*s forward connections over TLS using a TPM client key\n", fw, tlsProxyCommand)
+	fmt.Printf("    %-*s unseal a sealed data object\n", fw, unsealCommand)
 	fmt.Println()
 
 	fmt.Printf("Use \"%s <command> -help\" for more information about a command.\n", appName)
@@ -432,6 +1278,46 @@ func usageMain() error {
 	fmt.Printf("the global default of %s will be used.\n", defaultTPMDeviceGlobal)
 	fmt.Println()
 
+	fmt.Printf("Commands which take the handle of a key or other object with -%s also\n", handleFlagName)
+	fmt.Printf("accept -%s with a context file saved by %s, or by the -%s\n",
+		contextFlagName, contextSaveCommand, contextOutFlagName)
+	fmt.Printf("option of %s and %s. The context is loaded for the duration of\n", createCommand, createPrimaryCommand)
+	fmt.Println("the command, so transient objects may be used across invocations without")
+	fmt.Println("consuming persistent handles.")
+	fmt.Println()
+
+	fmt.Printf("The %s, %s and %s commands exit with\n", getTestStatusCommand, incrementalSelfTestCommand, selfTestCommand)
+	fmt.Printf("status %d if the TPM has yet to complete its self tests, and with status %d if\n", exitTestsPending, exitTPMFailure)
+	fmt.Println("it has failed them or is in failure mode.")
+	fmt.Println()
+
+	fmt.Printf("With -%s, passwords are used in HMAC sessions rather than sent in the clear,\n", sessionFlagName)
+	fmt.Println("and secret command and response parameters are encrypted with AES-CFB. The")
+	fmt.Printf("%s mode salts each session with a secret encrypted to the salt key, such as\n", saltedSessionMode)
+	fmt.Printf("an SRK or EK, while the %s mode derives session keys from passwords alone.\n", hmacSessionMode)
+	fmt.Printf("Since a policy session has no password from which to derive keys, the %s\n", hmacSessionMode)
+	fmt.Println("mode refuses to run a command with secret parameters which is authorized by")
+	fmt.Println("a policy session.")
+	fmt.Println()
+
+	fmt.Printf("With -%s, commands are also run in an audit session, and their command and\n", auditFlagName)
+	fmt.Println("response parameter hashes are recorded in the log file. The session handle")
+	fmt.Println("and nonce are also recorded, and the session is continued by later commands")
+	fmt.Printf("using the same log, so that its digest may be verified with the %s\n", getSessionAuditCommand)
+	fmt.Println("command. A log file which does not yet exist starts a new session. Since a")
+	fmt.Println("resource manager flushes the session when tpmtool exits, -audit is not")
+	fmt.Println("supported with a resource manager device such as /dev/tpmrm0.")
+	fmt.Println()
+
+	fmt.Printf("The -%s and -%s options are supported by the %s, %s,\n",
+		auditFlagName, sessionFlagName, activateCommand, changeAuthCommand)
+	fmt.Printf("%s, %s, %s, %s,\n", clearCommand, clearControlCommand, clockRateAdjustCommand, createCommand)
+	fmt.Printf("%s, %s, %s, %s,\n", createPrimaryCommand, daLockResetCommand, daParamsCommand, evictCommand)
+	fmt.Printf("%s, %s, %s,\n", getCommandAuditCommand, getSessionAuditCommand, getTimeCommand)
+	fmt.Printf("%s, %s, %s,\n", hierarchyControlCommand, nvReadCommand, setClockCommand)
+	fmt.Printf("%s, %s and %s commands.\n", setCommandAuditCommand, signCommand, unsealCommand)
+	fmt.Println()
+
 	return nil
 }
 
@@ -445,12 +1331,15 @@ func usageActivate() {
 
 	const fw = 29
 	fmt.Println("Options:")
+	fmt.Printf("    -%-*s context file of key\n", fw, contextFlagName+" <path>")
 	fmt.Printf("    -%-*s credential blob input file\n", fw, credInFlagName+" <path>")
 	fmt.Printf("    -%-*s persistent object handle of key\n", fw, handleFlagName+" <integer>")
 	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
 	fmt.Printf("    -%-*s key password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s key policy file\n", fw, policyFlagName+" <path>")
 	fmt.Printf("    -%-*s persistent object handle of protecting key\n", fw, protectorFlagName+" <integer>")
 	fmt.Printf("    -%-*s protecting key password\n", fw, protectorPasswordFlagName+" <string>")
+	fmt.Printf("    -%-*s protecting key policy file\n", fw, protectorPolicyFlagName+" <path>")
 	fmt.Printf("    -%-*s encrypted secret input file\n", fw, secretInFlagName+" <path>")
 	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
 	fmt.Println()
@@ -468,104 +1357,529 @@ func usageCaps() {
 	fmt.Println("Options:")
 	fmt.Printf("    -%-*s output supported algorithms\n", fw, algsFlagName)
 	fmt.Printf("    -%-*s output all capabilities\n", fw, allFlagName)
+	fmt.Printf("    -%-*s output audited commands\n", fw, auditCommandsFlagName)
+	fmt.Printf("    -%-*s output permanent handle authorization policies\n", fw, authPoliciesFlagName)
+	fmt.Printf("    -%-*s output supported commands and their attributes\n", fw, commandsFlagName)
+	fmt.Printf("    -%-*s output supported elliptic curves\n", fw, curvesFlagName)
+	fmt.Printf("    -%-*s with -%s, output details of each handle\n", fw, detailsFlagName, handlesFlagName)
+	fmt.Printf("    -%-*s output format, %s, %s or %s (default: %s)\n", fw, formatFlagName+" <string>",
+		textFormat, jsonFormat, yamlFormat, textFormat)
 	fmt.Printf("    -%-*s output active handles\n", fw, handlesFlagName)
 	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s output PCR properties\n", fw, pcrPropertiesFlagName)
+	fmt.Printf("    -%-*s output PCR bank allocation\n", fw, pcrsFlagName)
+	fmt.Printf("    -%-*s output commands requiring physical presence\n", fw, ppCommandsFlagName)
+	fmt.Printf("    -%-*s output fixed and variable TPM properties\n", fw, propertiesFlagName)
 	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
 	fmt.Println()
 }
 
-// usageCreate outputs usage information for the create command.
-func usageCreate() {
-	fmt.Printf("usage: %s %s [options]\n", appName, createCommand)
+// usageChangeAuth outputs usage information for the changeauth command.
+func usageChangeAuth() {
+	fmt.Printf("usage: %s %s [options]\n", appName, changeAuthCommand)
 	fmt.Println()
 
-	fmt.Printf("The %s command creates an object.\n", createCommand)
+	fmt.Printf("The %s command changes the authorization value of a hierarchy or of a\n", changeAuthCommand)
+	fmt.Println("loaded object. The authorization value of an object is part of its private")
+	fmt.Printf("area, so a new private area is written to the -%s file, and must be loaded\n", privOutFlagName)
+	fmt.Println("under the parent for the new value to be used. The object itself is unchanged.")
 	fmt.Println()
 
 	const fw = 29
 	fmt.Println("Options:")
+	fmt.Printf("    -%-*s context file of object\n", fw, contextFlagName+" <path>")
+	fmt.Printf("    -%-*s change endorsement hierarchy\n", fw, endorsementFlagName)
+	fmt.Printf("    -%-*s persistent object handle\n", fw, handleFlagName+" <integer>")
 	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
-	fmt.Printf("    -%-*s owner password\n", fw, ownerPasswordFlagName+" <string>")
+	fmt.Printf("    -%-*s change lockout hierarchy\n", fw, lockoutFlagName)
+	fmt.Printf("    -%-*s new password\n", fw, newPasswordFlagName+" <string>")
+	fmt.Printf("    -%-*s change owner hierarchy\n", fw, ownerFlagName)
 	fmt.Printf("    -%-*s persistent handle of parent object\n", fw, parentFlagName+" <integer>")
-	fmt.Printf("    -%-*s parent password\n", fw, parentPasswordFlagName+" <string>")
-	fmt.Printf("    -%-*s object password\n", fw, passwordFlagName+" <string>")
-	fmt.Printf("    -%-*s persistent object handle\n", fw, persistentFlagName+" <integer>")
-	fmt.Printf("    -%-*s public area output file\n", fw, pubOutFlagName+" <path>")
-	fmt.Printf("    -%-*s private area output file\n", fw, privOutFlagName+" <path>")
-	fmt.Printf("    -%-*s template\n", fw, templateFlagName+" <path>")
+	fmt.Printf("    -%-*s current password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s change platform hierarchy\n", fw, platformFlagName)
+	fmt.Printf("    -%-*s policy file\n", fw, policyFlagName+" <path>")
+	fmt.Printf("    -%-*s private area output file for object\n", fw, privOutFlagName+" <path>")
 	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
 	fmt.Println()
 }
 
-// usageCreatePrimary outputs usage information for the createprimary command.
-func usageCreatePrimary() {
-	fmt.Printf("usage: %s %s [options]\n", appName, createPrimaryCommand)
+// usageClear outputs usage information for the clear command.
+func usageClear() {
+	fmt.Printf("usage: %s %s [options]\n", appName, clearCommand)
 	fmt.Println()
 
-	fmt.Printf("The %s command creates a primary object.\n", createPrimaryCommand)
+	fmt.Printf("The %s command clears the owner and endorsement hierarchies, deleting all\n", clearCommand)
+	fmt.Println("of their keys, persistent objects and NV indices, and resetting the owner,")
+	fmt.Println("endorsement and lockout authorization values. It is authorized with the")
+	fmt.Printf("lockout hierarchy unless -%s is provided, and asks for confirmation\n", platformFlagName)
+	fmt.Printf("unless -%s is provided.\n", forceFlagName)
 	fmt.Println()
 
 	const fw = 29
 	fmt.Println("Options:")
-	fmt.Printf("    -%-*s create in endorsement hierarchy\n", fw, endorsementFlagName)
+	fmt.Printf("    -%-*s do not ask for confirmation\n", fw, forceFlagName)
 	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
-	fmt.Printf("    -%-*s owner password\n", fw, ownerPasswordFlagName+" <string>")
-	fmt.Printf("    -%-*s object password\n", fw, passwordFlagName+" <string>")
-	fmt.Printf("    -%-*s persistent object handle\n", fw, persistentFlagName+" <integer>")
-	fmt.Printf("    -%-*s create in platform hierarchy\n", fw, platformFlagName)
-	fmt.Printf("    -%-*s template\n", fw, templateFlagName+" <path>")
+	fmt.Printf("    -%-*s lockout or platform password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s authorize with platform hierarchy\n", fw, platformFlagName)
+	fmt.Printf("    -%-*s lockout or platform policy file\n", fw, policyFlagName+" <path>")
 	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
 	fmt.Println()
 }
 
-// usageEvict outputs usage information for the evict command.
-func usageEvict() {
-	fmt.Printf("usage: %s %s [options]\n", appName, evictCommand)
+// usageClearControl outputs usage information for the clearcontrol command.
+func usageClearControl() {
+	fmt.Printf("usage: %s %s [options]\n", appName, clearControlCommand)
 	fmt.Println()
 
-	fmt.Printf("The %s command evicts a persistent object.\n", evictCommand)
+	fmt.Printf("The %s command enables or disables the %s command. Clearing may be\n", clearControlCommand, clearCommand)
+	fmt.Printf("disabled with lockout or platform authorization, but only enabled with -%s,\n", platformFlagName)
+	fmt.Printf("and disabling it asks for confirmation unless -%s is provided.\n", forceFlagName)
 	fmt.Println()
 
 	const fw = 29
 	fmt.Println("Options:")
-	fmt.Printf("    -%-*s persistent object handle\n", fw, handleFlagName+" <integer>")
+	fmt.Printf("    -%-*s disable clearing\n", fw, disableFlagName)
+	fmt.Printf("    -%-*s enable clearing\n", fw, enableFlagName)
+	fmt.Printf("    -%-*s do not ask for confirmation\n", fw, forceFlagName)
 	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
-	fmt.Printf("    -%-*s owner password\n", fw, ownerPasswordFlagName+" <string>")
+	fmt.Printf("    -%-*s lockout or platform password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s authorize with platform hierarchy\n", fw, platformFlagName)
+	fmt.Printf("    -%-*s lockout or platform policy file\n", fw, policyFlagName+" <path>")
 	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
 	fmt.Println()
 }
 
-// usageFlush outputs usage information for the flush command.
-func usageFlush() {
-	fmt.Printf("usage: %s %s [options]\n", appName, flushCommand)
+// usageClockRateAdjust outputs usage information for the clockrateadjust
+// command.
+func usageClockRateAdjust() {
+	fmt.Printf("usage: %s %s [options]\n", appName, clockRateAdjustCommand)
 	fmt.Println()
 
-	fmt.Printf("The %s command flushes a transient object.\n", flushCommand)
+	fmt.Printf("The %s command adjusts the rate at which the TPM clock advances, in\n", clockRateAdjustCommand)
+	fmt.Println("coarse, medium or fine steps, to compensate for drift. An adjustment of none")
+	fmt.Println("restores the nominal rate.")
 	fmt.Println()
 
 	const fw = 29
 	fmt.Println("Options:")
-	fmt.Printf("    -%-*s transient object handle\n", fw, handleFlagName+" <integer>")
+	fmt.Printf("    -%-*s adjustment (coarse-slower, medium-slower, fine-slower,\n", fw, adjustFlagName+" <adjustment>")
+	fmt.Printf("    -%-*s none, fine-faster, medium-faster or coarse-faster)\n", fw, "")
 	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s owner password\n", fw, ownerPasswordFlagName+" <string>")
+	fmt.Printf("    -%-*s owner policy file\n", fw, policyFlagName+" <path>")
 	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
 	fmt.Println()
 }
 
-// usageMakeCred outputs usage information for the makecred command.
-func usageMakeCred() {
-	fmt.Printf("usage: %s %s [options]\n", appName, makeCredCommand)
+// usageContextLoad outputs usage information for the contextload command.
+func usageContextLoad() {
+	fmt.Printf("usage: %s %s [options]\n", appName, contextLoadCommand)
 	fmt.Println()
 
-	fmt.Printf("The %s command creates an activation credential.\n", makeCredCommand)
+	fmt.Printf("The %s command loads a saved context, and outputs the handle of the\n", contextLoadCommand)
+	fmt.Println("loaded object or session.")
 	fmt.Println()
 
 	const fw = 29
 	fmt.Println("Options:")
-	fmt.Printf("    -%-*s credential blob output file\n", fw, credOutFlagName+" <path>")
-	fmt.Printf("    -%-*s persistent object handle of protecting key\n", fw, handleFlagName+" <integer>")
 	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
-	fmt.Printf("    -%-*s input file containing credential (default: stdin)\n", fw, inFlagName+" <path>")
-	fmt.Printf("    -%-*s public area input file\n", fw, publicAreaFlagName+" <path>")
+	fmt.Printf("    -%-*s context file\n", fw, inFlagName+" <path>")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+
+	fmt.Println("When the TPM is accessed through a resource manager, the loaded object or")
+	fmt.Printf("session is flushed when %s exits. Use the -%s option of other commands\n", appName, contextFlagName)
+	fmt.Println("to load a saved context for the duration of the command.")
+	fmt.Println()
+}
+
+// usageContextSave outputs usage information for the contextsave command.
+func usageContextSave() {
+	fmt.Printf("usage: %s %s [options]\n", appName, contextSaveCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command saves the context of a transient object or session.\n", contextSaveCommand)
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s flush the transient object after saving its context\n", fw, flushFlagName)
+	fmt.Printf("    -%-*s transient object or session handle\n", fw, handleFlagName+" <integer>")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s output file (default: stdout)\n", fw, outFlagName+" <path>")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+
+	fmt.Println("Saving the context of a session unloads it from the TPM, which continues to")
+	fmt.Printf("track it until its context is loaded and it is flushed, so -%s applies only\n", flushFlagName)
+	fmt.Println("to transient objects and is refused for sessions.")
+	fmt.Println()
+}
+
+// usageCreate outputs usage information for the create command.
+func usageCreate() {
+	fmt.Printf("usage: %s %s [options]\n", appName, createCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command creates an object.\n", createCommand)
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s algorithm specifier, in place of -%s\n", fw, algFlagName+" <spec>", templateFlagName)
+	fmt.Printf("    -%-*s object attributes for -%s\n", fw, attrsFlagName+" <attrs>", algFlagName)
+	fmt.Printf("    -%-*s context output file\n", fw, contextOutFlagName+" <path>")
+	fmt.Printf("    -%-*s data to seal in a keyed hash object\n", fw, dataFlagName+" <path>")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s name algorithm for -%s (default: sha256)\n", fw, nameAlgFlagName+" <algorithm>", algFlagName)
+	fmt.Printf("    -%-*s owner password\n", fw, ownerPasswordFlagName+" <string>")
+	fmt.Printf("    -%-*s persistent handle of parent object\n", fw, parentFlagName+" <integer>")
+	fmt.Printf("    -%-*s parent password\n", fw, parentPasswordFlagName+" <string>")
+	fmt.Printf("    -%-*s object password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s persistent object handle\n", fw, persistentFlagName+" <integer>")
+	fmt.Printf("    -%-*s public area output file\n", fw, pubOutFlagName+" <path>")
+	fmt.Printf("    -%-*s private area output file\n", fw, privOutFlagName+" <path>")
+	fmt.Printf("    -%-*s template file or built-in template name\n", fw, templateFlagName+" <path>|<name>")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+
+	fmt.Printf("The -%s, -%s and -%s options are as for the %s %s command.\n",
+		algFlagName, attrsFlagName, nameAlgFlagName, templatesCommand, templatesGenCommand)
+	fmt.Println()
+}
+
+// usageCreatePrimary outputs usage information for the createprimary command.
+func usageCreatePrimary() {
+	fmt.Printf("usage: %s %s [options]\n", appName, createPrimaryCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command creates a primary object.\n", createPrimaryCommand)
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s algorithm specifier, in place of -%s\n", fw, algFlagName+" <spec>", templateFlagName)
+	fmt.Printf("    -%-*s object attributes for -%s\n", fw, attrsFlagName+" <attrs>", algFlagName)
+	fmt.Printf("    -%-*s context output file\n", fw, contextOutFlagName+" <path>")
+	fmt.Printf("    -%-*s create in endorsement hierarchy\n", fw, endorsementFlagName)
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s name algorithm for -%s (default: sha256)\n", fw, nameAlgFlagName+" <algorithm>", algFlagName)
+	fmt.Printf("    -%-*s owner password\n", fw, ownerPasswordFlagName+" <string>")
+	fmt.Printf("    -%-*s object password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s persistent object handle\n", fw, persistentFlagName+" <integer>")
+	fmt.Printf("    -%-*s create in platform hierarchy\n", fw, platformFlagName)
+	fmt.Printf("    -%-*s template file or built-in template name\n", fw, templateFlagName+" <path>|<name>")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+
+	fmt.Printf("The -%s, -%s and -%s options are as for the %s %s command.\n",
+		algFlagName, attrsFlagName, nameAlgFlagName, templatesCommand, templatesGenCommand)
+	fmt.Println()
+}
+
+// usageDALockReset outputs usage information for the dalockreset command.
+func usageDALockReset() {
+	fmt.Printf("usage: %s %s [options]\n", appName, daLockResetCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command resets the dictionary attack lockout counter, taking the\n", daLockResetCommand)
+	fmt.Println("TPM out of lockout. It is authorized with the lockout hierarchy, which is")
+	fmt.Printf("itself locked out for the lockout recovery time reported by %s after\n", daParamsCommand)
+	fmt.Println("an authorization failure.")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s lockout password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s lockout policy file\n", fw, policyFlagName+" <path>")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+}
+
+// usageDAParams outputs usage information for the daparams command.
+func usageDAParams() {
+	fmt.Printf("usage: %s %s [options]\n", appName, daParamsCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command changes the dictionary attack protection parameters of\n", daParamsCommand)
+	fmt.Println("the TPM, with lockout authorization. Parameters which are not provided keep")
+	fmt.Println("their current values. If none are provided, the current parameters are")
+	fmt.Println("output, together with the lockout state and the number of authorization")
+	fmt.Println("failures counted.")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s output format (%s or %s) (default: %s)\n", fw, formatFlagName+" <format>",
+		textFormat, jsonFormat, textFormat)
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s seconds before lockout authorization may be\n", fw, lockoutRecoveryFlagName+" <integer>")
+	fmt.Printf("    -%-*s retried after a failure, or 0 to require a reset\n", fw, "")
+	fmt.Printf("    -%-*s authorization failures before lockout\n", fw, maxTriesFlagName+" <integer>")
+	fmt.Printf("    -%-*s lockout password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s lockout policy file\n", fw, policyFlagName+" <path>")
+	fmt.Printf("    -%-*s seconds to forget one authorization failure,\n", fw, recoveryTimeFlagName+" <integer>")
+	fmt.Printf("    -%-*s or 0 to disable dictionary attack protection\n", fw, "")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+}
+
+// usageEvict outputs usage information for the evict command.
+func usageEvict() {
+	fmt.Printf("usage: %s %s [options]\n", appName, evictCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command evicts a persistent object.\n", evictCommand)
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s persistent object handle\n", fw, handleFlagName+" <integer>")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s owner password\n", fw, ownerPasswordFlagName+" <string>")
+	fmt.Printf("    -%-*s owner policy file\n", fw, policyFlagName+" <path>")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+}
+
+// usageFlush outputs usage information for the flush command.
+func usageFlush() {
+	fmt.Printf("usage: %s %s [options]\n", appName, flushCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command flushes a transient object or session.\n", flushCommand)
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s context file of transient object or session\n", fw, contextFlagName+" <path>")
+	fmt.Printf("    -%-*s transient object or session handle\n", fw, handleFlagName+" <integer>")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+}
+
+// usageGenCSR outputs usage information for the gencsr command.
+func usageGenCSR() {
+	fmt.Printf("usage: %s %s [options]\n", appName, genCSRCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command generates a PKCS#10 certificate signing request signed\n", genCSRCommand)
+	fmt.Printf("by a TPM key.\n")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s context file of key\n", fw, contextFlagName+" <path>")
+	fmt.Printf("    -%-*s persistent object handle of key\n", fw, handleFlagName+" <integer>")
+	fmt.Printf("    -%-*s hash algorithm (sha1, sha256, sha384 or sha512)\n", fw, hashFlagName+" <algorithm>")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s output file (default: stdout)\n", fw, outFlagName+" <path>")
+	fmt.Printf("    -%-*s key password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s use RSASSA-PSS for RSA keys\n", fw, pssFlagName)
+	fmt.Printf("    -%-*s subject alternative name (may be repeated)\n", fw, sanFlagName+" <type:value>")
+	fmt.Printf("    -%-*s subject distinguished name\n", fw, subjectFlagName+" <name>")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+
+	fmt.Println("Subject names take the form \"CN=name, O=organization\". Subject alternative")
+	fmt.Println("names take the form dns:<name>, email:<address>, ip:<address> or uri:<uri>.")
+	fmt.Println()
+}
+
+// usageGetCommandAudit outputs usage information for the
+// getcommandauditdigest command.
+func usageGetCommandAudit() {
+	fmt.Printf("usage: %s %s [options]\n", appName, getCommandAuditCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command gets the command audit digest in an attestation\n", getCommandAuditCommand)
+	fmt.Println("signed by a TPM key, and verifies the signature. The TPM clears the digest")
+	fmt.Println("once it has been returned.")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s context file of signing key\n", fw, contextFlagName+" <path>")
+	fmt.Printf("    -%-*s endorsement hierarchy password\n", fw, endorsementPasswordFlagName+" <string>")
+	fmt.Printf("    -%-*s persistent object handle of signing key\n", fw, handleFlagName+" <integer>")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s audit log file\n", fw, logFlagName+" <path>")
+	fmt.Printf("    -%-*s qualifying data in hex\n", fw, nonceFlagName+" <hex>")
+	fmt.Printf("    -%-*s attestation output file\n", fw, outFlagName+" <path>")
+	fmt.Printf("    -%-*s key password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s key policy file\n", fw, policyFlagName+" <path>")
+	fmt.Printf("    -%-*s signature output file\n", fw, sigOutFlagName+" <path>")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+
+	fmt.Printf("With -%s, the digest is verified by replaying the audited commands recorded\n", logFlagName)
+	fmt.Printf("in the log with the global -%s option since the digest was last cleared.\n", auditFlagName)
+	fmt.Println("The TPM audits the commands of every client, so the log must be the only")
+	fmt.Println("client to run audited commands for the whole audit period, and a mismatch")
+	fmt.Println("means that the log is incomplete or has been tampered with. A new log should")
+	fmt.Println("be started by running this command with a log file which does not yet exist,")
+	fmt.Println("which clears the digest without verifying it.")
+	fmt.Println()
+}
+
+// usageGetSessionAudit outputs usage information for the
+// getsessionauditdigest command.
+func usageGetSessionAudit() {
+	fmt.Printf("usage: %s %s [options]\n", appName, getSessionAuditCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command gets the audit digest of the audit session\n", getSessionAuditCommand)
+	fmt.Println("recorded in an audit log in an attestation signed by a TPM key, verifies the")
+	fmt.Println("signature, and verifies the digest by replaying the commands in the log.")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s context file of signing key\n", fw, contextFlagName+" <path>")
+	fmt.Printf("    -%-*s endorsement hierarchy password\n", fw, endorsementPasswordFlagName+" <string>")
+	fmt.Printf("    -%-*s persistent object handle of signing key\n", fw, handleFlagName+" <integer>")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s audit log file\n", fw, logFlagName+" <path>")
+	fmt.Printf("    -%-*s qualifying data in hex\n", fw, nonceFlagName+" <hex>")
+	fmt.Printf("    -%-*s attestation output file\n", fw, outFlagName+" <path>")
+	fmt.Printf("    -%-*s key password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s key policy file\n", fw, policyFlagName+" <path>")
+	fmt.Printf("    -%-*s signature output file\n", fw, sigOutFlagName+" <path>")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+}
+
+// usageGetTime outputs usage information for the gettime command.
+func usageGetTime() {
+	fmt.Printf("usage: %s %s [options]\n", appName, getTimeCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command gets the current time and clock values in an attestation\n", getTimeCommand)
+	fmt.Println("signed by a TPM key, and verifies the signature. The time is the number of")
+	fmt.Println("milliseconds since the TPM was last powered on, and the clock the number of")
+	fmt.Println("milliseconds it has been powered on in total. The reset and restart counts")
+	fmt.Println("reveal reboots and clock resets between attestations.")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s context file of signing key\n", fw, contextFlagName+" <path>")
+	fmt.Printf("    -%-*s endorsement hierarchy password\n", fw, endorsementPasswordFlagName+" <string>")
+	fmt.Printf("    -%-*s persistent object handle of signing key\n", fw, handleFlagName+" <integer>")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s qualifying data in hex\n", fw, nonceFlagName+" <hex>")
+	fmt.Printf("    -%-*s attestation output file\n", fw, outFlagName+" <path>")
+	fmt.Printf("    -%-*s key password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s key policy file\n", fw, policyFlagName+" <path>")
+	fmt.Printf("    -%-*s signature output file\n", fw, sigOutFlagName+" <path>")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+}
+
+// usageGetTestStatus outputs usage information for the getteststatus
+// command.
+func usageGetTestStatus() {
+	fmt.Printf("usage: %s %s [options]\n", appName, getTestStatusCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command outputs the result of the TPM self tests, together with\n", getTestStatusCommand)
+	fmt.Println("any manufacturer-specific test data, which may describe the cause of a")
+	fmt.Println("failure. It may be used when the TPM is in failure mode.")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s output format (%s or %s) (default: %s)\n", fw, formatFlagName+" <format>",
+		textFormat, jsonFormat, textFormat)
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+
+	usageTestExitStatus()
+}
+
+// usageHierarchyControl outputs usage information for the hierarchycontrol
+// command.
+func usageHierarchyControl() {
+	fmt.Printf("usage: %s %s [options]\n", appName, hierarchyControlCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command enables or disables a hierarchy until the next TPM\n", hierarchyControlCommand)
+	fmt.Println("reset. The owner and endorsement hierarchies may be disabled with their own")
+	fmt.Println("authorization. All other changes require platform authorization.")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s disable hierarchy\n", fw, disableFlagName)
+	fmt.Printf("    -%-*s enable hierarchy\n", fw, enableFlagName)
+	fmt.Printf("    -%-*s endorsement hierarchy\n", fw, endorsementFlagName)
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s owner hierarchy\n", fw, ownerFlagName)
+	fmt.Printf("    -%-*s authorizing hierarchy password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s platform hierarchy\n", fw, platformFlagName)
+	fmt.Printf("    -%-*s platform NV indices\n", fw, platformNVFlagName)
+	fmt.Printf("    -%-*s authorizing hierarchy policy file\n", fw, policyFlagName+" <path>")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+}
+
+// usageIncrementalSelfTest outputs usage information for the
+// incrementalselftest command.
+func usageIncrementalSelfTest() {
+	fmt.Printf("usage: %s %s [options]\n", appName, incrementalSelfTestCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command runs the TPM self tests of the selected algorithms\n", incrementalSelfTestCommand)
+	fmt.Println("which have not yet been tested, and outputs the algorithms which remain to")
+	fmt.Println("be tested.")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s algorithm to test (may be repeated)\n", fw, algFlagName+" <algorithm>")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+
+	usageTestExitStatus()
+}
+
+// usageInfo outputs usage information for the info command.
+func usageInfo() {
+	fmt.Printf("usage: %s %s [options]\n", appName, infoCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command outputs a summary of the TPM's identity, health and\n", infoCommand)
+	fmt.Printf("provisioning state. It exits with status %d if the TPM is in failure mode, and\n", exitTPMFailure)
+	fmt.Printf("with status %d if it is in dictionary attack lockout.\n", exitFailure)
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+}
+
+// usageMakeCred outputs usage information for the makecred command.
+func usageMakeCred() {
+	fmt.Printf("usage: %s %s [options]\n", appName, makeCredCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command creates an activation credential.\n", makeCredCommand)
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s context file of protecting key\n", fw, contextFlagName+" <path>")
+	fmt.Printf("    -%-*s credential blob output file\n", fw, credOutFlagName+" <path>")
+	fmt.Printf("    -%-*s persistent object handle of protecting key\n", fw, handleFlagName+" <integer>")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s input file containing credential (default: stdin)\n", fw, inFlagName+" <path>")
+	fmt.Printf("    -%-*s public area input file\n", fw, publicAreaFlagName+" <path>")
 	fmt.Printf("    -%-*s encrypted secret output file\n", fw, secretOutFlagName+" <path>")
 	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
 	fmt.Println()
@@ -584,7 +1898,141 @@ func usageNVRead() {
 	fmt.Printf("    -%-*s NV index handle\n", fw, handleFlagName+" <integer>")
 	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
 	fmt.Printf("    -%-*s output file (default: stdout)\n", fw, outFlagName+" <path>")
-	fmt.Printf("    -%-*s password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s owner password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s NV index policy file\n", fw, policyFlagName+" <path>")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+
+	fmt.Printf("With -%s, the owner authorizes the read. With -%s, the NV index itself\n",
+		passwordFlagName, policyFlagName)
+	fmt.Println("authorizes the read in a policy session.")
+	fmt.Println()
+}
+
+// usagePolicy outputs usage information for the policy command.
+func usagePolicy() {
+	fmt.Printf("usage: %s %s <command> [options]\n", appName, policyCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s commands operate on declarative authorization policy files.\n", policyCommand)
+	fmt.Println()
+
+	const fw = 16
+	fmt.Println("Commands:")
+	fmt.Printf("    %-*s compute a policy digest in software\n", fw, policyComputeCommand)
+	fmt.Printf("    %-*s sign a policy digest for use with PolicyAuthorize\n", fw, policySignCommand)
+	fmt.Printf("    %-*s compute a policy digest with the TPM in a trial session\n", fw, policyTrialCommand)
+	fmt.Println()
+
+	fmt.Printf("Use \"%s %s <command> -help\" for more information about a command.\n", appName, policyCommand)
+	fmt.Println()
+
+	fmt.Println("A policy file is a JSON object with a \"name_alg\" (default: TPM2_ALG_SHA256)")
+	fmt.Println("and a list of \"assertions\", each identified by its \"command\":")
+	fmt.Println()
+	fmt.Println("    TPM2_CC_PolicySecret        handle, name, policy_ref")
+	fmt.Println("    TPM2_CC_PolicySigned        name or public_key, private_key, policy_ref")
+	fmt.Println("    TPM2_CC_PolicyAuthorize     name or public_key, policy_ref, approved_policies")
+	fmt.Println("    TPM2_CC_PolicyPCR           pcrs, pcr_values or pcr_digest")
+	fmt.Println("    TPM2_CC_PolicyCommandCode   command_code")
+	fmt.Println("    TPM2_CC_PolicyOR            branches")
+	fmt.Println("    TPM2_CC_PolicyAuthValue")
+	fmt.Println("    TPM2_CC_PolicyPassword")
+	fmt.Println("    TPM2_CC_PolicyNV            handle, name, operand_b, offset, operation")
+	fmt.Println("    TPM2_CC_PolicyCounterTimer  operand_b, offset, operation")
+	fmt.Println()
+	fmt.Println("Byte values are hex-encoded. The name of a permanent handle is derived from")
+	fmt.Println("the handle, and other names are as output by readpublic. Each branch of a")
+	fmt.Println("PolicyOR is a list of assertions which continue from the preceding ones.")
+	fmt.Println()
+	fmt.Println("Each of the \"approved_policies\" of a PolicyAuthorize names a \"policy\" file")
+	fmt.Printf("and a \"signed_policy\" file, as output by the %s command, approving its\n", policySignCommand)
+	fmt.Println("digest. When the policy is executed, the first approved policy which can be")
+	fmt.Println("satisfied is run, and its signature is verified by the TPM. Relative paths")
+	fmt.Println("are resolved against the directory containing the policy file.")
+	fmt.Println()
+}
+
+// usagePolicyCompute outputs usage information for the policy compute
+// command.
+func usagePolicyCompute() {
+	fmt.Printf("usage: %s %s %s [options]\n", appName, policyCommand, policyComputeCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command computes the digest of a policy in software, for use as\n", policyComputeCommand)
+	fmt.Printf("the auth_policy of an object template.\n")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s output format, %s or %s (default: %s)\n", fw, formatFlagName+" <string>",
+		hexFormat, base64Format, hexFormat)
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s policy file\n", fw, inFlagName+" <path>")
+	fmt.Printf("    -%-*s binary output file (default: stdout)\n", fw, outFlagName+" <path>")
+	fmt.Println()
+}
+
+// usagePolicySign outputs usage information for the policy sign command.
+func usagePolicySign() {
+	fmt.Printf("usage: %s %s %s [options]\n", appName, policyCommand, policySignCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command signs a policy digest with an authorizing key, producing a\n", policySignCommand)
+	fmt.Println("signed policy file which approves the policy for a PolicyAuthorize assertion")
+	fmt.Println("naming that key. The digest may be provided directly, or computed from a")
+	fmt.Println("policy file.")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s policy name algorithm (sha1, sha256, sha384 or sha512)\n", fw, hashFlagName+" <algorithm>")
+	fmt.Printf("    -%-*s (default: sha256)\n", fw, "")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s policy file\n", fw, inFlagName+" <path>")
+	fmt.Printf("    -%-*s PEM-encoded private key of authorizing key\n", fw, keyFlagName+" <path>")
+	fmt.Printf("    -%-*s output file (default: stdout)\n", fw, outFlagName+" <path>")
+	fmt.Printf("    -%-*s hex-encoded policy digest\n", fw, policyFlagName+" <digest>")
+	fmt.Printf("    -%-*s hex-encoded policy reference\n", fw, policyRefFlagName+" <hex>")
+	fmt.Println()
+}
+
+// usagePolicyTrial outputs usage information for the policy trial command.
+func usagePolicyTrial() {
+	fmt.Printf("usage: %s %s %s [options]\n", appName, policyCommand, policyTrialCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command computes the digest of a policy with the TPM, by running its\n", policyTrialCommand)
+	fmt.Println("assertions in a trial session. The TPM does not check that the assertions")
+	fmt.Println("are satisfied, but secrets are still required for PolicySecret and PolicyNV.")
+	fmt.Println("Each branch of a PolicyOR is run in turn.")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s fail if the digest differs from the one computed in software\n", fw, compareFlagName)
+	fmt.Printf("    -%-*s output format, %s or %s (default: %s)\n", fw, formatFlagName+" <string>",
+		hexFormat, base64Format, hexFormat)
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s policy file\n", fw, inFlagName+" <path>")
+	fmt.Printf("    -%-*s binary output file (default: stdout)\n", fw, outFlagName+" <path>")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+}
+
+// usageReadClock outputs usage information for the readclock command.
+func usageReadClock() {
+	fmt.Printf("usage: %s %s [options]\n", appName, readClockCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command reads the current time and clock values of the TPM,\n", readClockCommand)
+	fmt.Println("together with its reset and restart counts, and whether the clock is safe,")
+	fmt.Println("meaning that it has not gone backwards since it was last reported.")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
 	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
 	fmt.Println()
 }
@@ -599,12 +2047,380 @@ func usageReadPublic() {
 
 	const fw = 29
 	fmt.Println("Options:")
+	fmt.Printf("    -%-*s context file of object\n", fw, contextFlagName+" <path>")
+	fmt.Printf("    -%-*s output format (text or json)\n", fw, formatFlagName+" <format>")
 	fmt.Printf("    -%-*s persistent object handle\n", fw, handleFlagName+" <integer>")
 	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
 	fmt.Printf("    -%-*s input file\n", fw, inFlagName+" <path>")
+	fmt.Printf("    -%-*s public key output file\n", fw, keyOutFlagName+" <path>")
 	fmt.Printf("    -%-*s output file (default: stdout)\n", fw, outFlagName+" <path>")
-	fmt.Printf("    -%-*s output public key in PEM format\n", fw, pubOutFlagName)
+	fmt.Printf("    -%-*s public key format (pem, der, jwk, ssh, tss or tpmt)\n", fw, pubFormatFlagName+" <format>")
+	fmt.Printf("    -%-*s output public key to stdout\n", fw, pubOutFlagName)
 	fmt.Printf("    -%-*s print the public area in text form\n", fw, textFlagName)
 	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
 	fmt.Println()
 }
+
+// usageSelfSign outputs usage information for the selfsign command.
+func usageSelfSign() {
+	fmt.Printf("usage: %s %s [options]\n", appName, selfSignCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command generates a self-signed X.509 certificate for a TPM key.\n", selfSignCommand)
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s generate a CA certificate\n", fw, caFlagName)
+	fmt.Printf("    -%-*s context file of key\n", fw, contextFlagName+" <path>")
+	fmt.Printf("    -%-*s validity period in days (default: 365)\n", fw, daysFlagName+" <integer>")
+	fmt.Printf("    -%-*s persistent object handle of key\n", fw, handleFlagName+" <integer>")
+	fmt.Printf("    -%-*s hash algorithm (sha1, sha256, sha384 or sha512)\n", fw, hashFlagName+" <algorithm>")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s output file (default: stdout)\n", fw, outFlagName+" <path>")
+	fmt.Printf("    -%-*s key password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s use RSASSA-PSS for RSA keys\n", fw, pssFlagName)
+	fmt.Printf("    -%-*s subject alternative name (may be repeated)\n", fw, sanFlagName+" <type:value>")
+	fmt.Printf("    -%-*s subject distinguished name\n", fw, subjectFlagName+" <name>")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+}
+
+// usageSelfTest outputs usage information for the selftest command.
+func usageSelfTest() {
+	fmt.Printf("usage: %s %s [options]\n", appName, selfTestCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command runs the TPM self tests of all functions which have not\n", selfTestCommand)
+	fmt.Printf("yet been tested, or of all functions with -%s.\n", fullFlagName)
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s test all functions\n", fw, fullFlagName)
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+
+	usageTestExitStatus()
+}
+
+// usageSetClock outputs usage information for the setclock command.
+func usageSetClock() {
+	fmt.Printf("usage: %s %s [options]\n", appName, setClockCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command sets the TPM clock to a new value in milliseconds. The\n", setClockCommand)
+	fmt.Println("clock can only be advanced, so the new value must not be less than the")
+	fmt.Printf("current value reported by %s.\n", readClockCommand)
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s owner password\n", fw, ownerPasswordFlagName+" <string>")
+	fmt.Printf("    -%-*s owner policy file\n", fw, policyFlagName+" <path>")
+	fmt.Printf("    -%-*s new clock value in milliseconds\n", fw, timeFlagName+" <integer>")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+}
+
+// usageSetCommandAudit outputs usage information for the
+// setcommandcodeauditstatus command.
+func usageSetCommandAudit() {
+	fmt.Printf("usage: %s %s [options]\n", appName, setCommandAuditCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command changes the audit hash algorithm and the\n", setCommandAuditCommand)
+	fmt.Println("commands audited by the TPM. Changing the algorithm clears the command audit")
+	fmt.Println("digest.")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s stop auditing a command (may be repeated)\n", fw, clearFlagName+" <command>")
+	fmt.Printf("    -%-*s audit hash algorithm (sha1, sha256, sha384 or sha512)\n", fw, hashFlagName+" <algorithm>")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s owner password\n", fw, ownerPasswordFlagName+" <string>")
+	fmt.Printf("    -%-*s owner policy file\n", fw, policyFlagName+" <path>")
+	fmt.Printf("    -%-*s start auditing a command (may be repeated)\n", fw, setFlagName+" <command>")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+
+	fmt.Println("Commands are specified by name, such as Unseal or TPM2_CC_Unseal, or by")
+	fmt.Println("command code.")
+	fmt.Println()
+
+	fmt.Printf("With the global -%s option, a change of algorithm restarts verification of\n", auditFlagName)
+	fmt.Println("the log's command audit digest. The log's hash algorithm is changed to match")
+	fmt.Println("if it has not yet started its audit session.")
+	fmt.Println()
+}
+
+// usageSign outputs usage information for the sign command.
+func usageSign() {
+	fmt.Printf("usage: %s %s [options]\n", appName, signCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command signs the digest of some data with a TPM key. RSA signatures\n", signCommand)
+	fmt.Println("are output as raw signature values, and ECDSA signatures as DER-encoded")
+	fmt.Println("ASN.1 sequences.")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s context file of key\n", fw, contextFlagName+" <path>")
+	fmt.Printf("    -%-*s persistent object handle of key\n", fw, handleFlagName+" <integer>")
+	fmt.Printf("    -%-*s hash algorithm (sha1, sha256, sha384 or sha512)\n", fw, hashFlagName+" <algorithm>")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s input file (default: stdin)\n", fw, inFlagName+" <path>")
+	fmt.Printf("    -%-*s output file (default: stdout)\n", fw, outFlagName+" <path>")
+	fmt.Printf("    -%-*s key password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s key policy file\n", fw, policyFlagName+" <path>")
+	fmt.Printf("    -%-*s use RSASSA-PSS for RSA keys\n", fw, pssFlagName)
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+}
+
+// usageSSHAgent outputs usage information for the ssh-agent command.
+func usageSSHAgent() {
+	fmt.Printf("usage: %s %s [options]\n", appName, sshAgentCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command runs an SSH agent which serves signing requests using\n", sshAgentCommand)
+	fmt.Printf("TPM keys on a Unix domain socket, until interrupted.\n")
+	fmt.Println()
+	fmt.Println("Keys cannot be added to a running agent with ssh-add, since private keys")
+	fmt.Println("cannot be imported into the TPM by the agent. To serve a key created with")
+	fmt.Printf("the %s command, restart the agent with -%s, or use -%s to\n", createCommand, keyFileFlagName, templateFlagName)
+	fmt.Println("create a new key when the agent starts.")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s context file of key (may be repeated)\n", fw, contextFlagName+" <path>")
+	fmt.Printf("    -%-*s persistent object handle of key (may be repeated)\n", fw, handleFlagName+" <integer>")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s public and private area files of key\n", fw, keyFileFlagName+" <path>,<path>")
+	fmt.Printf("    -%-*s (may be repeated)\n", fw, "")
+	fmt.Printf("    -%-*s persistent handle of parent object\n", fw, parentFlagName+" <integer>")
+	fmt.Printf("    -%-*s parent password\n", fw, parentPasswordFlagName+" <string>")
+	fmt.Printf("    -%-*s key password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s public area output file for new key\n", fw, pubOutFlagName+" <path>")
+	fmt.Printf("    -%-*s private area output file for new key\n", fw, privOutFlagName+" <path>")
+	fmt.Printf("    -%-*s socket path\n", fw, socketFlagName+" <path>")
+	fmt.Printf("    -%-*s template file or built-in template name\n", fw, templateFlagName+" <path>|<name>")
+	fmt.Printf("    -%-*s for new key to create\n", fw, "")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+}
+
+// usageTemplates outputs usage information for the templates command.
+func usageTemplates() {
+	fmt.Printf("usage: %s %s <command> [options]\n", appName, templatesCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s commands operate on the built-in templates, which may be given by\n", templatesCommand)
+	fmt.Printf("name to the -%s option of any command in place of a template file, if no\n", templateFlagName)
+	fmt.Println("file of that name exists.")
+	fmt.Println()
+	fmt.Println("Template files may be JSON or YAML. A template may contain an extends field")
+	fmt.Println("naming a template file, relative to its own directory, or a built-in")
+	fmt.Println("template, in which case its fields override those of that template. Objects")
+	fmt.Println("are merged field by field, and a null value removes a field.")
+	fmt.Println()
+
+	const fw = 16
+	fmt.Println("Commands:")
+	fmt.Printf("    %-*s generate a template from algorithm specifiers\n", fw, templatesGenCommand)
+	fmt.Printf("    %-*s list the built-in templates\n", fw, templatesListCommand)
+	fmt.Printf("    %-*s output the JSON Schema for templates\n", fw, templatesSchemaCommand)
+	fmt.Printf("    %-*s output a built-in template as JSON\n", fw, templatesShowCommand)
+	fmt.Println()
+
+	fmt.Printf("Use \"%s %s <command> -help\" for more information about a command.\n", appName, templatesCommand)
+	fmt.Println()
+
+	fmt.Println("The tcg-ek templates are the endorsement key templates of the TCG EK")
+	fmt.Println("Credential Profile, and the srk templates follow the TCG TPM v2.0")
+	fmt.Println("Provisioning Guidance.")
+	fmt.Println()
+}
+
+// usageTemplatesGen outputs usage information for the templates gen command.
+func usageTemplatesGen() {
+	fmt.Printf("usage: %s %s %s [options]\n", appName, templatesCommand, templatesGenCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command generates a template from an algorithm specifier and\n", templatesGenCommand)
+	fmt.Println("optional object attributes and name algorithm, and outputs it as JSON.")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s algorithm specifier\n", fw, algFlagName+" <spec>")
+	fmt.Printf("    -%-*s object attributes (default: chosen for algorithm)\n", fw, attrsFlagName+" <attrs>")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s name algorithm (default: sha256)\n", fw, nameAlgFlagName+" <algorithm>")
+	fmt.Printf("    -%-*s output file (default: stdout)\n", fw, outFlagName+" <path>")
+	fmt.Println()
+
+	fmt.Println("An algorithm specifier is a key type followed by up to two colon-separated")
+	fmt.Println("fields, such as rsa2048:rsassa-sha256 or ecc384:null:aes256cfb:")
+	fmt.Println()
+	fmt.Println("    rsa[<bits>]             RSA key (default: 2048 bits)")
+	fmt.Println("    ecc[<bits>]             NIST ECC key (default: 256 bits)")
+	fmt.Println("    sm2                     SM2 P256 ECC key")
+	fmt.Println("    aes|camellia|sm4[<bits>][<mode>]")
+	fmt.Println("                            symmetric cipher key (default: 128 bits)")
+	fmt.Println("    hmac[:<hash>]           HMAC key (default: sha256)")
+	fmt.Println("    xor[:<hash>]            XOR obfuscation key (default: sha256)")
+	fmt.Println("    keyedhash               sealed data object")
+	fmt.Println()
+	fmt.Println("RSA and ECC keys may be followed by a scheme and a symmetric algorithm, in")
+	fmt.Println("either order. Schemes are null (the default), rsassa, rsapss, rsaes or oaep")
+	fmt.Println("for RSA keys, and null, ecdsa, ecdaa, ecschnorr, sm2, ecdh or ecmqv for ECC")
+	fmt.Println("keys, with a hash algorithm suffix such as -sha384 (default: sha256) for all")
+	fmt.Println("but null and rsaes. A symmetric algorithm, such as aes128cfb, makes the key")
+	fmt.Println("a storage parent. Symmetric modes are cfb, cbc, ctr, ecb and ofb, and default")
+	fmt.Println("to cfb for storage parents and null for symmetric cipher keys.")
+	fmt.Println()
+	fmt.Println("Object attributes are separated by |, such as sign|fixedtpm|userwithauth,")
+	fmt.Println("and are named as in templates with or without the TPMA_OBJECT_ prefix. The")
+	fmt.Println("sign attribute is short for sign_encrypt. By default, the fixedtpm,")
+	fmt.Println("fixedparent, sensitivedataorigin and userwithauth attributes are set, with")
+	fmt.Println("restricted and decrypt for storage parents, and sign or decrypt according")
+	fmt.Println("to the scheme for other keys. HMAC keys may sign, and XOR keys decrypt.")
+	fmt.Println("Sealed data objects omit sensitivedataorigin.")
+	fmt.Println()
+}
+
+// usageTemplatesList outputs usage information for the templates list
+// command.
+func usageTemplatesList() {
+	fmt.Printf("usage: %s %s %s [options]\n", appName, templatesCommand, templatesListCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command outputs the names and descriptions of the built-in\n", templatesListCommand)
+	fmt.Println("templates.")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Println()
+}
+
+// usageTemplatesSchema outputs usage information for the templates schema
+// command.
+func usageTemplatesSchema() {
+	fmt.Printf("usage: %s %s %s [options]\n", appName, templatesCommand, templatesSchemaCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command outputs the JSON Schema for template files, which\n", templatesSchemaCommand)
+	fmt.Println("editors may use to validate and complete templates.")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s output file (default: stdout)\n", fw, outFlagName+" <path>")
+	fmt.Println()
+}
+
+// usageTemplatesShow outputs usage information for the templates show
+// command.
+func usageTemplatesShow() {
+	fmt.Printf("usage: %s %s %s [options] <name>\n", appName, templatesCommand, templatesShowCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command outputs a built-in template as JSON, which may be saved\n", templatesShowCommand)
+	fmt.Println("and edited for use as a template file.")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Println()
+}
+
+// usageTestParms outputs usage information for the testparms command.
+func usageTestParms() {
+	fmt.Printf("usage: %s %s [options]\n", appName, testParmsCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command checks whether the TPM supports the algorithms and\n", testParmsCommand)
+	fmt.Println("parameters of a template, and if not, identifies the unsupported template")
+	fmt.Printf("field. The %s and %s commands perform the same check before\n",
+		createCommand, createPrimaryCommand)
+	fmt.Println("creating an object.")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s template file or built-in template name\n", fw, templateFlagName+" <path>|<name>")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+}
+
+// usageTLSProxy outputs usage information for the tlsproxy command.
+func usageTLSProxy() {
+	fmt.Printf("usage: %s %s [options]\n", appName, tlsProxyCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command accepts TCP connections on a local address and forwards\n", tlsProxyCommand)
+	fmt.Printf("them to an upstream server over TLS, authenticating as a client with a\n")
+	fmt.Printf("TPM key and certificate, until interrupted.\n")
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s CA certificates for verifying upstream server\n", fw, caCertFlagName+" <path>")
+	fmt.Printf("    -%-*s (default: system roots)\n", fw, "")
+	fmt.Printf("    -%-*s client certificate chain file\n", fw, certFlagName+" <path>")
+	fmt.Printf("    -%-*s context file of key\n", fw, contextFlagName+" <path>")
+	fmt.Printf("    -%-*s persistent object handle of key\n", fw, handleFlagName+" <integer>")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s public and private area files of key\n", fw, keyFileFlagName+" <path>,<path>")
+	fmt.Printf("    -%-*s local address to listen on\n", fw, listenFlagName+" <host:port>")
+	fmt.Printf("    -%-*s persistent handle of parent object\n", fw, parentFlagName+" <integer>")
+	fmt.Printf("    -%-*s parent password\n", fw, parentPasswordFlagName+" <string>")
+	fmt.Printf("    -%-*s key password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s upstream server name for verification\n", fw, serverNameFlagName+" <string>")
+	fmt.Printf("    -%-*s (default: host from -%s)\n", fw, "", upstreamFlagName)
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Printf("    -%-*s upstream server address\n", fw, upstreamFlagName+" <host:port>")
+	fmt.Println()
+}
+
+// usageUnseal outputs usage information for the unseal command.
+func usageUnseal() {
+	fmt.Printf("usage: %s %s [options]\n", appName, unsealCommand)
+	fmt.Println()
+
+	fmt.Printf("The %s command unseals the data in a sealed data object.\n", unsealCommand)
+	fmt.Println()
+
+	const fw = 29
+	fmt.Println("Options:")
+	fmt.Printf("    -%-*s context file of object\n", fw, contextFlagName+" <path>")
+	fmt.Printf("    -%-*s persistent object handle\n", fw, handleFlagName+" <integer>")
+	fmt.Printf("    -%-*s output this usage information\n", fw, helpFlagName)
+	fmt.Printf("    -%-*s output file (default: stdout)\n", fw, outFlagName+" <path>")
+	fmt.Printf("    -%-*s object password\n", fw, passwordFlagName+" <string>")
+	fmt.Printf("    -%-*s object policy file\n", fw, policyFlagName+" <path>")
+	fmt.Printf("    -%-*s TPM device (default: %s)\n", fw, tpmFlagName+" <path>|<hostname:port>", defaultTPMDevice)
+	fmt.Println()
+}
+
+// usageTestExitStatus outputs the exit status codes of the commands which
+// check the results of the TPM self tests.
+func usageTestExitStatus() {
+	fmt.Println("Exit status:")
+	fmt.Printf("    %d    the TPM has passed its self tests\n", 0)
+	fmt.Printf("    %d    an error occurred\n", exitFailure)
+	fmt.Printf("    %d    the TPM has yet to complete its self tests\n", exitTestsPending)
+	fmt.Printf("    %d    the TPM has failed its self tests or is in failure mode\n", exitTPMFailure)
+	fmt.Println()
+}
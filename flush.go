@@ -7,9 +7,10 @@ import (
 	"github.com/google/go-tpm/tpmutil"
 )
 
-// flushContext flushes a transient object from the TPM.
+// flushContext flushes a transient object or session from the TPM. A saved
+// context is flushed by loading it first.
 func flushContext() error {
-	err := ensureAllPassed(fFlushSet, handleFlagName)
+	err := ensureExactlyOnePassed(fFlushSet, contextFlagName, handleFlagName)
 	if err != nil {
 		return err
 	}
@@ -21,6 +22,12 @@ func flushContext() error {
 	defer t.Close()
 
 	handle := tpmutil.Handle(fFlushHandle)
+	if *fFlushContext != "" {
+		handle, err = loadContextFile(t, *fFlushContext)
+		if err != nil {
+			return err
+		}
+	}
 
 	err = tpm2.FlushContext(t, handle)
 	if err != nil {
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+)
+
+// genCSR generates a PKCS#10 certificate signing request signed by a TPM key.
+func genCSR() (err error) {
+	err = ensureAllPassed(fGenCSRSet, subjectFlagName)
+	if err != nil {
+		return err
+	}
+
+	err = ensureExactlyOnePassed(fGenCSRSet, contextFlagName, handleFlagName)
+	if err != nil {
+		return err
+	}
+
+	subject, err := parseSubject(*fGenCSRSubject)
+	if err != nil {
+		return err
+	}
+
+	sans, err := parseSANs(fGenCSRSANs)
+	if err != nil {
+		return err
+	}
+
+	hash, err := parseHash(*fGenCSRHash)
+	if err != nil {
+		return err
+	}
+
+	t, err := getTPM(*fGenCSRTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	key, err := contextKey(t, fGenCSRHandle, *fGenCSRContext, *fGenCSRPassword)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if ferr := key.Close(); ferr != nil {
+			if err == nil {
+				err = ferr
+			} else {
+				log.Printf("%v", ferr)
+			}
+		}
+	}()
+
+	sigAlg, err := key.SignatureAlgorithm(hash, *fGenCSRPSS)
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:            subject,
+		SignatureAlgorithm: sigAlg,
+		DNSNames:           sans.dnsNames,
+		EmailAddresses:     sans.emailAddresses,
+		IPAddresses:        sans.ipAddresses,
+		URIs:               sans.uris,
+	}, key)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate request: %v", err)
+	}
+
+	return writePEM(*fGenCSROut, "CERTIFICATE REQUEST", der)
+}
+
+// writePEM writes a PEM-encoded block to the named file, or to standard
+// output if the name is empty.
+func writePEM(name, blockType string, der []byte) error {
+	var f *os.File
+	var err error
+
+	if name != "" {
+		f, err = os.Create(name)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %v", err)
+		}
+		defer f.Close()
+	} else {
+		f = os.Stdout
+	}
+
+	if err := pem.Encode(f, &pem.Block{Type: blockType, Bytes: der}); err != nil {
+		return fmt.Errorf("failed to write PEM block: %v", err)
+	}
+
+	return nil
+}
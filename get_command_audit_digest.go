@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/google/go-tpm/tpm2"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// getCommandAuditDigest gets the signed command audit digest, which the TPM
+// then clears. If an audit log is provided, the digest is verified against
+// the audited commands recorded in the log since the digest was last cleared.
+func getCommandAuditDigest() (err error) {
+	err = ensureExactlyOnePassed(fGetCommandAuditSet, contextFlagName, handleFlagName)
+	if err != nil {
+		return err
+	}
+
+	nonce, err := hex.DecodeString(*fGetCommandAuditNonce)
+	if err != nil {
+		return fmt.Errorf("failed to decode nonce: %v", err)
+	}
+
+	keyAuth, err := newEntityAuth(*fGetCommandAuditPassword, *fGetCommandAuditPolicy)
+	if err != nil {
+		return err
+	}
+
+	// A log which does not yet exist is created, but there is nothing in it
+	// against which to verify the digest.
+	var l *auditLog
+	var verify bool
+	if *fGetCommandAuditLog != "" {
+		_, err := os.Stat(*fGetCommandAuditLog)
+		verify = err == nil
+
+		l, err = loadAuditLog(*fGetCommandAuditLog)
+		if err != nil {
+			return err
+		}
+	}
+
+	t, err := getTPM(*fGetCommandAuditTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	handle, release, err := contextHandle(t, fGetCommandAuditHandle, *fGetCommandAuditContext)
+	if err != nil {
+		return err
+	}
+	defer release(&err)
+
+	var audited []pgtpm.Command
+	if verify {
+		audited, err = auditedCommands(t)
+		if err != nil {
+			return err
+		}
+	}
+
+	a, attest, signature, err := signedAttestation(t, pgtpm.TPM2_CC_GetCommandAuditDigest,
+		handle, keyAuth, *fGetCommandAuditEndorsementPassword,
+		tpm2.HandleNull, nonce)
+	if err != nil {
+		return err
+	}
+
+	if a.Type != attestCommandAuditTag {
+		return errors.New("attestation does not contain command audit information")
+	}
+
+	if err := writeAttestOutputs(attest, signature, *fGetCommandAuditOut, *fGetCommandAuditSigOut); err != nil {
+		return err
+	}
+
+	outputAttestation(a)
+
+	if l == nil {
+		return nil
+	}
+
+	// The TPM has cleared the digest, so later verification starts from the
+	// next entry, whatever the outcome of this one.
+	start := l.CommandAuditStart
+	l.CommandAuditStart = len(l.Entries)
+	if err := l.save(); err != nil {
+		return err
+	}
+
+	if !verify {
+		return nil
+	}
+
+	if a.DigestAlg != tpm2.Algorithm(l.HashAlg) {
+		return fmt.Errorf("audit digest algorithm %v does not match audit log hash algorithm %v",
+			pgtpm.Algorithm(a.DigestAlg), l.HashAlg)
+	}
+
+	h, err := l.hash()
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(commandListDigest(h, audited), a.CommandDigest) {
+		return errors.New("command digest does not match audited commands")
+	}
+
+	digest, n, err := l.commandDigest(start, audited)
+	if err != nil {
+		return err
+	}
+
+	const fw = attestFieldWidth
+	fmt.Printf("%-*s: %d\n", fw, "log entries", n)
+	fmt.Printf("%-*s: %s\n", fw, "log digest", hexEncodeBytes(digest))
+
+	if !bytes.Equal(digest, a.AuditDigest) {
+		return errors.New("command audit digest does not match audit log: log incomplete or tampered")
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// getSessionAuditDigest gets the signed audit digest of the audit session
+// recorded in an audit log, and verifies it against the log.
+func getSessionAuditDigest() (err error) {
+	err = ensureAllPassed(fGetSessionAuditSet, logFlagName)
+	if err != nil {
+		return err
+	}
+
+	err = ensureExactlyOnePassed(fGetSessionAuditSet, contextFlagName, handleFlagName)
+	if err != nil {
+		return err
+	}
+
+	nonce, err := hex.DecodeString(*fGetSessionAuditNonce)
+	if err != nil {
+		return fmt.Errorf("failed to decode nonce: %v", err)
+	}
+
+	keyAuth, err := newEntityAuth(*fGetSessionAuditPassword, *fGetSessionAuditPolicy)
+	if err != nil {
+		return err
+	}
+
+	l, err := loadAuditLog(*fGetSessionAuditLog)
+	if err != nil {
+		return err
+	}
+
+	if l.Session == nil {
+		return errors.New("audit log has no audit session")
+	}
+
+	t, err := getTPM(*fGetSessionAuditTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	handle, release, err := contextHandle(t, fGetSessionAuditHandle, *fGetSessionAuditContext)
+	if err != nil {
+		return err
+	}
+	defer release(&err)
+
+	a, attest, signature, err := signedAttestation(t, pgtpm.TPM2_CC_GetSessionAuditDigest,
+		handle, keyAuth, *fGetSessionAuditEndorsementPassword,
+		tpmutil.Handle(l.Session.Handle), nonce)
+	if err != nil {
+		return err
+	}
+
+	if a.Type != attestSessionAuditTag {
+		return errors.New("attestation does not contain session audit information")
+	}
+
+	if err := writeAttestOutputs(attest, signature, *fGetSessionAuditOut, *fGetSessionAuditSigOut); err != nil {
+		return err
+	}
+
+	digest, n, err := l.sessionDigest()
+	if err != nil {
+		return err
+	}
+
+	const fw = attestFieldWidth
+	outputAttestation(a)
+	fmt.Printf("%-*s: %d\n", fw, "log entries", n)
+	fmt.Printf("%-*s: %s\n", fw, "log digest", hexEncodeBytes(digest))
+
+	if !bytes.Equal(digest, a.SessionDigest) {
+		return errors.New("session audit digest does not match audit log: log incomplete or tampered")
+	}
+
+	return nil
+}
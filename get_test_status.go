@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// testStatus is the result of the TPM self tests. The JSON field names are
+// part of the output format of the getteststatus command, and should not be
+// changed.
+type testStatus struct {
+	Result string `json:"result"`
+	Code   uint32 `json:"code"`
+	Data   string `json:"data,omitempty"`
+}
+
+// getTestStatus outputs the result of the TPM self tests and any
+// manufacturer-specific test data, returning an error if the tests have not
+// all passed.
+func getTestStatus() error {
+	switch *fGetTestStatusFormat {
+	case textFormat, jsonFormat:
+	default:
+		return fmt.Errorf("unsupported output format: %s", *fGetTestStatusFormat)
+	}
+
+	t, err := getTPM(*fGetTestStatusTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	data, result, err := getTestResult(t)
+	if err != nil {
+		return err
+	}
+
+	status := testStatus{
+		Result: testResultString(result),
+		Code:   uint32(result),
+		Data:   hexEncodeBytes(data),
+	}
+
+	if *fGetTestStatusFormat == jsonFormat {
+		out, err := json.MarshalIndent(status, "", "    ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal test status: %v", err)
+		}
+
+		fmt.Printf("%s\n", out)
+	} else {
+		const fw = 9
+
+		fmt.Printf("%-*s: %s\n", fw, "Result", status.Result)
+		fmt.Printf("%-*s: 0x%x\n", fw, "Code", status.Code)
+		if status.Data != "" {
+			fmt.Printf("%-*s: %s\n", fw, "Test data", status.Data)
+		}
+	}
+
+	return testResultError(result, data)
+}
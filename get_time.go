@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// getTime gets the current time and clock values of the TPM in an
+// attestation signed by a TPM key.
+func getTime() (err error) {
+	err = ensureExactlyOnePassed(fGetTimeSet, contextFlagName, handleFlagName)
+	if err != nil {
+		return err
+	}
+
+	nonce, err := hex.DecodeString(*fGetTimeNonce)
+	if err != nil {
+		return fmt.Errorf("failed to decode nonce: %v", err)
+	}
+
+	keyAuth, err := newEntityAuth(*fGetTimePassword, *fGetTimePolicy)
+	if err != nil {
+		return err
+	}
+
+	t, err := getTPM(*fGetTimeTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	handle, release, err := contextHandle(t, fGetTimeHandle, *fGetTimeContext)
+	if err != nil {
+		return err
+	}
+	defer release(&err)
+
+	a, attest, signature, err := signedAttestation(t, pgtpm.TPM2_CC_GetTime,
+		handle, keyAuth, *fGetTimeEndorsementPassword, tpm2.HandleNull, nonce)
+	if err != nil {
+		return err
+	}
+
+	if a.Type != attestTimeTag {
+		return errors.New("attestation does not contain time information")
+	}
+
+	if err := writeAttestOutputs(attest, signature, *fGetTimeOut, *fGetTimeSigOut); err != nil {
+		return err
+	}
+
+	outputAttestation(a)
+
+	return nil
+}
@@ -1,50 +1,306 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
 
 	"github.com/google/go-tpm/tpm2"
 	"github.com/google/go-tpm/tpmutil"
+	"gopkg.in/yaml.v2"
 
 	"github.com/paulgriffiths/pgtpm"
 )
 
 const (
-	capRequestSize = 16
+	capRequestSize     = 16
+	capCommandListSize = 256
+
+	// capAuthPolicies is the TPM2_CAP_AUTH_POLICIES capability, which is not
+	// defined by pgtpm.
+	capAuthPolicies pgtpm.Capability = 0x00000009
+
+	// firstPermanentHandle is the first handle in the permanent handle
+	// range.
+	firstPermanentHandle = 0x40000000
+)
+
+// TPMA_CC bits and fields.
+const (
+	ccIndexMask     = 0x0000ffff
+	ccNV            = 1 << 22
+	ccExtensive     = 1 << 23
+	ccFlushed       = 1 << 24
+	ccCHandlesShift = 25
+	ccCHandlesMask  = 0x7
+	ccRHandle       = 1 << 28
+	ccVendor        = 1 << 29
+)
+
+// pcrPropertyNames maps TPM_PT_PCR PCR property tags to their names.
+var pcrPropertyNames = map[uint32]string{
+	0x00: "TPM2_PT_PCR_SAVE",
+	0x01: "TPM2_PT_PCR_EXTEND_L0",
+	0x02: "TPM2_PT_PCR_RESET_L0",
+	0x03: "TPM2_PT_PCR_EXTEND_L1",
+	0x04: "TPM2_PT_PCR_RESET_L1",
+	0x05: "TPM2_PT_PCR_EXTEND_L2",
+	0x06: "TPM2_PT_PCR_RESET_L2",
+	0x07: "TPM2_PT_PCR_EXTEND_L3",
+	0x08: "TPM2_PT_PCR_RESET_L3",
+	0x09: "TPM2_PT_PCR_EXTEND_L4",
+	0x0a: "TPM2_PT_PCR_RESET_L4",
+	0x11: "TPM2_PT_PCR_NO_INCREMENT",
+	0x12: "TPM2_PT_PCR_DRTM_RESET",
+	0x13: "TPM2_PT_PCR_POLICY",
+	0x14: "TPM2_PT_PCR_AUTH",
+}
+
+// NV index types, from the TPM_NT field of the NV attributes.
+const (
+	nvTypeShift = 4
+	nvTypeMask  = 0xf
 )
 
+// nvTypes maps TPM_NT NV index types to their descriptions.
+var nvTypes = map[uint32]string{
+	0x0: "ordinary",
+	0x1: "counter",
+	0x2: "bits",
+	0x4: "extend",
+	0x8: "pin fail",
+	0x9: "pin pass",
+}
+
+// nvAttributes are the NV index attributes, in the order in which they
+// should be output.
+var nvAttributes = []struct {
+	attr tpm2.NVAttr
+	name string
+}{
+	{tpm2.AttrPPWrite, "PPWRITE"},
+	{tpm2.AttrOwnerWrite, "OWNERWRITE"},
+	{tpm2.AttrAuthWrite, "AUTHWRITE"},
+	{tpm2.AttrPolicyWrite, "POLICYWRITE"},
+	{tpm2.AttrPolicyDelete, "POLICY_DELETE"},
+	{tpm2.AttrWriteLocked, "WRITELOCKED"},
+	{tpm2.AttrWriteAll, "WRITEALL"},
+	{tpm2.AttrWriteDefine, "WRITEDEFINE"},
+	{tpm2.AttrWriteSTClear, "WRITE_STCLEAR"},
+	{tpm2.AttrGlobalLock, "GLOBALLOCK"},
+	{tpm2.AttrPPRead, "PPREAD"},
+	{tpm2.AttrOwnerRead, "OWNERREAD"},
+	{tpm2.AttrAuthRead, "AUTHREAD"},
+	{tpm2.AttrPolicyRead, "POLICYREAD"},
+	{tpm2.AttrNoDA, "NO_DA"},
+	{tpm2.AttrOrderly, "ORDERLY"},
+	{tpm2.AttrClearSTClear, "CLEAR_STCLEAR"},
+	{tpm2.AttrReadLocked, "READLOCKED"},
+	{tpm2.AttrWritten, "WRITTEN"},
+	{tpm2.AttrPlatformCreate, "PLATFORMCREATE"},
+	{tpm2.AttrReadSTClear, "READ_STCLEAR"},
+}
+
+// permanentHandleNames maps permanent handles to their names.
+var permanentHandleNames = map[pgtpm.Handle]string{
+	pgtpm.TPM2_RH_OWNER:       "TPM2_RH_OWNER",
+	pgtpm.TPM2_RH_NULL:        "TPM2_RH_NULL",
+	pgtpm.TPM2_RS_PW:          "TPM2_RS_PW",
+	pgtpm.TPM2_RH_LOCKOUT:     "TPM2_RH_LOCKOUT",
+	pgtpm.TPM2_RH_ENDORSEMENT: "TPM2_RH_ENDORSEMENT",
+	pgtpm.TPM2_RH_PLATFORM:    "TPM2_RH_PLATFORM",
+	pgtpm.TPM2_RH_PLATFORM_NV: "TPM2_RH_PLATFORM_NV",
+}
+
+// capsCategory is the decoded value of a TPM capability, which can be
+// output as text, or marshaled as JSON or YAML. The JSON and YAML field
+// names are part of the output format of the caps command, and should not
+// be changed.
+type capsCategory interface {
+	outputText()
+}
+
+// capsAlgorithm is a supported algorithm and its attributes.
+type capsAlgorithm struct {
+	Algorithm  string   `json:"algorithm" yaml:"algorithm"`
+	ID         uint16   `json:"id" yaml:"id"`
+	Attributes []string `json:"attributes" yaml:"attributes,flow"`
+}
+
+// capsAlgorithms is the TPM2_CAP_ALGS capability.
+type capsAlgorithms []capsAlgorithm
+
+// capsHandle is an active handle and its type, and optionally details of
+// the entity it references.
+type capsHandle struct {
+	Handle  string             `json:"handle" yaml:"handle"`
+	Type    string             `json:"type" yaml:"type"`
+	Details *capsHandleDetails `json:"details,omitempty" yaml:"details,omitempty"`
+}
+
+// capsHandleDetails are details of the entity referenced by a handle. Only
+// the fields relevant to the type of entity are present.
+type capsHandleDetails struct {
+	Entity     string   `json:"entity,omitempty" yaml:"entity,omitempty"`
+	Session    string   `json:"session,omitempty" yaml:"session,omitempty"`
+	KeyType    string   `json:"key_type,omitempty" yaml:"key_type,omitempty"`
+	NVType     string   `json:"nv_type,omitempty" yaml:"nv_type,omitempty"`
+	Size       *uint16  `json:"size,omitempty" yaml:"size,omitempty"`
+	Attributes []string `json:"attributes,omitempty" yaml:"attributes,omitempty,flow"`
+	Name       string   `json:"name,omitempty" yaml:"name,omitempty"`
+}
+
+// capsHandles is the TPM2_CAP_HANDLES capability.
+type capsHandles []capsHandle
+
+// capsCommandAttributes is a supported command and its attributes.
+type capsCommandAttributes struct {
+	Command    string   `json:"command" yaml:"command"`
+	Code       uint32   `json:"code" yaml:"code"`
+	Attributes []string `json:"attributes" yaml:"attributes,flow"`
+	CHandles   int      `json:"chandles" yaml:"chandles"`
+}
+
+// capsCommands is the TPM2_CAP_COMMANDS capability.
+type capsCommands []capsCommandAttributes
+
+// capsCommandCode is a command code in a command code list.
+type capsCommandCode struct {
+	Command string `json:"command" yaml:"command"`
+	Code    uint32 `json:"code" yaml:"code"`
+}
+
+// capsCommandCodes is the TPM2_CAP_PP_COMMANDS or TPM2_CAP_AUDIT_COMMANDS
+// capability.
+type capsCommandCodes []capsCommandCode
+
+// capsPCRBank is an allocated PCR bank.
+type capsPCRBank struct {
+	Hash string `json:"hash" yaml:"hash"`
+	PCRs []int  `json:"pcrs" yaml:"pcrs,flow"`
+}
+
+// capsPCRBanks is the TPM2_CAP_PCRS capability.
+type capsPCRBanks []capsPCRBank
+
+// capsProperties is the TPM2_CAP_TPM_PROPERTIES capability. The fixed and
+// variable properties are keyed by property name, and their values are
+// strings for properties which contain characters or algorithms, lists of
+// names for bit fields, and integers otherwise.
+type capsProperties struct {
+	Manufacturer    string                 `json:"manufacturer" yaml:"manufacturer"`
+	VendorString    string                 `json:"vendor_string" yaml:"vendor_string"`
+	FirmwareVersion string                 `json:"firmware_version" yaml:"firmware_version"`
+	Fixed           map[string]interface{} `json:"fixed" yaml:"fixed"`
+	Variable        map[string]interface{} `json:"variable" yaml:"variable"`
+	props           []tpmProperty
+}
+
+// capsPCRProperty is a PCR property and the PCRs which have it.
+type capsPCRProperty struct {
+	Property string `json:"property" yaml:"property"`
+	PCRs     []int  `json:"pcrs" yaml:"pcrs,flow"`
+}
+
+// capsPCRProperties is the TPM2_CAP_PCR_PROPERTIES capability.
+type capsPCRProperties []capsPCRProperty
+
+// capsCurves is the TPM2_CAP_ECC_CURVES capability.
+type capsCurves []string
+
+// capsAuthPolicy is the authorization policy of a permanent handle.
+type capsAuthPolicy struct {
+	Handle  string `json:"handle" yaml:"handle"`
+	HashAlg string `json:"hash_alg" yaml:"hash_alg"`
+	Digest  string `json:"digest" yaml:"digest"`
+}
+
+// capsAuthPolicies is the TPM2_CAP_AUTH_POLICIES capability. It is nil if
+// the TPM does not support the capability.
+type capsAuthPolicies []capsAuthPolicy
+
 // outputCaps outputs selected TPM capabilities.
 func outputCaps() error {
+	switch *fCapsFormat {
+	case textFormat, jsonFormat, yamlFormat:
+	default:
+		return fmt.Errorf("unsupported output format: %s", *fCapsFormat)
+	}
+
+	if *fCapsDetails && !*fCapsHandles && !*fCapsAll {
+		return fmt.Errorf("-%s must be provided with -%s or -%s", detailsFlagName, handlesFlagName, allFlagName)
+	}
+
 	t, err := getTPM(*fCapsTPM)
 	if err != nil {
 		return err
 	}
 	defer t.Close()
 
+	var doc = make(map[string]capsCategory)
+
 	for _, c := range []struct {
 		process bool
-		id      pgtpm.Capability
-		cmdFunc func(io.ReadWriteCloser) error
+		key     string
+		name    string
+		getFunc func(io.ReadWriter) (capsCategory, error)
 	}{
-		{*fCapsAlgs, pgtpm.TPM2_CAP_ALGS, outputCapsAlgorithms},
-		{*fCapsHandles, pgtpm.TPM2_CAP_HANDLES, outputCapsHandles},
+		{*fCapsAlgs, algsFlagName, pgtpm.TPM2_CAP_ALGS.String(), getCapsAlgorithms},
+		{*fCapsHandles, handlesFlagName, pgtpm.TPM2_CAP_HANDLES.String(), getCapsHandles},
+		{*fCapsCommands, commandsFlagName, pgtpm.TPM2_CAP_COMMANDS.String(), getCapsCommands},
+		{*fCapsPPCommands, ppCommandsFlagName, pgtpm.TPM2_CAP_PP_COMMANDS.String(), getCapsPPCommands},
+		{*fCapsAuditCommands, auditCommandsFlagName, pgtpm.TPM2_CAP_AUDIT_COMMANDS.String(), getCapsAuditCommands},
+		{*fCapsPCRs, pcrsFlagName, pgtpm.TPM2_CAP_PCRS.String(), getCapsPCRs},
+		{*fCapsProperties, propertiesFlagName, pgtpm.TPM2_CAP_TPM_PROPERTIES.String(), getCapsProperties},
+		{*fCapsPCRProperties, pcrPropertiesFlagName, pgtpm.TPM2_CAP_PCR_PROPERTIES.String(), getCapsPCRProperties},
+		{*fCapsCurves, curvesFlagName, pgtpm.TPM2_CAP_ECC_CURVES.String(), getCapsCurves},
+		{*fCapsAuthPolicies, authPoliciesFlagName, "TPM2_CAP_AUTH_POLICIES", getCapsAuthPolicies},
 	} {
-		if c.process || *fCapsAll {
-			fmt.Printf("%s:\n", c.id.String())
-			if err := c.cmdFunc(t); err != nil {
-				return err
-			}
+		if !c.process && !*fCapsAll {
+			continue
+		}
+
+		cat, err := c.getFunc(t)
+		if err != nil {
+			return err
+		}
+
+		if *fCapsFormat == textFormat {
+			fmt.Printf("%s:\n", c.name)
+			cat.outputText()
 			fmt.Println()
 		}
+
+		doc[c.key] = cat
+	}
+
+	switch *fCapsFormat {
+	case jsonFormat:
+		data, err := json.MarshalIndent(doc, "", "    ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal capabilities: %v", err)
+		}
+
+		fmt.Printf("%s\n", data)
+
+	case yamlFormat:
+		data, err := yaml.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("failed to marshal capabilities: %v", err)
+		}
+
+		fmt.Printf("%s", data)
 	}
 
 	return nil
 }
 
-// outputCapsAlgorithms outputs the algorithms supported by the TPM.
-func outputCapsAlgorithms(t io.ReadWriteCloser) error {
+// getCapsAlgorithms gets the algorithms supported by the TPM.
+func getCapsAlgorithms(t io.ReadWriter) (capsCategory, error) {
+	var algs = capsAlgorithms{}
 	var vals []interface{}
 	var more = true
 	var err error
@@ -53,14 +309,14 @@ func outputCapsAlgorithms(t io.ReadWriteCloser) error {
 	for more {
 		vals, more, err = tpm2.GetCapability(t, tpm2.CapabilityAlgs, capRequestSize, next)
 		if err != nil {
-			return fmt.Errorf("failed to get algorithms: %v", err)
+			return nil, fmt.Errorf("failed to get algorithms: %v", err)
 		}
 
 		for _, val := range vals {
 			ad := val.(tpm2.AlgorithmDescription)
 			next = uint32(pgtpm.Algorithm(ad.ID) + 1)
 
-			var props []string
+			var props = []string{}
 			for _, p := range []pgtpm.AlgorithmAttribute{
 				pgtpm.TPMA_ALGORITHM_ASYMMETRIC,
 				pgtpm.TPMA_ALGORITHM_SYMMETRIC,
@@ -75,15 +331,28 @@ func outputCapsAlgorithms(t io.ReadWriteCloser) error {
 				}
 			}
 
-			fmt.Printf("  %-*s %s\n", 24, pgtpm.Algorithm(ad.ID).String(), strings.Join(props, " | "))
+			algs = append(algs, capsAlgorithm{
+				Algorithm:  pgtpm.Algorithm(ad.ID).String(),
+				ID:         uint16(ad.ID),
+				Attributes: props,
+			})
 		}
 	}
 
-	return nil
+	return algs, nil
+}
+
+// outputText outputs the algorithms as text.
+func (c capsAlgorithms) outputText() {
+	for _, a := range c {
+		fmt.Printf("  %-*s %s\n", 24, a.Algorithm, strings.Join(a.Attributes, " | "))
+	}
 }
 
-// outputCapsHandles outputs the handles currently active in the TPM.
-func outputCapsHandles(t io.ReadWriteCloser) error {
+// getCapsHandles gets the handles currently active in the TPM.
+func getCapsHandles(t io.ReadWriter) (capsCategory, error) {
+	var handles = capsHandles{}
+
 	for _, ht := range []pgtpm.HandleType{
 		pgtpm.TPM2_HT_PCR,
 		pgtpm.TPM2_HT_NV_INDEX,
@@ -93,23 +362,734 @@ func outputCapsHandles(t io.ReadWriteCloser) error {
 		pgtpm.TPM2_HT_TRANSIENT,
 		pgtpm.TPM2_HT_PERSISTENT,
 	} {
-		var vals []interface{}
-		var more = true
-		var err error
-		var next = uint32(ht.First())
+		hs, err := activeHandles(t, ht)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, h := range hs {
+			c := capsHandle{
+				Handle: fmt.Sprintf("0x%08X", h),
+				Type:   ht.String(),
+			}
+
+			if *fCapsDetails {
+				c.Details, err = handleDetails(t, h, ht)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			handles = append(handles, c)
+		}
+	}
+
+	return handles, nil
+}
+
+// outputText outputs the handles as text.
+func (c capsHandles) outputText() {
+	for _, h := range c {
+		fmt.Printf("  %s  %s\n", h.Handle, h.Type)
+
+		if d := h.Details; d != nil {
+			const fw = 12
+
+			var size string
+			if d.Size != nil {
+				size = fmt.Sprintf("%d", *d.Size)
+			}
+
+			for _, f := range []struct {
+				label string
+				value string
+			}{
+				{"Entity", d.Entity},
+				{"Session", d.Session},
+				{"Key type", d.KeyType},
+				{"NV type", d.NVType},
+				{"Size", size},
+				{"Attributes", strings.Join(d.Attributes, " | ")},
+				{"Name", d.Name},
+			} {
+				if f.value != "" {
+					fmt.Printf("      %-*s: %s\n", fw, f.label, f.value)
+				}
+			}
+		}
+	}
+}
+
+// handleDetails returns details of the entity referenced by a handle in the
+// range of the specified handle type, or nil if there are no details to
+// report.
+func handleDetails(rw io.ReadWriter, h tpmutil.Handle, ht pgtpm.HandleType) (*capsHandleDetails, error) {
+	switch ht {
+	case pgtpm.TPM2_HT_TRANSIENT, pgtpm.TPM2_HT_PERSISTENT:
+		pub, name, _, err := tpm2.ReadPublic(rw, h)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public area: %v", err)
+		}
+
+		var attrs = []string{}
+		for _, a := range objectAttributes {
+			if pgtpm.ObjectAttribute(pub.Attributes)&a != 0 {
+				attrs = append(attrs, strings.TrimPrefix(a.String(), "TPMA_OBJECT_"))
+			}
+		}
+
+		return &capsHandleDetails{
+			KeyType:    pgtpm.Algorithm(pub.Type).String(),
+			Attributes: attrs,
+			Name:       hexEncodeBytes(name),
+		}, nil
+
+	case pgtpm.TPM2_HT_NV_INDEX:
+		pub, err := tpm2.NVReadPublic(rw, h)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read NV public area: %v", err)
+		}
+
+		name, err := nvPublicName(pub)
+		if err != nil {
+			return nil, err
+		}
+
+		var attrs = []string{}
+		for _, a := range nvAttributes {
+			if tpm2.NVAttr(pub.Attributes)&a.attr != 0 {
+				attrs = append(attrs, a.name)
+			}
+		}
+
+		nvType, ok := nvTypes[(uint32(pub.Attributes)>>nvTypeShift)&nvTypeMask]
+		if !ok {
+			nvType = "unknown"
+		}
+
+		size := pub.DataSize
 
-		for more {
-			vals, more, err = tpm2.GetCapability(t, tpm2.CapabilityHandles, capRequestSize, next)
+		return &capsHandleDetails{
+			NVType:     nvType,
+			Size:       &size,
+			Attributes: attrs,
+			Name:       hexEncodeBytes(name),
+		}, nil
+
+	case pgtpm.TPM2_HT_HMAC_SESSION:
+		session := "loaded"
+		switch pgtpm.Handle(h).HandleType() {
+		case pgtpm.TPM2_HT_HMAC_SESSION:
+			session = "loaded HMAC session"
+		case pgtpm.TPM2_HT_POLICY_SESSION:
+			session = "loaded policy session"
+		}
+
+		return &capsHandleDetails{Session: session}, nil
+
+	case pgtpm.TPM2_HT_POLICY_SESSION:
+		return &capsHandleDetails{Session: "saved session"}, nil
+
+	case pgtpm.TPM2_HT_PERMANENT:
+		if s, ok := permanentHandleNames[pgtpm.Handle(h)]; ok {
+			return &capsHandleDetails{Entity: s}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// getCapsCommands gets the commands supported by the TPM, and their
+// attributes.
+func getCapsCommands(t io.ReadWriter) (capsCategory, error) {
+	attrs, err := commandAttributes(t)
+	if err != nil {
+		return nil, err
+	}
+
+	var ccs = capsCommands{}
+	for _, a := range attrs {
+		cc := pgtpm.Command(a & (ccIndexMask | ccVendor))
+
+		var props = []string{}
+		for _, p := range []struct {
+			mask uint32
+			name string
+		}{
+			{ccNV, "NV"},
+			{ccExtensive, "EXTENSIVE"},
+			{ccFlushed, "FLUSHED"},
+			{ccRHandle, "RHANDLE"},
+			{ccVendor, "VENDOR"},
+		} {
+			if a&p.mask != 0 {
+				props = append(props, p.name)
+			}
+		}
+
+		ccs = append(ccs, capsCommandAttributes{
+			Command:    commandName(cc),
+			Code:       uint32(cc),
+			Attributes: props,
+			CHandles:   int((a >> ccCHandlesShift) & ccCHandlesMask),
+		})
+	}
+
+	return ccs, nil
+}
+
+// outputText outputs the commands as text.
+func (c capsCommands) outputText() {
+	for _, cc := range c {
+		props := cc.Attributes
+		if cc.CHandles != 0 {
+			props = append(props[:len(props):len(props)], fmt.Sprintf("CHANDLES=%d", cc.CHandles))
+		}
+
+		fmt.Println(strings.TrimRight(fmt.Sprintf("  %-*s %s", 36, cc.Command, strings.Join(props, " | ")), " "))
+	}
+}
+
+// getCapsPPCommands gets the commands which require physical presence for
+// platform authorization.
+func getCapsPPCommands(t io.ReadWriter) (capsCategory, error) {
+	ccs, err := capabilityCommands(t, pgtpm.TPM2_CAP_PP_COMMANDS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get physical presence commands: %v", err)
+	}
+
+	return newCapsCommandCodes(ccs), nil
+}
+
+// getCapsAuditCommands gets the commands which are audited by the TPM.
+func getCapsAuditCommands(t io.ReadWriter) (capsCategory, error) {
+	ccs, err := auditedCommands(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCapsCommandCodes(ccs), nil
+}
+
+// newCapsCommandCodes returns a command code list capability containing the
+// specified commands.
+func newCapsCommandCodes(ccs []pgtpm.Command) capsCommandCodes {
+	var codes = capsCommandCodes{}
+	for _, cc := range ccs {
+		codes = append(codes, capsCommandCode{Command: commandName(cc), Code: uint32(cc)})
+	}
+
+	return codes
+}
+
+// outputText outputs the command codes as text.
+func (c capsCommandCodes) outputText() {
+	for _, cc := range c {
+		fmt.Printf("  %s\n", cc.Command)
+	}
+}
+
+// getCapsPCRs gets the current PCR bank allocation.
+func getCapsPCRs(t io.ReadWriter) (capsCategory, error) {
+	return allocatedPCRs(t)
+}
+
+// outputText outputs the PCR bank allocation as text.
+func (c capsPCRBanks) outputText() {
+	for _, b := range c {
+		fmt.Printf("  %-*s %s\n", 24, b.Hash, formatPCRs(b.PCRs))
+	}
+}
+
+// getCapsProperties gets the fixed and variable TPM properties.
+func getCapsProperties(t io.ReadWriter) (capsCategory, error) {
+	props, err := tpmProperties(t)
+	if err != nil {
+		return nil, err
+	}
+
+	var c = &capsProperties{
+		VendorString: vendorString(props),
+		Fixed:        make(map[string]interface{}),
+		Variable:     make(map[string]interface{}),
+		props:        props,
+	}
+
+	var fw1, fw2 uint32
+	for _, p := range props {
+		switch p.Property {
+		case ptManufacturer:
+			c.Manufacturer = manufacturerName(p.Value)
+
+		case ptFirmwareVersion1:
+			fw1 = p.Value
+
+		case ptFirmwareVersion2:
+			fw2 = p.Value
+		}
+
+		if p.Property < ptVar {
+			c.Fixed[propertyName(p.Property)] = propertyValue(p.Property, p.Value)
+		} else {
+			c.Variable[propertyName(p.Property)] = propertyValue(p.Property, p.Value)
+		}
+	}
+	c.FirmwareVersion = firmwareVersion(fw1, fw2)
+
+	return c, nil
+}
+
+// outputText outputs the TPM properties as text.
+func (c *capsProperties) outputText() {
+	for _, p := range c.props {
+		fmt.Printf("  %-*s %s\n", 28, propertyName(p.Property), formatProperty(p.Property, p.Value))
+
+		switch p.Property {
+		case ptFirmwareVersion2:
+			fmt.Printf("  %-*s %s\n", 28, "(firmware version)", c.FirmwareVersion)
+
+		case ptVendorString4:
+			fmt.Printf("  %-*s %q\n", 28, "(vendor string)", c.VendorString)
+		}
+	}
+}
+
+// getCapsPCRProperties gets the PCRs associated with each PCR property.
+func getCapsPCRProperties(t io.ReadWriter) (capsCategory, error) {
+	var props = capsPCRProperties{}
+	var next uint32
+
+	for {
+		more, buf, err := getCapability(t, pgtpm.TPM2_CAP_PCR_PROPERTIES, next, capRequestSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get PCR properties: %v", err)
+		}
+
+		var count uint32
+		if err := tpmutil.UnpackBuf(buf, &count); err != nil {
+			return nil, fmt.Errorf("failed to decode PCR properties: %v", err)
+		}
+
+		for i := uint32(0); i < count; i++ {
+			var tag uint32
+			if err := tpmutil.UnpackBuf(buf, &tag); err != nil {
+				return nil, fmt.Errorf("failed to decode PCR properties: %v", err)
+			}
+
+			sel, err := unpackPCRSelect(buf)
 			if err != nil {
-				return fmt.Errorf("failed to get handles: %v", err)
+				return nil, fmt.Errorf("failed to decode PCR properties: %v", err)
 			}
 
-			for _, val := range vals {
-				fmt.Printf("  0x%08X  %s\n", val.(tpmutil.Handle), ht.String())
-				next = uint32(val.(tpmutil.Handle)) + 1
+			name, ok := pcrPropertyNames[tag]
+			if !ok {
+				name = fmt.Sprintf("0x%08x", tag)
 			}
+
+			props = append(props, capsPCRProperty{Property: name, PCRs: selectedPCRs(sel)})
+			next = tag + 1
+		}
+
+		if !more || count == 0 {
+			return props, nil
 		}
 	}
+}
 
-	return nil
+// outputText outputs the PCR properties as text.
+func (c capsPCRProperties) outputText() {
+	for _, p := range c {
+		fmt.Printf("  %-*s %s\n", 28, p.Property, formatPCRs(p.PCRs))
+	}
+}
+
+// getCapsCurves gets the elliptic curves supported by the TPM.
+func getCapsCurves(t io.ReadWriter) (capsCategory, error) {
+	var curves = capsCurves{}
+	var next uint32
+
+	for {
+		more, buf, err := getCapability(t, pgtpm.TPM2_CAP_ECC_CURVES, next, capRequestSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get elliptic curves: %v", err)
+		}
+
+		var count uint32
+		if err := tpmutil.UnpackBuf(buf, &count); err != nil {
+			return nil, fmt.Errorf("failed to decode elliptic curves: %v", err)
+		}
+
+		for i := uint32(0); i < count; i++ {
+			var curve uint16
+			if err := tpmutil.UnpackBuf(buf, &curve); err != nil {
+				return nil, fmt.Errorf("failed to decode elliptic curves: %v", err)
+			}
+
+			curves = append(curves, pgtpm.EllipticCurve(curve).String())
+			next = uint32(curve) + 1
+		}
+
+		if !more || count == 0 {
+			return curves, nil
+		}
+	}
+}
+
+// outputText outputs the elliptic curves as text.
+func (c capsCurves) outputText() {
+	for _, curve := range c {
+		fmt.Printf("  %s\n", curve)
+	}
+}
+
+// getCapsAuthPolicies gets the authorization policies of the permanent
+// handles. TPMs implementing versions of the specification earlier than 1.38
+// do not support this capability.
+func getCapsAuthPolicies(t io.ReadWriter) (capsCategory, error) {
+	var policies = capsAuthPolicies{}
+	var next uint32 = firstPermanentHandle
+
+	for {
+		more, buf, err := getCapability(t, capAuthPolicies, next, capRequestSize)
+		if err != nil {
+			var perr tpm2.ParameterError
+			if errors.As(err, &perr) && perr.Code == tpm2.RCValue {
+				return capsAuthPolicies(nil), nil
+			}
+
+			return nil, fmt.Errorf("failed to get authorization policies: %v", err)
+		}
+
+		var count uint32
+		if err := tpmutil.UnpackBuf(buf, &count); err != nil {
+			return nil, fmt.Errorf("failed to decode authorization policies: %v", err)
+		}
+
+		for i := uint32(0); i < count; i++ {
+			var handle uint32
+			var alg tpm2.Algorithm
+			if err := tpmutil.UnpackBuf(buf, &handle, &alg); err != nil {
+				return nil, fmt.Errorf("failed to decode authorization policies: %v", err)
+			}
+
+			var digest []byte
+			if !alg.IsNull() {
+				h, err := alg.Hash()
+				if err != nil {
+					return nil, fmt.Errorf("failed to decode authorization policies: %v", err)
+				}
+
+				digest = make([]byte, h.Size())
+				if _, err := io.ReadFull(buf, digest); err != nil {
+					return nil, fmt.Errorf("failed to decode authorization policies: %v", err)
+				}
+			}
+
+			policies = append(policies, capsAuthPolicy{
+				Handle:  fmt.Sprintf("0x%08X", handle),
+				HashAlg: pgtpm.Algorithm(alg).String(),
+				Digest:  hexEncodeBytes(digest),
+			})
+			next = handle + 1
+		}
+
+		if !more || count == 0 {
+			return policies, nil
+		}
+	}
+}
+
+// outputText outputs the authorization policies as text.
+func (c capsAuthPolicies) outputText() {
+	if c == nil {
+		fmt.Println("  not supported by TPM")
+		return
+	}
+
+	for _, p := range c {
+		fmt.Println(strings.TrimRight(fmt.Sprintf("  %s  %-*s %s", p.Handle, 16, p.HashAlg, p.Digest), " "))
+	}
+}
+
+// getCapability runs TPM2_GetCapability, and returns whether more values
+// are available, and a buffer containing the undecoded capability data which
+// follows the capability selector.
+func getCapability(rw io.ReadWriter, capability pgtpm.Capability, property, count uint32) (bool, *bytes.Buffer, error) {
+	resp, err := runCommand(rw, pgtpm.TPM2_CC_GetCapability, uint32(capability), property, count)
+	if err != nil {
+		return false, nil, err
+	}
+
+	buf := bytes.NewBuffer(resp)
+
+	var more uint8
+	var got uint32
+	if err := tpmutil.UnpackBuf(buf, &more, &got); err != nil {
+		return false, nil, fmt.Errorf("failed to decode capability data: %v", err)
+	}
+
+	if pgtpm.Capability(got) != capability {
+		return false, nil, fmt.Errorf("unexpected capability in response: 0x%x", got)
+	}
+
+	return more != 0, buf, nil
+}
+
+// activeHandles returns the active handles in the range of the specified
+// handle type. In the session ranges, the TPM reports loaded sessions in the
+// TPM2_HT_HMAC_SESSION range and saved sessions in the TPM2_HT_POLICY_SESSION
+// range, regardless of the type of session.
+func activeHandles(rw io.ReadWriter, ht pgtpm.HandleType) ([]tpmutil.Handle, error) {
+	var handles []tpmutil.Handle
+	var vals []interface{}
+	var more = true
+	var err error
+	var next = uint32(ht.First())
+
+	for more {
+		vals, more, err = tpm2.GetCapability(rw, tpm2.CapabilityHandles, capRequestSize, next)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get handles: %v", err)
+		}
+
+		for _, val := range vals {
+			h := val.(tpmutil.Handle)
+			handles = append(handles, h)
+			next = uint32(h) + 1
+		}
+	}
+
+	return handles, nil
+}
+
+// allocatedPCRs returns the current PCR bank allocation.
+func allocatedPCRs(rw io.ReadWriter) (capsPCRBanks, error) {
+	_, buf, err := getCapability(rw, pgtpm.TPM2_CAP_PCRS, 0, capRequestSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get PCR allocation: %v", err)
+	}
+
+	var count uint32
+	if err := tpmutil.UnpackBuf(buf, &count); err != nil {
+		return nil, fmt.Errorf("failed to decode PCR allocation: %v", err)
+	}
+
+	var banks = capsPCRBanks{}
+	for i := uint32(0); i < count; i++ {
+		var alg uint16
+		if err := tpmutil.UnpackBuf(buf, &alg); err != nil {
+			return nil, fmt.Errorf("failed to decode PCR allocation: %v", err)
+		}
+
+		sel, err := unpackPCRSelect(buf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode PCR allocation: %v", err)
+		}
+
+		banks = append(banks, capsPCRBank{
+			Hash: pgtpm.Algorithm(alg).String(),
+			PCRs: selectedPCRs(sel),
+		})
+	}
+
+	return banks, nil
+}
+
+// capabilityCommands returns the command codes in a TPML_CC command code
+// list capability, such as TPM2_CAP_PP_COMMANDS or TPM2_CAP_AUDIT_COMMANDS.
+func capabilityCommands(rw io.ReadWriter, capability pgtpm.Capability) ([]pgtpm.Command, error) {
+	var ccs []pgtpm.Command
+	var next uint32
+
+	for {
+		more, buf, err := getCapability(rw, capability, next, capCommandListSize)
+		if err != nil {
+			return nil, err
+		}
+
+		var count uint32
+		if err := tpmutil.UnpackBuf(buf, &count); err != nil {
+			return nil, err
+		}
+
+		for i := uint32(0); i < count; i++ {
+			var cc uint32
+			if err := tpmutil.UnpackBuf(buf, &cc); err != nil {
+				return nil, err
+			}
+
+			ccs = append(ccs, pgtpm.Command(cc))
+			next = cc + 1
+		}
+
+		if !more || count == 0 {
+			return ccs, nil
+		}
+	}
+}
+
+// commandAttributes returns the TPMA_CC attributes of each command supported
+// by the TPM.
+func commandAttributes(rw io.ReadWriter) ([]uint32, error) {
+	var attrs []uint32
+	var next uint32
+
+	for {
+		more, buf, err := getCapability(rw, pgtpm.TPM2_CAP_COMMANDS, next, capRequestSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get commands: %v", err)
+		}
+
+		var count uint32
+		if err := tpmutil.UnpackBuf(buf, &count); err != nil {
+			return nil, fmt.Errorf("failed to decode commands: %v", err)
+		}
+
+		for i := uint32(0); i < count; i++ {
+			var a uint32
+			if err := tpmutil.UnpackBuf(buf, &a); err != nil {
+				return nil, fmt.Errorf("failed to decode commands: %v", err)
+			}
+
+			attrs = append(attrs, a)
+			next = (a & (ccIndexMask | ccVendor)) + 1
+		}
+
+		if !more || count == 0 {
+			return attrs, nil
+		}
+	}
+}
+
+// tpmProperty is a TPM property tag and its value.
+type tpmProperty struct {
+	Property uint32
+	Value    uint32
+}
+
+// tpmProperties returns the fixed and variable TPM properties.
+func tpmProperties(rw io.ReadWriter) ([]tpmProperty, error) {
+	var props []tpmProperty
+
+	for _, group := range []uint32{ptFixed, ptVar} {
+		var next = group
+		var done bool
+
+		for !done && next < group+ptGroupSize {
+			more, buf, err := getCapability(rw, pgtpm.TPM2_CAP_TPM_PROPERTIES, next, capRequestSize)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get TPM properties: %v", err)
+			}
+
+			var count uint32
+			if err := tpmutil.UnpackBuf(buf, &count); err != nil {
+				return nil, fmt.Errorf("failed to decode TPM properties: %v", err)
+			}
+
+			// The TPM may continue into the next group in the same
+			// response, which ends this group.
+			for i := uint32(0); i < count; i++ {
+				var p tpmProperty
+				if err := tpmutil.UnpackBuf(buf, &p.Property, &p.Value); err != nil {
+					return nil, fmt.Errorf("failed to decode TPM properties: %v", err)
+				}
+
+				if p.Property >= group+ptGroupSize {
+					done = true
+					break
+				}
+
+				props = append(props, p)
+				next = p.Property + 1
+			}
+
+			if !more || count == 0 {
+				done = true
+			}
+		}
+	}
+
+	return props, nil
+}
+
+// vendorString returns the concatenation of the TPM2_PT_VENDOR_STRING
+// properties.
+func vendorString(props []tpmProperty) string {
+	var s string
+	for _, p := range props {
+		switch p.Property {
+		case ptVendorString1, ptVendorString2, ptVendorString3, ptVendorString4:
+			v := p.Value
+			s += strings.TrimRight(string([]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}), "\x00")
+		}
+	}
+
+	return strings.TrimSpace(s)
+}
+
+// commandName returns the name of a command code, or its value in
+// hexadecimal if it is not known, as with vendor-specific commands.
+func commandName(cc pgtpm.Command) string {
+	if _, err := cc.MarshalJSON(); err != nil {
+		return fmt.Sprintf("0x%08x", uint32(cc))
+	}
+
+	return cc.String()
+}
+
+// unpackPCRSelect unpacks a PCR selection bitmap, preceded by its size in
+// octets.
+func unpackPCRSelect(buf *bytes.Buffer) ([]byte, error) {
+	var size uint8
+	if err := tpmutil.UnpackBuf(buf, &size); err != nil {
+		return nil, err
+	}
+
+	sel := make([]byte, size)
+	if _, err := io.ReadFull(buf, sel); err != nil {
+		return nil, err
+	}
+
+	return sel, nil
+}
+
+// selectedPCRs returns the indices of the PCRs selected in a PCR selection
+// bitmap.
+func selectedPCRs(sel []byte) []int {
+	var pcrs = []int{}
+	for i, b := range sel {
+		for j := 0; j < 8; j++ {
+			if b&(1<<uint(j)) != 0 {
+				pcrs = append(pcrs, i*8+j)
+			}
+		}
+	}
+
+	return pcrs
+}
+
+// formatPCRs formats a sorted list of PCR indices, collapsing runs of
+// consecutive PCRs into ranges.
+func formatPCRs(pcrs []int) string {
+	if len(pcrs) == 0 {
+		return "none"
+	}
+
+	var parts []string
+	for i := 0; i < len(pcrs); {
+		j := i
+		for j+1 < len(pcrs) && pcrs[j+1] == pcrs[j]+1 {
+			j++
+		}
+
+		if i == j {
+			parts = append(parts, fmt.Sprintf("%d", pcrs[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", pcrs[i], pcrs[j]))
+		}
+
+		i = j + 1
+	}
+
+	return strings.Join(parts, ", ")
 }
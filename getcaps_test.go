@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// fakePropertiesTPM answers TPM2_GetCapability requests for TPM properties
+// with up to perResponse properties from props, which do not stop at the end
+// of a property group.
+type fakePropertiesTPM struct {
+	props       []tpmProperty
+	perResponse int
+	requests    int
+	resp        []byte
+}
+
+// Write accepts a command and prepares its response.
+func (f *fakePropertiesTPM) Write(b []byte) (int, error) {
+	f.requests++
+	if f.requests > 10 {
+		return 0, errors.New("too many requests")
+	}
+
+	var tag tpmutil.Tag
+	var size uint32
+	var cc tpmutil.Command
+	var capability, property, count uint32
+	if _, err := tpmutil.Unpack(b, &tag, &size, &cc, &capability, &property, &count); err != nil {
+		return 0, err
+	}
+
+	if pgtpm.Command(cc) != pgtpm.TPM2_CC_GetCapability || pgtpm.Capability(capability) != pgtpm.TPM2_CAP_TPM_PROPERTIES {
+		return 0, errors.New("unexpected command")
+	}
+
+	var found []tpmProperty
+	for _, p := range f.props {
+		if p.Property >= property && len(found) < f.perResponse {
+			found = append(found, p)
+		}
+	}
+
+	more := uint8(0)
+	if len(found) > 0 && found[len(found)-1] != f.props[len(f.props)-1] {
+		more = 1
+	}
+
+	body, err := tpmutil.Pack(more, capability, uint32(len(found)))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, p := range found {
+		b, err := tpmutil.Pack(p.Property, p.Value)
+		if err != nil {
+			return 0, err
+		}
+		body = append(body, b...)
+	}
+
+	header, err := tpmutil.Pack(tpm2.TagNoSessions, uint32(10+len(body)), uint32(tpmutil.RCSuccess))
+	if err != nil {
+		return 0, err
+	}
+	f.resp = append(header, body...)
+
+	return len(b), nil
+}
+
+// Read returns the response to the last command.
+func (f *fakePropertiesTPM) Read(b []byte) (int, error) {
+	return copy(b, f.resp), nil
+}
+
+func TestTPMPropertiesGroupBoundary(t *testing.T) {
+	t.Parallel()
+
+	want := []tpmProperty{
+		{Property: ptFixed, Value: 1},
+		{Property: ptFixed + 1, Value: 2},
+		{Property: ptVar, Value: 3},
+		{Property: ptVar + 1, Value: 4},
+		{Property: ptVar + 2, Value: 5},
+		{Property: ptVar + 3, Value: 6},
+	}
+
+	// The response to the second request for the fixed group contains only
+	// properties of the variable group, and indicates that more are
+	// available.
+	rw := &fakePropertiesTPM{props: want, perResponse: 3}
+
+	got, err := tpmProperties(rw)
+	if err != nil {
+		t.Fatalf("couldn't get TPM properties: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// A response may also start past the end of the group.
+	got, err = tpmProperties(&fakePropertiesTPM{props: want, perResponse: 1})
+	if err != nil {
+		t.Fatalf("couldn't get TPM properties one at a time: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -1,9 +1,11 @@
 module github.com/paulgriffiths/tpmtool
 
-go 1.13
+go 1.14
 
 require (
 	github.com/google/go-tpm v0.2.1-0.20191106030929-f0607eac7f8a
 	github.com/paulgriffiths/pgtpm v0.0.0-20200328215603-26ce0aab5e1e
+	golang.org/x/crypto v0.0.0-20200323165209-0ec3e9974c59
 	golang.org/x/sys v0.0.0-20200327173247-9dae0f8f5775 // indirect
+	gopkg.in/yaml.v2 v2.2.8
 )
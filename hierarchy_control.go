@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// hierarchyControl enables or disables a hierarchy.
+func hierarchyControl() (err error) {
+	err = ensureExactlyOnePassed(fHierarchyControlSet, endorsementFlagName,
+		ownerFlagName, platformFlagName, platformNVFlagName)
+	if err != nil {
+		return err
+	}
+
+	err = ensureExactlyOnePassed(fHierarchyControlSet, disableFlagName, enableFlagName)
+	if err != nil {
+		return err
+	}
+
+	var enable tpmutil.Handle
+	switch {
+	case *fHierarchyControlEndorsement:
+		enable = tpm2.HandleEndorsement
+	case *fHierarchyControlOwner:
+		enable = tpm2.HandleOwner
+	case *fHierarchyControlPlatform:
+		enable = tpm2.HandlePlatform
+	case *fHierarchyControlPlatformNV:
+		enable = tpmutil.Handle(pgtpm.TPM2_RH_PLATFORM_NV)
+	}
+
+	// The owner and endorsement hierarchies may disable themselves, but
+	// only the platform hierarchy may enable them again. The platform
+	// hierarchy authorizes all other changes.
+	authHandle := tpm2.HandlePlatform
+	if *fHierarchyControlDisable && (enable == tpm2.HandleOwner || enable == tpm2.HandleEndorsement) {
+		authHandle = enable
+	}
+
+	var state byte
+	if *fHierarchyControlEnable {
+		state = 1
+	}
+
+	auth, err := newEntityAuth(*fHierarchyControlPassword, *fHierarchyControlPolicy)
+	if err != nil {
+		return err
+	}
+
+	t, err := getTPM(*fHierarchyControlTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	params, err := tpmutil.Pack(enable, state)
+	if err != nil {
+		return err
+	}
+
+	authz, err := auth.authorize(t, pgtpm.TPM2_CC_HierarchyControl)
+	if err != nil {
+		return fmt.Errorf("failed to authorize hierarchy: %v", err)
+	}
+	defer closeAuthorization(t, authz, &err)
+
+	_, _, err = runAuthCommand(t, pgtpm.TPM2_CC_HierarchyControl,
+		[]tpmutil.Handle{authHandle}, []authorization{authz}, 0, params)
+	if err != nil {
+		return fmt.Errorf("failed to change hierarchy state: %v", err)
+	}
+
+	return nil
+}
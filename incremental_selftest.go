@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// incrementalSelfTest runs the TPM self tests of the specified algorithms,
+// and outputs the algorithms which remain to be tested.
+func incrementalSelfTest() error {
+	err := ensureAllPassed(fIncrementalSelfTestSet, algFlagName)
+	if err != nil {
+		return err
+	}
+
+	algs, err := parseAlgorithms(fIncrementalSelfTestAlgs)
+	if err != nil {
+		return err
+	}
+
+	t, err := getTPM(*fIncrementalSelfTestTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	params, err := packAlgorithmList(algs)
+	if err != nil {
+		return err
+	}
+
+	resp, err := runCommand(t, pgtpm.TPM2_CC_IncrementalSelfTest, tpmutil.RawBytes(params))
+
+	// As for a full self test, the test result tells whether a failure put
+	// the TPM into failure mode.
+	if rerr := checkTestResult(t); rerr != nil {
+		return rerr
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to run incremental self test: %v", err)
+	}
+
+	buf := bytes.NewBuffer(resp)
+
+	var count uint32
+	if err := tpmutil.UnpackBuf(buf, &count); err != nil {
+		return fmt.Errorf("failed to decode algorithms to test: %v", err)
+	}
+
+	var remaining []string
+	for i := uint32(0); i < count; i++ {
+		var alg pgtpm.Algorithm
+		if err := tpmutil.UnpackBuf(buf, &alg); err != nil {
+			return fmt.Errorf("failed to decode algorithms to test: %v", err)
+		}
+		remaining = append(remaining, alg.String())
+	}
+
+	if len(remaining) == 0 {
+		remaining = []string{"none"}
+	}
+
+	fmt.Printf("Remaining: %s\n", strings.Join(remaining, ", "))
+
+	return nil
+}
+
+// parseAlgorithms parses a list of algorithms.
+func parseAlgorithms(names []string) ([]pgtpm.Algorithm, error) {
+	var algs []pgtpm.Algorithm
+
+	for _, name := range names {
+		if name == "" {
+			return nil, errors.New("empty algorithm")
+		}
+
+		alg, err := parseAlgorithm(name)
+		if err != nil {
+			return nil, err
+		}
+
+		algs = append(algs, alg)
+	}
+
+	return algs, nil
+}
+
+// packAlgorithmList packs a TPML_ALG structure.
+func packAlgorithmList(algs []pgtpm.Algorithm) ([]byte, error) {
+	b, err := tpmutil.Pack(uint32(len(algs)))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, alg := range algs {
+		ab, err := tpmutil.Pack(uint16(alg))
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, ab...)
+	}
+
+	return b, nil
+}
+
+// parseAlgorithm parses an algorithm, either as a name with or without the
+// TPM2_ALG_ prefix, in any case, or as an integer.
+func parseAlgorithm(s string) (pgtpm.Algorithm, error) {
+	if n, err := strconv.ParseUint(s, 0, 16); err == nil {
+		return pgtpm.Algorithm(n), nil
+	}
+
+	name := strings.ToUpper(s)
+	if !strings.HasPrefix(name, "TPM2_ALG_") {
+		name = "TPM2_ALG_" + name
+	}
+
+	quoted, err := json.Marshal(name)
+	if err != nil {
+		return 0, err
+	}
+
+	var alg pgtpm.Algorithm
+	if err := json.Unmarshal(quoted, &alg); err != nil {
+		return 0, fmt.Errorf("invalid algorithm: %s", s)
+	}
+
+	return alg, nil
+}
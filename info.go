@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// Self test result codes, as returned by TPM2_GetTestResult.
+const (
+	rcFailure   tpmutil.ResponseCode = 0x00000101
+	rcNeedsTest tpmutil.ResponseCode = 0x00000153
+	rcTesting   tpmutil.ResponseCode = 0x0000090a
+)
+
+// ekCertIndices are the NV indices at which TPM manufacturers provision
+// endorsement key certificates, from the TCG EK Credential Profile.
+var ekCertIndices = []struct {
+	index tpmutil.Handle
+	desc  string
+}{
+	{0x01c00002, "RSA 2048"},
+	{0x01c0000a, "ECC NIST P256"},
+	{0x01c00012, "RSA 2048 (high range)"},
+	{0x01c00014, "ECC NIST P256 (high range)"},
+	{0x01c00016, "ECC NIST P384 (high range)"},
+	{0x01c00018, "ECC NIST P521 (high range)"},
+	{0x01c0001a, "ECC SM2 P256 (high range)"},
+	{0x01c0001c, "RSA 3072 (high range)"},
+	{0x01c0001e, "RSA 4096 (high range)"},
+}
+
+// outputInfo outputs a summary of the identity, health and provisioning
+// state of the TPM. An error is returned if the TPM is in failure mode or in
+// dictionary attack lockout, after the summary has been output.
+func outputInfo() error {
+	t, err := getTPM(*fInfoTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	_, result, err := getTestResult(t)
+	if err != nil {
+		return err
+	}
+
+	// A TPM in failure mode reports only a limited set of properties, so
+	// output whatever it will report before failing.
+	props, err := tpmProperties(t)
+	if err != nil && result != rcFailure {
+		return err
+	}
+
+	values := make(map[uint32]uint32)
+	for _, p := range props {
+		values[p.Property] = p.Value
+	}
+
+	const fw = 22
+
+	if v, ok := values[ptManufacturer]; ok {
+		fmt.Printf("%-*s: %s (%s)\n", fw, "Manufacturer", propertyString(v), manufacturerName(v))
+	}
+	if s := vendorString(props); s != "" {
+		fmt.Printf("%-*s: %s\n", fw, "Vendor string", s)
+	}
+	if _, ok := values[ptFirmwareVersion1]; ok {
+		fmt.Printf("%-*s: %s\n", fw, "Firmware version",
+			firmwareVersion(values[ptFirmwareVersion1], values[ptFirmwareVersion2]))
+	}
+	if v, ok := values[ptFamilyIndicator]; ok {
+		fmt.Printf("%-*s: %s, level %d, revision %s\n", fw, "Specification", propertyString(v),
+			values[ptLevel], formatProperty(ptRevision, values[ptRevision]))
+	}
+	if v, ok := values[ptYear]; ok {
+		fmt.Printf("%-*s: day %d of %d\n", fw, "Specification date", values[ptDayOfYear], v)
+	}
+
+	permanent := values[ptPermanent]
+	inLockout := permanent&permInLockout != 0
+
+	var status string
+	switch {
+	case result != tpmutil.RCSuccess:
+		status = testResultString(result)
+	case inLockout:
+		status = "lockout"
+	default:
+		status = "ok"
+	}
+	fmt.Printf("%-*s: %s\n", fw, "Status", status)
+
+	if result == rcFailure {
+		return &exitError{err: errors.New("TPM is in failure mode"), code: exitTPMFailure}
+	}
+
+	fmt.Printf("%-*s: %s\n", fw, "Owner auth", authSetString(permanent&permOwnerAuthSet != 0))
+	fmt.Printf("%-*s: %s\n", fw, "Endorsement auth", authSetString(permanent&permEndorsementAuthSet != 0))
+	fmt.Printf("%-*s: %s\n", fw, "Lockout auth", authSetString(permanent&permLockoutAuthSet != 0))
+	fmt.Printf("%-*s: %s\n", fw, "Clear disabled", yesNoString(permanent&permDisableClear != 0))
+
+	var enabled []string
+	for _, h := range []struct {
+		mask uint32
+		name string
+	}{
+		{startupPHEnable, "platform"},
+		{startupSHEnable, "storage"},
+		{startupEHEnable, "endorsement"},
+	} {
+		if values[ptStartupClear]&h.mask != 0 {
+			enabled = append(enabled, h.name)
+		}
+	}
+	if len(enabled) == 0 {
+		enabled = []string{"none"}
+	}
+	fmt.Printf("%-*s: %s\n", fw, "Hierarchies enabled", strings.Join(enabled, ", "))
+
+	fmt.Printf("%-*s: %s\n", fw, "In lockout", yesNoString(inLockout))
+	fmt.Printf("%-*s: %d of %d\n", fw, "Auth failures", values[ptLockoutCounter], values[ptMaxAuthFail])
+	fmt.Printf("%-*s: %d seconds\n", fw, "Lockout interval", values[ptLockoutInterval])
+	fmt.Printf("%-*s: %d seconds\n", fw, "Lockout recovery", values[ptLockoutRecovery])
+
+	banks, err := allocatedPCRs(t)
+	if err != nil {
+		return err
+	}
+
+	var label = "PCR banks"
+	for _, b := range banks {
+		if len(b.PCRs) > 0 {
+			fmt.Printf("%-*s: %s (%s)\n", fw, label, b.Hash, formatPCRs(b.PCRs))
+			label = ""
+		}
+	}
+	if label != "" {
+		fmt.Printf("%-*s: none\n", fw, label)
+	}
+
+	// The TPM does not report its free NV memory directly, only estimates of
+	// how many more persistent objects and NV counters it could store.
+	fmt.Printf("%-*s: %d of %d\n", fw, "Persistent handles", values[ptHRPersistent],
+		values[ptHRPersistent]+values[ptHRPersistentAvail])
+	fmt.Printf("%-*s: %d\n", fw, "NV indices", values[ptHRNVIndex])
+	fmt.Printf("%-*s: %d of %d\n", fw, "NV counters", values[ptNVCounters],
+		values[ptNVCounters]+values[ptNVCountersAvail])
+	fmt.Printf("%-*s: %d persistent objects, %d NV counters\n", fw, "NV space available",
+		values[ptHRPersistentAvail], values[ptNVCountersAvail])
+
+	indices, err := activeHandles(t, pgtpm.TPM2_HT_NV_INDEX)
+	if err != nil {
+		return err
+	}
+
+	defined := make(map[tpmutil.Handle]bool)
+	for _, h := range indices {
+		defined[h] = true
+	}
+
+	label = "EK certificates"
+	for _, c := range ekCertIndices {
+		if !defined[c.index] {
+			continue
+		}
+
+		pub, err := tpm2.NVReadPublic(t, c.index)
+		if err != nil {
+			return fmt.Errorf("failed to read NV index public area: %v", err)
+		}
+
+		fmt.Printf("%-*s: 0x%08X %s, %d bytes\n", fw, label, uint32(c.index), c.desc, pub.DataSize)
+		label = ""
+	}
+	if label != "" {
+		fmt.Printf("%-*s: none\n", fw, label)
+	}
+
+	if inLockout {
+		return errors.New("TPM is in dictionary attack lockout")
+	}
+
+	return nil
+}
+
+// getTestResult runs TPM2_GetTestResult, and returns the manufacturer-specific
+// test data and the test result.
+func getTestResult(rw io.ReadWriter) ([]byte, tpmutil.ResponseCode, error) {
+	resp, err := runCommand(rw, pgtpm.TPM2_CC_GetTestResult)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get self test result: %v", err)
+	}
+
+	var data tpmutil.U16Bytes
+	var result uint32
+	if _, err := tpmutil.Unpack(resp, &data, &result); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode self test result: %v", err)
+	}
+
+	return []byte(data), tpmutil.ResponseCode(result), nil
+}
+
+// authSetString returns a description of whether an authorization value is
+// set.
+func authSetString(set bool) string {
+	if set {
+		return "set"
+	}
+
+	return "not set"
+}
+
+// yesNoString returns "yes" or "no".
+func yesNoString(b bool) string {
+	if b {
+		return "yes"
+	}
+
+	return "no"
+}
@@ -1,21 +1,61 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 )
 
+// Exit status codes. Commands which check the health of the TPM return an
+// exitError to select one of the more specific codes.
+const (
+	exitFailure      = 1
+	exitTestsPending = 3
+	exitTPMFailure   = 4
+)
+
+// exitError is an error which causes the application to exit with a
+// specific status code, so that scripts can distinguish between failures.
+type exitError struct {
+	err  error
+	code int
+}
+
+// Error returns the message of the underlying error.
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
 func main() {
 	log.SetPrefix(fmt.Sprintf("%s: ", appName))
 	log.SetFlags(0)
 
+	// Parse global options, and remove them from the arguments so that
+	// commands find their own options in the usual place.
+	fGlobalSet.Parse(os.Args[1:])
+	os.Args = append(os.Args[:1], fGlobalSet.Args()...)
+
 	if len(os.Args) < 2 {
 		usageError()
 	}
 
+	switch *fGlobalSession {
+	case "", hmacSessionMode, saltedSessionMode:
+	default:
+		log.Fatalf("invalid session mode: %s", *fGlobalSession)
+	}
+
 	for _, cmd := range commands {
 		if os.Args[1] == cmd.name {
+			if *fGlobalSession != "" && !cmd.sessions {
+				log.Fatalf("-%s is not supported by the %s command", sessionFlagName, cmd.name)
+			}
+
+			if *fGlobalAudit != "" && !cmd.sessions {
+				log.Fatalf("-%s is not supported by the %s command", auditFlagName, cmd.name)
+			}
+
 			if cmd.flagSet != nil {
 				cmd.flagSet.Parse(os.Args[2:])
 			}
@@ -24,7 +64,14 @@ func main() {
 				cmd.usageFunc()
 			} else {
 				if err := cmd.cmdFunc(); err != nil {
-					log.Fatalf("%v", err)
+					log.Printf("%v", err)
+
+					code := exitFailure
+					var e *exitError
+					if errors.As(err, &e) {
+						code = e.code
+					}
+					os.Exit(code)
 				}
 			}
 
@@ -6,13 +6,16 @@ import (
 	"os"
 
 	"github.com/google/go-tpm/tpm2"
-	"github.com/google/go-tpm/tpmutil"
 )
 
 // makeCred makes an activation credential.
-func makeCred() error {
-	err := ensureAllPassed(fMakeCredSet, handleFlagName, publicAreaFlagName,
-		credOutFlagName, secretOutFlagName)
+func makeCred() (err error) {
+	err = ensureAllPassed(fMakeCredSet, publicAreaFlagName, credOutFlagName, secretOutFlagName)
+	if err != nil {
+		return err
+	}
+
+	err = ensureExactlyOnePassed(fMakeCredSet, contextFlagName, handleFlagName)
 	if err != nil {
 		return err
 	}
@@ -72,8 +75,13 @@ func makeCred() error {
 	}
 	defer t.Close()
 
-	credBlob, secret, err := tpm2.MakeCredential(t,
-		tpmutil.Handle(fMakeCredHandle), cred, nameBytes)
+	handle, release, err := contextHandle(t, fMakeCredHandle, *fMakeCredContext)
+	if err != nil {
+		return err
+	}
+	defer release(&err)
+
+	credBlob, secret, err := tpm2.MakeCredential(t, handle, cred, nameBytes)
 	if err != nil {
 		return fmt.Errorf("failed to make credential: %v", err)
 	}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/google/go-tpm/tpm2"
 	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
 )
 
 // nvRead reads the value from an NV Index.
@@ -15,13 +19,18 @@ func nvRead() error {
 		return err
 	}
 
+	auth, err := newEntityAuth(*fNVReadPassword, *fNVReadPolicy)
+	if err != nil {
+		return err
+	}
+
 	t, err := getTPM(*fNVReadTPM)
 	if err != nil {
 		return err
 	}
 	defer t.Close()
 
-	data, err := tpm2.NVReadEx(t, tpmutil.Handle(fNVReadHandle), tpm2.HandleOwner, *fNVReadPassword, 0)
+	data, err := nvReadWithAuth(t, tpmutil.Handle(fNVReadHandle), auth)
 	if err != nil {
 		return fmt.Errorf("failed to read from NV index: %v", err)
 	}
@@ -41,3 +50,83 @@ func nvRead() error {
 
 	return nil
 }
+
+// nvReadWithAuth reads the entire value of an NV index. A password
+// authorizes the read as the owner, while a policy authorizes it as the index
+// itself. Since a policy session authorizes only a single command, each block
+// is read with a new authorization.
+func nvReadWithAuth(rw io.ReadWriter, index tpmutil.Handle, auth entityAuth) ([]byte, error) {
+	authHandle := tpm2.HandleOwner
+	if auth.policy != nil {
+		authHandle = index
+	}
+
+	props, _, err := tpm2.GetCapability(rw, tpm2.CapabilityTPMProperties, 1, uint32(tpm2.NVMaxBufferSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get maximum NV buffer size: %v", err)
+	}
+
+	if len(props) != 1 {
+		return nil, errors.New("failed to get maximum NV buffer size")
+	}
+
+	prop, ok := props[0].(tpm2.TaggedProperty)
+	if !ok || prop.Value == 0 {
+		return nil, errors.New("failed to get maximum NV buffer size")
+	}
+	blockSize := int(prop.Value)
+
+	pub, err := tpm2.NVReadPublic(rw, index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read NV public area: %v", err)
+	}
+
+	data := make([]byte, 0, int(pub.DataSize))
+	for len(data) < int(pub.DataSize) {
+		size := blockSize
+		if size > int(pub.DataSize)-len(data) {
+			size = int(pub.DataSize) - len(data)
+		}
+
+		block, err := nvReadBlock(rw, authHandle, index, auth, uint16(len(data)), uint16(size))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(block) == 0 {
+			return nil, fmt.Errorf("TPM returned no NV data at offset %d", len(data))
+		}
+
+		data = append(data, block...)
+	}
+
+	return data, nil
+}
+
+// nvReadBlock reads a block of data from an NV index.
+func nvReadBlock(rw io.ReadWriter, authHandle, index tpmutil.Handle, auth entityAuth,
+	offset, size uint16) (data []byte, err error) {
+	authz, err := auth.authorize(rw, pgtpm.TPM2_CC_NV_Read)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAuthorization(rw, authz, &err)
+
+	params, err := tpmutil.Pack(size, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	_, resp, err := runAuthCommand(rw, pgtpm.TPM2_CC_NV_Read,
+		[]tpmutil.Handle{authHandle, index}, []authorization{authz}, 0, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var block tpmutil.U16Bytes
+	if _, err := tpmutil.Unpack(resp, &block); err != nil {
+		return nil, fmt.Errorf("failed to decode NV data: %v", err)
+	}
+
+	return block, nil
+}
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// policy is a declarative description of a TPM authorization policy.
+type policy struct {
+	NameAlg    pgtpm.Algorithm   `json:"name_alg"`
+	Assertions []policyAssertion `json:"assertions"`
+
+	// dir is the directory containing the policy file, against which
+	// relative paths within the policy are resolved.
+	dir string
+}
+
+// policyAssertion is a single assertion in a policy. Which fields are
+// relevant depends on the assertion's command.
+type policyAssertion struct {
+	Command     pgtpm.Command       `json:"command"`
+	Handle      *policyHandle       `json:"handle,omitempty"`
+	Name        hexBytes            `json:"name,omitempty"`
+	PublicKey   string              `json:"public_key,omitempty"`
+	PrivateKey  string              `json:"private_key,omitempty"`
+	PolicyRef   hexBytes            `json:"policy_ref,omitempty"`
+	PCRs        []pcrSelection      `json:"pcrs,omitempty"`
+	PCRValues   []hexBytes          `json:"pcr_values,omitempty"`
+	PCRDigest   hexBytes            `json:"pcr_digest,omitempty"`
+	CommandCode *pgtpm.Command      `json:"command_code,omitempty"`
+	OperandB    hexBytes            `json:"operand_b,omitempty"`
+	Offset      uint16              `json:"offset,omitempty"`
+	Operation   *eaOperation        `json:"operation,omitempty"`
+	Branches    [][]policyAssertion `json:"branches,omitempty"`
+	Approved    []approvedPolicy    `json:"approved_policies,omitempty"`
+}
+
+// pcrSelection is a selection of PCRs from a single bank.
+type pcrSelection struct {
+	Hash pgtpm.Algorithm `json:"hash"`
+	PCRs []int           `json:"pcrs"`
+}
+
+// policyHandle is a TPM handle which is JSON-encoded as a hexadecimal string.
+type policyHandle tpmutil.Handle
+
+// hexBytes is a slice of bytes which is JSON-encoded as a hexadecimal string.
+type hexBytes []byte
+
+// eaOperation is an arithmetic or bitwise comparison operation used by
+// PolicyNV and PolicyCounterTimer.
+type eaOperation uint16
+
+// Comparison operations.
+const (
+	eoEQ         eaOperation = 0x0000
+	eoNEQ        eaOperation = 0x0001
+	eoSignedGT   eaOperation = 0x0002
+	eoUnsignedGT eaOperation = 0x0003
+	eoSignedLT   eaOperation = 0x0004
+	eoUnsignedLT eaOperation = 0x0005
+	eoSignedGE   eaOperation = 0x0006
+	eoUnsignedGE eaOperation = 0x0007
+	eoSignedLE   eaOperation = 0x0008
+	eoUnsignedLE eaOperation = 0x0009
+	eoBitSet     eaOperation = 0x000a
+	eoBitClear   eaOperation = 0x000b
+)
+
+// eaOperationNames maps comparison operations to their names.
+var eaOperationNames = map[eaOperation]string{
+	eoEQ:         "TPM2_EO_EQ",
+	eoNEQ:        "TPM2_EO_NEQ",
+	eoSignedGT:   "TPM2_EO_SIGNED_GT",
+	eoUnsignedGT: "TPM2_EO_UNSIGNED_GT",
+	eoSignedLT:   "TPM2_EO_SIGNED_LT",
+	eoUnsignedLT: "TPM2_EO_UNSIGNED_LT",
+	eoSignedGE:   "TPM2_EO_SIGNED_GE",
+	eoUnsignedGE: "TPM2_EO_UNSIGNED_GE",
+	eoSignedLE:   "TPM2_EO_SIGNED_LE",
+	eoUnsignedLE: "TPM2_EO_UNSIGNED_LE",
+	eoBitSet:     "TPM2_EO_BITSET",
+	eoBitClear:   "TPM2_EO_BITCLEAR",
+}
+
+// policyCommands are the policy subcommands.
+var policyCommands = []command{
+	{
+		name:      policyComputeCommand,
+		flagSet:   fPolicyComputeSet,
+		cmdFunc:   policyCompute,
+		usageFunc: usagePolicyCompute,
+	},
+	{
+		name:      policySignCommand,
+		flagSet:   fPolicySignSet,
+		cmdFunc:   policySign,
+		usageFunc: usagePolicySign,
+	},
+	{
+		name:      policyTrialCommand,
+		flagSet:   fPolicyTrialSet,
+		cmdFunc:   policyTrial,
+		usageFunc: usagePolicyTrial,
+	},
+}
+
+// policyCmd dispatches a policy subcommand.
+func policyCmd() error {
+	if len(os.Args) < 3 {
+		usagePolicy()
+		os.Exit(1)
+	}
+
+	switch os.Args[2] {
+	case helpCommand, "-" + helpFlagName, "--" + helpFlagName:
+		usagePolicy()
+		return nil
+	}
+
+	for _, cmd := range policyCommands {
+		if os.Args[2] == cmd.name {
+			cmd.flagSet.Parse(os.Args[3:])
+
+			if isFlagPassed(cmd.flagSet, helpFlagName) {
+				cmd.usageFunc()
+				return nil
+			}
+
+			return cmd.cmdFunc()
+		}
+	}
+
+	return fmt.Errorf("unknown %s command: %s", policyCommand, os.Args[2])
+}
+
+// loadPolicy reads and parses a policy file.
+func loadPolicy(name string) (*policy, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %v", err)
+	}
+
+	var p policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal policy: %v", err)
+	}
+
+	if p.NameAlg == 0 {
+		p.NameAlg = pgtpm.TPM2_ALG_SHA256
+	}
+
+	if len(p.Assertions) == 0 {
+		return nil, errors.New("policy contains no assertions")
+	}
+
+	p.dir = filepath.Dir(name)
+
+	return &p, nil
+}
+
+// hash returns the hash function for the policy's name algorithm.
+func (p *policy) hash() (crypto.Hash, error) {
+	h, err := tpm2.Algorithm(p.NameAlg).Hash()
+	if err != nil {
+		return 0, fmt.Errorf("unsupported policy name algorithm: %v", p.NameAlg)
+	}
+
+	return h, nil
+}
+
+// path resolves a path relative to the directory containing the policy file.
+func (p *policy) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+
+	return filepath.Join(p.dir, name)
+}
+
+// MarshalJSON returns the JSON-encoding of a value.
+func (h policyHandle) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("0x%08x", uint32(h)))
+}
+
+// UnmarshalJSON parses a JSON-encoded value and stores the result in the
+// object. The value may be a number or a string.
+func (h *policyHandle) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		s = string(b)
+	}
+
+	v, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return fmt.Errorf("invalid handle value: %s", s)
+	}
+
+	*h = policyHandle(v)
+
+	return nil
+}
+
+// MarshalJSON returns the JSON-encoding of a value.
+func (b hexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(b))
+}
+
+// UnmarshalJSON parses a JSON-encoded value and stores the result in the
+// object.
+func (b *hexBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	v, err := hex.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("invalid hex value: %s", s)
+	}
+
+	*b = v
+
+	return nil
+}
+
+// String returns a string representation of a value.
+func (o eaOperation) String() string {
+	s, ok := eaOperationNames[o]
+	if !ok {
+		return "UNKNOWN OPERATION VALUE"
+	}
+
+	return s
+}
+
+// MarshalJSON returns the JSON-encoding of a value.
+func (o eaOperation) MarshalJSON() ([]byte, error) {
+	s, ok := eaOperationNames[o]
+	if !ok {
+		return nil, fmt.Errorf("invalid operation value: %d", o)
+	}
+
+	return json.Marshal(s)
+}
+
+// UnmarshalJSON parses a JSON-encoded value and stores the result in the
+// object.
+func (o *eaOperation) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	for k, v := range eaOperationNames {
+		if v == s {
+			*o = k
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid operation value: %s", s)
+}
+
+// encodePCRSelections returns the TPML_PCR_SELECTION encoding of a list of
+// PCR selections.
+func encodePCRSelections(sels []pcrSelection) ([]byte, error) {
+	data, err := tpmutil.Pack(uint32(len(sels)))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sel := range sels {
+		size := 3
+		for _, pcr := range sel.PCRs {
+			if pcr < 0 || pcr > 255 {
+				return nil, fmt.Errorf("invalid PCR index: %d", pcr)
+			}
+
+			if pcr/8+1 > size {
+				size = pcr/8 + 1
+			}
+		}
+
+		bitmap := make([]byte, size)
+		for _, pcr := range sel.PCRs {
+			bitmap[pcr/8] |= 1 << uint(pcr%8)
+		}
+
+		b, err := tpmutil.Pack(uint16(sel.Hash), uint8(size))
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, b...)
+		data = append(data, bitmap...)
+	}
+
+	return data, nil
+}
+
+// sortedPCRs returns the indices of the selected PCRs in ascending order,
+// which is the order in which the TPM reads their values, without
+// duplicates.
+func (s pcrSelection) sortedPCRs() []int {
+	var seen [256]bool
+	for _, pcr := range s.PCRs {
+		if pcr >= 0 && pcr < len(seen) {
+			seen[pcr] = true
+		}
+	}
+
+	var pcrs []int
+	for i := range seen {
+		if seen[i] {
+			pcrs = append(pcrs, i)
+		}
+	}
+
+	return pcrs
+}
+
+// externalKeyPublic returns the public area with which a public key, such as
+// a policy signing key, is loaded into the TPM. The name of this public area
+// is the name used in PolicySigned and PolicyAuthorize assertions.
+func externalKeyPublic(key crypto.PublicKey, nameAlg tpm2.Algorithm) (tpm2.Public, error) {
+	pub := tpm2.Public{
+		NameAlg:    nameAlg,
+		Attributes: tpm2.FlagSign | tpm2.FlagUserWithAuth,
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		pub.Type = tpm2.AlgRSA
+		pub.RSAParameters = &tpm2.RSAParams{
+			KeyBits:    uint16(k.N.BitLen()),
+			ModulusRaw: k.N.Bytes(),
+		}
+
+		// An exponent of zero denotes the default exponent of 65537.
+		if k.E != 65537 {
+			pub.RSAParameters.ExponentRaw = uint32(k.E)
+		}
+
+	case *ecdsa.PublicKey:
+		var curve tpm2.EllipticCurve
+		switch k.Curve {
+		case elliptic.P224():
+			curve = tpm2.CurveNISTP224
+
+		case elliptic.P256():
+			curve = tpm2.CurveNISTP256
+
+		case elliptic.P384():
+			curve = tpm2.CurveNISTP384
+
+		case elliptic.P521():
+			curve = tpm2.CurveNISTP521
+
+		default:
+			return tpm2.Public{}, fmt.Errorf("unsupported elliptic curve: %s", k.Curve.Params().Name)
+		}
+
+		size := (k.Curve.Params().BitSize + 7) / 8
+
+		pub.Type = tpm2.AlgECC
+		pub.ECCParameters = &tpm2.ECCParams{
+			CurveID: curve,
+			Point: tpm2.ECPoint{
+				XRaw: bigIntToFixedSizeBytes(k.X, size),
+				YRaw: bigIntToFixedSizeBytes(k.Y, size),
+			},
+		}
+
+	default:
+		return tpm2.Public{}, fmt.Errorf("unsupported public key type: %T", key)
+	}
+
+	return pub, nil
+}
+
+// readPublicKeyFile reads a PEM-encoded public key, or the public key from a
+// PEM-encoded certificate or private key, from the named file.
+func readPublicKeyFile(name string) (crypto.PublicKey, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %v", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", name)
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %v", err)
+		}
+
+		return cert.PublicKey, nil
+
+	case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY":
+		key, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, err
+		}
+
+		return key.Public(), nil
+	}
+
+	return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+}
+
+// parsePrivateKey parses a PEM-encoded PKCS#8, PKCS#1 or SEC 1 private key.
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	var key interface{}
+	var err error
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type: %T", key)
+	}
+
+	return signer, nil
+}
+
+// keyName returns the name of the key for a PolicySigned or PolicyAuthorize
+// assertion, either as specified directly or computed from its public key.
+func (p *policy) keyName(a *policyAssertion) ([]byte, error) {
+	if len(a.Name) > 0 {
+		return a.Name, nil
+	}
+
+	var key crypto.PublicKey
+	var err error
+
+	switch {
+	case a.PublicKey != "":
+		key, err = readPublicKeyFile(p.path(a.PublicKey))
+
+	case a.PrivateKey != "":
+		key, err = readPublicKeyFile(p.path(a.PrivateKey))
+
+	default:
+		return nil, errors.New("name, public_key or private_key must be specified")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := externalKeyPublic(key, tpm2.Algorithm(p.NameAlg))
+	if err != nil {
+		return nil, err
+	}
+
+	return publicName(pub)
+}
+
+// publicName returns the name of a public area.
+func publicName(pub tpm2.Public) ([]byte, error) {
+	name, err := pub.Name()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute name: %v", err)
+	}
+
+	data, err := name.Encode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode name: %v", err)
+	}
+
+	// Strip the size prefix.
+	return data[2:], nil
+}
+
+// entityName returns the name of the entity for a PolicySecret or PolicyNV
+// assertion. The names of permanent handles and PCRs are their handles, and
+// must otherwise be specified.
+func entityName(a *policyAssertion) ([]byte, error) {
+	if len(a.Name) > 0 {
+		return a.Name, nil
+	}
+
+	if a.Handle != nil {
+		switch pgtpm.Handle(*a.Handle).HandleType() {
+		case pgtpm.TPM2_HT_PERMANENT, pgtpm.TPM2_HT_PCR:
+			return tpmutil.Pack(tpmutil.Handle(*a.Handle))
+		}
+	}
+
+	return nil, errors.New("name must be specified, unless handle is a permanent handle")
+}
+
+// assertionName returns a short name for an assertion for use in messages.
+func assertionName(a *policyAssertion) string {
+	return strings.TrimPrefix(a.Command.String(), "TPM2_CC_")
+}
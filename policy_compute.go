@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+)
+
+// policyCompute computes a policy digest in software.
+func policyCompute() error {
+	err := ensureAllPassed(fPolicyComputeSet, inFlagName)
+	if err != nil {
+		return err
+	}
+
+	p, err := loadPolicy(*fPolicyComputeIn)
+	if err != nil {
+		return err
+	}
+
+	digest, err := p.digest()
+	if err != nil {
+		return err
+	}
+
+	return outputDigest(digest, *fPolicyComputeFormat, *fPolicyComputeOut)
+}
+
+// outputDigest writes a digest to the named file, or outputs it in the
+// specified format if no file is named.
+func outputDigest(digest []byte, format, out string) error {
+	if out != "" {
+		if err := ioutil.WriteFile(out, digest, 0644); err != nil {
+			return fmt.Errorf("failed to write output file: %v", err)
+		}
+
+		return nil
+	}
+
+	switch format {
+	case "", hexFormat:
+		fmt.Println(hex.EncodeToString(digest))
+
+	case base64Format:
+		fmt.Println(base64.StdEncoding.EncodeToString(digest))
+
+	default:
+		return fmt.Errorf("unsupported output format: %s", format)
+	}
+
+	return nil
+}
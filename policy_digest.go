@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// Limits on the number of branches in a PolicyOR assertion.
+const (
+	minPolicyORBranches = 2
+	maxPolicyORBranches = 8
+)
+
+// digest computes the policy digest in software.
+func (p *policy) digest() ([]byte, error) {
+	h, err := p.hash()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.digestFrom(make([]byte, h.Size()), p.Assertions)
+}
+
+// digestFrom computes the policy digest resulting from applying a sequence of
+// assertions to an initial digest.
+func (p *policy) digestFrom(digest []byte, assertions []policyAssertion) ([]byte, error) {
+	var err error
+
+	for i := range assertions {
+		digest, err = p.update(digest, &assertions[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", assertionName(&assertions[i]), err)
+		}
+	}
+
+	return digest, nil
+}
+
+// update computes the policy digest resulting from applying an assertion to
+// the current digest, per TPM 2.0 Part 3.
+func (p *policy) update(digest []byte, a *policyAssertion) ([]byte, error) {
+	h, err := p.hash()
+	if err != nil {
+		return nil, err
+	}
+
+	switch a.Command {
+	case pgtpm.TPM2_CC_PolicySecret:
+		name, err := entityName(a)
+		if err != nil {
+			return nil, err
+		}
+
+		return policyUpdate(h, digest, a.Command, name, a.PolicyRef)
+
+	case pgtpm.TPM2_CC_PolicySigned:
+		name, err := p.keyName(a)
+		if err != nil {
+			return nil, err
+		}
+
+		return policyUpdate(h, digest, a.Command, name, a.PolicyRef)
+
+	case pgtpm.TPM2_CC_PolicyAuthorize:
+		name, err := p.keyName(a)
+		if err != nil {
+			return nil, err
+		}
+
+		// The policy digest is reset before being updated, since the
+		// approved policy replaces everything which preceded it.
+		return policyUpdate(h, make([]byte, h.Size()), a.Command, name, a.PolicyRef)
+
+	case pgtpm.TPM2_CC_PolicyPCR:
+		pcrDigest, err := p.pcrDigest(a)
+		if err != nil {
+			return nil, err
+		}
+
+		sels, err := encodePCRSelections(a.PCRs)
+		if err != nil {
+			return nil, err
+		}
+
+		return extendDigest(h, digest, a.Command, sels, pcrDigest)
+
+	case pgtpm.TPM2_CC_PolicyCommandCode:
+		if a.CommandCode == nil {
+			return nil, errors.New("command_code must be specified")
+		}
+
+		cc, err := tpmutil.Pack(uint32(*a.CommandCode))
+		if err != nil {
+			return nil, err
+		}
+
+		return extendDigest(h, digest, a.Command, cc)
+
+	case pgtpm.TPM2_CC_PolicyOR:
+		digests, err := p.branchDigests(digest, a)
+		if err != nil {
+			return nil, err
+		}
+
+		return extendDigest(h, make([]byte, h.Size()), a.Command, digests...)
+
+	case pgtpm.TPM2_CC_PolicyAuthValue:
+		return extendDigest(h, digest, a.Command)
+
+	case pgtpm.TPM2_CC_PolicyPassword:
+		// PolicyPassword updates the digest exactly as PolicyAuthValue does,
+		// with only the session's behavior differing.
+		return extendDigest(h, digest, pgtpm.TPM2_CC_PolicyAuthValue)
+
+	case pgtpm.TPM2_CC_PolicyNV:
+		name, err := entityName(a)
+		if err != nil {
+			return nil, err
+		}
+
+		args, err := operandArgs(h, a)
+		if err != nil {
+			return nil, err
+		}
+
+		return extendDigest(h, digest, a.Command, args, name)
+
+	case pgtpm.TPM2_CC_PolicyCounterTimer:
+		args, err := operandArgs(h, a)
+		if err != nil {
+			return nil, err
+		}
+
+		return extendDigest(h, digest, a.Command, args)
+	}
+
+	return nil, errors.New("unsupported assertion")
+}
+
+// branchDigests returns the digests of each branch of a PolicyOR assertion,
+// each computed by applying the branch's assertions to the current digest.
+func (p *policy) branchDigests(digest []byte, a *policyAssertion) ([][]byte, error) {
+	if len(a.Branches) < minPolicyORBranches || len(a.Branches) > maxPolicyORBranches {
+		return nil, fmt.Errorf("between %d and %d branches must be specified",
+			minPolicyORBranches, maxPolicyORBranches)
+	}
+
+	var digests [][]byte
+	for i, branch := range a.Branches {
+		d, err := p.digestFrom(digest, branch)
+		if err != nil {
+			return nil, fmt.Errorf("branch %d: %v", i, err)
+		}
+
+		digests = append(digests, d)
+	}
+
+	return digests, nil
+}
+
+// pcrDigest returns the digest of the PCR values for a PolicyPCR assertion,
+// either as specified directly or computed from the specified values.
+func (p *policy) pcrDigest(a *policyAssertion) ([]byte, error) {
+	if len(a.PCRs) == 0 {
+		return nil, errors.New("pcrs must be specified")
+	}
+
+	if len(a.PCRDigest) > 0 {
+		return a.PCRDigest, nil
+	}
+
+	var count int
+	for _, sel := range a.PCRs {
+		count += len(sel.sortedPCRs())
+	}
+
+	if len(a.PCRValues) != count {
+		return nil, fmt.Errorf("pcr_digest or %d pcr_values must be specified", count)
+	}
+
+	var values [][]byte
+	for _, v := range a.PCRValues {
+		values = append(values, v)
+	}
+
+	h, err := p.hash()
+	if err != nil {
+		return nil, err
+	}
+
+	return hashConcat(h, values...), nil
+}
+
+// operandArgs returns the digest of the operand, offset and operation for a
+// PolicyNV or PolicyCounterTimer assertion.
+func operandArgs(h crypto.Hash, a *policyAssertion) ([]byte, error) {
+	if a.Operation == nil {
+		return nil, errors.New("operation must be specified")
+	}
+
+	b, err := tpmutil.Pack(a.Offset, uint16(*a.Operation))
+	if err != nil {
+		return nil, err
+	}
+
+	return hashConcat(h, a.OperandB, b), nil
+}
+
+// extendDigest returns H(digest || commandCode || args...).
+func extendDigest(h crypto.Hash, digest []byte, cc pgtpm.Command, args ...[]byte) ([]byte, error) {
+	b, err := tpmutil.Pack(uint32(cc))
+	if err != nil {
+		return nil, err
+	}
+
+	return hashConcat(h, append([][]byte{digest, b}, args...)...), nil
+}
+
+// policyUpdate implements the PolicyUpdate function from TPM 2.0 Part 3,
+// returning H(H(digest || commandCode || name) || policyRef).
+func policyUpdate(h crypto.Hash, digest []byte, cc pgtpm.Command, name, policyRef []byte) ([]byte, error) {
+	d, err := extendDigest(h, digest, cc, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return hashConcat(h, d, policyRef), nil
+}
+
+// hashConcat returns the digest of the concatenation of the provided values.
+func hashConcat(h crypto.Hash, values ...[]byte) []byte {
+	hh := h.New()
+	for _, v := range values {
+		hh.Write(v)
+	}
+
+	return hh.Sum(nil)
+}
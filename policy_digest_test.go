@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+	"github.com/paulgriffiths/tpmtool/tpmkey"
+)
+
+// Known SHA256 policy digests.
+const (
+	// policyAuthValueDigest is the digest of a policy consisting of
+	// PolicyAuthValue alone.
+	policyAuthValueDigest = "8fcd2169ab92694e0c633f1ab772842b8241bbc20288981fc7ac1eddc1fddb0e"
+
+	// policyEndorsementDigest is the digest of a policy consisting of
+	// PolicySecret with the endorsement hierarchy alone, which is the
+	// PolicyA policy of the TCG EK Credential Profile.
+	policyEndorsementDigest = "837197674484b3f81a90cc8d46a5d724fd52d76e06520b64f2a1da1b331469aa"
+)
+
+func TestPolicyDigestEK(t *testing.T) {
+	t.Parallel()
+
+	p, err := loadPolicy(filepath.Join("testdata", "ek_policy.json"))
+	if err != nil {
+		t.Fatalf("couldn't load policy: %v", err)
+	}
+
+	got, err := p.digest()
+	if err != nil {
+		t.Fatalf("couldn't compute policy digest: %v", err)
+	}
+
+	pub, err := tpmkey.LoadTemplate(filepath.Join("testdata", "rsa_ek.json"))
+	if err != nil {
+		t.Fatalf("couldn't load template: %v", err)
+	}
+
+	if !bytes.Equal(got, pub.AuthPolicy) {
+		t.Errorf("got %x, want %x", got, pub.AuthPolicy)
+	}
+
+	if want := mustDecodeHex(t, policyEndorsementDigest); !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+}
+
+func TestPolicyDigest(t *testing.T) {
+	t.Parallel()
+
+	zero := make([]byte, sha256.Size)
+	authValue := mustDecodeHex(t, policyAuthValueDigest)
+	endorsement := mustDecodeHex(t, policyEndorsementDigest)
+
+	keyName := mustDecodeHex(t, "000b"+
+		"0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	policyRef := []byte("policy reference")
+
+	var testcases = []struct {
+		name       string
+		assertions []policyAssertion
+		want       []byte
+	}{
+		{
+			name:       "PolicyAuthValue",
+			assertions: []policyAssertion{{Command: pgtpm.TPM2_CC_PolicyAuthValue}},
+			want:       authValue,
+		},
+		{
+			name:       "PolicyPassword",
+			assertions: []policyAssertion{{Command: pgtpm.TPM2_CC_PolicyPassword}},
+			want:       authValue,
+		},
+		{
+			name: "PolicyOR",
+			assertions: []policyAssertion{
+				{
+					Command: pgtpm.TPM2_CC_PolicyOR,
+					Branches: [][]policyAssertion{
+						{endorsementAssertion()},
+						{{Command: pgtpm.TPM2_CC_PolicyAuthValue}},
+					},
+				},
+			},
+			want: sha256Concat(zero, commandCode(t, pgtpm.TPM2_CC_PolicyOR), endorsement, authValue),
+		},
+		{
+			// The branches of a PolicyOR extend the preceding digest, after
+			// which the digest is reset and extended with the branch
+			// digests.
+			name: "PolicyOR/ResetThenExtend",
+			assertions: []policyAssertion{
+				{Command: pgtpm.TPM2_CC_PolicyAuthValue},
+				{
+					Command: pgtpm.TPM2_CC_PolicyOR,
+					Branches: [][]policyAssertion{
+						{endorsementAssertion()},
+						{{Command: pgtpm.TPM2_CC_PolicyPassword}},
+					},
+				},
+			},
+			want: sha256Concat(zero, commandCode(t, pgtpm.TPM2_CC_PolicyOR),
+				sha256Concat(sha256Concat(authValue, commandCode(t, pgtpm.TPM2_CC_PolicySecret),
+					mustPack(t, tpmutil.Handle(pgtpm.TPM2_RH_ENDORSEMENT)))),
+				sha256Concat(authValue, commandCode(t, pgtpm.TPM2_CC_PolicyAuthValue))),
+		},
+		{
+			name: "PolicyAuthorize",
+			assertions: []policyAssertion{
+				{Command: pgtpm.TPM2_CC_PolicyAuthorize, Name: keyName, PolicyRef: policyRef},
+			},
+			want: sha256Concat(sha256Concat(zero, commandCode(t, pgtpm.TPM2_CC_PolicyAuthorize), keyName), policyRef),
+		},
+		{
+			// PolicyAuthorize resets the digest, since the approved policy
+			// replaces the assertions which precede it.
+			name: "PolicyAuthorize/Reset",
+			assertions: []policyAssertion{
+				{Command: pgtpm.TPM2_CC_PolicyAuthValue},
+				{Command: pgtpm.TPM2_CC_PolicyAuthorize, Name: keyName},
+			},
+			want: sha256Concat(sha256Concat(zero, commandCode(t, pgtpm.TPM2_CC_PolicyAuthorize), keyName)),
+		},
+	}
+
+	for _, tc := range testcases {
+		var tc = tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := &policy{NameAlg: pgtpm.TPM2_ALG_SHA256, Assertions: tc.assertions}
+
+			got, err := p.digest()
+			if err != nil {
+				t.Fatalf("couldn't compute policy digest: %v", err)
+			}
+
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("got %x, want %x", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPolicyDigestAuthorizeKey(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "tpmtool")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "key.pem"),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatalf("failed to write public key: %v", err)
+	}
+
+	// The key name is computed from the public key of the external key
+	// which signs approved policies.
+	pub, err := externalKeyPublic(key.Public(), tpm2.AlgSHA256)
+	if err != nil {
+		t.Fatalf("couldn't get public area: %v", err)
+	}
+
+	name, err := publicName(pub)
+	if err != nil {
+		t.Fatalf("couldn't get name: %v", err)
+	}
+
+	p := &policy{
+		NameAlg:    pgtpm.TPM2_ALG_SHA256,
+		Assertions: []policyAssertion{{Command: pgtpm.TPM2_CC_PolicyAuthorize, PublicKey: "key.pem"}},
+		dir:        dir,
+	}
+
+	got, err := p.digest()
+	if err != nil {
+		t.Fatalf("couldn't compute policy digest: %v", err)
+	}
+
+	want := sha256Concat(sha256Concat(make([]byte, sha256.Size),
+		commandCode(t, pgtpm.TPM2_CC_PolicyAuthorize), name))
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+}
+
+func TestPolicyDigestFailure(t *testing.T) {
+	t.Parallel()
+
+	var testcases = []struct {
+		name       string
+		assertions []policyAssertion
+	}{
+		{
+			name: "PolicyOR/OneBranch",
+			assertions: []policyAssertion{
+				{
+					Command:  pgtpm.TPM2_CC_PolicyOR,
+					Branches: [][]policyAssertion{{{Command: pgtpm.TPM2_CC_PolicyAuthValue}}},
+				},
+			},
+		},
+		{
+			name:       "PolicyAuthorize/NoKey",
+			assertions: []policyAssertion{{Command: pgtpm.TPM2_CC_PolicyAuthorize}},
+		},
+		{
+			name:       "PolicySecret/NoName",
+			assertions: []policyAssertion{{Command: pgtpm.TPM2_CC_PolicySecret}},
+		},
+	}
+
+	for _, tc := range testcases {
+		var tc = tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := &policy{NameAlg: pgtpm.TPM2_ALG_SHA256, Assertions: tc.assertions}
+
+			if got, err := p.digest(); err == nil {
+				t.Fatalf("unexpectedly computed policy digest %x", got)
+			}
+		})
+	}
+}
+
+// endorsementAssertion returns a PolicySecret assertion for the endorsement
+// hierarchy.
+func endorsementAssertion() policyAssertion {
+	h := policyHandle(pgtpm.TPM2_RH_ENDORSEMENT)
+
+	return policyAssertion{Command: pgtpm.TPM2_CC_PolicySecret, Handle: &h}
+}
+
+// commandCode returns the big-endian encoding of a command code.
+func commandCode(t *testing.T, cc pgtpm.Command) []byte {
+	t.Helper()
+
+	return mustPack(t, uint32(cc))
+}
+
+// mustPack packs values in TPM wire format.
+func mustPack(t *testing.T, values ...interface{}) []byte {
+	t.Helper()
+
+	b, err := tpmutil.Pack(values...)
+	if err != nil {
+		t.Fatalf("failed to pack values: %v", err)
+	}
+
+	return b
+}
+
+// mustDecodeHex decodes a hexadecimal string.
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("failed to decode hex: %v", err)
+	}
+
+	return b
+}
+
+// sha256Concat returns the SHA256 digest of the concatenation of values.
+func sha256Concat(values ...[]byte) []byte {
+	h := sha256.New()
+	for _, v := range values {
+		h.Write(v)
+	}
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,913 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// verifiedTag is the TPM_ST_VERIFIED structure tag.
+const verifiedTag = 0x8022
+
+// entityAuth describes how use of an entity is authorized, either with a
+// password or by satisfying a policy.
+type entityAuth struct {
+	password string
+	policy   *policy
+}
+
+// policyExecutor runs the assertions of a policy in a policy session.
+type policyExecutor struct {
+	rw   io.ReadWriter
+	p    *policy
+	sess *session
+
+	// cc is the command which the session will authorize, or zero if not
+	// known, and is used to exclude PolicyOR branches which could never
+	// authorize it.
+	cc pgtpm.Command
+
+	// history contains a function for each assertion run so far, so that
+	// they may be replayed after the session is restarted.
+	history []func() error
+
+	// trial indicates that the session is a trial session, in which the TPM
+	// updates the policy digest without checking the assertions.
+	trial bool
+}
+
+// stdinReader reads secrets from standard input when it is not a terminal.
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// secrets caches secrets entered for each handle.
+var secrets = make(map[tpmutil.Handle]string)
+
+// newEntityAuth returns an entityAuth for a password and, if the name is not
+// empty, the named policy file.
+func newEntityAuth(password, policyFile string) (entityAuth, error) {
+	auth := entityAuth{password: password}
+
+	if policyFile != "" {
+		p, err := loadPolicy(policyFile)
+		if err != nil {
+			return entityAuth{}, err
+		}
+		auth.policy = p
+	}
+
+	return auth, nil
+}
+
+// authorize returns an authorization for a single use of the entity by the
+// specified command. If a policy is specified, a policy session is started
+// and the policy is satisfied, and the caller must close the authorization
+// after use.
+func (e entityAuth) authorize(rw io.ReadWriter, cc pgtpm.Command) (authorization, error) {
+	if e.policy == nil {
+		return authorization{password: e.password}, nil
+	}
+
+	sess, err := e.policy.execute(rw, tpm2.SessionPolicy, cc)
+	if err != nil {
+		return authorization{}, err
+	}
+
+	return authorization{session: sess, password: e.password}, nil
+}
+
+// close flushes the authorization's session, if any.
+func (a authorization) close(rw io.ReadWriter) error {
+	if a.session == nil {
+		return nil
+	}
+
+	return a.session.close(rw)
+}
+
+// execute starts a session of the specified type and runs the policy's
+// assertions in it, returning the session.
+func (p *policy) execute(rw io.ReadWriter, sessionType tpm2.SessionType, cc pgtpm.Command) (*session, error) {
+	if err := p.resolve(rw, p.Assertions); err != nil {
+		return nil, err
+	}
+
+	h, err := p.hash()
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := startSession(rw, sessionType, tpm2.Algorithm(p.NameAlg))
+	if err != nil {
+		return nil, err
+	}
+
+	e := &policyExecutor{
+		rw:    rw,
+		p:     p,
+		sess:  sess,
+		cc:    cc,
+		trial: sessionType == tpm2.SessionTrial,
+	}
+
+	if _, err := e.run(make([]byte, h.Size()), p.Assertions); err != nil {
+		sess.close(rw)
+		return nil, err
+	}
+
+	return sess, nil
+}
+
+// resolve obtains from the TPM any values omitted from the policy which are
+// needed to compute its digest, namely the current values of PCRs and the
+// names of entities.
+func (p *policy) resolve(rw io.ReadWriter, assertions []policyAssertion) error {
+	for i := range assertions {
+		a := &assertions[i]
+
+		switch a.Command {
+		case pgtpm.TPM2_CC_PolicyPCR:
+			if len(a.PCRDigest) > 0 || len(a.PCRValues) > 0 {
+				continue
+			}
+
+			for _, sel := range a.PCRs {
+				for _, pcr := range sel.sortedPCRs() {
+					v, err := tpm2.ReadPCR(rw, pcr, tpm2.Algorithm(sel.Hash))
+					if err != nil {
+						return fmt.Errorf("failed to read PCR %d: %v", pcr, err)
+					}
+
+					a.PCRValues = append(a.PCRValues, v)
+				}
+			}
+
+		case pgtpm.TPM2_CC_PolicySecret, pgtpm.TPM2_CC_PolicyNV:
+			if len(a.Name) > 0 || a.Handle == nil {
+				continue
+			}
+
+			name, err := handleName(rw, tpmutil.Handle(*a.Handle))
+			if err != nil {
+				return err
+			}
+			a.Name = name
+
+		case pgtpm.TPM2_CC_PolicyOR:
+			for _, branch := range a.Branches {
+				if err := p.resolve(rw, branch); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// run runs a sequence of assertions, given the policy digest before the first
+// of them, and returns the resulting digest.
+func (e *policyExecutor) run(digest []byte, assertions []policyAssertion) ([]byte, error) {
+	for i := range assertions {
+		a := &assertions[i]
+
+		switch a.Command {
+		case pgtpm.TPM2_CC_PolicyOR:
+			run := e.runOR
+			if e.trial {
+				run = e.runTrialOR
+			}
+
+			d, err := run(digest, a)
+			if err != nil {
+				return nil, err
+			}
+			digest = d
+
+			continue
+
+		case pgtpm.TPM2_CC_PolicyAuthorize:
+			if e.trial {
+				break
+			}
+
+			d, err := e.runAuthorize(digest, a)
+			if err != nil {
+				return nil, err
+			}
+			digest = d
+
+			continue
+		}
+
+		step := func() error { return e.assert(a) }
+		if err := step(); err != nil {
+			return nil, fmt.Errorf("%s: %v", assertionName(a), err)
+		}
+		e.history = append(e.history, step)
+
+		d, err := e.p.update(digest, a)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", assertionName(a), err)
+		}
+		digest = d
+	}
+
+	return digest, nil
+}
+
+// runOR runs the first branch of a PolicyOR assertion which can be
+// satisfied, followed by the PolicyOR itself. After each unsuccessful branch,
+// the session is restarted and the preceding assertions are replayed.
+func (e *policyExecutor) runOR(digest []byte, a *policyAssertion) ([]byte, error) {
+	digests, err := e.p.branchDigests(digest, a)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", assertionName(a), err)
+	}
+
+	step := func() error { return e.policyOR(digests) }
+
+	var failures []string
+	for i, branch := range a.Branches {
+		if !e.branchMayAuthorize(branch) {
+			failures = append(failures, fmt.Sprintf("branch %d: does not authorize %v", i, e.cc))
+			continue
+		}
+
+		mark := len(e.history)
+
+		_, err := e.run(digest, branch)
+		if err == nil {
+			err = step()
+		}
+
+		if err == nil {
+			e.history = append(e.history, step)
+
+			h, err := e.p.hash()
+			if err != nil {
+				return nil, err
+			}
+
+			return extendDigest(h, make([]byte, h.Size()), a.Command, digests...)
+		}
+
+		failures = append(failures, fmt.Sprintf("branch %d: %v", i, err))
+
+		e.history = e.history[:mark]
+		if err := e.restart(); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("%s: no branch could be satisfied (%s)",
+		assertionName(a), strings.Join(failures, "; "))
+}
+
+// runTrialOR obtains the digest of each branch of a PolicyOR assertion from
+// the TPM, restarting the session and replaying the preceding assertions after
+// each, and runs the PolicyOR with those digests. Since the TPM does not check
+// the current digest against the list in a trial session, this verifies each
+// branch without requiring that any can be satisfied.
+func (e *policyExecutor) runTrialOR(digest []byte, a *policyAssertion) ([]byte, error) {
+	result, err := e.p.update(digest, a)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", assertionName(a), err)
+	}
+
+	var digests [][]byte
+	for i, branch := range a.Branches {
+		mark := len(e.history)
+
+		if _, err := e.run(digest, branch); err != nil {
+			return nil, fmt.Errorf("%s: branch %d: %v", assertionName(a), i, err)
+		}
+
+		d, err := tpm2.PolicyGetDigest(e.rw, e.sess.handle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get policy digest: %v", err)
+		}
+		digests = append(digests, d)
+
+		e.history = e.history[:mark]
+		if err := e.restart(); err != nil {
+			return nil, err
+		}
+	}
+
+	step := func() error { return e.policyOR(digests) }
+	if err := step(); err != nil {
+		return nil, fmt.Errorf("%s: %v", assertionName(a), err)
+	}
+	e.history = append(e.history, step)
+
+	return result, nil
+}
+
+// runAuthorize runs the first of the approved policies of a PolicyAuthorize
+// assertion which can be satisfied, followed by the PolicyAuthorize itself.
+// After each unsuccessful approved policy, the session is restarted and the
+// preceding assertions are replayed.
+func (e *policyExecutor) runAuthorize(digest []byte, a *policyAssertion) ([]byte, error) {
+	if len(a.Approved) == 0 {
+		return nil, fmt.Errorf("%s: approved_policies must be specified", assertionName(a))
+	}
+
+	var failures []string
+	for i := range a.Approved {
+		mark := len(e.history)
+
+		err := e.authorizeApproved(digest, a, &a.Approved[i])
+		if err == nil {
+			d, err := e.p.update(digest, a)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", assertionName(a), err)
+			}
+
+			return d, nil
+		}
+
+		failures = append(failures, fmt.Sprintf("%s: %v", a.Approved[i].Policy, err))
+
+		e.history = e.history[:mark]
+		if err := e.restart(); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("%s: no approved policy could be satisfied (%s)",
+		assertionName(a), strings.Join(failures, "; "))
+}
+
+// authorizeApproved runs an approved policy for a PolicyAuthorize assertion,
+// verifies the signature over it with TPM2_VerifySignature, and runs
+// TPM2_PolicyAuthorize with the resulting ticket.
+func (e *policyExecutor) authorizeApproved(digest []byte, a *policyAssertion, ap *approvedPolicy) error {
+	if ap.Policy == "" || ap.SignedPolicy == "" {
+		return errors.New("policy and signed_policy must be specified")
+	}
+
+	var keyFile string
+	switch {
+	case a.PublicKey != "":
+		keyFile = a.PublicKey
+
+	case a.PrivateKey != "":
+		keyFile = a.PrivateKey
+
+	default:
+		return errors.New("public_key or private_key must be specified")
+	}
+
+	sp, err := loadSignedPolicy(e.p.path(ap.SignedPolicy))
+	if err != nil {
+		return err
+	}
+
+	// The authorizing key is loaded with the policy's name algorithm, which
+	// the TPM also uses to compute the digest which the key signed.
+	if sp.NameAlg != e.p.NameAlg {
+		return fmt.Errorf("signed policy name algorithm %v does not match policy name algorithm %v",
+			sp.NameAlg, e.p.NameAlg)
+	}
+
+	if !bytes.Equal(sp.PolicyRef, a.PolicyRef) {
+		return errors.New("signed policy_ref does not match assertion policy_ref")
+	}
+
+	approved, err := loadPolicy(e.p.path(ap.Policy))
+	if err != nil {
+		return err
+	}
+
+	if approved.NameAlg != e.p.NameAlg {
+		return fmt.Errorf("approved policy name algorithm %v does not match policy name algorithm %v",
+			approved.NameAlg, e.p.NameAlg)
+	}
+
+	if !e.branchMayAuthorize(approved.Assertions) {
+		return fmt.Errorf("does not authorize %v", e.cc)
+	}
+
+	if err := approved.resolve(e.rw, approved.Assertions); err != nil {
+		return err
+	}
+
+	// Check the approved policy against the signed digest before running
+	// it, since it would otherwise only fail at the PolicyAuthorize.
+	d, err := approved.digestFrom(digest, approved.Assertions)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(d, sp.ApprovedPolicy) {
+		return errors.New("policy digest does not match signed policy")
+	}
+
+	key, err := readPublicKeyFile(e.p.path(keyFile))
+	if err != nil {
+		return err
+	}
+
+	keyName, err := e.p.keyName(a)
+	if err != nil {
+		return err
+	}
+
+	h, err := e.p.hash()
+	if err != nil {
+		return err
+	}
+
+	ticket, err := verifySignature(e.rw, key, tpm2.Algorithm(e.p.NameAlg),
+		sp.authorizationDigest(h), sp.Signature)
+	if err != nil {
+		return err
+	}
+
+	// Run the approved policy's assertions in the same session, with paths
+	// resolved relative to the approved policy file.
+	sub := &policyExecutor{
+		rw:      e.rw,
+		p:       approved,
+		sess:    e.sess,
+		cc:      e.cc,
+		history: e.history,
+		trial:   e.trial,
+	}
+
+	if _, err := sub.run(digest, approved.Assertions); err != nil {
+		return err
+	}
+	e.history = sub.history
+
+	step := func() error {
+		_, err := runCommand(e.rw, pgtpm.TPM2_CC_PolicyAuthorize, e.sess.handle,
+			tpmutil.U16Bytes(sp.ApprovedPolicy), tpmutil.U16Bytes(sp.PolicyRef),
+			tpmutil.U16Bytes(keyName), tpmutil.RawBytes(ticket))
+
+		return err
+	}
+
+	if err := step(); err != nil {
+		return err
+	}
+	e.history = append(e.history, step)
+
+	return nil
+}
+
+// verifySignature loads a public key and verifies a TPMT_SIGNATURE over a
+// digest with TPM2_VerifySignature, returning the TPMT_TK_VERIFIED ticket.
+// The key is loaded into the owner hierarchy, since the TPM would otherwise
+// return a NULL ticket.
+func verifySignature(rw io.ReadWriter, key crypto.PublicKey, nameAlg tpm2.Algorithm,
+	digest, sig []byte) ([]byte, error) {
+	handle, _, err := loadExternalKey(rw, key, nameAlg, tpm2.HandleOwner)
+	if err != nil {
+		return nil, err
+	}
+	defer tpm2.FlushContext(rw, handle)
+
+	ticket, err := runCommand(rw, pgtpm.TPM2_CC_VerifySignature, handle,
+		tpmutil.U16Bytes(digest), tpmutil.RawBytes(sig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify signature: %v", err)
+	}
+
+	return ticket, nil
+}
+
+// branchMayAuthorize reports whether a PolicyOR branch could authorize the
+// command for which the session is being prepared, based on any
+// PolicyCommandCode assertions within it.
+func (e *policyExecutor) branchMayAuthorize(branch []policyAssertion) bool {
+	if e.cc == 0 {
+		return true
+	}
+
+	for _, a := range branch {
+		if a.Command == pgtpm.TPM2_CC_PolicyCommandCode && a.CommandCode != nil && *a.CommandCode != e.cc {
+			return false
+		}
+	}
+
+	return true
+}
+
+// restart resets the session's policy digest and replays the history.
+func (e *policyExecutor) restart() error {
+	if _, err := runCommand(e.rw, pgtpm.TPM2_CC_PolicyRestart, e.sess.handle); err != nil {
+		return fmt.Errorf("failed to restart policy session: %v", err)
+	}
+
+	e.sess.authValue = false
+	e.sess.password = false
+
+	for _, step := range e.history {
+		if err := step(); err != nil {
+			return fmt.Errorf("failed to replay policy after restart: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// assert runs a single assertion other than PolicyOR.
+func (e *policyExecutor) assert(a *policyAssertion) error {
+	rw, sess := e.rw, e.sess.handle
+
+	switch a.Command {
+	case pgtpm.TPM2_CC_PolicySecret:
+		if a.Handle == nil {
+			return errors.New("handle must be specified")
+		}
+
+		secret, err := readSecret(tpmutil.Handle(*a.Handle))
+		if err != nil {
+			return err
+		}
+
+		_, err = tpm2.PolicySecret(rw, tpmutil.Handle(*a.Handle),
+			tpm2.AuthCommand{
+				Session:    tpm2.HandlePasswordSession,
+				Attributes: tpm2.AttrContinueSession,
+				Auth:       []byte(secret),
+			},
+			sess, nil, nil, a.PolicyRef, 0)
+
+		return err
+
+	case pgtpm.TPM2_CC_PolicySigned:
+		return e.policySigned(a)
+
+	case pgtpm.TPM2_CC_PolicyAuthorize:
+		// Outside of trial sessions, PolicyAuthorize is run by runAuthorize
+		// along with its approved policies.
+		if !e.trial {
+			return errors.New("approved policies must be run")
+		}
+
+		return e.trialPolicyAuthorize(a)
+
+	case pgtpm.TPM2_CC_PolicyPCR:
+		pcrDigest, err := e.p.pcrDigest(a)
+		if err != nil {
+			return err
+		}
+
+		sels, err := encodePCRSelections(a.PCRs)
+		if err != nil {
+			return err
+		}
+
+		_, err = runCommand(rw, a.Command, sess, tpmutil.U16Bytes(pcrDigest), tpmutil.RawBytes(sels))
+
+		return err
+
+	case pgtpm.TPM2_CC_PolicyCommandCode:
+		if a.CommandCode == nil {
+			return errors.New("command_code must be specified")
+		}
+
+		_, err := runCommand(rw, a.Command, sess, uint32(*a.CommandCode))
+
+		return err
+
+	case pgtpm.TPM2_CC_PolicyAuthValue:
+		if _, err := runCommand(rw, a.Command, sess); err != nil {
+			return err
+		}
+		e.sess.authValue = true
+		e.sess.password = false
+
+		return nil
+
+	case pgtpm.TPM2_CC_PolicyPassword:
+		if _, err := runCommand(rw, a.Command, sess); err != nil {
+			return err
+		}
+		e.sess.authValue = true
+		e.sess.password = true
+
+		return nil
+
+	case pgtpm.TPM2_CC_PolicyNV:
+		if a.Handle == nil {
+			return errors.New("handle must be specified")
+		}
+
+		if a.Operation == nil {
+			return errors.New("operation must be specified")
+		}
+
+		index := tpmutil.Handle(*a.Handle)
+
+		secret, err := readSecret(index)
+		if err != nil {
+			return err
+		}
+
+		params, err := tpmutil.Pack(tpmutil.U16Bytes(a.OperandB), a.Offset, uint16(*a.Operation))
+		if err != nil {
+			return err
+		}
+
+		_, _, err = runAuthCommand(rw, a.Command, []tpmutil.Handle{index, index, sess},
+			[]authorization{{password: secret}}, 0, params)
+
+		return err
+
+	case pgtpm.TPM2_CC_PolicyCounterTimer:
+		if a.Operation == nil {
+			return errors.New("operation must be specified")
+		}
+
+		_, err := runCommand(rw, a.Command, sess, tpmutil.U16Bytes(a.OperandB), a.Offset, uint16(*a.Operation))
+
+		return err
+	}
+
+	return errors.New("unsupported assertion")
+}
+
+// policyOR runs TPM2_PolicyOR with the specified branch digests.
+func (e *policyExecutor) policyOR(digests [][]byte) error {
+	list, err := tpmutil.Pack(uint32(len(digests)))
+	if err != nil {
+		return err
+	}
+
+	for _, d := range digests {
+		b, err := tpmutil.Pack(tpmutil.U16Bytes(d))
+		if err != nil {
+			return err
+		}
+
+		list = append(list, b...)
+	}
+
+	_, err = runCommand(e.rw, pgtpm.TPM2_CC_PolicyOR, e.sess.handle, tpmutil.RawBytes(list))
+
+	return err
+}
+
+// policySigned signs the session's nonce with the assertion's private key, and
+// runs TPM2_PolicySigned with the signature. In a trial session, where the TPM
+// does not check the signature, a public key suffices and a placeholder
+// signature is used.
+func (e *policyExecutor) policySigned(a *policyAssertion) error {
+	var key crypto.Signer
+	var pub crypto.PublicKey
+	var err error
+
+	switch {
+	case a.PrivateKey != "":
+		key, err = readPrivateKeyFile(e.p.path(a.PrivateKey))
+		if err == nil {
+			pub = key.Public()
+		}
+
+	case e.trial && a.PublicKey != "":
+		pub, err = readPublicKeyFile(e.p.path(a.PublicKey))
+
+	case e.trial:
+		return errors.New("public_key or private_key must be specified")
+
+	default:
+		return errors.New("private_key must be specified")
+	}
+	if err != nil {
+		return err
+	}
+
+	h, err := e.p.hash()
+	if err != nil {
+		return err
+	}
+
+	var sig []byte
+	if key != nil {
+		// Sign the digest of nonceTPM || expiration || cpHashA || policyRef,
+		// with no expiration and no cpHashA.
+		aHash := hashConcat(h, e.sess.nonceTPM, []byte{0, 0, 0, 0}, a.PolicyRef)
+
+		sig, err = encodeSignature(key, h, aHash)
+	} else {
+		sig, err = placeholderSignature(pub, h)
+	}
+	if err != nil {
+		return err
+	}
+
+	handle, _, err := loadExternalKey(e.rw, pub, tpm2.Algorithm(e.p.NameAlg), tpm2.HandleNull)
+	if err != nil {
+		return err
+	}
+	defer tpm2.FlushContext(e.rw, handle)
+
+	_, err = runCommand(e.rw, pgtpm.TPM2_CC_PolicySigned, handle, e.sess.handle,
+		tpmutil.U16Bytes(e.sess.nonceTPM), tpmutil.U16Bytes(nil), tpmutil.U16Bytes(a.PolicyRef),
+		int32(0), tpmutil.RawBytes(sig))
+
+	return err
+}
+
+// trialPolicyAuthorize runs TPM2_PolicyAuthorize in a trial session, in which
+// the TPM does not check the ticket, so a NULL ticket is used. If a public key
+// is specified, the key's name is obtained by loading it into the TPM.
+func (e *policyExecutor) trialPolicyAuthorize(a *policyAssertion) error {
+	name := []byte(a.Name)
+
+	if len(name) == 0 {
+		var keyFile string
+		switch {
+		case a.PublicKey != "":
+			keyFile = a.PublicKey
+
+		case a.PrivateKey != "":
+			keyFile = a.PrivateKey
+
+		default:
+			return errors.New("name, public_key or private_key must be specified")
+		}
+
+		key, err := readPublicKeyFile(e.p.path(keyFile))
+		if err != nil {
+			return err
+		}
+
+		var handle tpmutil.Handle
+		handle, name, err = loadExternalKey(e.rw, key, tpm2.Algorithm(e.p.NameAlg), tpm2.HandleNull)
+		if err != nil {
+			return err
+		}
+
+		if err := tpm2.FlushContext(e.rw, handle); err != nil {
+			return fmt.Errorf("failed to flush external key: %v", err)
+		}
+	}
+
+	current, err := tpm2.PolicyGetDigest(e.rw, e.sess.handle)
+	if err != nil {
+		return fmt.Errorf("failed to get policy digest: %v", err)
+	}
+
+	_, err = runCommand(e.rw, pgtpm.TPM2_CC_PolicyAuthorize, e.sess.handle,
+		tpmutil.U16Bytes(current), tpmutil.U16Bytes(a.PolicyRef), tpmutil.U16Bytes(name),
+		uint16(verifiedTag), tpm2.HandleNull, tpmutil.U16Bytes(nil))
+
+	return err
+}
+
+// placeholderSignature returns a TPMT_SIGNATURE of the appropriate form for a
+// public key, with a zero signature value.
+func placeholderSignature(key crypto.PublicKey, h crypto.Hash) ([]byte, error) {
+	hashAlg, ok := hashToTPMAlgorithm[h]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash function: %v", h)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return tpmutil.Pack(tpm2.AlgRSASSA, hashAlg, tpmutil.U16Bytes(make([]byte, k.Size())))
+
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+
+		return tpmutil.Pack(tpm2.AlgECDSA, hashAlg, tpmutil.U16Bytes(make([]byte, size)),
+			tpmutil.U16Bytes(make([]byte, size)))
+	}
+
+	return nil, fmt.Errorf("unsupported public key type: %T", key)
+}
+
+// loadExternalKey loads a public key into a hierarchy, with the public area
+// returned by externalKeyPublic, and returns its handle and name. The caller
+// should flush the returned handle.
+func loadExternalKey(rw io.ReadWriter, key crypto.PublicKey, nameAlg tpm2.Algorithm,
+	hierarchy tpmutil.Handle) (tpmutil.Handle, []byte, error) {
+	pub, err := externalKeyPublic(key, nameAlg)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	handle, name, err := tpm2.LoadExternal(rw, pub, tpm2.Private{Type: tpm2.AlgNull}, hierarchy)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to load external key: %v", err)
+	}
+
+	return handle, name, nil
+}
+
+// encodeSignature signs a digest with a private key and returns the
+// TPMT_SIGNATURE encoding of the signature. RSA keys use RSASSA-PKCS1-v1_5.
+func encodeSignature(key crypto.Signer, h crypto.Hash, digest []byte) ([]byte, error) {
+	hashAlg, ok := hashToTPMAlgorithm[h]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash function: %v", h)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err := rsa.SignPKCS1v15(rand.Reader, k, h, digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign: %v", err)
+		}
+
+		return tpmutil.Pack(tpm2.AlgRSASSA, hashAlg, tpmutil.U16Bytes(sig))
+
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign: %v", err)
+		}
+
+		return tpmutil.Pack(tpm2.AlgECDSA, hashAlg, tpmutil.U16Bytes(r.Bytes()), tpmutil.U16Bytes(s.Bytes()))
+	}
+
+	return nil, fmt.Errorf("unsupported private key type: %T", key)
+}
+
+// hashToTPMAlgorithm maps Go hash functions to TPM algorithm IDs.
+var hashToTPMAlgorithm = map[crypto.Hash]tpm2.Algorithm{
+	crypto.SHA1:   tpm2.AlgSHA1,
+	crypto.SHA256: tpm2.AlgSHA256,
+	crypto.SHA384: tpm2.AlgSHA384,
+	crypto.SHA512: tpm2.AlgSHA512,
+}
+
+// readPrivateKeyFile reads a PEM-encoded private key from the named file.
+func readPrivateKeyFile(name string) (crypto.Signer, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %v", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", name)
+	}
+
+	return parsePrivateKey(block)
+}
+
+// readSecret returns the secret for the entity with the specified handle,
+// prompting for it the first time it is needed. If standard input is not a
+// terminal, a line is read from it instead.
+func readSecret(h tpmutil.Handle) (string, error) {
+	if s, ok := secrets[h]; ok {
+		return s, nil
+	}
+
+	var secret string
+
+	if fd := int(os.Stdin.Fd()); terminal.IsTerminal(fd) {
+		fmt.Fprintf(os.Stderr, "Password for 0x%08x: ", uint32(h))
+		b, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password: %v", err)
+		}
+		secret = string(b)
+	} else {
+		line, err := stdinReader.ReadString('\n')
+		if err != nil && !(err == io.EOF && line != "") {
+			return "", fmt.Errorf("failed to read password for 0x%08x: %v", uint32(h), err)
+		}
+		secret = strings.TrimRight(line, "\r\n")
+	}
+
+	secrets[h] = secret
+
+	return secret, nil
+}
+
+// closeAuthorization closes an authorization, and is intended to be deferred
+// by functions with a named error result. A failure is returned through errp
+// if no other error occurred, and is logged otherwise.
+func closeAuthorization(rw io.ReadWriter, a authorization, errp *error) {
+	if err := a.close(rw); err != nil {
+		if *errp == nil {
+			*errp = err
+		} else {
+			log.Printf("%v", err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/google/go-tpm/tpm2"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// signedPolicy is a policy digest approved by an authorizing key, for use
+// with a PolicyAuthorize assertion naming that key.
+type signedPolicy struct {
+	NameAlg        pgtpm.Algorithm `json:"name_alg"`
+	ApprovedPolicy hexBytes        `json:"approved_policy"`
+	PolicyRef      hexBytes        `json:"policy_ref,omitempty"`
+	Signature      hexBytes        `json:"signature"`
+}
+
+// approvedPolicy is a policy approved for a PolicyAuthorize assertion,
+// together with the signed policy file which approves it.
+type approvedPolicy struct {
+	Policy       string `json:"policy"`
+	SignedPolicy string `json:"signed_policy"`
+}
+
+// policySign signs a policy digest with an authorizing key.
+func policySign() error {
+	err := ensureAllPassed(fPolicySignSet, keyFlagName)
+	if err != nil {
+		return err
+	}
+
+	err = ensureExactlyOnePassed(fPolicySignSet, inFlagName, policyFlagName)
+	if err != nil {
+		return err
+	}
+
+	hash, err := parseHash(*fPolicySignHash)
+	if err != nil {
+		return err
+	}
+
+	if hash == 0 {
+		hash = crypto.SHA256
+	}
+
+	sp := signedPolicy{NameAlg: pgtpm.Algorithm(hashToTPMAlgorithm[hash])}
+
+	if *fPolicySignIn != "" {
+		p, err := loadPolicy(*fPolicySignIn)
+		if err != nil {
+			return err
+		}
+
+		if p.NameAlg != sp.NameAlg {
+			return fmt.Errorf("policy name algorithm %v does not match hash algorithm %v", p.NameAlg, sp.NameAlg)
+		}
+
+		sp.ApprovedPolicy, err = p.digest()
+		if err != nil {
+			return err
+		}
+	} else {
+		sp.ApprovedPolicy, err = hex.DecodeString(*fPolicySignPolicy)
+		if err != nil {
+			return fmt.Errorf("invalid policy digest: %v", err)
+		}
+	}
+
+	if len(sp.ApprovedPolicy) != hash.Size() {
+		return fmt.Errorf("policy digest must be %d bytes", hash.Size())
+	}
+
+	sp.PolicyRef, err = hex.DecodeString(*fPolicySignPolicyRef)
+	if err != nil {
+		return fmt.Errorf("invalid policy reference: %v", err)
+	}
+
+	key, err := readPrivateKeyFile(*fPolicySignKey)
+	if err != nil {
+		return err
+	}
+
+	sp.Signature, err = encodeSignature(key, hash, sp.authorizationDigest(hash))
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(sp, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal signed policy: %v", err)
+	}
+	data = append(data, '\n')
+
+	if *fPolicySignOut != "" {
+		if err := ioutil.WriteFile(*fPolicySignOut, data, 0644); err != nil {
+			return fmt.Errorf("failed to write output file: %v", err)
+		}
+
+		return nil
+	}
+
+	os.Stdout.Write(data)
+
+	return nil
+}
+
+// authorizationDigest returns H(approvedPolicy || policyRef), which is the
+// digest signed by the authorizing key.
+func (sp *signedPolicy) authorizationDigest(h crypto.Hash) []byte {
+	return hashConcat(h, sp.ApprovedPolicy, sp.PolicyRef)
+}
+
+// loadSignedPolicy reads and parses a signed policy file.
+func loadSignedPolicy(name string) (*signedPolicy, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signed policy: %v", err)
+	}
+
+	var sp signedPolicy
+	if err := json.Unmarshal(data, &sp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal signed policy: %v", err)
+	}
+
+	if len(sp.ApprovedPolicy) == 0 {
+		return nil, errors.New("signed policy contains no approved_policy")
+	}
+
+	if len(sp.Signature) == 0 {
+		return nil, errors.New("signed policy contains no signature")
+	}
+
+	if _, err := tpm2.Algorithm(sp.NameAlg).Hash(); err != nil {
+		return nil, fmt.Errorf("unsupported signed policy name algorithm: %v", sp.NameAlg)
+	}
+
+	return &sp, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+// policyTrial computes a policy digest with the TPM by running the policy's
+// assertions in a trial session.
+func policyTrial() (err error) {
+	err = ensureAllPassed(fPolicyTrialSet, inFlagName)
+	if err != nil {
+		return err
+	}
+
+	p, err := loadPolicy(*fPolicyTrialIn)
+	if err != nil {
+		return err
+	}
+
+	t, err := getTPM(*fPolicyTrialTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	sess, err := p.execute(t, tpm2.SessionTrial, 0)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if ferr := sess.close(t); ferr != nil {
+			if err == nil {
+				err = ferr
+			} else {
+				log.Printf("%v", ferr)
+			}
+		}
+	}()
+
+	digest, err := tpm2.PolicyGetDigest(t, sess.handle)
+	if err != nil {
+		return fmt.Errorf("failed to get policy digest: %v", err)
+	}
+
+	// Any PCR values and names omitted from the policy have been obtained
+	// from the TPM, so the offline calculation uses the same values.
+	if *fPolicyTrialCompare {
+		computed, err := p.digest()
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(digest, computed) {
+			return fmt.Errorf("TPM policy digest %s does not match computed policy digest %s",
+				hex.EncodeToString(digest), hex.EncodeToString(computed))
+		}
+	}
+
+	return outputDigest(digest, *fPolicyTrialFormat, *fPolicyTrialOut)
+}
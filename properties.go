@@ -0,0 +1,330 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// TPM property tags, from the TPM_PT constants. Fixed properties start at
+// ptFixed and variable properties at ptVar, and each group spans
+// ptGroupSize tags.
+const (
+	ptFixed     = 0x00000100
+	ptVar       = 0x00000200
+	ptGroupSize = 0x00000100
+
+	ptFamilyIndicator   = ptFixed + 0
+	ptLevel             = ptFixed + 1
+	ptRevision          = ptFixed + 2
+	ptDayOfYear         = ptFixed + 3
+	ptYear              = ptFixed + 4
+	ptManufacturer      = ptFixed + 5
+	ptVendorString1     = ptFixed + 6
+	ptVendorString2     = ptFixed + 7
+	ptVendorString3     = ptFixed + 8
+	ptVendorString4     = ptFixed + 9
+	ptVendorTPMType     = ptFixed + 10
+	ptFirmwareVersion1  = ptFixed + 11
+	ptFirmwareVersion2  = ptFixed + 12
+	ptInputBuffer       = ptFixed + 13
+	ptHRTransientMin    = ptFixed + 14
+	ptHRPersistentMin   = ptFixed + 15
+	ptHRLoadedMin       = ptFixed + 16
+	ptActiveSessionsMax = ptFixed + 17
+	ptPCRCount          = ptFixed + 18
+	ptPCRSelectMin      = ptFixed + 19
+	ptContextGapMax     = ptFixed + 20
+	ptNVCountersMax     = ptFixed + 22
+	ptNVIndexMax        = ptFixed + 23
+	ptMemory            = ptFixed + 24
+	ptClockUpdate       = ptFixed + 25
+	ptContextHash       = ptFixed + 26
+	ptContextSym        = ptFixed + 27
+	ptContextSymSize    = ptFixed + 28
+	ptOrderlyCount      = ptFixed + 29
+	ptMaxCommandSize    = ptFixed + 30
+	ptMaxResponseSize   = ptFixed + 31
+	ptMaxDigest         = ptFixed + 32
+	ptMaxObjectContext  = ptFixed + 33
+	ptMaxSessionContext = ptFixed + 34
+	ptPSFamilyIndicator = ptFixed + 35
+	ptPSLevel           = ptFixed + 36
+	ptPSRevision        = ptFixed + 37
+	ptPSDayOfYear       = ptFixed + 38
+	ptPSYear            = ptFixed + 39
+	ptSplitMax          = ptFixed + 40
+	ptTotalCommands     = ptFixed + 41
+	ptLibraryCommands   = ptFixed + 42
+	ptVendorCommands    = ptFixed + 43
+	ptNVBufferMax       = ptFixed + 44
+	ptModes             = ptFixed + 45
+	ptMaxCapBuffer      = ptFixed + 46
+
+	ptPermanent         = ptVar + 0
+	ptStartupClear      = ptVar + 1
+	ptHRNVIndex         = ptVar + 2
+	ptHRLoaded          = ptVar + 3
+	ptHRLoadedAvail     = ptVar + 4
+	ptHRActive          = ptVar + 5
+	ptHRActiveAvail     = ptVar + 6
+	ptHRTransientAvail  = ptVar + 7
+	ptHRPersistent      = ptVar + 8
+	ptHRPersistentAvail = ptVar + 9
+	ptNVCounters        = ptVar + 10
+	ptNVCountersAvail   = ptVar + 11
+	ptAlgorithmSet      = ptVar + 12
+	ptLoadedCurves      = ptVar + 13
+	ptLockoutCounter    = ptVar + 14
+	ptMaxAuthFail       = ptVar + 15
+	ptLockoutInterval   = ptVar + 16
+	ptLockoutRecovery   = ptVar + 17
+	ptNVWriteRecovery   = ptVar + 18
+	ptAuditCounter0     = ptVar + 19
+	ptAuditCounter1     = ptVar + 20
+)
+
+// TPMA_PERMANENT and TPMA_STARTUP_CLEAR bits, as reported in the
+// TPM2_PT_PERMANENT and TPM2_PT_STARTUP_CLEAR properties.
+const (
+	permOwnerAuthSet       = 1 << 0
+	permEndorsementAuthSet = 1 << 1
+	permLockoutAuthSet     = 1 << 2
+	permDisableClear       = 1 << 8
+	permInLockout          = 1 << 9
+
+	startupPHEnable = 1 << 0
+	startupSHEnable = 1 << 1
+	startupEHEnable = 1 << 2
+)
+
+// propertyNames maps TPM property tags to their names.
+var propertyNames = map[uint32]string{
+	ptFamilyIndicator:   "TPM2_PT_FAMILY_INDICATOR",
+	ptLevel:             "TPM2_PT_LEVEL",
+	ptRevision:          "TPM2_PT_REVISION",
+	ptDayOfYear:         "TPM2_PT_DAY_OF_YEAR",
+	ptYear:              "TPM2_PT_YEAR",
+	ptManufacturer:      "TPM2_PT_MANUFACTURER",
+	ptVendorString1:     "TPM2_PT_VENDOR_STRING_1",
+	ptVendorString2:     "TPM2_PT_VENDOR_STRING_2",
+	ptVendorString3:     "TPM2_PT_VENDOR_STRING_3",
+	ptVendorString4:     "TPM2_PT_VENDOR_STRING_4",
+	ptVendorTPMType:     "TPM2_PT_VENDOR_TPM_TYPE",
+	ptFirmwareVersion1:  "TPM2_PT_FIRMWARE_VERSION_1",
+	ptFirmwareVersion2:  "TPM2_PT_FIRMWARE_VERSION_2",
+	ptInputBuffer:       "TPM2_PT_INPUT_BUFFER",
+	ptHRTransientMin:    "TPM2_PT_HR_TRANSIENT_MIN",
+	ptHRPersistentMin:   "TPM2_PT_HR_PERSISTENT_MIN",
+	ptHRLoadedMin:       "TPM2_PT_HR_LOADED_MIN",
+	ptActiveSessionsMax: "TPM2_PT_ACTIVE_SESSIONS_MAX",
+	ptPCRCount:          "TPM2_PT_PCR_COUNT",
+	ptPCRSelectMin:      "TPM2_PT_PCR_SELECT_MIN",
+	ptContextGapMax:     "TPM2_PT_CONTEXT_GAP_MAX",
+	ptNVCountersMax:     "TPM2_PT_NV_COUNTERS_MAX",
+	ptNVIndexMax:        "TPM2_PT_NV_INDEX_MAX",
+	ptMemory:            "TPM2_PT_MEMORY",
+	ptClockUpdate:       "TPM2_PT_CLOCK_UPDATE",
+	ptContextHash:       "TPM2_PT_CONTEXT_HASH",
+	ptContextSym:        "TPM2_PT_CONTEXT_SYM",
+	ptContextSymSize:    "TPM2_PT_CONTEXT_SYM_SIZE",
+	ptOrderlyCount:      "TPM2_PT_ORDERLY_COUNT",
+	ptMaxCommandSize:    "TPM2_PT_MAX_COMMAND_SIZE",
+	ptMaxResponseSize:   "TPM2_PT_MAX_RESPONSE_SIZE",
+	ptMaxDigest:         "TPM2_PT_MAX_DIGEST",
+	ptMaxObjectContext:  "TPM2_PT_MAX_OBJECT_CONTEXT",
+	ptMaxSessionContext: "TPM2_PT_MAX_SESSION_CONTEXT",
+	ptPSFamilyIndicator: "TPM2_PT_PS_FAMILY_INDICATOR",
+	ptPSLevel:           "TPM2_PT_PS_LEVEL",
+	ptPSRevision:        "TPM2_PT_PS_REVISION",
+	ptPSDayOfYear:       "TPM2_PT_PS_DAY_OF_YEAR",
+	ptPSYear:            "TPM2_PT_PS_YEAR",
+	ptSplitMax:          "TPM2_PT_SPLIT_MAX",
+	ptTotalCommands:     "TPM2_PT_TOTAL_COMMANDS",
+	ptLibraryCommands:   "TPM2_PT_LIBRARY_COMMANDS",
+	ptVendorCommands:    "TPM2_PT_VENDOR_COMMANDS",
+	ptNVBufferMax:       "TPM2_PT_NV_BUFFER_MAX",
+	ptModes:             "TPM2_PT_MODES",
+	ptMaxCapBuffer:      "TPM2_PT_MAX_CAP_BUFFER",
+	ptPermanent:         "TPM2_PT_PERMANENT",
+	ptStartupClear:      "TPM2_PT_STARTUP_CLEAR",
+	ptHRNVIndex:         "TPM2_PT_HR_NV_INDEX",
+	ptHRLoaded:          "TPM2_PT_HR_LOADED",
+	ptHRLoadedAvail:     "TPM2_PT_HR_LOADED_AVAIL",
+	ptHRActive:          "TPM2_PT_HR_ACTIVE",
+	ptHRActiveAvail:     "TPM2_PT_HR_ACTIVE_AVAIL",
+	ptHRTransientAvail:  "TPM2_PT_HR_TRANSIENT_AVAIL",
+	ptHRPersistent:      "TPM2_PT_HR_PERSISTENT",
+	ptHRPersistentAvail: "TPM2_PT_HR_PERSISTENT_AVAIL",
+	ptNVCounters:        "TPM2_PT_NV_COUNTERS",
+	ptNVCountersAvail:   "TPM2_PT_NV_COUNTERS_AVAIL",
+	ptAlgorithmSet:      "TPM2_PT_ALGORITHM_SET",
+	ptLoadedCurves:      "TPM2_PT_LOADED_CURVES",
+	ptLockoutCounter:    "TPM2_PT_LOCKOUT_COUNTER",
+	ptMaxAuthFail:       "TPM2_PT_MAX_AUTH_FAIL",
+	ptLockoutInterval:   "TPM2_PT_LOCKOUT_INTERVAL",
+	ptLockoutRecovery:   "TPM2_PT_LOCKOUT_RECOVERY",
+	ptNVWriteRecovery:   "TPM2_PT_NV_WRITE_RECOVERY",
+	ptAuditCounter0:     "TPM2_PT_AUDIT_COUNTER_0",
+	ptAuditCounter1:     "TPM2_PT_AUDIT_COUNTER_1",
+}
+
+// propertyBits names the bits of the TPM properties which are bit fields.
+var propertyBits = map[uint32][]struct {
+	bit  uint
+	name string
+}{
+	ptPermanent: {
+		{0, "ownerAuthSet"},
+		{1, "endorsementAuthSet"},
+		{2, "lockoutAuthSet"},
+		{8, "disableClear"},
+		{9, "inLockout"},
+		{10, "tpmGeneratedEPS"},
+	},
+	ptStartupClear: {
+		{0, "phEnable"},
+		{1, "shEnable"},
+		{2, "ehEnable"},
+		{3, "phEnableNV"},
+		{31, "orderly"},
+	},
+	ptMemory: {
+		{0, "sharedRAM"},
+		{1, "sharedNV"},
+		{2, "objectCopiedToRam"},
+	},
+	ptModes: {
+		{0, "FIPS_140_2"},
+	},
+}
+
+// manufacturers maps TPM vendor IDs, as reported in TPM2_PT_MANUFACTURER, to
+// the names of the vendors, from the TCG vendor ID registry.
+var manufacturers = map[string]string{
+	"AMD":  "AMD",
+	"ATML": "Atmel",
+	"BRCM": "Broadcom",
+	"CSCO": "Cisco",
+	"FLYS": "Flyslice Technologies",
+	"GOOG": "Google",
+	"HISI": "HiSilicon",
+	"HPE":  "HPE",
+	"IBM":  "IBM",
+	"IFX":  "Infineon",
+	"INTC": "Intel",
+	"LEN":  "Lenovo",
+	"MSFT": "Microsoft",
+	"NSM":  "National Semiconductor",
+	"NTZ":  "Nationz",
+	"NTC":  "Nuvoton Technology",
+	"QCOM": "Qualcomm",
+	"ROCC": "Fuzhou Rockchip",
+	"SMSC": "SMSC",
+	"SMSN": "Samsung",
+	"SNS":  "Sinosun",
+	"STM":  "STMicroelectronics",
+	"TXN":  "Texas Instruments",
+	"WEC":  "Winbond",
+}
+
+// propertyName returns the name of a TPM property tag.
+func propertyName(p uint32) string {
+	if s, ok := propertyNames[p]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("0x%08x", p)
+}
+
+// propertyString returns the value of a TPM property packed as four ASCII
+// characters, as used for the family indicator, manufacturer and vendor
+// strings, with any trailing padding removed.
+func propertyString(v uint32) string {
+	b := []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+
+	return strings.TrimRight(string(b), "\x00 ")
+}
+
+// manufacturerName returns the vendor name for a TPM2_PT_MANUFACTURER value,
+// or the vendor ID itself if the vendor is not known.
+func manufacturerName(v uint32) string {
+	id := propertyString(v)
+	if s, ok := manufacturers[id]; ok {
+		return s
+	}
+
+	return id
+}
+
+// firmwareVersion returns the firmware version string for the values of the
+// TPM2_PT_FIRMWARE_VERSION_1 and TPM2_PT_FIRMWARE_VERSION_2 properties. The
+// TCG leaves the format to the vendor, but most vendors encode the major and
+// minor versions in the high and low words of the first value, and the build
+// numbers in the high and low words of the second.
+func firmwareVersion(v1, v2 uint32) string {
+	return fmt.Sprintf("%d.%d.%d.%d", v1>>16, v1&0xffff, v2>>16, v2&0xffff)
+}
+
+// propertyBitNames returns the names of the bits set in a bit field TPM
+// property.
+func propertyBitNames(p, v uint32) []string {
+	var names []string
+	for _, b := range propertyBits[p] {
+		if v&(1<<b.bit) != 0 {
+			names = append(names, b.name)
+		}
+	}
+
+	return names
+}
+
+// propertyValue returns the value of a TPM property as a string for
+// properties which contain characters or algorithms, a list of names for
+// bit fields, and an integer otherwise.
+func propertyValue(p, v uint32) interface{} {
+	switch p {
+	case ptFamilyIndicator, ptPSFamilyIndicator, ptManufacturer,
+		ptVendorString1, ptVendorString2, ptVendorString3, ptVendorString4:
+		return propertyString(v)
+
+	case ptContextHash, ptContextSym:
+		return pgtpm.Algorithm(v).String()
+
+	case ptPermanent, ptStartupClear, ptMemory, ptModes:
+		return append([]string{}, propertyBitNames(p, v)...)
+	}
+
+	return v
+}
+
+// formatProperty returns the value of a TPM property as a human-readable
+// string.
+func formatProperty(p, v uint32) string {
+	switch p {
+	case ptFamilyIndicator, ptPSFamilyIndicator,
+		ptVendorString1, ptVendorString2, ptVendorString3, ptVendorString4:
+		return fmt.Sprintf("%q", propertyString(v))
+
+	case ptManufacturer:
+		return fmt.Sprintf("%q (%s)", propertyString(v), manufacturerName(v))
+
+	case ptRevision, ptPSRevision:
+		return fmt.Sprintf("%d.%02d", v/100, v%100)
+
+	case ptFirmwareVersion1, ptFirmwareVersion2:
+		return fmt.Sprintf("0x%08x (%d.%d)", v, v>>16, v&0xffff)
+
+	case ptContextHash, ptContextSym:
+		return pgtpm.Algorithm(v).String()
+
+	case ptPermanent, ptStartupClear, ptMemory, ptModes:
+		return fmt.Sprintf("0x%08x %s", v, strings.Join(propertyBitNames(p, v), " | "))
+
+	case ptAlgorithmSet:
+		return fmt.Sprintf("0x%08x", v)
+	}
+
+	return fmt.Sprintf("%d", v)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+	"golang.org/x/crypto/ssh"
+)
+
+// jsonWebKey represents a public JSON Web Key, per RFC 7517.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// encodePublicKey encodes the public key from a public area in the specified
+// format.
+func encodePublicKey(pub tpm2.Public, format string) ([]byte, error) {
+	// The TPM formats encode the entire public area, rather than just the
+	// public key, so handle them before extracting the key.
+	switch format {
+	case tssFormat:
+		data, err := pub.Encode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode public area: %v", err)
+		}
+
+		return tpmutil.Pack(tpmutil.U16Bytes(data))
+
+	case tpmtFormat:
+		data, err := pub.Encode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode public area: %v", err)
+		}
+
+		return data, nil
+	}
+
+	key, err := pub.Key()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get public key from public area: %v", err)
+	}
+
+	switch format {
+	case "", pemFormat, derFormat:
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal public key: %v", err)
+		}
+
+		if format == derFormat {
+			return der, nil
+		}
+
+		return pem.EncodeToMemory(&pem.Block{
+			Type:  "PUBLIC KEY",
+			Bytes: der,
+		}), nil
+
+	case jwkFormat:
+		jwk, err := newJSONWebKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := json.MarshalIndent(jwk, "", "    ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal JSON web key: %v", err)
+		}
+
+		return append(data, '\n'), nil
+
+	case sshFormat:
+		sshKey, err := ssh.NewPublicKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create SSH public key: %v", err)
+		}
+
+		return ssh.MarshalAuthorizedKey(sshKey), nil
+	}
+
+	return nil, fmt.Errorf("unsupported public key format: %s", format)
+}
+
+// newJSONWebKey returns a JSON web key for the specified public key.
+func newJSONWebKey(key interface{}) (*jsonWebKey, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return &jsonWebKey{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}, nil
+
+	case *ecdsa.PublicKey:
+		// Per RFC 7518 section 6.2.1.2, coordinates must be the full size
+		// of a coordinate for the curve, including leading zeros.
+		size := (k.Curve.Params().BitSize + 7) / 8
+
+		return &jsonWebKey{
+			Kty: "EC",
+			Crv: k.Curve.Params().Name,
+			X:   base64.RawURLEncoding.EncodeToString(bigIntToFixedSizeBytes(k.X, size)),
+			Y:   base64.RawURLEncoding.EncodeToString(bigIntToFixedSizeBytes(k.Y, size)),
+		}, nil
+	}
+
+	return nil, errors.New("unsupported public key type for JSON web key")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// readClock outputs the current time and clock values of the TPM.
+func readClock() error {
+	t, err := getTPM(*fReadClockTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	resp, err := runCommand(t, pgtpm.TPM2_CC_ReadClock)
+	if err != nil {
+		return fmt.Errorf("failed to read clock: %v", err)
+	}
+
+	info, err := decodeTimeInfo(bytes.NewBuffer(resp))
+	if err != nil {
+		return fmt.Errorf("failed to decode time information: %v", err)
+	}
+
+	const fw = attestFieldWidth
+
+	fmt.Printf("%-*s: %d\n", fw, "time", info.Time)
+	fmt.Printf("%-*s: %d\n", fw, "clock", info.Clock)
+	fmt.Printf("%-*s: %d\n", fw, "reset count", info.ResetCount)
+	fmt.Printf("%-*s: %d\n", fw, "restart count", info.RestartCount)
+	fmt.Printf("%-*s: %t\n", fw, "safe", info.Safe)
+
+	return nil
+}
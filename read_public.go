@@ -1,15 +1,13 @@
 package main
 
 import (
-	"crypto/x509"
 	"encoding/binary"
-	"encoding/pem"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 
 	"github.com/google/go-tpm/tpm2"
-	"github.com/google/go-tpm/tpmutil"
 
 	"github.com/paulgriffiths/pgtpm"
 )
@@ -21,32 +19,38 @@ func readPublic() error {
 	var qnameAlg pgtpm.Algorithm
 	var nameHash []byte
 	var qnameHash []byte
+	var name []byte
+	var qname []byte
 
-	err := ensureExactlyOnePassed(fReadPublicSet, inFlagName, handleFlagName)
+	err := ensureExactlyOnePassed(fReadPublicSet, contextFlagName, inFlagName, handleFlagName)
 	if err != nil {
 		return err
 	}
 
+	switch *fReadPublicFormat {
+	case "", textFormat, jsonFormat:
+	default:
+		return fmt.Errorf("unsupported output format: %s", *fReadPublicFormat)
+	}
+
+	switch *fReadPublicPubFormat {
+	case pemFormat, derFormat, jwkFormat, sshFormat, tssFormat, tpmtFormat:
+	default:
+		return fmt.Errorf("unsupported public key format: %s", *fReadPublicPubFormat)
+	}
+
 	// Read a public area from a file, or from a TPM.
 	if *fReadPublicIn == "" {
-		var handle = pgtpm.Handle(fReadPublicHandle)
-
-		t, err := getTPM(*fReadPublicTPM)
+		pub, name, qname, err = readTPMPublic(*fReadPublicTPM, fReadPublicHandle, *fReadPublicContext)
 		if err != nil {
 			return err
 		}
-		defer t.Close()
-
-		pub, nameHash, qnameHash, err = tpm2.ReadPublic(t, tpmutil.Handle(handle))
-		if err != nil {
-			return fmt.Errorf("failed to read public area: %v", err)
-		}
 
-		nameAlg = pgtpm.Algorithm(binary.BigEndian.Uint16(nameHash))
-		nameHash = nameHash[2:]
+		nameAlg = pgtpm.Algorithm(binary.BigEndian.Uint16(name))
+		nameHash = name[2:]
 
-		qnameAlg = pgtpm.Algorithm(binary.BigEndian.Uint16(qnameHash))
-		qnameHash = qnameHash[2:]
+		qnameAlg = pgtpm.Algorithm(binary.BigEndian.Uint16(qname))
+		qnameHash = qname[2:]
 	} else {
 		data, err := ioutil.ReadFile(*fReadPublicIn)
 		if err != nil {
@@ -58,19 +62,27 @@ func readPublic() error {
 			return fmt.Errorf("failed to decode public area: %v", err)
 		}
 
-		name, err := pub.Name()
+		n, err := pub.Name()
 		if err != nil {
 			return fmt.Errorf("failed to get name from public area: %v", err)
 		}
 
-		if name.Digest != nil {
-			nameHash = name.Digest.Value
-			nameAlg = pgtpm.Algorithm(name.Digest.Alg)
+		if n.Digest != nil {
+			nameHash = n.Digest.Value
+			nameAlg = pgtpm.Algorithm(n.Digest.Alg)
+		}
+
+		// Strip the size field from the encoded name.
+		encoded, err := n.Encode()
+		if err != nil {
+			return fmt.Errorf("failed to encode name: %v", err)
 		}
+		name = encoded[2:]
 	}
 
 	// Write the raw public area, if requested.
-	if *fReadPublicOut != "" || (!*fReadPublicText && !*fReadPublicPubOut) {
+	if *fReadPublicOut != "" || (!*fReadPublicText && !*fReadPublicPubOut &&
+		*fReadPublicFormat == "" && *fReadPublicKeyOut == "") {
 		var f *os.File
 		var err error
 
@@ -96,7 +108,7 @@ func readPublic() error {
 	}
 
 	// Write the public area as text, if requested.
-	if *fReadPublicText {
+	if *fReadPublicText || *fReadPublicFormat == textFormat {
 		const fw = 21
 
 		fmt.Printf("%-*s: %s\n", fw, "Type", pgtpm.Algorithm(pub.Type).String())
@@ -113,19 +125,7 @@ func readPublic() error {
 		if pub.Attributes != 0 {
 			var first = true
 
-			for _, a := range []pgtpm.ObjectAttribute{
-				pgtpm.TPMA_OBJECT_FIXEDTPM,
-				pgtpm.TPMA_OBJECT_STCLEAR,
-				pgtpm.TPMA_OBJECT_FIXEDPARENT,
-				pgtpm.TPMA_OBJECT_SENSITIVEDATAORIGIN,
-				pgtpm.TPMA_OBJECT_USERWITHAUTH,
-				pgtpm.TPMA_OBJECT_ADMINWITHPOLICY,
-				pgtpm.TPMA_OBJECT_NODA,
-				pgtpm.TPMA_OBJECT_ENCRYPTEDDUPLICATION,
-				pgtpm.TPMA_OBJECT_RESTRICTED,
-				pgtpm.TPMA_OBJECT_DECRYPT,
-				pgtpm.TPMA_OBJECT_SIGN_ENCRYPT,
-			} {
+			for _, a := range objectAttributes {
 				if pgtpm.ObjectAttribute(pub.Attributes)&a != 0 {
 					var label string
 					if first {
@@ -217,23 +217,66 @@ func readPublic() error {
 		}
 	}
 
-	// Write the PEM-encoded public key, if requested.
-	if *fReadPublicPubOut {
-		key, err := pub.Key()
+	// Write the public area as JSON, if requested.
+	if *fReadPublicFormat == jsonFormat {
+		out := struct {
+			pgtpm.PublicTemplate
+			Name          string `json:"name,omitempty"`
+			QualifiedName string `json:"qualified_name,omitempty"`
+		}{
+			PublicTemplate: publicToTemplate(pub),
+			Name:           hexEncodeBytes(name),
+			QualifiedName:  hexEncodeBytes(qname),
+		}
+
+		data, err := json.MarshalIndent(out, "", "    ")
 		if err != nil {
-			return fmt.Errorf("failed to get public key from public area: %v", err)
+			return fmt.Errorf("failed to marshal public area: %v", err)
 		}
 
-		der, err := x509.MarshalPKIXPublicKey(key)
+		fmt.Printf("%s\n", data)
+	}
+
+	// Write the public key, if requested.
+	if *fReadPublicPubOut || *fReadPublicKeyOut != "" {
+		data, err := encodePublicKey(pub, *fReadPublicPubFormat)
 		if err != nil {
-			return fmt.Errorf("failed to marshal public key: %v", err)
+			return err
+		}
+
+		if *fReadPublicKeyOut != "" {
+			if err := ioutil.WriteFile(*fReadPublicKeyOut, data, 0644); err != nil {
+				return fmt.Errorf("failed to write public key: %v", err)
+			}
 		}
 
-		fmt.Printf("%s", pem.EncodeToMemory(&pem.Block{
-			Type:  "PUBLIC KEY",
-			Bytes: der,
-		}))
+		if *fReadPublicPubOut {
+			os.Stdout.Write(data)
+		}
 	}
 
 	return nil
 }
+
+// readTPMPublic reads the public area, name and qualified name of a TPM
+// object, specified by handle or by a context file.
+func readTPMPublic(tpmName string, h handleFlag, contextFile string) (_ tpm2.Public, _, _ []byte, err error) {
+	t, err := getTPM(tpmName)
+	if err != nil {
+		return tpm2.Public{}, nil, nil, err
+	}
+	defer t.Close()
+
+	handle, release, err := contextHandle(t, h, contextFile)
+	if err != nil {
+		return tpm2.Public{}, nil, nil, err
+	}
+	defer release(&err)
+
+	pub, name, qname, err := tpm2.ReadPublic(t, handle)
+	if err != nil {
+		return tpm2.Public{}, nil, nil, fmt.Errorf("failed to read public area: %v", err)
+	}
+
+	return pub, name, qname, nil
+}
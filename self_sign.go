@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"time"
+)
+
+// selfSign generates a self-signed X.509 certificate for a TPM key.
+func selfSign() (err error) {
+	err = ensureAllPassed(fSelfSignSet, subjectFlagName)
+	if err != nil {
+		return err
+	}
+
+	err = ensureExactlyOnePassed(fSelfSignSet, contextFlagName, handleFlagName)
+	if err != nil {
+		return err
+	}
+
+	if *fSelfSignDays <= 0 {
+		return fmt.Errorf("-%s must be positive", daysFlagName)
+	}
+
+	subject, err := parseSubject(*fSelfSignSubject)
+	if err != nil {
+		return err
+	}
+
+	sans, err := parseSANs(fSelfSignSANs)
+	if err != nil {
+		return err
+	}
+
+	hash, err := parseHash(*fSelfSignHash)
+	if err != nil {
+		return err
+	}
+
+	serial, err := randomSerialNumber()
+	if err != nil {
+		return err
+	}
+
+	t, err := getTPM(*fSelfSignTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	key, err := contextKey(t, fSelfSignHandle, *fSelfSignContext, *fSelfSignPassword)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if ferr := key.Close(); ferr != nil {
+			if err == nil {
+				err = ferr
+			} else {
+				log.Printf("%v", ferr)
+			}
+		}
+	}()
+
+	sigAlg, err := key.SignatureAlgorithm(hash, *fSelfSignPSS)
+	if err != nil {
+		return err
+	}
+
+	usage := x509.KeyUsageDigitalSignature
+	if *fSelfSignCA {
+		usage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+
+	now := time.Now()
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.AddDate(0, 0, *fSelfSignDays),
+		SignatureAlgorithm:    sigAlg,
+		KeyUsage:              usage,
+		BasicConstraintsValid: true,
+		IsCA:                  *fSelfSignCA,
+		DNSNames:              sans.dnsNames,
+		EmailAddresses:        sans.emailAddresses,
+		IPAddresses:           sans.ipAddresses,
+		URIs:                  sans.uris,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate: %v", err)
+	}
+
+	return writePEM(*fSelfSignOut, "CERTIFICATE", der)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// selfTest runs the TPM self tests of all functions which have not yet been
+// tested, or of all functions if a full test is requested.
+func selfTest() error {
+	t, err := getTPM(*fSelfTestTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	var full byte
+	if *fSelfTestFull {
+		full = 1
+	}
+
+	_, err = runCommand(t, pgtpm.TPM2_CC_SelfTest, full)
+
+	// The TPM fails the command if a test fails, but the test result tells
+	// whether it has entered failure mode or is still testing.
+	if rerr := checkTestResult(t); rerr != nil {
+		return rerr
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to run self test: %v", err)
+	}
+
+	return nil
+}
+
+// checkTestResult returns an error if the TPM has not passed its self tests,
+// with an exit status which distinguishes a TPM which is still to complete
+// them from one which has failed them.
+func checkTestResult(rw io.ReadWriter) error {
+	data, result, err := getTestResult(rw)
+	if err != nil {
+		return err
+	}
+
+	return testResultError(result, data)
+}
+
+// testResultError returns an error for a self test result other than
+// success, together with any manufacturer-specific test data.
+func testResultError(result tpmutil.ResponseCode, data []byte) error {
+	switch result {
+	case tpmutil.RCSuccess:
+		return nil
+
+	case rcNeedsTest, rcTesting:
+		return &exitError{
+			err:  fmt.Errorf("TPM %s", testResultString(result)),
+			code: exitTestsPending,
+		}
+	}
+
+	err := fmt.Errorf("TPM %s: %v", testResultString(result), responseError(result))
+	if len(data) > 0 {
+		err = fmt.Errorf("%v (test data %s)", err, hexEncodeBytes(data))
+	}
+
+	return &exitError{err: err, code: exitTPMFailure}
+}
+
+// testResultString returns a description of a self test result.
+func testResultString(result tpmutil.ResponseCode) string {
+	switch result {
+	case tpmutil.RCSuccess:
+		return "self test passed"
+	case rcFailure:
+		return "failure mode"
+	case rcNeedsTest:
+		return "self test needed"
+	case rcTesting:
+		return "self test in progress"
+	}
+
+	return fmt.Sprintf("self test failed (0x%x)", uint32(result))
+}
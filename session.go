@@ -0,0 +1,802 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// session is an authorization session started with TPM2_StartAuthSession.
+type session struct {
+	handle      tpmutil.Handle
+	hash        crypto.Hash
+	nonceCaller []byte
+	nonceTPM    []byte
+	sessionKey  []byte
+
+	// authValue indicates that the authorized entity's authValue is
+	// included in the HMAC key, as for HMAC sessions, or for policy sessions
+	// after PolicyAuthValue.
+	authValue bool
+
+	// password indicates that the authorized entity's authValue is sent in
+	// the clear, as for policy sessions after PolicyPassword.
+	password bool
+
+	// hmac indicates that the session is an HMAC session, rather than a
+	// policy session.
+	hmac bool
+
+	// symmetric indicates that the session was started with AES-CFB
+	// parameter encryption.
+	symmetric bool
+
+	// audit indicates that the session is used to audit commands.
+	audit bool
+}
+
+// authorization is the authorization for one of a command's handles, either
+// a password or a session together with the entity's authValue.
+type authorization struct {
+	session  *session
+	password string
+}
+
+// paramEncryption records, for commands which may be run with parameter
+// encryption, whether their first command and response parameters are sized
+// buffers which may be encrypted.
+var paramEncryption = map[pgtpm.Command]struct{ command, response bool }{
+	pgtpm.TPM2_CC_ActivateCredential:  {true, true},
+	pgtpm.TPM2_CC_Create:              {true, true},
+	pgtpm.TPM2_CC_CreatePrimary:       {true, true},
+	pgtpm.TPM2_CC_HierarchyChangeAuth: {true, false},
+	pgtpm.TPM2_CC_NV_Read:             {false, true},
+	pgtpm.TPM2_CC_ObjectChangeAuth:    {true, true},
+	pgtpm.TPM2_CC_PolicyNV:            {true, false},
+	pgtpm.TPM2_CC_Sign:                {true, false},
+	pgtpm.TPM2_CC_Unseal:              {false, true},
+}
+
+// authChange records commands which change the authValue of the entity
+// authorized by their first authorization to the value of their first
+// command parameter. The TPM computes the response HMAC with the new value.
+var authChange = map[pgtpm.Command]bool{
+	pgtpm.TPM2_CC_HierarchyChangeAuth: true,
+}
+
+// Parameters of the sessions started for the global -session option.
+const (
+	paramSessionHash    = tpm2.AlgSHA256
+	paramSessionKeyBits = 128
+)
+
+// startSession starts an unbound, unsalted authorization session.
+func startSession(rw io.ReadWriter, sessionType tpm2.SessionType, hashAlg tpm2.Algorithm) (*session, error) {
+	return startAuthSession(rw, sessionType, hashAlg, tpm2.HandleNull, false)
+}
+
+// startParamSession starts an HMAC session for authorization and parameter
+// encryption, as selected by the global -session option. The session is
+// salted with the salt key if the salted mode was selected.
+func startParamSession(rw io.ReadWriter) (*session, error) {
+	tpmKey := tpm2.HandleNull
+	if *fGlobalSession == saltedSessionMode {
+		tpmKey = tpmutil.Handle(fGlobalSaltKey)
+	}
+
+	return startAuthSession(rw, tpm2.SessionHMAC, paramSessionHash, tpmKey, true)
+}
+
+// startAuthSession starts an unbound authorization session, salted with the
+// specified key unless it is the null handle, and with AES-CFB parameter
+// encryption if symmetric is true.
+func startAuthSession(rw io.ReadWriter, sessionType tpm2.SessionType, hashAlg tpm2.Algorithm,
+	tpmKey tpmutil.Handle, symmetric bool) (*session, error) {
+	h, err := hashAlg.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("unsupported session hash algorithm: %v", pgtpm.Algorithm(hashAlg))
+	}
+
+	nonce := make([]byte, h.Size())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+
+	var salt, encryptedSalt []byte
+	if tpmKey != tpm2.HandleNull {
+		salt, encryptedSalt, err = encryptSalt(rw, tpmKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sym, err := tpmutil.Pack(tpm2.AlgNull)
+	if symmetric {
+		sym, err = tpmutil.Pack(tpm2.AlgAES, uint16(paramSessionKeyBits), tpm2.AlgCFB)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := runCommand(rw, pgtpm.TPM2_CC_StartAuthSession, tpmKey, tpm2.HandleNull,
+		tpmutil.U16Bytes(nonce), tpmutil.U16Bytes(encryptedSalt), sessionType,
+		tpmutil.RawBytes(sym), hashAlg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session: %v", err)
+	}
+
+	var handle tpmutil.Handle
+	var nonceTPM tpmutil.U16Bytes
+	if _, err := tpmutil.Unpack(resp, &handle, &nonceTPM); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %v", err)
+	}
+
+	s := &session{
+		handle:      handle,
+		hash:        h,
+		nonceCaller: nonce,
+		nonceTPM:    nonceTPM,
+		hmac:        sessionType == tpm2.SessionHMAC,
+		authValue:   sessionType == tpm2.SessionHMAC,
+		symmetric:   symmetric,
+	}
+
+	// With no bind entity, the session key is derived from the salt alone,
+	// and is empty for an unsalted session.
+	if len(salt) > 0 {
+		s.sessionKey, err = deriveSessionKey(hashAlg, salt, nonceTPM, nonce)
+		if err != nil {
+			s.close(rw)
+			return nil, fmt.Errorf("failed to derive session key: %v", err)
+		}
+	}
+
+	return s, nil
+}
+
+// deriveSessionKey derives the key of an unbound session from its salt and
+// initial nonces, per TPM 2.0 Part 1 section 19.6.8.
+func deriveSessionKey(hashAlg tpm2.Algorithm, salt, nonceTPM, nonceCaller []byte) ([]byte, error) {
+	h, err := hashAlg.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("unsupported session hash algorithm: %v", pgtpm.Algorithm(hashAlg))
+	}
+
+	return tpm2.KDFa(hashAlg, salt, "ATH", nonceTPM, nonceCaller, h.Size()*8)
+}
+
+// encryptSalt generates a session salt and encrypts it to a TPM key, per TPM
+// 2.0 Part 1 Annex B and C, returning the salt and the encrypted salt.
+func encryptSalt(rw io.ReadWriter, tpmKey tpmutil.Handle) ([]byte, []byte, error) {
+	pub, _, _, err := tpm2.ReadPublic(rw, tpmKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read salt key public area: %v", err)
+	}
+
+	h, err := pub.NameAlg.Hash()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unsupported salt key name algorithm: %v", pgtpm.Algorithm(pub.NameAlg))
+	}
+
+	key, err := pub.Key()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get salt key: %v", err)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		salt := make([]byte, h.Size())
+		if _, err := rand.Read(salt); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate salt: %v", err)
+		}
+
+		encrypted, err := rsa.EncryptOAEP(h.New(), rand.Reader, k, salt, []byte("SECRET\x00"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to encrypt salt: %v", err)
+		}
+
+		return salt, encrypted, nil
+
+	case *ecdsa.PublicKey:
+		priv, x, y, err := elliptic.GenerateKey(k.Curve, rand.Reader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate ephemeral key: %v", err)
+		}
+
+		size := (k.Curve.Params().BitSize + 7) / 8
+		zx, _ := k.Curve.ScalarMult(k.X, k.Y, priv)
+
+		ephX := bigIntToFixedSizeBytes(x, size)
+		salt, err := tpm2.KDFe(pub.NameAlg, bigIntToFixedSizeBytes(zx, size), "SECRET",
+			ephX, bigIntToFixedSizeBytes(k.X, size), h.Size()*8)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to derive salt: %v", err)
+		}
+
+		encrypted, err := tpmutil.Pack(tpmutil.U16Bytes(ephX), tpmutil.U16Bytes(bigIntToFixedSizeBytes(y, size)))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return salt, encrypted, nil
+	}
+
+	return nil, nil, fmt.Errorf("unsupported salt key type: %T", key)
+}
+
+// paramCipher returns an AES-CFB stream for encrypting or decrypting a
+// parameter, with the key and IV derived from the session's key, the
+// entity's authValue and the nonces, newest first.
+func (s *session) paramCipher(authValue string, nonceNewer, nonceOlder []byte,
+	encrypt bool) (cipher.Stream, error) {
+	const blockBits = aes.BlockSize * 8
+
+	h, ok := hashToTPMAlgorithm[s.hash]
+	if !ok {
+		return nil, fmt.Errorf("unsupported session hash function: %v", s.hash)
+	}
+
+	keyIV, err := tpm2.KDFa(h, s.hmacKey(authValue), "CFB", nonceNewer, nonceOlder,
+		paramSessionKeyBits+blockBits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive parameter encryption key: %v", err)
+	}
+
+	block, err := aes.NewCipher(keyIV[:paramSessionKeyBits/8])
+	if err != nil {
+		return nil, err
+	}
+
+	iv := keyIV[paramSessionKeyBits/8:]
+	if encrypt {
+		return cipher.NewCFBEncrypter(block, iv), nil
+	}
+
+	return cipher.NewCFBDecrypter(block, iv), nil
+}
+
+// cryptParam encrypts or decrypts in place the contents of the sized buffer
+// at the start of a command's or response's parameters.
+func cryptParam(params []byte, stream cipher.Stream) error {
+	var size uint16
+	if _, err := tpmutil.Unpack(params, &size); err != nil {
+		return fmt.Errorf("failed to decode parameter size: %v", err)
+	}
+
+	if int(size)+2 > len(params) {
+		return errors.New("invalid parameter size")
+	}
+
+	stream.XORKeyStream(params[2:2+size], params[2:2+size])
+
+	return nil
+}
+
+// close flushes the session from the TPM.
+func (s *session) close(rw io.ReadWriter) error {
+	if err := tpm2.FlushContext(rw, s.handle); err != nil {
+		return fmt.Errorf("failed to flush session: %v", err)
+	}
+
+	return nil
+}
+
+// computesHMAC reports whether the session authorizes commands with an HMAC.
+func (s *session) computesHMAC() bool {
+	return s.hmac || (s.authValue && !s.password)
+}
+
+// hmacKey returns the HMAC key for the session and an entity's authValue.
+func (s *session) hmacKey(authValue string) []byte {
+	key := append([]byte{}, s.sessionKey...)
+	if s.authValue {
+		key = append(key, bytes.TrimRight([]byte(authValue), "\x00")...)
+	}
+
+	return key
+}
+
+// runAuthCommand runs a command which requires authorization for one or more
+// of its handles. The first len(auths) handles are authorized, and respHandles
+// is the number of handles in the response. The response handles and
+// parameters are returned.
+//
+// If the global -session option was provided, password authorizations are
+// replaced with HMAC sessions, and a session is used to encrypt the first
+// command and response parameters where the command allows. If the global
+// -audit option was provided, the command is also run in the audit session,
+// and recorded in the audit log.
+func runAuthCommand(rw io.ReadWriter, cc pgtpm.Command, handles []tpmutil.Handle,
+	auths []authorization, respHandles int, params []byte) (_ []tpmutil.Handle, _ []byte, err error) {
+	if len(auths) == 0 || len(auths) > len(handles) {
+		return nil, nil, errors.New("invalid number of authorizations")
+	}
+
+	auths, enc, started, err := paramSessions(rw, cc, auths)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		for _, s := range started {
+			if ferr := s.close(rw); ferr != nil {
+				if err == nil {
+					err = ferr
+				} else {
+					log.Printf("%v", ferr)
+				}
+			}
+		}
+	}()
+
+	auditLog, err := currentAuditLog()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var audit *session
+	if auditLog != nil {
+		audit, err = auditLog.session(rw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to start audit session: %v", err)
+		}
+
+		auths = append(auths[:len(auths):len(auths)], authorization{session: audit})
+	}
+
+	for _, a := range auths {
+		if s := a.session; s != nil {
+			s.nonceCaller = make([]byte, s.hash.Size())
+			if _, err := rand.Read(s.nonceCaller); err != nil {
+				return nil, nil, fmt.Errorf("failed to generate nonce: %v", err)
+			}
+		}
+	}
+
+	// Determine the authorizations with which the response HMACs are
+	// computed before the new authValue of a command which changes it is
+	// encrypted.
+	respAuths, err := responseAuths(cc, auths, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Encrypt the first command parameter, if requested, before computing
+	// the command parameter hash.
+	pe := paramEncryption[cc]
+	if enc >= 0 && pe.command {
+		a := auths[enc]
+		stream, err := a.session.paramCipher(a.password, a.session.nonceCaller, a.session.nonceTPM, true)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		params = append([]byte{}, params...)
+		if err := cryptParam(params, stream); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Compute the command parameter hash for each session which needs it,
+	// which requires the names of all the command's handles.
+	var names [][]byte
+	for _, a := range auths {
+		if a.session != nil && a.session.computesHMAC() && names == nil {
+			for _, h := range handles {
+				name, err := handleName(rw, h)
+				if err != nil {
+					return nil, nil, err
+				}
+
+				names = append(names, name)
+			}
+		}
+	}
+
+	var authArea []byte
+	for i, a := range auths {
+		cmd := tpm2.AuthCommand{
+			Session:    tpm2.HandlePasswordSession,
+			Attributes: tpm2.AttrContinueSession,
+			Auth:       []byte(a.password),
+		}
+
+		if s := a.session; s != nil {
+			cmd.Session = s.handle
+			cmd.Nonce = s.nonceCaller
+			cmd.Auth = nil
+
+			if i == enc && pe.command {
+				cmd.Attributes |= tpm2.AttrDecrypt
+			}
+
+			if i == enc && pe.response {
+				cmd.Attributes |= tpm2.AttrEcrypt
+			}
+
+			if s.audit {
+				cmd.Attributes |= tpm2.AttrAudit
+			}
+
+			switch {
+			case s.password:
+				cmd.Auth = []byte(a.password)
+
+			case s.computesHMAC():
+				cpHash, err := commandParamHash(s.hash, cc, names, params)
+				if err != nil {
+					return nil, nil, err
+				}
+
+				// The HMAC of the first session also covers the nonces
+				// of a separate session used for parameter encryption.
+				var encNonces [][]byte
+				if i == 0 && enc > 0 {
+					if pe.command {
+						encNonces = append(encNonces, auths[enc].session.nonceTPM)
+					}
+					if pe.response {
+						encNonces = append(encNonces, auths[enc].session.nonceTPM)
+					}
+				}
+
+				cmd.Auth = sessionHMAC(s.hash, s.hmacKey(a.password), cpHash,
+					s.nonceCaller, s.nonceTPM, cmd.Attributes, encNonces...)
+			}
+		}
+
+		b, err := tpmutil.Pack(cmd)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		authArea = append(authArea, b...)
+	}
+
+	var body []byte
+	for _, h := range handles {
+		b, err := tpmutil.Pack(h)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		body = append(body, b...)
+	}
+
+	size, err := tpmutil.Pack(uint32(len(authArea)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body = append(append(append(body, size...), authArea...), params...)
+
+	resp, code, err := tpmutil.RunCommand(rw, tpm2.TagSessions, tpmutil.Command(cc), tpmutil.RawBytes(body))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if code != tpmutil.RCSuccess {
+		return nil, nil, responseError(code)
+	}
+
+	// Parse the response handles, parameters and authorization area.
+	buf := bytes.NewBuffer(resp)
+
+	rhandles := make([]tpmutil.Handle, respHandles)
+	for i := range rhandles {
+		if err := tpmutil.UnpackBuf(buf, &rhandles[i]); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode response handles: %v", err)
+		}
+	}
+
+	var paramSize uint32
+	if err := tpmutil.UnpackBuf(buf, &paramSize); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode response parameter size: %v", err)
+	}
+
+	if int(paramSize) > buf.Len() {
+		return nil, nil, errors.New("invalid response parameter size")
+	}
+	rparams := append([]byte{}, buf.Next(int(paramSize))...)
+
+	for _, a := range respAuths {
+		var nonce, ack tpmutil.U16Bytes
+		var attrs tpm2.SessionAttributes
+		if err := tpmutil.UnpackBuf(buf, &nonce, &attrs, &ack); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode response authorization: %v", err)
+		}
+
+		if s := a.session; s != nil {
+			s.nonceTPM = nonce
+
+			if err := s.verifyResponse(a.password, cc, rparams, ack, attrs); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if audit != nil {
+		cpHash, err := commandParamHash(audit.hash, cc, names, params)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		rpHash, err := responseParamHash(audit.hash, cc, rparams)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := auditLog.record(cc, cpHash, rpHash); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Decrypt the first response parameter, if requested, after verifying
+	// the response HMAC.
+	if enc >= 0 && pe.response {
+		a := auths[enc]
+		stream, err := a.session.paramCipher(a.password, a.session.nonceTPM, a.session.nonceCaller, false)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := cryptParam(rparams, stream); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return rhandles, rparams, nil
+}
+
+// paramSessions applies the global -session option to a command's
+// authorizations, replacing passwords with HMAC sessions. If the command
+// allows parameter encryption, the index of the session to use for it is
+// returned, or -1 if there is none. For the salted mode, when no HMAC session
+// authorizes the command, a separate session is added for parameter
+// encryption. For the hmac mode, such a session would have no secret from
+// which to derive its keys, so an error is returned instead. Sessions started
+// here are also returned, and must be closed after the command.
+func paramSessions(rw io.ReadWriter, cc pgtpm.Command, auths []authorization) ([]authorization, int, []*session, error) {
+	if *fGlobalSession == "" {
+		return auths, -1, nil, nil
+	}
+
+	var started []*session
+	closeStarted := func() {
+		for _, s := range started {
+			s.close(rw)
+		}
+	}
+
+	result := make([]authorization, len(auths))
+	copy(result, auths)
+
+	enc := -1
+	for i := range result {
+		if result[i].session == nil {
+			s, err := startParamSession(rw)
+			if err != nil {
+				closeStarted()
+				return nil, 0, nil, err
+			}
+			started = append(started, s)
+			result[i].session = s
+		}
+
+		if enc == -1 && result[i].session.hmac && result[i].session.symmetric {
+			enc = i
+		}
+	}
+
+	pe, ok := paramEncryption[cc]
+	if !ok || (!pe.command && !pe.response) {
+		return result, -1, started, nil
+	}
+
+	if enc == -1 && *fGlobalSession != saltedSessionMode {
+		closeStarted()
+		return nil, 0, nil, fmt.Errorf("cannot encrypt parameters of %v, which is authorized by a policy session, "+
+			"with -%s %s: use -%s %s instead", cc, sessionFlagName, hmacSessionMode, sessionFlagName, saltedSessionMode)
+	}
+
+	if enc == -1 {
+		s, err := startParamSession(rw)
+		if err != nil {
+			closeStarted()
+			return nil, 0, nil, err
+		}
+		started = append(started, s)
+
+		// A session used only for parameter encryption is associated with
+		// no entity, so no authValue is included in its keys.
+		s.authValue = false
+		result = append(result, authorization{session: s})
+		enc = len(result) - 1
+	}
+
+	return result, enc, started, nil
+}
+
+// responseAuths returns the authorizations with which the HMACs of a
+// command's response are computed, given its unencrypted parameters. These are
+// the command's authorizations, except that for a command which changes the
+// authValue of the entity authorized by its first authorization, the new
+// authValue is used for that authorization.
+func responseAuths(cc pgtpm.Command, auths []authorization, params []byte) ([]authorization, error) {
+	if !authChange[cc] {
+		return auths, nil
+	}
+
+	var newAuth tpmutil.U16Bytes
+	if _, err := tpmutil.Unpack(params, &newAuth); err != nil {
+		return nil, fmt.Errorf("failed to decode new authorization value: %v", err)
+	}
+
+	result := append([]authorization{}, auths...)
+	result[0].password = string(newAuth)
+
+	return result, nil
+}
+
+// verifyResponse verifies the response HMAC of a session which authorizes
+// commands with an HMAC, using the session's current nonces. Sessions which
+// do not compute HMACs are not verified.
+func (s *session) verifyResponse(authValue string, cc pgtpm.Command, rparams, ack []byte,
+	attrs tpm2.SessionAttributes) error {
+	if !s.computesHMAC() {
+		return nil
+	}
+
+	rpHash, err := responseParamHash(s.hash, cc, rparams)
+	if err != nil {
+		return err
+	}
+
+	expected := sessionHMAC(s.hash, s.hmacKey(authValue), rpHash, s.nonceTPM, s.nonceCaller, attrs)
+
+	if !hmac.Equal(ack, expected) {
+		return errors.New("response HMAC verification failed")
+	}
+
+	return nil
+}
+
+// commandParamHash computes the command parameter hash, cpHash, of a command
+// from the names of its handles and its parameters, per TPM 2.0 Part 1
+// section 18.7.
+func commandParamHash(h crypto.Hash, cc pgtpm.Command, names [][]byte, params []byte) ([]byte, error) {
+	b, err := tpmutil.Pack(uint32(cc))
+	if err != nil {
+		return nil, err
+	}
+
+	return hashConcat(h, append(append([][]byte{b}, names...), params)...), nil
+}
+
+// responseParamHash computes the response parameter hash, rpHash, of a
+// successful command from its response parameters, per TPM 2.0 Part 1
+// section 18.8.
+func responseParamHash(h crypto.Hash, cc pgtpm.Command, rparams []byte) ([]byte, error) {
+	b, err := tpmutil.Pack(uint32(tpmutil.RCSuccess), uint32(cc))
+	if err != nil {
+		return nil, err
+	}
+
+	return hashConcat(h, b, rparams), nil
+}
+
+// sessionHMAC computes a command or response HMAC, per TPM 2.0 Part 1
+// section 19.6. The command HMAC of the first session includes encNonces,
+// the TPM nonces of a different session used for parameter decryption and
+// encryption, in that order.
+func sessionHMAC(h crypto.Hash, key, pHash, nonceNewer, nonceOlder []byte,
+	attrs tpm2.SessionAttributes, encNonces ...[]byte) []byte {
+	mac := hmac.New(h.New, key)
+	mac.Write(pHash)
+	mac.Write(nonceNewer)
+	mac.Write(nonceOlder)
+	for _, n := range encNonces {
+		mac.Write(n)
+	}
+	mac.Write([]byte{byte(attrs)})
+
+	return mac.Sum(nil)
+}
+
+// handleName returns the name of the entity with the specified handle.
+func handleName(rw io.ReadWriter, h tpmutil.Handle) ([]byte, error) {
+	switch pgtpm.Handle(h).HandleType() {
+	case pgtpm.TPM2_HT_TRANSIENT, pgtpm.TPM2_HT_PERSISTENT:
+		pub, _, _, err := tpm2.ReadPublic(rw, h)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public area: %v", err)
+		}
+
+		return publicName(pub)
+
+	case pgtpm.TPM2_HT_NV_INDEX:
+		pub, err := tpm2.NVReadPublic(rw, h)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read NV public area: %v", err)
+		}
+
+		return nvPublicName(pub)
+	}
+
+	return tpmutil.Pack(h)
+}
+
+// nvPublicName returns the name of an NV index from its public area.
+func nvPublicName(pub tpm2.NVPublic) ([]byte, error) {
+	h, err := pub.NameAlg.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("unsupported NV name algorithm: %v", pgtpm.Algorithm(pub.NameAlg))
+	}
+
+	data, err := tpmutil.Pack(pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode NV public area: %v", err)
+	}
+
+	alg, err := tpmutil.Pack(pub.NameAlg)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(alg, hashConcat(h, data)...), nil
+}
+
+// responseError returns the error corresponding to a TPM response code, per
+// the "Response Code Evaluation" chart in TPM 2.0 Part 1.
+func responseError(code tpmutil.ResponseCode) error {
+	switch {
+	case code&0x180 == 0:
+		return fmt.Errorf("response status 0x%x", code)
+
+	case code&0x80 == 0 && code&0x400 != 0:
+		return tpm2.VendorError{Code: uint32(code)}
+
+	case code&0x80 == 0 && code&0x800 != 0:
+		return tpm2.Warning{Code: tpm2.RCWarn(code & 0x7f)}
+
+	case code&0x80 == 0:
+		return tpm2.Error{Code: tpm2.RCFmt0(code & 0x7f)}
+
+	case code&0x40 != 0:
+		return tpm2.ParameterError{Code: tpm2.RCFmt1(code & 0x3f), Parameter: tpm2.RCIndex((code & 0xf00) >> 8)}
+
+	case code&0x800 == 0:
+		return tpm2.HandleError{Code: tpm2.RCFmt1(code & 0x3f), Handle: tpm2.RCIndex((code & 0x700) >> 8)}
+	}
+
+	return tpm2.SessionError{Code: tpm2.RCFmt1(code & 0x3f), Session: tpm2.RCIndex((code & 0x700) >> 8)}
+}
+
+// runCommand runs a command which requires no authorization, and returns the
+// response.
+func runCommand(rw io.ReadWriter, cc pgtpm.Command, in ...interface{}) ([]byte, error) {
+	resp, code, err := tpmutil.RunCommand(rw, tpm2.TagNoSessions, tpmutil.Command(cc), in...)
+	if err != nil {
+		return nil, err
+	}
+
+	if code != tpmutil.RCSuccess {
+		return nil, responseError(code)
+	}
+
+	return resp, nil
+}
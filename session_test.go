@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// Known-answer vectors for SHA256 sessions, computed independently from the
+// definitions in TPM 2.0 Part 1 with the inputs returned by byteRange.
+const (
+	// testSessionKey is KDFa(salt, "ATH", nonceTPM, nonceCaller, 256).
+	testSessionKey = "0e910bfdca487340700b56f80f725785fc10ae9b0fc45c7bd79d2dc606187153"
+
+	// testCipherText is "secret parameter!!" encrypted with AES-128-CFB,
+	// with the key and IV from KDFa(sessionKey || "owner", "CFB",
+	// nonceCaller, nonceTPM, 256).
+	testCipherText = "df4394d5c589f36c979b986e4e68fdf30e6c"
+
+	// testCPHash is the cpHash of TPM2_Sign with testName and testParams.
+	testCPHash = "cbd5ebe628c2336d83c515600e675444fb3e82fd7f71cdcbf7f952cf6c4e4c93"
+
+	// testRPHash is the rpHash of TPM2_Sign with testResponseData.
+	testRPHash = "1fa2186dad55bbc1b034ce2c3c08e1e0978e415b98318b158a2e5f9ebad13917"
+
+	// testCommandHMAC is the command HMAC of testCPHash with the salted
+	// session key and the authValue "owner", with continueSession and
+	// decrypt set.
+	testCommandHMAC = "e73df8dc06a800ca2feee8c75b68b5d2f1fb77f12f9e4808f1f53acce72a99a4"
+
+	// testUnsaltedCommandHMAC is as testCommandHMAC, but for an unsalted
+	// session, whose HMAC key is the authValue alone.
+	testUnsaltedCommandHMAC = "0b13db2d4e76c940c5ce3deb3289ba664280967a1b49ef3324820294ec034c59"
+
+	// testSeparateDecryptHMAC is as testUnsaltedCommandHMAC, but with only
+	// continueSession set, and with decrypt set on a separate session whose
+	// nonceTPM is testNonceTPM2.
+	testSeparateDecryptHMAC = "d4a33ed7f5c4991848acb686a57293cb86d7fe9cebf1f2222a5c943b082e35a3"
+
+	// testChangeAuthHMAC is the response HMAC of TPM2_HierarchyChangeAuth
+	// with the salted session key and the new authValue "newpass", the
+	// response nonce testNonceTPM2, and continueSession set.
+	testChangeAuthHMAC = "6835f0b7d9e4abb798f4e1a4380a876f7fcf35a20b1f3c20e86d66941ec07e35"
+)
+
+// Inputs of the known-answer vectors.
+var (
+	testSalt         = byteRange(0x00, 32)
+	testNonceTPM     = byteRange(0x20, 32)
+	testNonceCaller  = byteRange(0x40, 32)
+	testNonceTPM2    = byteRange(0x80, 32)
+	testName         = append([]byte{0x00, 0x0b}, byteRange(0x60, 32)...)
+	testParams       = []byte{0x00, 0x04, 0xde, 0xad, 0xbe, 0xef}
+	testResponseData = []byte{0x00, 0x14, 0x00, 0x0b, 0x00, 0x02, 0xca, 0xfe}
+)
+
+func TestDeriveSessionKey(t *testing.T) {
+	t.Parallel()
+
+	got, err := deriveSessionKey(tpm2.AlgSHA256, testSalt, testNonceTPM, testNonceCaller)
+	if err != nil {
+		t.Fatalf("couldn't derive session key: %v", err)
+	}
+
+	if want := mustDecodeHex(t, testSessionKey); !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+}
+
+func TestHMACKey(t *testing.T) {
+	t.Parallel()
+
+	sessionKey := mustDecodeHex(t, testSessionKey)
+
+	var testcases = []struct {
+		name      string
+		sess      *session
+		authValue string
+		want      []byte
+	}{
+		{
+			name:      "Salted",
+			sess:      &session{sessionKey: sessionKey, authValue: true},
+			authValue: "owner",
+			want:      append(append([]byte{}, sessionKey...), "owner"...),
+		},
+		{
+			name:      "Unsalted",
+			sess:      &session{authValue: true},
+			authValue: "owner",
+			want:      []byte("owner"),
+		},
+		{
+			// Trailing zero octets are removed from authValues.
+			name:      "TrailingZeros",
+			sess:      &session{sessionKey: sessionKey, authValue: true},
+			authValue: "owner\x00\x00",
+			want:      append(append([]byte{}, sessionKey...), "owner"...),
+		},
+		{
+			// An authValue is not included for policy sessions without
+			// PolicyAuthValue, or for sessions used only for parameter
+			// encryption.
+			name:      "NoAuthValue",
+			sess:      &session{sessionKey: sessionKey},
+			authValue: "owner",
+			want:      sessionKey,
+		},
+	}
+
+	for _, tc := range testcases {
+		var tc = tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tc.sess.hmacKey(tc.authValue); !bytes.Equal(got, tc.want) {
+				t.Errorf("got %x, want %x", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParamCipher(t *testing.T) {
+	t.Parallel()
+
+	s := &session{
+		hash:       crypto.SHA256,
+		sessionKey: mustDecodeHex(t, testSessionKey),
+		authValue:  true,
+		symmetric:  true,
+	}
+
+	const plainText = "secret parameter!!"
+
+	params := append(mustPack(t, tpmutil.U16Bytes(plainText)), testParams...)
+
+	stream, err := s.paramCipher("owner", testNonceCaller, testNonceTPM, true)
+	if err != nil {
+		t.Fatalf("couldn't get cipher: %v", err)
+	}
+
+	if err := cryptParam(params, stream); err != nil {
+		t.Fatalf("couldn't encrypt parameter: %v", err)
+	}
+
+	// Only the contents of the sized buffer are encrypted.
+	want := append(append(mustPack(t, uint16(len(plainText))),
+		mustDecodeHex(t, testCipherText)...), testParams...)
+	if !bytes.Equal(params, want) {
+		t.Fatalf("got %x, want %x", params, want)
+	}
+
+	stream, err = s.paramCipher("owner", testNonceCaller, testNonceTPM, false)
+	if err != nil {
+		t.Fatalf("couldn't get cipher: %v", err)
+	}
+
+	if err := cryptParam(params, stream); err != nil {
+		t.Fatalf("couldn't decrypt parameter: %v", err)
+	}
+
+	if got := string(params[2 : 2+len(plainText)]); got != plainText {
+		t.Errorf("got %q, want %q", got, plainText)
+	}
+}
+
+func TestCryptParamFailure(t *testing.T) {
+	t.Parallel()
+
+	s := &session{hash: crypto.SHA256, authValue: true, symmetric: true}
+
+	for _, params := range [][]byte{{}, {0x00}, {0x00, 0x04, 0x01, 0x02, 0x03}} {
+		stream, err := s.paramCipher("owner", testNonceCaller, testNonceTPM, true)
+		if err != nil {
+			t.Fatalf("couldn't get cipher: %v", err)
+		}
+
+		if err := cryptParam(params, stream); err == nil {
+			t.Errorf("unexpectedly encrypted parameters %x", params)
+		}
+	}
+}
+
+func TestParamHashes(t *testing.T) {
+	t.Parallel()
+
+	cpHash, err := commandParamHash(crypto.SHA256, pgtpm.TPM2_CC_Sign, [][]byte{testName}, testParams)
+	if err != nil {
+		t.Fatalf("couldn't compute cpHash: %v", err)
+	}
+
+	if want := mustDecodeHex(t, testCPHash); !bytes.Equal(cpHash, want) {
+		t.Errorf("got cpHash %x, want %x", cpHash, want)
+	}
+
+	rpHash, err := responseParamHash(crypto.SHA256, pgtpm.TPM2_CC_Sign, testResponseData)
+	if err != nil {
+		t.Fatalf("couldn't compute rpHash: %v", err)
+	}
+
+	if want := mustDecodeHex(t, testRPHash); !bytes.Equal(rpHash, want) {
+		t.Errorf("got rpHash %x, want %x", rpHash, want)
+	}
+}
+
+func TestSessionHMAC(t *testing.T) {
+	t.Parallel()
+
+	var testcases = []struct {
+		name      string
+		sess      *session
+		attrs     tpm2.SessionAttributes
+		encNonces [][]byte
+		want      string
+	}{
+		{
+			name:  "Salted",
+			sess:  &session{hash: crypto.SHA256, sessionKey: mustDecodeHex(t, testSessionKey), authValue: true},
+			attrs: tpm2.AttrContinueSession | tpm2.AttrDecrypt,
+			want:  testCommandHMAC,
+		},
+		{
+			name:  "Unsalted",
+			sess:  &session{hash: crypto.SHA256, authValue: true},
+			attrs: tpm2.AttrContinueSession | tpm2.AttrDecrypt,
+			want:  testUnsaltedCommandHMAC,
+		},
+		{
+			name:      "SeparateDecryptSession",
+			sess:      &session{hash: crypto.SHA256, authValue: true},
+			attrs:     tpm2.AttrContinueSession,
+			encNonces: [][]byte{testNonceTPM2},
+			want:      testSeparateDecryptHMAC,
+		},
+	}
+
+	for _, tc := range testcases {
+		var tc = tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := sessionHMAC(tc.sess.hash, tc.sess.hmacKey("owner"), mustDecodeHex(t, testCPHash),
+				testNonceCaller, testNonceTPM, tc.attrs, tc.encNonces...)
+
+			if want := mustDecodeHex(t, tc.want); !bytes.Equal(got, want) {
+				t.Errorf("got %x, want %x", got, want)
+			}
+		})
+	}
+}
+
+func TestVerifyResponseAuthChange(t *testing.T) {
+	t.Parallel()
+
+	s := &session{
+		hash:        crypto.SHA256,
+		nonceCaller: testNonceCaller,
+		nonceTPM:    testNonceTPM2,
+		sessionKey:  mustDecodeHex(t, testSessionKey),
+		authValue:   true,
+		hmac:        true,
+	}
+
+	auths := []authorization{{session: s, password: "owner"}}
+	params := mustPack(t, tpmutil.U16Bytes("newpass"))
+	ack := mustDecodeHex(t, testChangeAuthHMAC)
+
+	respAuths, err := responseAuths(pgtpm.TPM2_CC_HierarchyChangeAuth, auths, params)
+	if err != nil {
+		t.Fatalf("couldn't get response authorizations: %v", err)
+	}
+
+	if err := s.verifyResponse(respAuths[0].password, pgtpm.TPM2_CC_HierarchyChangeAuth,
+		nil, ack, tpm2.AttrContinueSession); err != nil {
+		t.Errorf("couldn't verify response with new authValue: %v", err)
+	}
+
+	// The response is not computed with the old authValue, which is left
+	// unchanged in the command's authorizations.
+	if auths[0].password != "owner" {
+		t.Errorf("command authValue changed to %q", auths[0].password)
+	}
+
+	if err := s.verifyResponse(auths[0].password, pgtpm.TPM2_CC_HierarchyChangeAuth,
+		nil, ack, tpm2.AttrContinueSession); err == nil {
+		t.Errorf("unexpectedly verified response with old authValue")
+	}
+}
+
+func TestResponseAuths(t *testing.T) {
+	t.Parallel()
+
+	auths := []authorization{{password: "owner"}, {password: "other"}}
+	params := mustPack(t, tpmutil.U16Bytes("newpass"))
+
+	got, err := responseAuths(pgtpm.TPM2_CC_Sign, auths, params)
+	if err != nil {
+		t.Fatalf("couldn't get response authorizations: %v", err)
+	}
+
+	if got[0].password != "owner" || got[1].password != "other" {
+		t.Errorf("got %+v, want %+v", got, auths)
+	}
+
+	if _, err := responseAuths(pgtpm.TPM2_CC_HierarchyChangeAuth, auths, []byte{0x00}); err == nil {
+		t.Errorf("unexpectedly decoded new authValue")
+	}
+}
+
+// TestParamSessionsPolicy is not run in parallel, since it sets the global
+// -session option.
+func TestParamSessionsPolicy(t *testing.T) {
+	defer func(mode string) { *fGlobalSession = mode }(*fGlobalSession)
+
+	policy := &session{hash: crypto.SHA256}
+	auths := []authorization{{session: policy}}
+
+	// A command which is authorized by a policy session alone cannot have
+	// its parameters encrypted in the hmac mode, so is refused rather than
+	// run without encryption. No sessions are started, so no TPM is needed.
+	*fGlobalSession = hmacSessionMode
+	if _, _, _, err := paramSessions(nil, pgtpm.TPM2_CC_Sign, auths); err == nil {
+		t.Errorf("unexpectedly allowed unencrypted parameters")
+	}
+
+	// A command without secret parameters is run with the policy session.
+	got, enc, started, err := paramSessions(nil, pgtpm.TPM2_CC_Certify, auths)
+	if err != nil {
+		t.Fatalf("couldn't get sessions: %v", err)
+	}
+
+	if len(got) != 1 || got[0].session != policy || enc != -1 || len(started) != 0 {
+		t.Errorf("got %d authorizations, encryption session %d, %d started sessions", len(got), enc, len(started))
+	}
+}
+
+// byteRange returns n consecutive byte values beginning with start.
+func byteRange(start byte, n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = start + byte(i)
+	}
+
+	return b
+}
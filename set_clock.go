@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// setClock advances the TPM clock.
+func setClock() (err error) {
+	err = ensureAllPassed(fSetClockSet, timeFlagName)
+	if err != nil {
+		return err
+	}
+
+	ownerAuth, err := newEntityAuth(*fSetClockOwnerPassword, *fSetClockPolicy)
+	if err != nil {
+		return err
+	}
+
+	t, err := getTPM(*fSetClockTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	params, err := tpmutil.Pack(*fSetClockTime)
+	if err != nil {
+		return err
+	}
+
+	authz, err := ownerAuth.authorize(t, pgtpm.TPM2_CC_ClockSet)
+	if err != nil {
+		return fmt.Errorf("failed to authorize owner: %v", err)
+	}
+	defer closeAuthorization(t, authz, &err)
+
+	_, _, err = runAuthCommand(t, pgtpm.TPM2_CC_ClockSet,
+		[]tpmutil.Handle{tpm2.HandleOwner}, []authorization{authz}, 0, params)
+	if err != nil {
+		return fmt.Errorf("failed to set clock: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// setCommandAuditStatus changes the audit hash algorithm and the list of
+// command codes audited by the TPM.
+func setCommandAuditStatus() error {
+	if countFlagsPassed(fSetCommandAuditSet, clearFlagName, hashFlagName, setFlagName) == 0 {
+		return fmt.Errorf("at least one of %s must be provided",
+			listifyFlagNames(clearFlagName, hashFlagName, setFlagName))
+	}
+
+	var hashAlg tpm2.Algorithm
+	if *fSetCommandAuditHash != "" {
+		h, err := parseHash(*fSetCommandAuditHash)
+		if err != nil {
+			return err
+		}
+		hashAlg = hashToTPMAlgorithm[h]
+	}
+
+	setList, err := parseCommandCodes(fSetCommandAuditSetCCs)
+	if err != nil {
+		return err
+	}
+
+	clearList, err := parseCommandCodes(fSetCommandAuditClearCCs)
+	if err != nil {
+		return err
+	}
+
+	ownerAuth, err := newEntityAuth(*fSetCommandAuditOwnerPassword, *fSetCommandAuditPolicy)
+	if err != nil {
+		return err
+	}
+
+	t, err := getTPM(*fSetCommandAuditTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	// The TPM ignores the command lists when the audit hash algorithm is
+	// changed, so the two are changed in separate commands.
+	if hashAlg != 0 {
+		l, err := auditLogForHash(hashAlg)
+		if err != nil {
+			return err
+		}
+
+		var start int
+		if l != nil {
+			start = len(l.Entries)
+		}
+
+		if err := runSetCommandAudit(t, ownerAuth, hashAlg, nil, nil); err != nil {
+			return fmt.Errorf("failed to set audit hash algorithm: %v", err)
+		}
+
+		// Changing the algorithm clears the command audit digest, which
+		// the TPM then extends with the command which changed it, so
+		// verification of the log restarts from that command.
+		if l != nil {
+			l.CommandAuditStart = start
+			if err := l.save(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(setList) > 0 || len(clearList) > 0 {
+		if err := runSetCommandAudit(t, ownerAuth, tpm2.AlgNull, setList, clearList); err != nil {
+			return fmt.Errorf("failed to set command audit status: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// auditLogForHash returns the audit log named by the global -audit option,
+// if any, prepared for a change of the audit hash algorithm. The log's hash
+// algorithm must match the TPM's for its command audit digest to be
+// verified, and may only be changed before the log starts its audit session.
+func auditLogForHash(hashAlg tpm2.Algorithm) (*auditLog, error) {
+	l, err := currentAuditLog()
+	if err != nil || l == nil {
+		return nil, err
+	}
+
+	if l.HashAlg != pgtpm.Algorithm(hashAlg) {
+		if l.Session != nil {
+			return nil, fmt.Errorf("audit log hash algorithm %v does not match %v, start a new audit log",
+				l.HashAlg, pgtpm.Algorithm(hashAlg))
+		}
+		l.HashAlg = pgtpm.Algorithm(hashAlg)
+	}
+
+	return l, nil
+}
+
+// runSetCommandAudit runs TPM2_SetCommandCodeAuditStatus with owner
+// authorization.
+func runSetCommandAudit(rw io.ReadWriter, ownerAuth entityAuth, hashAlg tpm2.Algorithm,
+	setList, clearList []pgtpm.Command) (err error) {
+	params, err := tpmutil.Pack(hashAlg)
+	if err != nil {
+		return err
+	}
+
+	for _, list := range [][]pgtpm.Command{setList, clearList} {
+		b, err := tpmutil.Pack(uint32(len(list)))
+		if err != nil {
+			return err
+		}
+		params = append(params, b...)
+
+		for _, cc := range list {
+			b, err := tpmutil.Pack(uint32(cc))
+			if err != nil {
+				return err
+			}
+			params = append(params, b...)
+		}
+	}
+
+	authz, err := ownerAuth.authorize(rw, pgtpm.TPM2_CC_SetCommandCodeAuditStatus)
+	if err != nil {
+		return fmt.Errorf("failed to authorize owner: %v", err)
+	}
+	defer closeAuthorization(rw, authz, &err)
+
+	_, _, err = runAuthCommand(rw, pgtpm.TPM2_CC_SetCommandCodeAuditStatus,
+		[]tpmutil.Handle{tpm2.HandleOwner}, []authorization{authz}, 0, params)
+
+	return err
+}
+
+// parseCommandCodes parses a list of command codes.
+func parseCommandCodes(names []string) ([]pgtpm.Command, error) {
+	var ccs []pgtpm.Command
+
+	for _, name := range names {
+		if name == "" {
+			return nil, errors.New("empty command code")
+		}
+
+		cc, err := parseCommandCode(name)
+		if err != nil {
+			return nil, err
+		}
+
+		ccs = append(ccs, cc)
+	}
+
+	return ccs, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// hashCheckTag is the TPM_ST_HASHCHECK structure tag.
+const hashCheckTag = 0x8024
+
+// signData signs the digest of some data with a TPM key. RSA signatures are
+// output as raw signature values, and ECDSA signatures as ASN.1 DER-encoded
+// sequences of r and s.
+func signData() (err error) {
+	err = ensureExactlyOnePassed(fSignSet, contextFlagName, handleFlagName)
+	if err != nil {
+		return err
+	}
+
+	hash, err := parseHash(*fSignHash)
+	if err != nil {
+		return err
+	}
+
+	auth, err := newEntityAuth(*fSignPassword, *fSignPolicy)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if *fSignIn != "" {
+		data, err = ioutil.ReadFile(*fSignIn)
+	} else {
+		data, err = ioutil.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read input: %v", err)
+	}
+
+	t, err := getTPM(*fSignTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	handle, release, err := contextHandle(t, fSignHandle, *fSignContext)
+	if err != nil {
+		return err
+	}
+	defer release(&err)
+
+	pub, _, _, err := tpm2.ReadPublic(t, handle)
+	if err != nil {
+		return fmt.Errorf("failed to read public area: %v", err)
+	}
+
+	scheme, err := signingScheme(pub, hash, *fSignPSS)
+	if err != nil {
+		return err
+	}
+
+	h, err := scheme.Hash.Hash()
+	if err != nil {
+		return err
+	}
+
+	digest := hashConcat(h, data)
+
+	authz, err := auth.authorize(t, pgtpm.TPM2_CC_Sign)
+	if err != nil {
+		return fmt.Errorf("failed to authorize key: %v", err)
+	}
+	defer closeAuthorization(t, authz, &err)
+
+	params, err := tpmutil.Pack(tpmutil.U16Bytes(digest), scheme.Alg, scheme.Hash,
+		uint16(hashCheckTag), tpm2.HandleNull, tpmutil.U16Bytes(nil))
+	if err != nil {
+		return err
+	}
+
+	_, resp, err := runAuthCommand(t, pgtpm.TPM2_CC_Sign,
+		[]tpmutil.Handle{handle}, []authorization{authz}, 0, params)
+	if err != nil {
+		return fmt.Errorf("failed to sign digest: %v", err)
+	}
+
+	sig, err := tpm2.DecodeSignature(bytes.NewBuffer(resp))
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %v", err)
+	}
+
+	var out []byte
+	switch {
+	case sig.RSA != nil:
+		out = sig.RSA.Signature
+
+	case sig.ECC != nil:
+		out, err = asn1.Marshal(struct{ R, S *big.Int }{sig.ECC.R, sig.ECC.S})
+		if err != nil {
+			return fmt.Errorf("failed to marshal ECDSA signature: %v", err)
+		}
+
+	default:
+		return errors.New("unexpected signature type")
+	}
+
+	if *fSignOut != "" {
+		if err := ioutil.WriteFile(*fSignOut, out, 0644); err != nil {
+			return fmt.Errorf("failed to write output file: %v", err)
+		}
+
+		return nil
+	}
+
+	os.Stdout.Write(out)
+
+	return nil
+}
+
+// signingScheme returns the signature scheme to use with a key. The key's own
+// scheme is used if it has one, otherwise RSASSA, RSAPSS or ECDSA is chosen
+// as appropriate. If hash is zero, SHA256 is used unless the key's scheme
+// specifies otherwise.
+func signingScheme(pub tpm2.Public, hash crypto.Hash, pss bool) (tpm2.SigScheme, error) {
+	var keyScheme *tpm2.SigScheme
+	var scheme tpm2.SigScheme
+
+	switch {
+	case pub.RSAParameters != nil:
+		keyScheme = pub.RSAParameters.Sign
+		scheme.Alg = tpm2.AlgRSASSA
+		if pss {
+			scheme.Alg = tpm2.AlgRSAPSS
+		}
+
+	case pub.ECCParameters != nil:
+		if pss {
+			return tpm2.SigScheme{}, errors.New("RSASSA-PSS cannot be used with an ECC key")
+		}
+		keyScheme = pub.ECCParameters.Sign
+		scheme.Alg = tpm2.AlgECDSA
+
+	default:
+		return tpm2.SigScheme{}, errors.New("not an RSA or ECC key")
+	}
+
+	if keyScheme != nil && !keyScheme.Alg.IsNull() {
+		if pss && keyScheme.Alg != tpm2.AlgRSAPSS {
+			return tpm2.SigScheme{}, fmt.Errorf("key requires signature scheme %v",
+				pgtpm.Algorithm(keyScheme.Alg))
+		}
+
+		if hash != 0 && hashToTPMAlgorithm[hash] != keyScheme.Hash {
+			return tpm2.SigScheme{}, fmt.Errorf("key requires hash algorithm %v",
+				pgtpm.Algorithm(keyScheme.Hash))
+		}
+
+		return *keyScheme, nil
+	}
+
+	if hash == 0 {
+		hash = crypto.SHA256
+	}
+
+	alg, ok := hashToTPMAlgorithm[hash]
+	if !ok {
+		return tpm2.SigScheme{}, fmt.Errorf("unsupported hash algorithm: %v", hash)
+	}
+	scheme.Hash = alg
+
+	return scheme, nil
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/paulgriffiths/tpmtool/tpmkey"
+)
+
+// tpmAgent implements agent.ExtendedAgent using keys resident in a TPM. Since
+// the agent serves connections concurrently, all access to the TPM is
+// serialized.
+type tpmAgent struct {
+	mu         sync.Mutex
+	keys       []agentKey
+	locked     bool
+	passphrase []byte
+}
+
+// agentKey is a TPM key served by the agent.
+type agentKey struct {
+	key     *tpmkey.Key
+	signer  ssh.AlgorithmSigner
+	comment string
+}
+
+// errAgentLocked is returned by operations attempted on a locked agent.
+var errAgentLocked = errors.New("agent is locked")
+
+// sshAgent runs an SSH agent serving TPM keys on a Unix domain socket.
+func sshAgent() (err error) {
+	err = ensureAllPassed(fSSHAgentSet, socketFlagName)
+	if err != nil {
+		return err
+	}
+
+	if len(fSSHAgentHandles) == 0 && len(fSSHAgentContexts) == 0 &&
+		len(fSSHAgentKeyFiles) == 0 && *fSSHAgentTemplate == "" {
+		return fmt.Errorf("at least one of %s must be provided",
+			listifyFlagNames(contextFlagName, handleFlagName, keyFileFlagName, templateFlagName))
+	}
+
+	if (len(fSSHAgentKeyFiles) != 0 || *fSSHAgentTemplate != "") && !isFlagPassed(fSSHAgentSet, parentFlagName) {
+		return fmt.Errorf("-%s must be provided with -%s or -%s",
+			parentFlagName, keyFileFlagName, templateFlagName)
+	}
+
+	t, err := getTPM(*fSSHAgentTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	var a tpmAgent
+	defer func() {
+		if cerr := a.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	parent := tpmutil.Handle(fSSHAgentParent)
+
+	// Add keys by handle.
+	for _, h := range fSSHAgentHandles {
+		key, err := tpmkey.New(t, tpmutil.Handle(h), *fSSHAgentPassword)
+		if err != nil {
+			return err
+		}
+
+		if err := a.addKey(key, fmt.Sprintf("tpm:%s", h.String())); err != nil {
+			return err
+		}
+	}
+
+	// Add keys from saved contexts.
+	for _, name := range fSSHAgentContexts {
+		key, err := tpmkey.LoadContextFile(t, name, *fSSHAgentPassword)
+		if err != nil {
+			return err
+		}
+
+		if err := a.addKey(key, fmt.Sprintf("tpm:%s", name)); err != nil {
+			key.Close()
+			return err
+		}
+	}
+
+	// Add keys from public and private area files.
+	for _, kf := range fSSHAgentKeyFiles {
+		files := strings.Split(kf, ",")
+		if len(files) != 2 {
+			return fmt.Errorf("-%s must be of the form <public>,<private>", keyFileFlagName)
+		}
+
+		key, err := tpmkey.LoadFiles(t, parent, *fSSHAgentParentPassword,
+			files[0], files[1], *fSSHAgentPassword)
+		if err != nil {
+			return err
+		}
+
+		if err := a.addKey(key, fmt.Sprintf("tpm:%s", files[0])); err != nil {
+			key.Close()
+			return err
+		}
+	}
+
+	// Create and add a new key, if requested.
+	if *fSSHAgentTemplate != "" {
+		key, err := createAgentKey(t, parent)
+		if err != nil {
+			return err
+		}
+
+		if err := a.addKey(key, "tpm:new"); err != nil {
+			key.Close()
+			return err
+		}
+	}
+
+	// Listen for and serve connections until interrupted. The socket is
+	// created with owner-only permissions from the outset, since anyone who
+	// can connect to it can sign with the keys.
+	mask := syscall.Umask(0177)
+	l, err := net.Listen("unix", *fSSHAgentSocket)
+	syscall.Umask(mask)
+	if err != nil {
+		return fmt.Errorf("failed to listen on socket: %v", err)
+	}
+
+	// Stop accepting and serving connections before the keys are closed.
+	var conns serverConns
+	defer conns.closeAll()
+	defer l.Close()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		l.Close()
+	}()
+
+	fmt.Printf("SSH_AUTH_SOCK=%s; export SSH_AUTH_SOCK;\n", *fSSHAgentSocket)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+
+			// The listener is closed when the agent is interrupted.
+			return nil
+		}
+
+		if !conns.add(conn) {
+			conn.Close()
+			continue
+		}
+
+		go func() {
+			defer conns.remove(conn)
+			if err := agent.ServeAgent(&a, conn); err != nil && !errors.Is(err, io.EOF) && !conns.exiting() {
+				log.Printf("failed to serve agent connection: %v", err)
+			}
+		}()
+	}
+}
+
+// serverConns tracks the connections being served by the agent or TLS proxy,
+// so that they can be closed and their goroutines waited for on exit.
+type serverConns struct {
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	conns  map[net.Conn]bool
+	closed bool
+}
+
+// add adds a connection, returning false if the server is exiting.
+func (c *serverConns) add(conn net.Conn) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return false
+	}
+
+	if c.conns == nil {
+		c.conns = make(map[net.Conn]bool)
+	}
+	c.conns[conn] = true
+	c.wg.Add(1)
+
+	return true
+}
+
+// remove closes and removes a connection once it has been served.
+func (c *serverConns) remove(conn net.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	conn.Close()
+	delete(c.conns, conn)
+	c.wg.Done()
+}
+
+// exiting reports whether the server is exiting, in which case errors from
+// closed connections are expected.
+func (c *serverConns) exiting() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.closed
+}
+
+// closeAll closes all connections and waits for them to finish being served.
+func (c *serverConns) closeAll() {
+	c.mu.Lock()
+	c.closed = true
+	for conn := range c.conns {
+		conn.Close()
+	}
+	c.mu.Unlock()
+
+	c.wg.Wait()
+}
+
+// createAgentKey creates a new key under the specified parent and loads it,
+// optionally writing the public and private areas to files so that the key
+// may be reused.
+func createAgentKey(t io.ReadWriter, parent tpmutil.Handle) (*tpmkey.Key, error) {
+	tmpl, err := tpmkey.LoadTemplate(*fSSHAgentTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	private, public, _, _, _, err := tpm2.CreateKey(t, parent, tpm2.PCRSelection{},
+		*fSSHAgentParentPassword, *fSSHAgentPassword, tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create object: %v", err)
+	}
+
+	if *fSSHAgentPublicOut != "" {
+		if err := ioutil.WriteFile(*fSSHAgentPublicOut, public, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write public area: %v", err)
+		}
+	}
+
+	if *fSSHAgentPrivateOut != "" {
+		if err := ioutil.WriteFile(*fSSHAgentPrivateOut, private, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write private area: %v", err)
+		}
+	}
+
+	return tpmkey.Load(t, parent, *fSSHAgentParentPassword, public, private, *fSSHAgentPassword)
+}
+
+// addKey adds a TPM key to the agent.
+func (a *tpmAgent) addKey(key *tpmkey.Key, comment string) error {
+	signer, err := ssh.NewSignerFromSigner(key)
+	if err != nil {
+		return fmt.Errorf("failed to create SSH signer: %v", err)
+	}
+
+	algSigner, ok := signer.(ssh.AlgorithmSigner)
+	if !ok {
+		return errors.New("SSH signer does not support algorithm selection")
+	}
+
+	a.keys = append(a.keys, agentKey{
+		key:     key,
+		signer:  algSigner,
+		comment: comment,
+	})
+
+	return nil
+}
+
+// List returns the identities known to the agent.
+func (a *tpmAgent) List() ([]*agent.Key, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.locked {
+		return nil, nil
+	}
+
+	var keys []*agent.Key
+	for _, k := range a.keys {
+		pub := k.signer.PublicKey()
+		keys = append(keys, &agent.Key{
+			Format:  pub.Type(),
+			Blob:    pub.Marshal(),
+			Comment: k.comment,
+		})
+	}
+
+	return keys, nil
+}
+
+// Sign has the agent sign the data using a protocol 2 key as defined in
+// [PROTOCOL.agent] section 2.6.2.
+func (a *tpmAgent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return a.SignWithFlags(key, data, 0)
+}
+
+// SignWithFlags signs like Sign, but allows for RSA SHA-2 signature
+// algorithms to be requested.
+func (a *tpmAgent) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.locked {
+		return nil, errAgentLocked
+	}
+
+	var alg string
+	if key.Type() == ssh.KeyAlgoRSA {
+		switch {
+		case flags&agent.SignatureFlagRsaSha512 != 0:
+			alg = ssh.SigAlgoRSASHA2512
+
+		case flags&agent.SignatureFlagRsaSha256 != 0:
+			alg = ssh.SigAlgoRSASHA2256
+		}
+	}
+
+	blob := key.Marshal()
+	for _, k := range a.keys {
+		if bytes.Equal(k.signer.PublicKey().Marshal(), blob) {
+			return k.signer.SignWithAlgorithm(rand.Reader, data, alg)
+		}
+	}
+
+	return nil, errors.New("key not found")
+}
+
+// close closes all the keys served by the agent.
+func (a *tpmAgent) close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.closeKeys()
+}
+
+// closeKeys closes and removes all the keys served by the agent, returning
+// the first error encountered. The caller must hold a.mu.
+func (a *tpmAgent) closeKeys() error {
+	var err error
+	for _, k := range a.keys {
+		if cerr := k.key.Close(); cerr != nil {
+			if err == nil {
+				err = cerr
+			} else {
+				log.Printf("%v", cerr)
+			}
+		}
+	}
+	a.keys = nil
+
+	return err
+}
+
+// Add is not supported, since private keys cannot be imported into the TPM by
+// the agent. TPM keys can only be served if given when the agent is started.
+func (a *tpmAgent) Add(key agent.AddedKey) error {
+	return fmt.Errorf("adding keys is not supported, restart %s %s with -%s, -%s or -%s",
+		appName, sshAgentCommand, handleFlagName, keyFileFlagName, templateFlagName)
+}
+
+// Remove stops the agent serving the specified key. The key is not removed
+// from the TPM.
+func (a *tpmAgent) Remove(key ssh.PublicKey) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.locked {
+		return errAgentLocked
+	}
+
+	blob := key.Marshal()
+	for i, k := range a.keys {
+		if bytes.Equal(k.signer.PublicKey().Marshal(), blob) {
+			a.keys = append(a.keys[:i], a.keys[i+1:]...)
+
+			return k.key.Close()
+		}
+	}
+
+	return errors.New("key not found")
+}
+
+// RemoveAll stops the agent serving any keys. The keys are not removed from
+// the TPM.
+func (a *tpmAgent) RemoveAll() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.locked {
+		return errAgentLocked
+	}
+
+	return a.closeKeys()
+}
+
+// Lock locks the agent. Sign and Remove will fail, and List will return an
+// empty list, until the agent is unlocked.
+func (a *tpmAgent) Lock(passphrase []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.locked {
+		return errAgentLocked
+	}
+
+	a.locked = true
+	a.passphrase = passphrase
+
+	return nil
+}
+
+// Unlock undoes the effect of Lock.
+func (a *tpmAgent) Unlock(passphrase []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.locked {
+		return errors.New("agent is not locked")
+	}
+
+	if subtle.ConstantTimeCompare(passphrase, a.passphrase) != 1 {
+		return errors.New("incorrect passphrase")
+	}
+
+	a.locked = false
+	a.passphrase = nil
+
+	return nil
+}
+
+// Signers returns signers for all the known keys.
+func (a *tpmAgent) Signers() ([]ssh.Signer, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.locked {
+		return nil, errAgentLocked
+	}
+
+	var signers []ssh.Signer
+	for _, k := range a.keys {
+		signers = append(signers, k.signer)
+	}
+
+	return signers, nil
+}
+
+// Extension is not supported.
+func (a *tpmAgent) Extension(extensionType string, contents []byte) ([]byte, error) {
+	return nil, agent.ErrExtensionUnsupported
+}
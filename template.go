@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math/big"
+
+	"github.com/google/go-tpm/tpm2"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// objectAttributes are the object attributes, in the order in which they
+// should be output.
+var objectAttributes = []pgtpm.ObjectAttribute{
+	pgtpm.TPMA_OBJECT_FIXEDTPM,
+	pgtpm.TPMA_OBJECT_STCLEAR,
+	pgtpm.TPMA_OBJECT_FIXEDPARENT,
+	pgtpm.TPMA_OBJECT_SENSITIVEDATAORIGIN,
+	pgtpm.TPMA_OBJECT_USERWITHAUTH,
+	pgtpm.TPMA_OBJECT_ADMINWITHPOLICY,
+	pgtpm.TPMA_OBJECT_NODA,
+	pgtpm.TPMA_OBJECT_ENCRYPTEDDUPLICATION,
+	pgtpm.TPMA_OBJECT_RESTRICTED,
+	pgtpm.TPMA_OBJECT_DECRYPT,
+	pgtpm.TPMA_OBJECT_SIGN_ENCRYPT,
+}
+
+// publicToTemplate converts a public area to a template which, when passed
+// to ToPublic, yields an identical public area.
+func publicToTemplate(pub tpm2.Public) pgtpm.PublicTemplate {
+	tmpl := pgtpm.PublicTemplate{
+		Type:    pgtpm.Algorithm(pub.Type),
+		NameAlg: pgtpm.Algorithm(pub.NameAlg),
+	}
+
+	for _, a := range objectAttributes {
+		if pgtpm.ObjectAttribute(pub.Attributes)&a != 0 {
+			tmpl.Attributes = append(tmpl.Attributes, a)
+		}
+	}
+
+	if len(pub.AuthPolicy) > 0 {
+		tmpl.AuthPolicy = []byte(pub.AuthPolicy)
+	}
+
+	switch {
+	case pub.RSAParameters != nil:
+		param := pub.RSAParameters
+
+		tmpl.RSAParameters = &pgtpm.RSAParams{
+			Symmetric: symSchemeToTemplate(param.Symmetric),
+			Sign:      sigSchemeToTemplate(param.Sign),
+			KeyBits:   param.KeyBits,
+			Exponent:  param.ExponentRaw,
+		}
+
+		if len(param.ModulusRaw) > 0 {
+			tmpl.RSAParameters.Modulus = new(big.Int).SetBytes(param.ModulusRaw)
+		}
+
+	case pub.ECCParameters != nil:
+		param := pub.ECCParameters
+
+		tmpl.ECCParameters = &pgtpm.ECCParams{
+			Symmetric: symSchemeToTemplate(param.Symmetric),
+			Sign:      sigSchemeToTemplate(param.Sign),
+			CurveID:   pgtpm.EllipticCurve(param.CurveID),
+		}
+
+		if kdf := param.KDF; kdf != nil {
+			tmpl.ECCParameters.KDF = &pgtpm.KDFScheme{
+				Alg:  pgtpm.Algorithm(kdf.Alg),
+				Hash: pgtpm.Algorithm(kdf.Hash),
+			}
+		}
+
+		if len(param.Point.XRaw) > 0 || len(param.Point.YRaw) > 0 {
+			tmpl.ECCParameters.Point = &pgtpm.ECPoint{
+				X: param.Point.X(),
+				Y: param.Point.Y(),
+			}
+		}
+
+	case pub.SymCipherParameters != nil:
+		tmpl.SymCipherParameters = &pgtpm.SymCipherParams{
+			Symmetric: symSchemeToTemplate(pub.SymCipherParameters.Symmetric),
+		}
+
+	case pub.KeyedHashParameters != nil:
+		param := pub.KeyedHashParameters
+
+		tmpl.KeyedHashParameters = &pgtpm.KeyedHashParams{
+			Alg:  pgtpm.Algorithm(param.Alg),
+			Hash: pgtpm.Algorithm(param.Hash),
+			KDF:  pgtpm.Algorithm(param.KDF),
+		}
+	}
+
+	return tmpl
+}
+
+// symSchemeToTemplate converts a symmetric scheme to its template form.
+func symSchemeToTemplate(s *tpm2.SymScheme) *pgtpm.SymScheme {
+	if s == nil {
+		return nil
+	}
+
+	return &pgtpm.SymScheme{
+		Alg:     pgtpm.Algorithm(s.Alg),
+		KeyBits: s.KeyBits,
+		Mode:    pgtpm.Algorithm(s.Mode),
+	}
+}
+
+// sigSchemeToTemplate converts a signature scheme to its template form.
+func sigSchemeToTemplate(s *tpm2.SigScheme) *pgtpm.SigScheme {
+	if s == nil {
+		return nil
+	}
+
+	return &pgtpm.SigScheme{
+		Alg:   pgtpm.Algorithm(s.Alg),
+		Hash:  pgtpm.Algorithm(s.Hash),
+		Count: s.Count,
+	}
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+
+	"github.com/paulgriffiths/pgtpm"
+	"github.com/paulgriffiths/tpmtool/tpmkey"
+)
+
+// eccCurveSizes are the NIST elliptic curves by key size, as given in ECC
+// algorithm specifiers.
+var eccCurveSizes = map[string]pgtpm.EllipticCurve{
+	"":    pgtpm.TPM2_ECC_NIST_P256,
+	"192": pgtpm.TPM2_ECC_NIST_P192,
+	"224": pgtpm.TPM2_ECC_NIST_P224,
+	"256": pgtpm.TPM2_ECC_NIST_P256,
+	"384": pgtpm.TPM2_ECC_NIST_P384,
+	"521": pgtpm.TPM2_ECC_NIST_P521,
+}
+
+// symAlgorithms are the symmetric block ciphers which may be given in
+// algorithm specifiers.
+var symAlgorithms = map[string]pgtpm.Algorithm{
+	"aes":      pgtpm.TPM2_ALG_AES,
+	"camellia": pgtpm.TPM2_ALG_CAMELLIA,
+	"sm4":      pgtpm.TPM2_ALG_SM4,
+}
+
+// symModes are the symmetric block cipher modes which may be given in
+// algorithm specifiers.
+var symModes = map[string]pgtpm.Algorithm{
+	"cbc": pgtpm.TPM2_ALG_CBC,
+	"cfb": pgtpm.TPM2_ALG_CFB,
+	"ctr": pgtpm.TPM2_ALG_CTR,
+	"ecb": pgtpm.TPM2_ALG_ECB,
+	"ofb": pgtpm.TPM2_ALG_OFB,
+}
+
+// rsaSchemes and eccSchemes are the asymmetric schemes which may be given in
+// algorithm specifiers, and whether they are signing schemes.
+var (
+	rsaSchemes = map[string]bool{
+		"null":   false,
+		"oaep":   false,
+		"rsaes":  false,
+		"rsapss": true,
+		"rsassa": true,
+	}
+
+	eccSchemes = map[string]bool{
+		"ecdaa":     true,
+		"ecdh":      false,
+		"ecdsa":     true,
+		"ecmqv":     false,
+		"ecschnorr": true,
+		"null":      false,
+		"sm2":       true,
+	}
+)
+
+// Default object attributes for generated templates.
+const (
+	defaultObjectAttrs = pgtpm.TPMA_OBJECT_FIXEDTPM | pgtpm.TPMA_OBJECT_FIXEDPARENT |
+		pgtpm.TPMA_OBJECT_SENSITIVEDATAORIGIN | pgtpm.TPMA_OBJECT_USERWITHAUTH
+	defaultSealedAttrs = pgtpm.TPMA_OBJECT_FIXEDTPM | pgtpm.TPMA_OBJECT_FIXEDPARENT |
+		pgtpm.TPMA_OBJECT_USERWITHAUTH
+)
+
+// commandTemplate returns the public area for a new object, from the
+// -template option of a command, or generated from its -alg, -attrs and
+// -namealg options.
+func commandTemplate(set *flag.FlagSet, tmpl, algSpec, attrSpec, nameAlgSpec string) (tpm2.Public, error) {
+	err := ensureExactlyOnePassed(set, templateFlagName, algFlagName)
+	if err != nil {
+		return tpm2.Public{}, err
+	}
+
+	if tmpl != "" {
+		if countFlagsPassed(set, attrsFlagName, nameAlgFlagName) != 0 {
+			return tpm2.Public{}, fmt.Errorf("-%s and -%s may only be provided with -%s",
+				attrsFlagName, nameAlgFlagName, algFlagName)
+		}
+
+		return tpmkey.LoadTemplate(tmpl)
+	}
+
+	t, err := genTemplate(algSpec, attrSpec, nameAlgSpec)
+	if err != nil {
+		return tpm2.Public{}, err
+	}
+
+	return t.ToPublic(), nil
+}
+
+// genTemplate generates a template from an algorithm specifier, such as
+// rsa2048:rsassa-sha256 or ecc384:aes256cfb, and optional object attribute
+// and name algorithm specifiers. If no object attributes are specified,
+// attributes suitable for the algorithm are chosen.
+func genTemplate(algSpec, attrSpec, nameAlgSpec string) (pgtpm.PublicTemplate, error) {
+	tmpl := pgtpm.PublicTemplate{
+		NameAlg: pgtpm.TPM2_ALG_SHA256,
+	}
+
+	if nameAlgSpec != "" {
+		alg, err := parseHashAlgorithm(nameAlgSpec)
+		if err != nil {
+			return pgtpm.PublicTemplate{}, fmt.Errorf("invalid name algorithm: %s", nameAlgSpec)
+		}
+		tmpl.NameAlg = alg
+	}
+
+	fields := strings.Split(strings.ToLower(algSpec), ":")
+	typ, fields := fields[0], fields[1:]
+
+	var attrs pgtpm.ObjectAttribute
+
+	switch {
+	case strings.HasPrefix(typ, "rsa"):
+		bits := uint64(2048)
+		if s := strings.TrimPrefix(typ, "rsa"); s != "" {
+			var err error
+			if bits, err = strconv.ParseUint(s, 10, 16); err != nil || bits == 0 {
+				return pgtpm.PublicTemplate{}, fmt.Errorf("invalid RSA key size: %s", s)
+			}
+		}
+
+		sym, scheme, sign, err := parseAsymFields(fields, rsaSchemes)
+		if err != nil {
+			return pgtpm.PublicTemplate{}, err
+		}
+
+		tmpl.Type = pgtpm.TPM2_ALG_RSA
+		tmpl.RSAParameters = &pgtpm.RSAParams{
+			Symmetric: sym,
+			Sign:      scheme,
+			KeyBits:   uint16(bits),
+		}
+		attrs = asymAttrs(sym, scheme, sign)
+
+	case strings.HasPrefix(typ, "ecc"), typ == "sm2":
+		curve := pgtpm.TPM2_ECC_SM2_P256
+		if typ != "sm2" {
+			var ok bool
+			if curve, ok = eccCurveSizes[strings.TrimPrefix(typ, "ecc")]; !ok {
+				return pgtpm.PublicTemplate{}, fmt.Errorf("invalid ECC key size: %s", strings.TrimPrefix(typ, "ecc"))
+			}
+		}
+
+		sym, scheme, sign, err := parseAsymFields(fields, eccSchemes)
+		if err != nil {
+			return pgtpm.PublicTemplate{}, err
+		}
+
+		tmpl.Type = pgtpm.TPM2_ALG_ECC
+		tmpl.ECCParameters = &pgtpm.ECCParams{
+			Symmetric: sym,
+			Sign:      scheme,
+			CurveID:   curve,
+			KDF:       &pgtpm.KDFScheme{Alg: pgtpm.TPM2_ALG_NULL, Hash: pgtpm.TPM2_ALG_NULL},
+		}
+		attrs = asymAttrs(sym, scheme, sign)
+
+	case typ == "hmac", typ == "xor":
+		hash := pgtpm.TPM2_ALG_SHA256
+		if len(fields) > 1 {
+			return pgtpm.PublicTemplate{}, fmt.Errorf("unexpected %s parameters: %s", typ, strings.Join(fields[1:], ":"))
+		} else if len(fields) == 1 {
+			var err error
+			if hash, err = parseHashAlgorithm(fields[0]); err != nil {
+				return pgtpm.PublicTemplate{}, fmt.Errorf("invalid hash algorithm: %s", fields[0])
+			}
+		}
+
+		tmpl.Type = pgtpm.TPM2_ALG_KEYEDHASH
+		tmpl.KeyedHashParameters = &pgtpm.KeyedHashParams{
+			Alg:  pgtpm.TPM2_ALG_HMAC,
+			Hash: hash,
+			KDF:  pgtpm.TPM2_ALG_NULL,
+		}
+		attrs = defaultObjectAttrs | pgtpm.TPMA_OBJECT_SIGN_ENCRYPT
+
+		if typ == "xor" {
+			tmpl.KeyedHashParameters.Alg = pgtpm.TPM2_ALG_XOR
+			tmpl.KeyedHashParameters.KDF = pgtpm.TPM2_ALG_KDF1_SP800_108
+			attrs = defaultObjectAttrs | pgtpm.TPMA_OBJECT_DECRYPT
+		}
+
+	case typ == "keyedhash":
+		if len(fields) != 0 {
+			return pgtpm.PublicTemplate{}, fmt.Errorf("unexpected %s parameters: %s", typ, strings.Join(fields, ":"))
+		}
+
+		tmpl.Type = pgtpm.TPM2_ALG_KEYEDHASH
+		tmpl.KeyedHashParameters = &pgtpm.KeyedHashParams{
+			Alg:  pgtpm.TPM2_ALG_NULL,
+			Hash: pgtpm.TPM2_ALG_NULL,
+			KDF:  pgtpm.TPM2_ALG_NULL,
+		}
+		attrs = defaultSealedAttrs
+
+	default:
+		sym, err := parseSymSpec(typ, pgtpm.TPM2_ALG_NULL)
+		if err != nil {
+			return pgtpm.PublicTemplate{}, err
+		} else if sym == nil {
+			return pgtpm.PublicTemplate{}, fmt.Errorf("invalid algorithm: %s", typ)
+		}
+
+		if len(fields) != 0 {
+			return pgtpm.PublicTemplate{}, fmt.Errorf("unexpected %s parameters: %s", typ, strings.Join(fields, ":"))
+		}
+
+		tmpl.Type = pgtpm.TPM2_ALG_SYMCIPHER
+		tmpl.SymCipherParameters = &pgtpm.SymCipherParams{Symmetric: sym}
+		attrs = defaultObjectAttrs | pgtpm.TPMA_OBJECT_DECRYPT | pgtpm.TPMA_OBJECT_SIGN_ENCRYPT
+	}
+
+	if attrSpec != "" {
+		var err error
+		if attrs, err = parseObjectAttrs(attrSpec); err != nil {
+			return pgtpm.PublicTemplate{}, err
+		}
+	}
+
+	for _, a := range objectAttributes {
+		if attrs&a != 0 {
+			tmpl.Attributes = append(tmpl.Attributes, a)
+		}
+	}
+
+	return tmpl, nil
+}
+
+// parseAsymFields parses the scheme and symmetric algorithm fields, in
+// either order, of an RSA or ECC algorithm specifier. The scheme defaults to
+// null, and is returned with whether it is a signing scheme. A symmetric
+// algorithm is only valid for a restricted decryption key, whose scheme must
+// be null.
+func parseAsymFields(fields []string, schemes map[string]bool) (*pgtpm.SymScheme, *pgtpm.SigScheme, bool, error) {
+	if len(fields) > 2 {
+		return nil, nil, false, fmt.Errorf("unexpected parameters: %s", strings.Join(fields[2:], ":"))
+	}
+
+	var sym *pgtpm.SymScheme
+	var scheme *pgtpm.SigScheme
+	var schemeField string
+	var sign bool
+
+	for _, f := range fields {
+		s, err := parseSymSpec(f, pgtpm.TPM2_ALG_CFB)
+		if err != nil {
+			return nil, nil, false, err
+		}
+
+		if s != nil {
+			if sym != nil {
+				return nil, nil, false, fmt.Errorf("more than one symmetric algorithm: %s", f)
+			}
+			sym = s
+			continue
+		}
+
+		if scheme != nil {
+			return nil, nil, false, fmt.Errorf("more than one scheme: %s", f)
+		}
+
+		name, hashName := f, ""
+		if i := strings.Index(f, "-"); i != -1 {
+			name, hashName = f[:i], f[i+1:]
+		}
+
+		var ok bool
+		if sign, ok = schemes[name]; !ok {
+			return nil, nil, false, fmt.Errorf("invalid scheme: %s", name)
+		}
+
+		alg, err := parseAlgorithm(name)
+		if err != nil {
+			return nil, nil, false, err
+		}
+
+		hash := pgtpm.TPM2_ALG_NULL
+		if alg == pgtpm.TPM2_ALG_NULL || alg == pgtpm.TPM2_ALG_RSAES {
+			if hashName != "" {
+				return nil, nil, false, fmt.Errorf("scheme %s takes no hash algorithm", name)
+			}
+		} else {
+			if hashName == "" {
+				hashName = "sha256"
+			}
+
+			if hash, err = parseHashAlgorithm(hashName); err != nil {
+				return nil, nil, false, fmt.Errorf("invalid hash algorithm: %s", hashName)
+			}
+		}
+
+		scheme = &pgtpm.SigScheme{Alg: alg, Hash: hash}
+		schemeField = f
+	}
+
+	if sym != nil && scheme != nil && scheme.Alg != pgtpm.TPM2_ALG_NULL {
+		return nil, nil, false, fmt.Errorf("scheme %s may not be combined with a symmetric algorithm", schemeField)
+	}
+
+	if scheme == nil {
+		scheme = &pgtpm.SigScheme{Alg: pgtpm.TPM2_ALG_NULL, Hash: pgtpm.TPM2_ALG_NULL}
+	}
+
+	return sym, scheme, sign, nil
+}
+
+// parseSymSpec parses a symmetric algorithm specifier, such as aes, aes256
+// or aes128cfb, returning nil if the specifier is not for a symmetric
+// algorithm. The key size defaults to 128 bits, and the mode to the mode
+// provided.
+func parseSymSpec(s string, defaultMode pgtpm.Algorithm) (*pgtpm.SymScheme, error) {
+	for name, alg := range symAlgorithms {
+		if !strings.HasPrefix(s, name) {
+			continue
+		}
+
+		rest := strings.TrimPrefix(s, name)
+		sym := &pgtpm.SymScheme{Alg: alg, KeyBits: 128, Mode: defaultMode}
+
+		if i := strings.IndexFunc(rest, func(r rune) bool { return r < '0' || r > '9' }); i != -1 {
+			mode, ok := symModes[rest[i:]]
+			if !ok {
+				return nil, fmt.Errorf("invalid %s mode: %s", name, rest[i:])
+			}
+			sym.Mode = mode
+			rest = rest[:i]
+		}
+
+		if rest != "" {
+			bits, err := strconv.ParseUint(rest, 10, 16)
+			if err != nil || bits == 0 {
+				return nil, fmt.Errorf("invalid %s key size: %s", name, rest)
+			}
+			sym.KeyBits = uint16(bits)
+		}
+
+		return sym, nil
+	}
+
+	return nil, nil
+}
+
+// parseHashAlgorithm parses the name of a hash algorithm, such as sha256.
+// SM3_256 has no Go implementation, but is accepted as the hash algorithm of
+// SM2 keys.
+func parseHashAlgorithm(s string) (pgtpm.Algorithm, error) {
+	alg, err := parseAlgorithm(s)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tpm2.Algorithm(alg).Hash(); err != nil && alg != pgtpm.TPM2_ALG_SM3_256 {
+		return 0, fmt.Errorf("not a hash algorithm: %s", s)
+	}
+
+	return alg, nil
+}
+
+// asymAttrs returns the default object attributes for an RSA or ECC key.
+// Keys with a symmetric algorithm are restricted decryption keys, for use as
+// parents, and otherwise keys may sign or decrypt according to their scheme.
+func asymAttrs(sym *pgtpm.SymScheme, scheme *pgtpm.SigScheme, sign bool) pgtpm.ObjectAttribute {
+	switch {
+	case sym != nil:
+		return defaultObjectAttrs | pgtpm.TPMA_OBJECT_RESTRICTED | pgtpm.TPMA_OBJECT_DECRYPT
+	case scheme.Alg == pgtpm.TPM2_ALG_NULL:
+		return defaultObjectAttrs | pgtpm.TPMA_OBJECT_SIGN_ENCRYPT | pgtpm.TPMA_OBJECT_DECRYPT
+	case sign:
+		return defaultObjectAttrs | pgtpm.TPMA_OBJECT_SIGN_ENCRYPT
+	default:
+		return defaultObjectAttrs | pgtpm.TPMA_OBJECT_DECRYPT
+	}
+}
+
+// parseObjectAttrs parses a |-separated list of object attributes, such as
+// sign|fixedtpm|userwithauth. Attributes are case-insensitive and may be
+// given with or without their TPMA_OBJECT_ prefix, and sign is accepted for
+// sign_encrypt.
+func parseObjectAttrs(s string) (pgtpm.ObjectAttribute, error) {
+	var attrs pgtpm.ObjectAttribute
+
+	for _, name := range strings.Split(s, "|") {
+		name = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "tpma_object_")
+		if name == "" {
+			return 0, errors.New("empty object attribute")
+		} else if name == "sign" {
+			name = "sign_encrypt"
+		}
+
+		var found bool
+		for _, a := range objectAttributes {
+			if name == strings.ToLower(strings.TrimPrefix(a.String(), "TPMA_OBJECT_")) {
+				attrs |= a
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return 0, fmt.Errorf("invalid object attribute: %s", name)
+		}
+	}
+
+	return attrs, nil
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/paulgriffiths/pgtpm"
+	"github.com/paulgriffiths/tpmtool/tpmkey"
+)
+
+func TestGenTemplate(t *testing.T) {
+	t.Parallel()
+
+	var nullScheme = &pgtpm.SigScheme{Alg: pgtpm.TPM2_ALG_NULL, Hash: pgtpm.TPM2_ALG_NULL}
+	var nullKDF = &pgtpm.KDFScheme{Alg: pgtpm.TPM2_ALG_NULL, Hash: pgtpm.TPM2_ALG_NULL}
+
+	var testcases = []struct {
+		name    string
+		alg     string
+		attrs   string
+		nameAlg string
+		want    pgtpm.PublicTemplate
+	}{
+		{
+			name:    "RSASigning",
+			alg:     "rsa2048:rsassa-sha256",
+			attrs:   "sign|fixedtpm|fixedparent|sensitivedataorigin|userwithauth",
+			nameAlg: "sha256",
+			want: pgtpm.PublicTemplate{
+				Type:    pgtpm.TPM2_ALG_RSA,
+				NameAlg: pgtpm.TPM2_ALG_SHA256,
+				Attributes: []pgtpm.ObjectAttribute{
+					pgtpm.TPMA_OBJECT_FIXEDTPM,
+					pgtpm.TPMA_OBJECT_FIXEDPARENT,
+					pgtpm.TPMA_OBJECT_SENSITIVEDATAORIGIN,
+					pgtpm.TPMA_OBJECT_USERWITHAUTH,
+					pgtpm.TPMA_OBJECT_SIGN_ENCRYPT,
+				},
+				RSAParameters: &pgtpm.RSAParams{
+					Sign:    &pgtpm.SigScheme{Alg: pgtpm.TPM2_ALG_RSASSA, Hash: pgtpm.TPM2_ALG_SHA256},
+					KeyBits: 2048,
+				},
+			},
+		},
+		{
+			name: "RSADefault",
+			alg:  "rsa",
+			want: pgtpm.PublicTemplate{
+				Type:    pgtpm.TPM2_ALG_RSA,
+				NameAlg: pgtpm.TPM2_ALG_SHA256,
+				Attributes: []pgtpm.ObjectAttribute{
+					pgtpm.TPMA_OBJECT_FIXEDTPM,
+					pgtpm.TPMA_OBJECT_FIXEDPARENT,
+					pgtpm.TPMA_OBJECT_SENSITIVEDATAORIGIN,
+					pgtpm.TPMA_OBJECT_USERWITHAUTH,
+					pgtpm.TPMA_OBJECT_DECRYPT,
+					pgtpm.TPMA_OBJECT_SIGN_ENCRYPT,
+				},
+				RSAParameters: &pgtpm.RSAParams{Sign: nullScheme, KeyBits: 2048},
+			},
+		},
+		{
+			name:    "RSADecryption",
+			alg:     "RSA3072:OAEP-SHA384",
+			nameAlg: "sha384",
+			want: pgtpm.PublicTemplate{
+				Type:    pgtpm.TPM2_ALG_RSA,
+				NameAlg: pgtpm.TPM2_ALG_SHA384,
+				Attributes: []pgtpm.ObjectAttribute{
+					pgtpm.TPMA_OBJECT_FIXEDTPM,
+					pgtpm.TPMA_OBJECT_FIXEDPARENT,
+					pgtpm.TPMA_OBJECT_SENSITIVEDATAORIGIN,
+					pgtpm.TPMA_OBJECT_USERWITHAUTH,
+					pgtpm.TPMA_OBJECT_DECRYPT,
+				},
+				RSAParameters: &pgtpm.RSAParams{
+					Sign:    &pgtpm.SigScheme{Alg: pgtpm.TPM2_ALG_OAEP, Hash: pgtpm.TPM2_ALG_SHA384},
+					KeyBits: 3072,
+				},
+			},
+		},
+		{
+			name: "ECCStorage",
+			alg:  "ecc384:aes256cfb",
+			want: pgtpm.PublicTemplate{
+				Type:    pgtpm.TPM2_ALG_ECC,
+				NameAlg: pgtpm.TPM2_ALG_SHA256,
+				Attributes: []pgtpm.ObjectAttribute{
+					pgtpm.TPMA_OBJECT_FIXEDTPM,
+					pgtpm.TPMA_OBJECT_FIXEDPARENT,
+					pgtpm.TPMA_OBJECT_SENSITIVEDATAORIGIN,
+					pgtpm.TPMA_OBJECT_USERWITHAUTH,
+					pgtpm.TPMA_OBJECT_RESTRICTED,
+					pgtpm.TPMA_OBJECT_DECRYPT,
+				},
+				ECCParameters: &pgtpm.ECCParams{
+					Symmetric: &pgtpm.SymScheme{Alg: pgtpm.TPM2_ALG_AES, KeyBits: 256, Mode: pgtpm.TPM2_ALG_CFB},
+					Sign:      nullScheme,
+					CurveID:   pgtpm.TPM2_ECC_NIST_P384,
+					KDF:       nullKDF,
+				},
+			},
+		},
+		{
+			// The symmetric algorithm and a null scheme may be given in
+			// either order.
+			name: "ECCStorageNullScheme",
+			alg:  "ecc:null:aes",
+			want: pgtpm.PublicTemplate{
+				Type:    pgtpm.TPM2_ALG_ECC,
+				NameAlg: pgtpm.TPM2_ALG_SHA256,
+				Attributes: []pgtpm.ObjectAttribute{
+					pgtpm.TPMA_OBJECT_FIXEDTPM,
+					pgtpm.TPMA_OBJECT_FIXEDPARENT,
+					pgtpm.TPMA_OBJECT_SENSITIVEDATAORIGIN,
+					pgtpm.TPMA_OBJECT_USERWITHAUTH,
+					pgtpm.TPMA_OBJECT_RESTRICTED,
+					pgtpm.TPMA_OBJECT_DECRYPT,
+				},
+				ECCParameters: &pgtpm.ECCParams{
+					Symmetric: &pgtpm.SymScheme{Alg: pgtpm.TPM2_ALG_AES, KeyBits: 128, Mode: pgtpm.TPM2_ALG_CFB},
+					Sign:      nullScheme,
+					CurveID:   pgtpm.TPM2_ECC_NIST_P256,
+					KDF:       nullKDF,
+				},
+			},
+		},
+		{
+			name: "SM2Signing",
+			alg:  "sm2:sm2-sm3_256",
+			want: pgtpm.PublicTemplate{
+				Type:    pgtpm.TPM2_ALG_ECC,
+				NameAlg: pgtpm.TPM2_ALG_SHA256,
+				Attributes: []pgtpm.ObjectAttribute{
+					pgtpm.TPMA_OBJECT_FIXEDTPM,
+					pgtpm.TPMA_OBJECT_FIXEDPARENT,
+					pgtpm.TPMA_OBJECT_SENSITIVEDATAORIGIN,
+					pgtpm.TPMA_OBJECT_USERWITHAUTH,
+					pgtpm.TPMA_OBJECT_SIGN_ENCRYPT,
+				},
+				ECCParameters: &pgtpm.ECCParams{
+					Sign:    &pgtpm.SigScheme{Alg: pgtpm.TPM2_ALG_SM2, Hash: pgtpm.TPM2_ALG_SM3_256},
+					CurveID: pgtpm.TPM2_ECC_SM2_P256,
+					KDF:     nullKDF,
+				},
+			},
+		},
+		{
+			name: "HMAC",
+			alg:  "hmac:sha384",
+			want: pgtpm.PublicTemplate{
+				Type:    pgtpm.TPM2_ALG_KEYEDHASH,
+				NameAlg: pgtpm.TPM2_ALG_SHA256,
+				Attributes: []pgtpm.ObjectAttribute{
+					pgtpm.TPMA_OBJECT_FIXEDTPM,
+					pgtpm.TPMA_OBJECT_FIXEDPARENT,
+					pgtpm.TPMA_OBJECT_SENSITIVEDATAORIGIN,
+					pgtpm.TPMA_OBJECT_USERWITHAUTH,
+					pgtpm.TPMA_OBJECT_SIGN_ENCRYPT,
+				},
+				KeyedHashParameters: &pgtpm.KeyedHashParams{
+					Alg:  pgtpm.TPM2_ALG_HMAC,
+					Hash: pgtpm.TPM2_ALG_SHA384,
+					KDF:  pgtpm.TPM2_ALG_NULL,
+				},
+			},
+		},
+		{
+			name: "XOR",
+			alg:  "xor",
+			want: pgtpm.PublicTemplate{
+				Type:    pgtpm.TPM2_ALG_KEYEDHASH,
+				NameAlg: pgtpm.TPM2_ALG_SHA256,
+				Attributes: []pgtpm.ObjectAttribute{
+					pgtpm.TPMA_OBJECT_FIXEDTPM,
+					pgtpm.TPMA_OBJECT_FIXEDPARENT,
+					pgtpm.TPMA_OBJECT_SENSITIVEDATAORIGIN,
+					pgtpm.TPMA_OBJECT_USERWITHAUTH,
+					pgtpm.TPMA_OBJECT_DECRYPT,
+				},
+				KeyedHashParameters: &pgtpm.KeyedHashParams{
+					Alg:  pgtpm.TPM2_ALG_XOR,
+					Hash: pgtpm.TPM2_ALG_SHA256,
+					KDF:  pgtpm.TPM2_ALG_KDF1_SP800_108,
+				},
+			},
+		},
+		{
+			name: "SealedData",
+			alg:  "keyedhash",
+			want: pgtpm.PublicTemplate{
+				Type:    pgtpm.TPM2_ALG_KEYEDHASH,
+				NameAlg: pgtpm.TPM2_ALG_SHA256,
+				Attributes: []pgtpm.ObjectAttribute{
+					pgtpm.TPMA_OBJECT_FIXEDTPM,
+					pgtpm.TPMA_OBJECT_FIXEDPARENT,
+					pgtpm.TPMA_OBJECT_USERWITHAUTH,
+				},
+				KeyedHashParameters: &pgtpm.KeyedHashParams{
+					Alg:  pgtpm.TPM2_ALG_NULL,
+					Hash: pgtpm.TPM2_ALG_NULL,
+					KDF:  pgtpm.TPM2_ALG_NULL,
+				},
+			},
+		},
+		{
+			// The mode of a symmetric cipher key defaults to null.
+			name:  "SymCipher",
+			alg:   "aes256",
+			attrs: "TPMA_OBJECT_FIXEDTPM|FixedParent|sensitivedataorigin|userwithauth|decrypt",
+			want: pgtpm.PublicTemplate{
+				Type:    pgtpm.TPM2_ALG_SYMCIPHER,
+				NameAlg: pgtpm.TPM2_ALG_SHA256,
+				Attributes: []pgtpm.ObjectAttribute{
+					pgtpm.TPMA_OBJECT_FIXEDTPM,
+					pgtpm.TPMA_OBJECT_FIXEDPARENT,
+					pgtpm.TPMA_OBJECT_SENSITIVEDATAORIGIN,
+					pgtpm.TPMA_OBJECT_USERWITHAUTH,
+					pgtpm.TPMA_OBJECT_DECRYPT,
+				},
+				SymCipherParameters: &pgtpm.SymCipherParams{
+					Symmetric: &pgtpm.SymScheme{Alg: pgtpm.TPM2_ALG_AES, KeyBits: 256, Mode: pgtpm.TPM2_ALG_NULL},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		var tc = tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := genTemplate(tc.alg, tc.attrs, tc.nameAlg)
+			if err != nil {
+				t.Fatalf("couldn't generate template: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+
+			// The generated template should be a valid template file.
+			data, err := json.Marshal(got)
+			if err != nil {
+				t.Fatalf("failed to marshal template: %v", err)
+			}
+
+			if _, err := tpmkey.ParseTemplate(data); err != nil {
+				t.Errorf("couldn't parse generated template: %v", err)
+			}
+		})
+	}
+}
+
+func TestGenTemplateFailure(t *testing.T) {
+	t.Parallel()
+
+	var testcases = []struct {
+		name    string
+		alg     string
+		attrs   string
+		nameAlg string
+	}{
+		{
+			name: "UnknownAlgorithm",
+			alg:  "dsa2048",
+		},
+		{
+			name: "RSAKeySize",
+			alg:  "rsa2k",
+		},
+		{
+			name: "ECCKeySize",
+			alg:  "ecc255",
+		},
+		{
+			name: "RSAZeroKeySize",
+			alg:  "rsa0",
+		},
+		{
+			name: "UnknownScheme",
+			alg:  "rsa:ecdsa",
+		},
+		{
+			name: "UnknownHash",
+			alg:  "rsa:rsassa-sha999",
+		},
+		{
+			name: "SchemeHashNotHash",
+			alg:  "rsa2048:rsassa-aes",
+		},
+		{
+			name: "HMACHashNotHash",
+			alg:  "hmac:rsa",
+		},
+		{
+			name: "NullSchemeWithHash",
+			alg:  "rsa:null-sha256",
+		},
+		{
+			name: "TwoSchemes",
+			alg:  "rsa:rsassa:rsapss",
+		},
+		{
+			name: "TwoSymmetricAlgorithms",
+			alg:  "ecc:aes:camellia",
+		},
+		{
+			name: "TooManyFields",
+			alg:  "rsa:aes:null:oaep",
+		},
+		{
+			// Only restricted decryption keys may have a symmetric
+			// algorithm, and their scheme must be null.
+			name: "SymmetricWithScheme",
+			alg:  "rsa3072:aes128cfb:rsassa",
+		},
+		{
+			name: "SchemeWithSymmetric",
+			alg:  "ecc:ecdh-sha256:aes",
+		},
+		{
+			name: "SymmetricMode",
+			alg:  "rsa:aes128xts",
+		},
+		{
+			name: "SymmetricKeySize",
+			alg:  "aes99999999",
+		},
+		{
+			name: "SymmetricZeroKeySize",
+			alg:  "aes0",
+		},
+		{
+			name: "ParentSymmetricZeroKeySize",
+			alg:  "rsa:aes0cfb",
+		},
+		{
+			name: "HMACParameters",
+			alg:  "hmac:sha256:sha384",
+		},
+		{
+			name: "KeyedHashParameters",
+			alg:  "keyedhash:sha256",
+		},
+		{
+			name: "SymCipherParameters",
+			alg:  "aes128:cfb",
+		},
+		{
+			name:  "UnknownAttribute",
+			alg:   "rsa",
+			attrs: "sign|nosuchattribute",
+		},
+		{
+			name:  "EmptyAttribute",
+			alg:   "rsa",
+			attrs: "sign||fixedtpm",
+		},
+		{
+			name:    "NameAlgorithm",
+			alg:     "rsa",
+			nameAlg: "sha999",
+		},
+		{
+			name:    "NameAlgorithmNotHash",
+			alg:     "rsa",
+			nameAlg: "ecc",
+		},
+	}
+
+	for _, tc := range testcases {
+		var tc = tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got, err := genTemplate(tc.alg, tc.attrs, tc.nameAlg); err == nil {
+				t.Fatalf("unexpectedly generated template %+v", got)
+			}
+		})
+	}
+}
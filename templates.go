@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/paulgriffiths/tpmtool/tpmkey"
+)
+
+//go:generate go run . templates schema -out template.schema.json
+
+// templatesCommands are the templates subcommands.
+var templatesCommands = []command{
+	{
+		name:      templatesGenCommand,
+		flagSet:   fTemplatesGenSet,
+		cmdFunc:   templatesGen,
+		usageFunc: usageTemplatesGen,
+	},
+	{
+		name:      templatesListCommand,
+		flagSet:   fTemplatesListSet,
+		cmdFunc:   templatesList,
+		usageFunc: usageTemplatesList,
+	},
+	{
+		name:      templatesSchemaCommand,
+		flagSet:   fTemplatesSchemaSet,
+		cmdFunc:   templatesSchema,
+		usageFunc: usageTemplatesSchema,
+	},
+	{
+		name:      templatesShowCommand,
+		flagSet:   fTemplatesShowSet,
+		cmdFunc:   templatesShow,
+		usageFunc: usageTemplatesShow,
+	},
+}
+
+// templatesCmd dispatches a templates subcommand.
+func templatesCmd() error {
+	if len(os.Args) < 3 {
+		usageTemplates()
+		os.Exit(1)
+	}
+
+	switch os.Args[2] {
+	case helpCommand, "-" + helpFlagName, "--" + helpFlagName:
+		usageTemplates()
+		return nil
+	}
+
+	for _, cmd := range templatesCommands {
+		if os.Args[2] == cmd.name {
+			cmd.flagSet.Parse(os.Args[3:])
+
+			if isFlagPassed(cmd.flagSet, helpFlagName) {
+				cmd.usageFunc()
+				return nil
+			}
+
+			return cmd.cmdFunc()
+		}
+	}
+
+	return fmt.Errorf("unknown %s command: %s", templatesCommand, os.Args[2])
+}
+
+// templatesGen generates a template from algorithm specifiers.
+func templatesGen() error {
+	err := ensureAllPassed(fTemplatesGenSet, algFlagName)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := genTemplate(*fTemplatesGenAlg, *fTemplatesGenAttrs, *fTemplatesGenNameAlg)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(tmpl, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal template: %v", err)
+	}
+	data = append(data, '\n')
+
+	if *fTemplatesGenOut == "" {
+		os.Stdout.Write(data)
+		return nil
+	}
+
+	if err := ioutil.WriteFile(*fTemplatesGenOut, data, 0644); err != nil {
+		return fmt.Errorf("failed to write template: %v", err)
+	}
+
+	return nil
+}
+
+// templatesList outputs the names and descriptions of the built-in
+// templates.
+func templatesList() error {
+	if fTemplatesListSet.NArg() != 0 {
+		return fmt.Errorf("unexpected argument: %s", fTemplatesListSet.Arg(0))
+	}
+
+	tmpls := tpmkey.BuiltinTemplates()
+
+	var fw int
+	for _, t := range tmpls {
+		if len(t.Name) > fw {
+			fw = len(t.Name)
+		}
+	}
+
+	for _, t := range tmpls {
+		fmt.Printf("%-*s  %s\n", fw, t.Name, t.Description)
+	}
+
+	return nil
+}
+
+// templatesSchema outputs the JSON Schema for templates.
+func templatesSchema() error {
+	if fTemplatesSchemaSet.NArg() != 0 {
+		return fmt.Errorf("unexpected argument: %s", fTemplatesSchemaSet.Arg(0))
+	}
+
+	data, err := tpmkey.TemplateSchema()
+	if err != nil {
+		return err
+	}
+
+	if *fTemplatesSchemaOut == "" {
+		os.Stdout.Write(data)
+		return nil
+	}
+
+	if err := ioutil.WriteFile(*fTemplatesSchemaOut, data, 0644); err != nil {
+		return fmt.Errorf("failed to write schema: %v", err)
+	}
+
+	return nil
+}
+
+// templatesShow outputs a built-in template as JSON.
+func templatesShow() error {
+	if fTemplatesShowSet.NArg() != 1 {
+		return fmt.Errorf("exactly one template name must be provided")
+	}
+
+	name := fTemplatesShowSet.Arg(0)
+
+	t, ok := tpmkey.LookupBuiltinTemplate(name)
+	if !ok {
+		return fmt.Errorf("unknown template: %s", name)
+	}
+
+	fmt.Print(t.JSON)
+
+	return nil
+}
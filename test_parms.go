@@ -0,0 +1,281 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+	"github.com/paulgriffiths/tpmtool/tpmkey"
+)
+
+// templateParam is a parameter of a template, identified by the path of its
+// field in the JSON template.
+type templateParam struct {
+	field string
+	value string
+
+	// alg is the value of the parameter if it is an algorithm, and zero
+	// otherwise.
+	alg tpm2.Algorithm
+
+	// codes are the TPM2_TestParms response codes which may indicate that
+	// the parameter is not supported.
+	codes []tpm2.RCFmt1
+}
+
+// testParms checks whether the TPM supports the parameters of a template.
+func testParms() error {
+	err := ensureAllPassed(fTestParmsSet, templateFlagName)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := tpmkey.LoadTemplate(*fTestParmsTemplate)
+	if err != nil {
+		return err
+	}
+
+	t, err := getTPM(*fTestParmsTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	if err := checkTemplate(t, tmpl); err != nil {
+		return err
+	}
+
+	fmt.Println("template is supported by the TPM")
+
+	return nil
+}
+
+// checkTemplate checks that the TPM supports the algorithms and parameters
+// of a template, returning an error which identifies the first unsupported
+// parameter found. The algorithms and curves are checked against those the
+// TPM reports, before the parameters as a whole are checked with
+// TPM2_TestParms.
+func checkTemplate(rw io.ReadWriter, pub tpm2.Public) error {
+	params := templateParams(pub)
+
+	cat, err := getCapsAlgorithms(rw)
+	if err != nil {
+		return err
+	}
+
+	algs := make(map[tpm2.Algorithm]bool)
+	for _, a := range cat.(capsAlgorithms) {
+		algs[tpm2.Algorithm(a.ID)] = true
+	}
+
+	for _, p := range params {
+		if p.alg != 0 && !p.alg.IsNull() && !algs[p.alg] {
+			return fmt.Errorf("template %s (%s) is not supported by the TPM (see %s -%s)",
+				p.field, p.value, capsCommand, algsFlagName)
+		}
+	}
+
+	if pub.ECCParameters != nil {
+		cat, err := getCapsCurves(rw)
+		if err != nil {
+			return err
+		}
+
+		curve := pgtpm.EllipticCurve(pub.ECCParameters.CurveID).String()
+		var found bool
+		for _, c := range cat.(capsCurves) {
+			if c == curve {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("template ecc.elliptic_curve (%s) is not supported by the TPM (see %s -%s)",
+				curve, capsCommand, curvesFlagName)
+		}
+	}
+
+	parms, err := publicParms(pub)
+	if err != nil {
+		return err
+	}
+
+	if _, err := runCommand(rw, pgtpm.TPM2_CC_TestParms, tpmutil.RawBytes(parms)); err != nil {
+		var fields []string
+		if pe, ok := err.(tpm2.ParameterError); ok {
+			for _, p := range params {
+				for _, code := range p.codes {
+					if code == pe.Code {
+						fields = append(fields, fmt.Sprintf("%s (%s)", p.field, p.value))
+						break
+					}
+				}
+			}
+		}
+
+		if len(fields) == 0 {
+			return fmt.Errorf("template is not supported by the TPM: %v", err)
+		}
+
+		return fmt.Errorf("template %s is not supported by the TPM: %v", strings.Join(fields, " or "), err)
+	}
+
+	return nil
+}
+
+// templateParams returns the algorithms and other parameters of a template
+// which the TPM may not support.
+func templateParams(pub tpm2.Public) []templateParam {
+	params := []templateParam{
+		algParam("type", pub.Type, tpm2.RCType),
+		algParam("name_alg", pub.NameAlg, tpm2.RCHash),
+	}
+
+	symParams := func(prefix string, s *tpm2.SymScheme) {
+		if s == nil || s.Alg.IsNull() {
+			return
+		}
+
+		params = append(params,
+			algParam(prefix+".symmetric.algorithm", s.Alg, tpm2.RCSymmetric),
+			templateParam{
+				field: prefix + ".symmetric.key_bits",
+				value: fmt.Sprintf("%d", s.KeyBits),
+				codes: []tpm2.RCFmt1{tpm2.RCKeySize, tpm2.RCValue, tpm2.RCSymmetric},
+			},
+			algParam(prefix+".symmetric.mode", s.Mode, tpm2.RCMode, tpm2.RCSymmetric))
+	}
+
+	sigParams := func(prefix string, s *tpm2.SigScheme) {
+		if s == nil || s.Alg.IsNull() {
+			return
+		}
+
+		params = append(params,
+			algParam(prefix+".scheme.algorithm", s.Alg, tpm2.RCScheme),
+			algParam(prefix+".scheme.hash", s.Hash, tpm2.RCHash, tpm2.RCScheme))
+	}
+
+	switch {
+	case pub.RSAParameters != nil:
+		p := pub.RSAParameters
+		symParams("rsa", p.Symmetric)
+		sigParams("rsa", p.Sign)
+		params = append(params, templateParam{
+			field: "rsa.key_bits",
+			value: fmt.Sprintf("%d", p.KeyBits),
+			codes: []tpm2.RCFmt1{tpm2.RCKeySize, tpm2.RCValue},
+		})
+
+	case pub.ECCParameters != nil:
+		p := pub.ECCParameters
+		symParams("ecc", p.Symmetric)
+		sigParams("ecc", p.Sign)
+		params = append(params, templateParam{
+			field: "ecc.elliptic_curve",
+			value: pgtpm.EllipticCurve(p.CurveID).String(),
+			codes: []tpm2.RCFmt1{tpm2.RCCurve},
+		})
+
+		if kdf := p.KDF; kdf != nil && !kdf.Alg.IsNull() {
+			params = append(params,
+				algParam("ecc.kdf.algorithm", kdf.Alg, tpm2.RCKDF),
+				algParam("ecc.kdf.hash", kdf.Hash, tpm2.RCHash, tpm2.RCKDF))
+		}
+
+	case pub.SymCipherParameters != nil:
+		symParams("sym_cipher", pub.SymCipherParameters.Symmetric)
+
+	case pub.KeyedHashParameters != nil:
+		p := pub.KeyedHashParameters
+		if !p.Alg.IsNull() {
+			params = append(params,
+				algParam("keyed_hash.algorithm", p.Alg, tpm2.RCScheme),
+				algParam("keyed_hash.hash", p.Hash, tpm2.RCHash, tpm2.RCScheme))
+		}
+		if p.Alg == tpm2.AlgXOR {
+			params = append(params, algParam("keyed_hash.kdf", p.KDF, tpm2.RCKDF))
+		}
+	}
+
+	return params
+}
+
+// algParam returns a template parameter whose value is an algorithm.
+func algParam(field string, alg tpm2.Algorithm, codes ...tpm2.RCFmt1) templateParam {
+	return templateParam{
+		field: field,
+		value: pgtpm.Algorithm(alg).String(),
+		alg:   alg,
+		codes: codes,
+	}
+}
+
+// publicParms returns the TPMT_PUBLIC_PARMS structure for a public area,
+// which consists of its type and its type-specific parameters.
+func publicParms(pub tpm2.Public) ([]byte, error) {
+	// The parameters are encoded between the authorization policy and the
+	// unique identifier, so the public area is encoded with an empty unique
+	// identifier, and the fields around the parameters stripped.
+	uniqueSize := 2
+
+	switch pub.Type {
+	case tpm2.AlgRSA:
+		if pub.RSAParameters == nil {
+			return nil, errors.New("template has no RSA parameters")
+		}
+		p := *pub.RSAParameters
+		p.ModulusRaw = nil
+		pub.RSAParameters = &p
+
+	case tpm2.AlgECC:
+		if pub.ECCParameters == nil {
+			return nil, errors.New("template has no ECC parameters")
+		}
+		p := *pub.ECCParameters
+		p.Point = tpm2.ECPoint{}
+		pub.ECCParameters = &p
+		uniqueSize = 4
+
+	case tpm2.AlgSymCipher:
+		if pub.SymCipherParameters == nil {
+			return nil, errors.New("template has no symmetric cipher parameters")
+		}
+		p := *pub.SymCipherParameters
+		p.Unique = nil
+		pub.SymCipherParameters = &p
+
+	case tpm2.AlgKeyedHash:
+		if pub.KeyedHashParameters != nil {
+			p := *pub.KeyedHashParameters
+			p.Unique = nil
+			pub.KeyedHashParameters = &p
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported template type: %v", pgtpm.Algorithm(pub.Type))
+	}
+
+	b, err := pub.Encode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public area: %v", err)
+	}
+
+	head := 2 + 2 + 4 + 2 + len(pub.AuthPolicy)
+	if len(b) < head+uniqueSize {
+		return nil, errors.New("failed to encode public area parameters")
+	}
+
+	parms, err := tpmutil.Pack(pub.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(parms, b[head:len(b)-uniqueSize]...), nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/tpmtool/tpmkey"
+)
+
+// lockedSigner serializes access to a TPM key, since TLS handshakes on
+// concurrent connections may otherwise attempt to use the TPM simultaneously.
+type lockedSigner struct {
+	mu     sync.Mutex
+	signer crypto.Signer
+}
+
+// Public returns the public key corresponding to the private key.
+func (s *lockedSigner) Public() crypto.PublicKey {
+	return s.signer.Public()
+}
+
+// Sign signs digest with the private key.
+func (s *lockedSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.signer.Sign(rand, digest, opts)
+}
+
+// tlsProxy accepts plain TCP connections on a local address and forwards them
+// to an upstream server over TLS, authenticating as a client with a TPM key.
+func tlsProxy() (err error) {
+	err = ensureAllPassed(fTLSProxySet, certFlagName, listenFlagName, upstreamFlagName)
+	if err != nil {
+		return err
+	}
+
+	err = ensureExactlyOnePassed(fTLSProxySet, contextFlagName, handleFlagName, keyFileFlagName)
+	if err != nil {
+		return err
+	}
+
+	if isFlagPassed(fTLSProxySet, keyFileFlagName) && !isFlagPassed(fTLSProxySet, parentFlagName) {
+		return fmt.Errorf("-%s must be provided with -%s", parentFlagName, keyFileFlagName)
+	}
+
+	chain, err := readCertificateChain(*fTLSProxyCert)
+	if err != nil {
+		return err
+	}
+
+	config := &tls.Config{
+		ServerName: *fTLSProxyServerName,
+	}
+
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(*fTLSProxyUpstream)
+		if err != nil {
+			return fmt.Errorf("invalid upstream address: %v", err)
+		}
+		config.ServerName = host
+	}
+
+	if *fTLSProxyCACert != "" {
+		data, err := ioutil.ReadFile(*fTLSProxyCACert)
+		if err != nil {
+			return fmt.Errorf("failed to read CA certificates: %v", err)
+		}
+
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return errors.New("failed to parse CA certificates")
+		}
+	}
+
+	t, err := getTPM(*fTLSProxyTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	var key *tpmkey.Key
+	if *fTLSProxyKeyFile == "" {
+		key, err = contextKey(t, fTLSProxyHandle, *fTLSProxyContext, *fTLSProxyPassword)
+	} else {
+		files := strings.Split(*fTLSProxyKeyFile, ",")
+		if len(files) != 2 {
+			return fmt.Errorf("-%s must be of the form <public>,<private>", keyFileFlagName)
+		}
+
+		key, err = tpmkey.LoadFiles(t, tpmutil.Handle(fTLSProxyParent), *fTLSProxyParentPassword,
+			files[0], files[1], *fTLSProxyPassword)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if ferr := key.Close(); ferr != nil {
+			if err == nil {
+				err = ferr
+			} else {
+				log.Printf("%v", ferr)
+			}
+		}
+	}()
+
+	// Ensure the certificate was issued for the TPM key, since otherwise the
+	// failure would only become apparent during a handshake.
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %v", err)
+	}
+
+	certPub, err := x509.MarshalPKIXPublicKey(leaf.PublicKey)
+	if err != nil {
+		return fmt.Errorf("failed to marshal certificate public key: %v", err)
+	}
+
+	keyPub, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return fmt.Errorf("failed to marshal TPM public key: %v", err)
+	}
+
+	if !bytes.Equal(certPub, keyPub) {
+		return errors.New("certificate public key does not match TPM key")
+	}
+
+	schemes := key.TLSSignatureSchemes()
+	if len(schemes) == 0 {
+		return errors.New("TPM key cannot be used for TLS client authentication")
+	}
+
+	config.Certificates = []tls.Certificate{
+		{
+			Certificate:                  chain,
+			PrivateKey:                   &lockedSigner{signer: key},
+			SupportedSignatureAlgorithms: schemes,
+			Leaf:                         leaf,
+		},
+	}
+
+	// Listen for and forward connections until interrupted. Accepting and
+	// forwarding connections stops before the key is closed, since TLS
+	// handshakes may still be signing with it.
+	l, err := net.Listen("tcp", *fTLSProxyListen)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+
+	var conns serverConns
+	defer conns.closeAll()
+	defer l.Close()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		l.Close()
+	}()
+
+	fmt.Printf("forwarding %s to %s\n", l.Addr(), *fTLSProxyUpstream)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+
+			// The listener is closed when the proxy is interrupted.
+			return nil
+		}
+
+		if !conns.add(conn) {
+			conn.Close()
+			continue
+		}
+
+		go func() {
+			defer conns.remove(conn)
+			if err := forwardTLS(conn, *fTLSProxyUpstream, config); err != nil && !conns.exiting() {
+				log.Printf("failed to forward connection from %s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// forwardTLS forwards a local connection to an upstream server over TLS until
+// both directions are finished.
+func forwardTLS(local net.Conn, upstream string, config *tls.Config) error {
+	defer local.Close()
+
+	remote, err := tls.Dial("tcp", upstream, config)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+
+	errs := make(chan error, 2)
+
+	// Each direction is closed for writing when the other end finishes
+	// sending. If either direction fails, such as when the server rejects
+	// the client certificate after a TLS 1.3 handshake, both connections
+	// are closed so that the other direction does not wait indefinitely.
+	go func() {
+		_, err := io.Copy(remote, local)
+		if err == nil {
+			err = remote.CloseWrite()
+		}
+		errs <- err
+	}()
+
+	go func() {
+		_, err := io.Copy(local, remote)
+		if c, ok := local.(*net.TCPConn); ok && err == nil {
+			err = c.CloseWrite()
+		}
+		errs <- err
+	}()
+
+	for i := 0; i < 2; i++ {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+			local.Close()
+			remote.Close()
+		}
+	}
+
+	return err
+}
+
+// readCertificateChain reads a PEM-encoded certificate chain, leaf first,
+// from the named file.
+func readCertificateChain(name string) ([][]byte, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %v", err)
+	}
+
+	var chain [][]byte
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		if block.Type == "CERTIFICATE" {
+			chain = append(chain, block.Bytes)
+		}
+	}
+
+	if len(chain) == 0 {
+		return nil, errors.New("no certificates found in certificate file")
+	}
+
+	return chain, nil
+}
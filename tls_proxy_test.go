@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingSigner counts the signatures made with a signer.
+type countingSigner struct {
+	crypto.Signer
+	count int32
+}
+
+// Sign signs digest with the private key.
+func (s *countingSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	atomic.AddInt32(&s.count, 1)
+
+	return s.Signer.Sign(rand, digest, opts)
+}
+
+func TestForwardTLS(t *testing.T) {
+	t.Parallel()
+
+	ca, caKey := mustCreateCertificate(t, "Test CA", nil, nil, mustGenerateECDSAKey(t))
+
+	var testcases = []struct {
+		name    string
+		key     crypto.Signer
+		version uint16
+	}{
+		{
+			name:    "ECDSA/TLS12",
+			key:     mustGenerateECDSAKey(t),
+			version: tls.VersionTLS12,
+		},
+		{
+			name:    "ECDSA/TLS13",
+			key:     mustGenerateECDSAKey(t),
+			version: tls.VersionTLS13,
+		},
+		{
+			name:    "RSA/TLS12",
+			key:     mustGenerateRSAKey(t),
+			version: tls.VersionTLS12,
+		},
+		{
+			name:    "RSA/TLS13",
+			key:     mustGenerateRSAKey(t),
+			version: tls.VersionTLS13,
+		},
+	}
+
+	for _, tc := range testcases {
+		var tc = tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			// Start a server which requires a client certificate issued by
+			// the CA, and which echoes the request body and the client
+			// certificate subject.
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				fmt.Fprintf(w, "%s:%s", r.TLS.PeerCertificates[0].Subject.CommonName, body)
+			}))
+
+			server.TLS = &tls.Config{
+				ClientAuth: tls.RequireAndVerifyClientCert,
+				ClientCAs:  x509.NewCertPool(),
+				MaxVersion: tc.version,
+			}
+			server.TLS.ClientCAs.AddCert(ca)
+			server.StartTLS()
+			defer server.Close()
+
+			leaf, _ := mustCreateCertificate(t, "Test Client", ca, caKey, tc.key)
+			signer := &countingSigner{Signer: tc.key}
+
+			config := &tls.Config{
+				RootCAs:    x509.NewCertPool(),
+				ServerName: "example.com",
+				Certificates: []tls.Certificate{
+					{
+						Certificate: [][]byte{leaf.Raw},
+						PrivateKey:  &lockedSigner{signer: signer},
+						Leaf:        leaf,
+					},
+				},
+			}
+			config.RootCAs.AddCert(server.Certificate())
+
+			// Forward connections from a local listener to the server.
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			defer l.Close()
+
+			errs := make(chan error, 1)
+			go func() {
+				conn, err := l.Accept()
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				errs <- forwardTLS(conn, server.Listener.Addr().String(), config)
+			}()
+
+			conn, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				t.Fatalf("failed to dial proxy: %v", err)
+			}
+			defer conn.Close()
+
+			conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+			const body = "hello, upstream"
+			req := fmt.Sprintf("POST / HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n"+
+				"Content-Length: %d\r\n\r\n%s", len(body), body)
+
+			if _, err := io.WriteString(conn, req); err != nil {
+				t.Fatalf("failed to write request: %v", err)
+			}
+
+			// Half-close the local connection, which should be forwarded
+			// upstream, and read until the server closes the connection.
+			if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+				t.Fatalf("failed to close connection for writing: %v", err)
+			}
+
+			resp, err := ioutil.ReadAll(conn)
+			if err != nil {
+				t.Fatalf("failed to read response: %v", err)
+			}
+
+			if err := <-errs; err != nil {
+				t.Fatalf("failed to forward connection: %v", err)
+			}
+
+			if !strings.HasPrefix(string(resp), "HTTP/1.1 200 OK\r\n") {
+				t.Fatalf("unexpected response: %q", resp)
+			}
+
+			if want := "Test Client:" + body; !strings.HasSuffix(string(resp), want) {
+				t.Errorf("got response %q, want body %q", resp, want)
+			}
+
+			if n := atomic.LoadInt32(&signer.count); n != 1 {
+				t.Errorf("got %d signatures, want 1", n)
+			}
+		})
+	}
+}
+
+func TestForwardTLSFailure(t *testing.T) {
+	t.Parallel()
+
+	// A server which requires a client certificate should reject a client
+	// without one.
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  x509.NewCertPool(),
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	config := &tls.Config{
+		RootCAs:    x509.NewCertPool(),
+		ServerName: "example.com",
+	}
+	config.RootCAs.AddCert(server.Certificate())
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	done := make(chan struct{})
+	go func() {
+		// Reading from the forwarded connection fails once the server
+		// rejects the handshake.
+		ioutil.ReadAll(remote)
+		close(done)
+	}()
+
+	if err := forwardTLS(local, server.Listener.Addr().String(), config); err == nil {
+		t.Fatalf("unexpectedly forwarded connection without a client certificate")
+	}
+
+	<-done
+}
+
+// mustCreateCertificate creates a certificate for the public key of a
+// signer, issued by the specified parent, or self-signed if parent is nil.
+func mustCreateCertificate(t *testing.T, cn string, parent *x509.Certificate,
+	parentKey, key crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+		parent = tmpl
+		parentKey = key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	return cert, key
+}
+
+// mustGenerateECDSAKey generates a P256 ECDSA key.
+func mustGenerateECDSAKey(t *testing.T) crypto.Signer {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	return key
+}
+
+// mustGenerateRSAKey generates a 2048-bit RSA key.
+func mustGenerateRSAKey(t *testing.T) crypto.Signer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	return key
+}
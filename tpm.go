@@ -3,40 +3,35 @@ package main
 import (
 	"fmt"
 	"io"
-	"os"
+	"path/filepath"
 	"strings"
 
-	"github.com/google/go-tpm/tpm2"
-
-	"github.com/paulgriffiths/pgtpm"
+	"github.com/paulgriffiths/tpmtool/tpmkey"
 )
 
-// getTPM opens the TPM associated with the named device. If the named device
-// cannot be found, and the name is in the form hostname:port, an attempt will
-// be made to open a connection with a Microsoft TPM 2.0 Simulator listening on
-// that port.
+// getTPM opens the TPM associated with the named device, or the default
+// device if the name is empty. See tpmkey.OpenTPM for details.
 func getTPM(name string) (io.ReadWriteCloser, error) {
 	if name == "" {
 		name = defaultTPMDevice
 	}
 
-	if _, err := os.Stat(name); err != nil {
-		if os.IsNotExist(err) && len(strings.Split(name, ":")) == 2 {
-			s, err := pgtpm.NewMSSimulator(name)
-			if err != nil {
-				return nil, fmt.Errorf("failed to initialize MS TPM simulator: %v", err)
-			}
-
-			return s, nil
-		}
-
-		return nil, fmt.Errorf("failed to locate TPM device: %v", err)
+	// The audit session must outlive this process, which a resource manager
+	// prevents by flushing its sessions when the device is closed.
+	if *fGlobalAudit != "" && isResourceManager(name) {
+		return nil, fmt.Errorf("-%s is not supported with resource manager device %s, which flushes "+
+			"the audit session on exit", auditFlagName, name)
 	}
 
-	t, err := tpm2.OpenTPM(name)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open TPM device: %v", err)
+	return tpmkey.OpenTPM(name)
+}
+
+// isResourceManager reports whether the named TPM device is an in-kernel
+// resource manager, such as /dev/tpmrm0.
+func isResourceManager(name string) bool {
+	if path, err := filepath.EvalSymlinks(name); err == nil {
+		name = path
 	}
 
-	return t, nil
+	return strings.HasPrefix(filepath.Base(name), "tpmrm")
 }
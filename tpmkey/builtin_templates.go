@@ -0,0 +1,364 @@
+package tpmkey
+
+import "sort"
+
+// BuiltinTemplate is a standard template built into the package, which may
+// be loaded by name with LoadTemplate.
+type BuiltinTemplate struct {
+	Name        string
+	Description string
+
+	// JSON is the JSON-encoded pgtpm.PublicTemplate.
+	JSON string
+}
+
+// builtinTemplates are the built-in templates, indexed by name. The EK
+// templates are those of the TCG EK Credential Profile, with the low range
+// templates L-1 and L-2 and the high range templates H-3 to H-6. The SRK
+// templates are those of the TCG TPM v2.0 Provisioning Guidance.
+var builtinTemplates = map[string]BuiltinTemplate{
+	"tcg-ek-rsa2048": {
+		Description: "TCG RSA 2048 endorsement key (template L-1)",
+		JSON: `{
+    "type": "TPM2_ALG_RSA",
+    "name_alg": "TPM2_ALG_SHA256",
+    "attributes": [
+        "TPMA_OBJECT_FIXEDTPM",
+        "TPMA_OBJECT_FIXEDPARENT",
+        "TPMA_OBJECT_SENSITIVEDATAORIGIN",
+        "TPMA_OBJECT_ADMINWITHPOLICY",
+        "TPMA_OBJECT_RESTRICTED",
+        "TPMA_OBJECT_DECRYPT"
+    ],
+    "auth_policy": "g3GXZ0SEs/gakMyNRqXXJP1S124GUgtk8qHaGzMUaao=",
+    "rsa": {
+        "symmetric": {
+            "algorithm": "TPM2_ALG_AES",
+            "key_bits": 128,
+            "mode": "TPM2_ALG_CFB"
+        },
+        "scheme": {
+            "algorithm": "TPM2_ALG_NULL"
+        },
+        "key_bits": 2048,
+        "exponent": 0,
+        "modulus": 0
+    }
+}
+`,
+	},
+	"tcg-ek-ecc-p256": {
+		Description: "TCG ECC NIST P256 endorsement key (template L-2)",
+		JSON: `{
+    "type": "TPM2_ALG_ECC",
+    "name_alg": "TPM2_ALG_SHA256",
+    "attributes": [
+        "TPMA_OBJECT_FIXEDTPM",
+        "TPMA_OBJECT_FIXEDPARENT",
+        "TPMA_OBJECT_SENSITIVEDATAORIGIN",
+        "TPMA_OBJECT_ADMINWITHPOLICY",
+        "TPMA_OBJECT_RESTRICTED",
+        "TPMA_OBJECT_DECRYPT"
+    ],
+    "auth_policy": "g3GXZ0SEs/gakMyNRqXXJP1S124GUgtk8qHaGzMUaao=",
+    "ecc": {
+        "symmetric": {
+            "algorithm": "TPM2_ALG_AES",
+            "key_bits": 128,
+            "mode": "TPM2_ALG_CFB"
+        },
+        "scheme": {
+            "algorithm": "TPM2_ALG_NULL"
+        },
+        "elliptic_curve": "TPM2_ECC_NIST_P256",
+        "kdf": {
+            "algorithm": "TPM2_ALG_NULL"
+        },
+        "point": {
+            "x": 0,
+            "y": 0
+        }
+    }
+}
+`,
+	},
+	"tcg-ek-ecc-p384": {
+		Description: "TCG ECC NIST P384 endorsement key (template H-3)",
+		JSON: `{
+    "type": "TPM2_ALG_ECC",
+    "name_alg": "TPM2_ALG_SHA384",
+    "attributes": [
+        "TPMA_OBJECT_FIXEDTPM",
+        "TPMA_OBJECT_FIXEDPARENT",
+        "TPMA_OBJECT_SENSITIVEDATAORIGIN",
+        "TPMA_OBJECT_USERWITHAUTH",
+        "TPMA_OBJECT_ADMINWITHPOLICY",
+        "TPMA_OBJECT_RESTRICTED",
+        "TPMA_OBJECT_DECRYPT"
+    ],
+    "auth_policy": "sm59KNEaULxT2IK89f06GgdBSLs107TkyxwK2b3kGcrLR7oJaZZGFQ+fwADz+A4S",
+    "ecc": {
+        "symmetric": {
+            "algorithm": "TPM2_ALG_AES",
+            "key_bits": 256,
+            "mode": "TPM2_ALG_CFB"
+        },
+        "scheme": {
+            "algorithm": "TPM2_ALG_NULL"
+        },
+        "elliptic_curve": "TPM2_ECC_NIST_P384",
+        "kdf": {
+            "algorithm": "TPM2_ALG_NULL"
+        }
+    }
+}
+`,
+	},
+	"tcg-ek-ecc-p521": {
+		Description: "TCG ECC NIST P521 endorsement key (template H-4)",
+		JSON: `{
+    "type": "TPM2_ALG_ECC",
+    "name_alg": "TPM2_ALG_SHA512",
+    "attributes": [
+        "TPMA_OBJECT_FIXEDTPM",
+        "TPMA_OBJECT_FIXEDPARENT",
+        "TPMA_OBJECT_SENSITIVEDATAORIGIN",
+        "TPMA_OBJECT_USERWITHAUTH",
+        "TPMA_OBJECT_ADMINWITHPOLICY",
+        "TPMA_OBJECT_RESTRICTED",
+        "TPMA_OBJECT_DECRYPT"
+    ],
+    "auth_policy": "uCIcpp6FUKSRTeP6pqGMByzAEggHOpKNXWbVnveeSaQpxBprJpVx1X7bJfvbGDhCVgi0E81hal9ttbYHGvmb6g==",
+    "ecc": {
+        "symmetric": {
+            "algorithm": "TPM2_ALG_AES",
+            "key_bits": 256,
+            "mode": "TPM2_ALG_CFB"
+        },
+        "scheme": {
+            "algorithm": "TPM2_ALG_NULL"
+        },
+        "elliptic_curve": "TPM2_ECC_NIST_P521",
+        "kdf": {
+            "algorithm": "TPM2_ALG_NULL"
+        }
+    }
+}
+`,
+	},
+	"tcg-ek-ecc-sm2": {
+		Description: "TCG ECC SM2 P256 endorsement key (template H-5)",
+		JSON: `{
+    "type": "TPM2_ALG_ECC",
+    "name_alg": "TPM2_ALG_SM3_256",
+    "attributes": [
+        "TPMA_OBJECT_FIXEDTPM",
+        "TPMA_OBJECT_FIXEDPARENT",
+        "TPMA_OBJECT_SENSITIVEDATAORIGIN",
+        "TPMA_OBJECT_USERWITHAUTH",
+        "TPMA_OBJECT_ADMINWITHPOLICY",
+        "TPMA_OBJECT_RESTRICTED",
+        "TPMA_OBJECT_DECRYPT"
+    ],
+    "auth_policy": "Fnhgo18sXDVn+cknrFbAMvOzpkYvjQN5mOehD3f6RUo=",
+    "ecc": {
+        "symmetric": {
+            "algorithm": "TPM2_ALG_SM4",
+            "key_bits": 128,
+            "mode": "TPM2_ALG_CFB"
+        },
+        "scheme": {
+            "algorithm": "TPM2_ALG_NULL"
+        },
+        "elliptic_curve": "TPM2_ECC_SM2_P256",
+        "kdf": {
+            "algorithm": "TPM2_ALG_NULL"
+        }
+    }
+}
+`,
+	},
+	"tcg-ek-rsa3072": {
+		Description: "TCG RSA 3072 endorsement key (template H-6)",
+		JSON: `{
+    "type": "TPM2_ALG_RSA",
+    "name_alg": "TPM2_ALG_SHA384",
+    "attributes": [
+        "TPMA_OBJECT_FIXEDTPM",
+        "TPMA_OBJECT_FIXEDPARENT",
+        "TPMA_OBJECT_SENSITIVEDATAORIGIN",
+        "TPMA_OBJECT_USERWITHAUTH",
+        "TPMA_OBJECT_ADMINWITHPOLICY",
+        "TPMA_OBJECT_RESTRICTED",
+        "TPMA_OBJECT_DECRYPT"
+    ],
+    "auth_policy": "sm59KNEaULxT2IK89f06GgdBSLs107TkyxwK2b3kGcrLR7oJaZZGFQ+fwADz+A4S",
+    "rsa": {
+        "symmetric": {
+            "algorithm": "TPM2_ALG_AES",
+            "key_bits": 256,
+            "mode": "TPM2_ALG_CFB"
+        },
+        "scheme": {
+            "algorithm": "TPM2_ALG_NULL"
+        },
+        "key_bits": 3072,
+        "exponent": 0
+    }
+}
+`,
+	},
+	"srk-rsa": {
+		Description: "RSA 2048 storage root key",
+		JSON: `{
+    "type": "TPM2_ALG_RSA",
+    "name_alg": "TPM2_ALG_SHA256",
+    "attributes": [
+        "TPMA_OBJECT_FIXEDTPM",
+        "TPMA_OBJECT_FIXEDPARENT",
+        "TPMA_OBJECT_SENSITIVEDATAORIGIN",
+        "TPMA_OBJECT_USERWITHAUTH",
+        "TPMA_OBJECT_NODA",
+        "TPMA_OBJECT_RESTRICTED",
+        "TPMA_OBJECT_DECRYPT"
+    ],
+    "rsa": {
+        "symmetric": {
+            "algorithm": "TPM2_ALG_AES",
+            "key_bits": 128,
+            "mode": "TPM2_ALG_CFB"
+        },
+        "scheme": {
+            "algorithm": "TPM2_ALG_NULL"
+        },
+        "key_bits": 2048,
+        "exponent": 0
+    }
+}
+`,
+	},
+	"srk-ecc": {
+		Description: "ECC NIST P256 storage root key",
+		JSON: `{
+    "type": "TPM2_ALG_ECC",
+    "name_alg": "TPM2_ALG_SHA256",
+    "attributes": [
+        "TPMA_OBJECT_FIXEDTPM",
+        "TPMA_OBJECT_FIXEDPARENT",
+        "TPMA_OBJECT_SENSITIVEDATAORIGIN",
+        "TPMA_OBJECT_USERWITHAUTH",
+        "TPMA_OBJECT_NODA",
+        "TPMA_OBJECT_RESTRICTED",
+        "TPMA_OBJECT_DECRYPT"
+    ],
+    "ecc": {
+        "symmetric": {
+            "algorithm": "TPM2_ALG_AES",
+            "key_bits": 128,
+            "mode": "TPM2_ALG_CFB"
+        },
+        "scheme": {
+            "algorithm": "TPM2_ALG_NULL"
+        },
+        "elliptic_curve": "TPM2_ECC_NIST_P256",
+        "kdf": {
+            "algorithm": "TPM2_ALG_NULL"
+        }
+    }
+}
+`,
+	},
+	"ak-rsa": {
+		Description: "RSA 2048 attestation key with RSASSA-SHA256",
+		JSON: `{
+    "type": "TPM2_ALG_RSA",
+    "name_alg": "TPM2_ALG_SHA256",
+    "attributes": [
+        "TPMA_OBJECT_FIXEDTPM",
+        "TPMA_OBJECT_FIXEDPARENT",
+        "TPMA_OBJECT_SENSITIVEDATAORIGIN",
+        "TPMA_OBJECT_USERWITHAUTH",
+        "TPMA_OBJECT_RESTRICTED",
+        "TPMA_OBJECT_SIGN_ENCRYPT"
+    ],
+    "rsa": {
+        "scheme": {
+            "algorithm": "TPM2_ALG_RSASSA",
+            "hash": "TPM2_ALG_SHA256"
+        },
+        "key_bits": 2048,
+        "exponent": 0
+    }
+}
+`,
+	},
+	"ak-ecc": {
+		Description: "ECC NIST P256 attestation key with ECDSA-SHA256",
+		JSON: `{
+    "type": "TPM2_ALG_ECC",
+    "name_alg": "TPM2_ALG_SHA256",
+    "attributes": [
+        "TPMA_OBJECT_FIXEDTPM",
+        "TPMA_OBJECT_FIXEDPARENT",
+        "TPMA_OBJECT_SENSITIVEDATAORIGIN",
+        "TPMA_OBJECT_USERWITHAUTH",
+        "TPMA_OBJECT_RESTRICTED",
+        "TPMA_OBJECT_SIGN_ENCRYPT"
+    ],
+    "ecc": {
+        "scheme": {
+            "algorithm": "TPM2_ALG_ECDSA",
+            "hash": "TPM2_ALG_SHA256"
+        },
+        "elliptic_curve": "TPM2_ECC_NIST_P256",
+        "kdf": {
+            "algorithm": "TPM2_ALG_NULL"
+        }
+    }
+}
+`,
+	},
+	"sealing": {
+		Description: "sealed data object",
+		JSON: `{
+    "type": "TPM2_ALG_KEYEDHASH",
+    "name_alg": "TPM2_ALG_SHA256",
+    "attributes": [
+        "TPMA_OBJECT_FIXEDTPM",
+        "TPMA_OBJECT_FIXEDPARENT",
+        "TPMA_OBJECT_USERWITHAUTH"
+    ],
+    "keyed_hash": {
+        "algorithm": "TPM2_ALG_NULL"
+    }
+}
+`,
+	},
+}
+
+// BuiltinTemplates returns the built-in templates, sorted by name.
+func BuiltinTemplates() []BuiltinTemplate {
+	var tmpls []BuiltinTemplate
+	for name := range builtinTemplates {
+		t, _ := LookupBuiltinTemplate(name)
+		tmpls = append(tmpls, t)
+	}
+
+	sort.Slice(tmpls, func(i, j int) bool {
+		return tmpls[i].Name < tmpls[j].Name
+	})
+
+	return tmpls
+}
+
+// LookupBuiltinTemplate returns the built-in template with the given name,
+// and reports whether it was found.
+func LookupBuiltinTemplate(name string) (BuiltinTemplate, bool) {
+	t, ok := builtinTemplates[name]
+	if !ok {
+		return BuiltinTemplate{}, false
+	}
+	t.Name = name
+
+	return t, true
+}
@@ -0,0 +1,27 @@
+/*
+Package tpmkey provides access to keys resident in a TPM 2.0 device.
+
+A TPM is opened with OpenTPM, which accepts either the path to a TPM device or
+the hostname:port address of a Microsoft TPM 2.0 Simulator. Keys may then be
+obtained either by persistent handle with New, by loading public and private
+areas previously created under a parent key with Load or LoadFiles, or by
+loading a saved context with LoadContext or LoadContextFile.
+
+Key implements crypto.Signer and crypto.Decrypter, and so may be used directly
+with packages such as crypto/tls and crypto/x509:
+
+	rw, err := tpmkey.OpenTPM("/dev/tpmrm0")
+	if err != nil {
+		return err
+	}
+	defer rw.Close()
+
+	key, err := tpmkey.New(rw, 0x81000002, "")
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, tmpl, key)
+*/
+package tpmkey
@@ -0,0 +1,415 @@
+package tpmkey
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// Key represents a key resident in a TPM. It implements crypto.Signer for
+// signing keys and crypto.Decrypter for RSA decryption keys.
+type Key struct {
+	rw        io.ReadWriter
+	handle    tpmutil.Handle
+	password  string
+	pub       tpm2.Public
+	pubKey    crypto.PublicKey
+	scheme    *tpm2.SigScheme
+	transient bool
+}
+
+// ecdsaSignature is the ASN.1 structure of an ECDSA signature.
+type ecdsaSignature struct {
+	R *big.Int
+	S *big.Int
+}
+
+// hashToAlgorithm maps Go hash functions to TPM algorithm IDs.
+var hashToAlgorithm = map[crypto.Hash]tpm2.Algorithm{
+	crypto.SHA1:   tpm2.AlgSHA1,
+	crypto.SHA256: tpm2.AlgSHA256,
+	crypto.SHA384: tpm2.AlgSHA384,
+	crypto.SHA512: tpm2.AlgSHA512,
+}
+
+// New returns the key with the specified handle, which will usually be a
+// persistent handle. The caller is responsible for ensuring that the TPM is
+// not closed and the handle is not flushed until the key will no longer be
+// used.
+func New(rw io.ReadWriter, handle tpmutil.Handle, password string) (*Key, error) {
+	pub, _, _, err := tpm2.ReadPublic(rw, handle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public area: %v", err)
+	}
+
+	k := &Key{
+		rw:       rw,
+		handle:   handle,
+		password: password,
+		pub:      pub,
+	}
+
+	switch {
+	case pub.RSAParameters != nil:
+		k.scheme = pub.RSAParameters.Sign
+
+	case pub.ECCParameters != nil:
+		k.scheme = pub.ECCParameters.Sign
+
+	default:
+		return nil, errors.New("not an RSA or ECC key")
+	}
+
+	k.pubKey, err = pub.Key()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get public key from public area: %v", err)
+	}
+
+	return k, nil
+}
+
+// Load loads a key from its public and private areas, as output by
+// TPM2_Create, into the TPM under the specified parent. The returned key
+// should be closed when no longer needed, to flush it from the TPM.
+func Load(rw io.ReadWriter, parent tpmutil.Handle, parentPassword string,
+	public, private []byte, password string) (*Key, error) {
+	handle, _, err := tpm2.Load(rw, parent, parentPassword, public, private)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key: %v", err)
+	}
+
+	k, err := New(rw, handle, password)
+	if err != nil {
+		tpm2.FlushContext(rw, handle)
+		return nil, err
+	}
+	k.transient = true
+
+	return k, nil
+}
+
+// LoadFiles reads a key's public and private areas from the named files,
+// and loads it into the TPM as with Load.
+func LoadFiles(rw io.ReadWriter, parent tpmutil.Handle, parentPassword string,
+	publicFile, privateFile string, password string) (*Key, error) {
+	public, err := ioutil.ReadFile(publicFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public area: %v", err)
+	}
+
+	private, err := ioutil.ReadFile(privateFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private area: %v", err)
+	}
+
+	return Load(rw, parent, parentPassword, public, private, password)
+}
+
+// LoadContext loads a key from a saved context, as output by
+// TPM2_ContextSave. The returned key should be closed when no longer needed,
+// to flush it from the TPM.
+func LoadContext(rw io.ReadWriter, context []byte, password string) (*Key, error) {
+	handle, err := tpm2.ContextLoad(rw, context)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load context: %v", err)
+	}
+
+	k, err := New(rw, handle, password)
+	if err != nil {
+		tpm2.FlushContext(rw, handle)
+		return nil, err
+	}
+	k.transient = true
+
+	return k, nil
+}
+
+// LoadContextFile reads a saved context from the named file, and loads it
+// into the TPM as with LoadContext.
+func LoadContextFile(rw io.ReadWriter, name string, password string) (*Key, error) {
+	context, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read context: %v", err)
+	}
+
+	return LoadContext(rw, context, password)
+}
+
+// Close flushes the key from the TPM if it was loaded with Load, LoadFiles,
+// LoadContext or LoadContextFile. Keys obtained with New are unaffected.
+func (k *Key) Close() error {
+	if !k.transient {
+		return nil
+	}
+	k.transient = false
+
+	if err := tpm2.FlushContext(k.rw, k.handle); err != nil {
+		return fmt.Errorf("failed to flush key: %v", err)
+	}
+
+	return nil
+}
+
+// Handle returns the key's handle.
+func (k *Key) Handle() tpmutil.Handle {
+	return k.handle
+}
+
+// TPMPublic returns the key's public area.
+func (k *Key) TPMPublic() tpm2.Public {
+	return k.pub
+}
+
+// Public returns the public key corresponding to the private key.
+func (k *Key) Public() crypto.PublicKey {
+	return k.pubKey
+}
+
+// Sign signs digest with the private key. If opts is a *rsa.PSSOptions, the
+// RSASSA-PSS signature scheme will be used for RSA keys, unless the key's
+// own scheme requires otherwise. The TPM always uses a salt as long as the
+// digest, so other salt lengths are rejected.
+func (k *Key) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if k.pub.Attributes&tpm2.FlagSign == 0 {
+		return nil, errors.New("key is not a signing key")
+	}
+
+	scheme, err := k.sigScheme(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := tpm2.Sign(k.rw, k.handle, k.password, digest, &scheme)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign digest: %v", err)
+	}
+
+	switch {
+	case sig.RSA != nil:
+		return sig.RSA.Signature, nil
+
+	case sig.ECC != nil:
+		der, err := asn1.Marshal(ecdsaSignature{R: sig.ECC.R, S: sig.ECC.S})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal ECDSA signature: %v", err)
+		}
+
+		return der, nil
+	}
+
+	return nil, errors.New("unexpected signature type")
+}
+
+// sigScheme returns the TPM signature scheme to use to sign with the key
+// and the specified signer options.
+func (k *Key) sigScheme(opts crypto.SignerOpts) (tpm2.SigScheme, error) {
+	var scheme tpm2.SigScheme
+
+	_, pss := opts.(*rsa.PSSOptions)
+
+	// Use the signature algorithm specified by the key, or choose an
+	// appropriate default.
+	if k.scheme == nil || k.scheme.Alg.IsNull() {
+		switch t := k.pubKey.(type) {
+		case *rsa.PublicKey:
+			if pss {
+				scheme.Alg = tpm2.AlgRSAPSS
+			} else {
+				scheme.Alg = tpm2.AlgRSASSA
+			}
+
+		case *ecdsa.PublicKey:
+			scheme.Alg = tpm2.AlgECDSA
+
+		default:
+			return tpm2.SigScheme{}, fmt.Errorf("unexpected public key type: %T", t)
+		}
+	} else {
+		if pss != (k.scheme.Alg == tpm2.AlgRSAPSS) {
+			return tpm2.SigScheme{}, fmt.Errorf("key requires signature scheme %s",
+				pgtpm.Algorithm(k.scheme.Alg).String())
+		}
+
+		scheme.Alg = k.scheme.Alg
+		scheme.Count = k.scheme.Count
+	}
+
+	if opts.HashFunc() == 0 {
+		return tpm2.SigScheme{}, errors.New("digest was not hashed")
+	}
+
+	alg, ok := hashToAlgorithm[opts.HashFunc()]
+	if !ok {
+		return tpm2.SigScheme{}, errors.New("unsupported hash function")
+	}
+
+	if k.scheme != nil && !k.scheme.Alg.IsNull() && k.scheme.Hash != alg {
+		return tpm2.SigScheme{}, fmt.Errorf("key requires hash algorithm %s",
+			pgtpm.Algorithm(k.scheme.Hash).String())
+	}
+	scheme.Hash = alg
+
+	if o, ok := opts.(*rsa.PSSOptions); ok {
+		switch o.SaltLength {
+		case rsa.PSSSaltLengthAuto, rsa.PSSSaltLengthEqualsHash, opts.HashFunc().Size():
+
+		default:
+			return tpm2.SigScheme{}, fmt.Errorf("unsupported PSS salt length: %d", o.SaltLength)
+		}
+	}
+
+	return scheme, nil
+}
+
+// Decrypt decrypts msg with the private key. If opts is a *rsa.OAEPOptions,
+// RSAES-OAEP is used, otherwise RSAES-PKCS1-v1_5 is used. Only RSA keys are
+// supported. As with rsa.PrivateKey, if opts is a *rsa.PKCS1v15DecryptOptions
+// with a non-zero SessionKeyLen, a random key of that length, read from rand,
+// is returned in place of any decryption error, so that padding errors are not
+// revealed.
+func (k *Key) Decrypt(rand io.Reader, msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	if k.pub.RSAParameters == nil {
+		return nil, errors.New("decryption is only supported for RSA keys")
+	}
+
+	if k.pub.Attributes&tpm2.FlagDecrypt == 0 {
+		return nil, errors.New("key is not a decryption key")
+	}
+
+	var scheme = tpm2.AsymScheme{Alg: tpm2.AlgRSAES}
+	var label string
+	var sessionKey []byte
+
+	switch o := opts.(type) {
+	case *rsa.OAEPOptions:
+		alg, ok := hashToAlgorithm[o.Hash]
+		if !ok {
+			return nil, errors.New("unsupported hash function")
+		}
+
+		scheme = tpm2.AsymScheme{Alg: tpm2.AlgOAEP, Hash: alg}
+
+		// The TPM appends a terminating zero byte to the label, so one
+		// must be present, and is removed here.
+		if len(o.Label) > 0 {
+			if o.Label[len(o.Label)-1] != 0 {
+				return nil, errors.New("OAEP label must be zero-terminated")
+			}
+			label = string(o.Label[:len(o.Label)-1])
+		}
+
+	case *rsa.PKCS1v15DecryptOptions:
+		if o != nil && o.SessionKeyLen > 0 {
+			sessionKey = make([]byte, o.SessionKeyLen)
+			if _, err := io.ReadFull(rand, sessionKey); err != nil {
+				return nil, fmt.Errorf("failed to generate session key: %v", err)
+			}
+		}
+
+	case nil:
+
+	default:
+		return nil, fmt.Errorf("unsupported decrypter options: %T", opts)
+	}
+
+	plain, err := tpm2.RSADecrypt(k.rw, k.handle, k.password, msg, &scheme, label)
+	if sessionKey != nil {
+		if err != nil || len(plain) != len(sessionKey) {
+			return sessionKey, nil
+		}
+
+		return plain, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt message: %v", err)
+	}
+
+	return plain, nil
+}
+
+// SignatureAlgorithm returns the X.509 signature algorithm to use with the
+// key. If hash is zero, the hash algorithm specified by the key's scheme will
+// be used, or SHA256 if the key does not specify a scheme. RSASSA-PSS is used
+// for RSA keys if pss is true or the key's scheme requires it.
+func (k *Key) SignatureAlgorithm(hash crypto.Hash, pss bool) (x509.SignatureAlgorithm, error) {
+	if k.scheme != nil && !k.scheme.Alg.IsNull() {
+		h, err := k.scheme.Hash.Hash()
+		if err != nil {
+			return x509.UnknownSignatureAlgorithm, err
+		}
+
+		if hash != 0 && hash != h {
+			return x509.UnknownSignatureAlgorithm, fmt.Errorf("key requires hash algorithm %s",
+				pgtpm.Algorithm(k.scheme.Hash).String())
+		}
+		hash = h
+
+		if k.scheme.Alg == tpm2.AlgRSAPSS {
+			pss = true
+		}
+	}
+
+	if hash == 0 {
+		hash = crypto.SHA256
+	}
+
+	switch k.pubKey.(type) {
+	case *rsa.PublicKey:
+		switch {
+		case hash == crypto.SHA1 && !pss:
+			return x509.SHA1WithRSA, nil
+
+		case hash == crypto.SHA256 && pss:
+			return x509.SHA256WithRSAPSS, nil
+
+		case hash == crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+
+		case hash == crypto.SHA384 && pss:
+			return x509.SHA384WithRSAPSS, nil
+
+		case hash == crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+
+		case hash == crypto.SHA512 && pss:
+			return x509.SHA512WithRSAPSS, nil
+
+		case hash == crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+
+	case *ecdsa.PublicKey:
+		if pss {
+			return x509.UnknownSignatureAlgorithm, errors.New("RSASSA-PSS cannot be used with an ECC key")
+		}
+
+		switch hash {
+		case crypto.SHA1:
+			return x509.ECDSAWithSHA1, nil
+
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, nil
+
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, nil
+
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, nil
+		}
+	}
+
+	return x509.UnknownSignatureAlgorithm, errors.New("unsupported signature algorithm")
+}
@@ -0,0 +1,340 @@
+package tpmkey
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+// testKey returns a key of the specified type with the specified scheme,
+// for tests which do not need a TPM.
+func testKey(typ tpm2.Algorithm, scheme *tpm2.SigScheme) *Key {
+	k := &Key{scheme: scheme}
+
+	switch typ {
+	case tpm2.AlgRSA:
+		k.pubKey = &rsa.PublicKey{N: big.NewInt(1), E: 65537}
+
+	case tpm2.AlgECC:
+		k.pubKey = &ecdsa.PublicKey{Curve: elliptic.P256()}
+	}
+
+	return k
+}
+
+func TestSigScheme(t *testing.T) {
+	t.Parallel()
+
+	var testcases = []struct {
+		name   string
+		typ    tpm2.Algorithm
+		scheme *tpm2.SigScheme
+		opts   crypto.SignerOpts
+		want   tpm2.SigScheme
+	}{
+		{
+			name: "RSA/NoScheme/PKCS1v15",
+			typ:  tpm2.AlgRSA,
+			opts: crypto.SHA256,
+			want: tpm2.SigScheme{Alg: tpm2.AlgRSASSA, Hash: tpm2.AlgSHA256},
+		},
+		{
+			name:   "RSA/NullScheme/PKCS1v15",
+			typ:    tpm2.AlgRSA,
+			scheme: &tpm2.SigScheme{Alg: tpm2.AlgNull},
+			opts:   crypto.SHA384,
+			want:   tpm2.SigScheme{Alg: tpm2.AlgRSASSA, Hash: tpm2.AlgSHA384},
+		},
+		{
+			name: "RSA/NoScheme/PSSEqualsHash",
+			typ:  tpm2.AlgRSA,
+			opts: &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256},
+			want: tpm2.SigScheme{Alg: tpm2.AlgRSAPSS, Hash: tpm2.AlgSHA256},
+		},
+		{
+			name: "RSA/NoScheme/PSSAuto",
+			typ:  tpm2.AlgRSA,
+			opts: &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto, Hash: crypto.SHA512},
+			want: tpm2.SigScheme{Alg: tpm2.AlgRSAPSS, Hash: tpm2.AlgSHA512},
+		},
+		{
+			name: "RSA/NoScheme/PSSHashLength",
+			typ:  tpm2.AlgRSA,
+			opts: &rsa.PSSOptions{SaltLength: 48, Hash: crypto.SHA384},
+			want: tpm2.SigScheme{Alg: tpm2.AlgRSAPSS, Hash: tpm2.AlgSHA384},
+		},
+		{
+			name:   "RSA/PSSScheme/PSS",
+			typ:    tpm2.AlgRSA,
+			scheme: &tpm2.SigScheme{Alg: tpm2.AlgRSAPSS, Hash: tpm2.AlgSHA256},
+			opts:   &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256},
+			want:   tpm2.SigScheme{Alg: tpm2.AlgRSAPSS, Hash: tpm2.AlgSHA256},
+		},
+		{
+			name:   "RSA/RSASSAScheme/PKCS1v15",
+			typ:    tpm2.AlgRSA,
+			scheme: &tpm2.SigScheme{Alg: tpm2.AlgRSASSA, Hash: tpm2.AlgSHA1},
+			opts:   crypto.SHA1,
+			want:   tpm2.SigScheme{Alg: tpm2.AlgRSASSA, Hash: tpm2.AlgSHA1},
+		},
+		{
+			name: "ECC/NoScheme",
+			typ:  tpm2.AlgECC,
+			opts: crypto.SHA256,
+			want: tpm2.SigScheme{Alg: tpm2.AlgECDSA, Hash: tpm2.AlgSHA256},
+		},
+		{
+			name:   "ECC/ECDAAScheme",
+			typ:    tpm2.AlgECC,
+			scheme: &tpm2.SigScheme{Alg: tpm2.AlgECDAA, Hash: tpm2.AlgSHA256, Count: 3},
+			opts:   crypto.SHA256,
+			want:   tpm2.SigScheme{Alg: tpm2.AlgECDAA, Hash: tpm2.AlgSHA256, Count: 3},
+		},
+	}
+
+	for _, tc := range testcases {
+		var tc = tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := testKey(tc.typ, tc.scheme).sigScheme(tc.opts)
+			if err != nil {
+				t.Fatalf("couldn't get signature scheme: %v", err)
+			}
+
+			if got != tc.want {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSigSchemeFailure(t *testing.T) {
+	t.Parallel()
+
+	var testcases = []struct {
+		name   string
+		typ    tpm2.Algorithm
+		scheme *tpm2.SigScheme
+		opts   crypto.SignerOpts
+	}{
+		{
+			name: "NotHashed",
+			typ:  tpm2.AlgRSA,
+			opts: crypto.Hash(0),
+		},
+		{
+			name: "UnsupportedHash",
+			typ:  tpm2.AlgECC,
+			opts: crypto.MD5,
+		},
+		{
+			name: "PSSSaltLength",
+			typ:  tpm2.AlgRSA,
+			opts: &rsa.PSSOptions{SaltLength: 20, Hash: crypto.SHA256},
+		},
+		{
+			name:   "PSSWithRSASSAScheme",
+			typ:    tpm2.AlgRSA,
+			scheme: &tpm2.SigScheme{Alg: tpm2.AlgRSASSA, Hash: tpm2.AlgSHA256},
+			opts:   &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256},
+		},
+		{
+			name:   "PKCS1v15WithPSSScheme",
+			typ:    tpm2.AlgRSA,
+			scheme: &tpm2.SigScheme{Alg: tpm2.AlgRSAPSS, Hash: tpm2.AlgSHA256},
+			opts:   crypto.SHA256,
+		},
+		{
+			name:   "HashMismatch",
+			typ:    tpm2.AlgECC,
+			scheme: &tpm2.SigScheme{Alg: tpm2.AlgECDSA, Hash: tpm2.AlgSHA384},
+			opts:   crypto.SHA256,
+		},
+	}
+
+	for _, tc := range testcases {
+		var tc = tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got, err := testKey(tc.typ, tc.scheme).sigScheme(tc.opts); err == nil {
+				t.Fatalf("unexpectedly got signature scheme %+v", got)
+			}
+		})
+	}
+}
+
+func TestSignatureAlgorithm(t *testing.T) {
+	t.Parallel()
+
+	var testcases = []struct {
+		name   string
+		typ    tpm2.Algorithm
+		scheme *tpm2.SigScheme
+		hash   crypto.Hash
+		pss    bool
+		want   x509.SignatureAlgorithm
+	}{
+		{
+			name: "RSA/Default",
+			typ:  tpm2.AlgRSA,
+			want: x509.SHA256WithRSA,
+		},
+		{
+			name: "RSA/SHA1",
+			typ:  tpm2.AlgRSA,
+			hash: crypto.SHA1,
+			want: x509.SHA1WithRSA,
+		},
+		{
+			name: "RSA/SHA384/PSS",
+			typ:  tpm2.AlgRSA,
+			hash: crypto.SHA384,
+			pss:  true,
+			want: x509.SHA384WithRSAPSS,
+		},
+		{
+			name:   "RSA/PSSScheme",
+			typ:    tpm2.AlgRSA,
+			scheme: &tpm2.SigScheme{Alg: tpm2.AlgRSAPSS, Hash: tpm2.AlgSHA512},
+			want:   x509.SHA512WithRSAPSS,
+		},
+		{
+			name:   "RSA/RSASSAScheme",
+			typ:    tpm2.AlgRSA,
+			scheme: &tpm2.SigScheme{Alg: tpm2.AlgRSASSA, Hash: tpm2.AlgSHA384},
+			hash:   crypto.SHA384,
+			want:   x509.SHA384WithRSA,
+		},
+		{
+			name:   "RSA/NullScheme",
+			typ:    tpm2.AlgRSA,
+			scheme: &tpm2.SigScheme{Alg: tpm2.AlgNull},
+			hash:   crypto.SHA512,
+			want:   x509.SHA512WithRSA,
+		},
+		{
+			name: "ECC/Default",
+			typ:  tpm2.AlgECC,
+			want: x509.ECDSAWithSHA256,
+		},
+		{
+			name:   "ECC/ECDSAScheme",
+			typ:    tpm2.AlgECC,
+			scheme: &tpm2.SigScheme{Alg: tpm2.AlgECDSA, Hash: tpm2.AlgSHA384},
+			want:   x509.ECDSAWithSHA384,
+		},
+	}
+
+	for _, tc := range testcases {
+		var tc = tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := testKey(tc.typ, tc.scheme).SignatureAlgorithm(tc.hash, tc.pss)
+			if err != nil {
+				t.Fatalf("couldn't get signature algorithm: %v", err)
+			}
+
+			if got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSignatureAlgorithmFailure(t *testing.T) {
+	t.Parallel()
+
+	var testcases = []struct {
+		name   string
+		typ    tpm2.Algorithm
+		scheme *tpm2.SigScheme
+		hash   crypto.Hash
+		pss    bool
+	}{
+		{
+			name: "RSA/SHA1/PSS",
+			typ:  tpm2.AlgRSA,
+			hash: crypto.SHA1,
+			pss:  true,
+		},
+		{
+			name:   "RSA/HashMismatch",
+			typ:    tpm2.AlgRSA,
+			scheme: &tpm2.SigScheme{Alg: tpm2.AlgRSASSA, Hash: tpm2.AlgSHA256},
+			hash:   crypto.SHA384,
+		},
+		{
+			name: "ECC/PSS",
+			typ:  tpm2.AlgECC,
+			pss:  true,
+		},
+		{
+			name: "ECC/MD5",
+			typ:  tpm2.AlgECC,
+			hash: crypto.MD5,
+		},
+	}
+
+	for _, tc := range testcases {
+		var tc = tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got, err := testKey(tc.typ, tc.scheme).SignatureAlgorithm(tc.hash, tc.pss); err == nil {
+				t.Fatalf("unexpectedly got signature algorithm %v", got)
+			}
+		})
+	}
+}
+
+// failingTPM is a TPM whose commands all fail.
+type failingTPM struct{}
+
+func (failingTPM) Read([]byte) (int, error)  { return 0, errors.New("TPM failure") }
+func (failingTPM) Write([]byte) (int, error) { return 0, errors.New("TPM failure") }
+
+func TestDecryptSessionKey(t *testing.T) {
+	t.Parallel()
+
+	k := &Key{
+		rw: failingTPM{},
+		pub: tpm2.Public{
+			Type:          tpm2.AlgRSA,
+			Attributes:    tpm2.FlagDecrypt,
+			RSAParameters: &tpm2.RSAParams{KeyBits: 2048},
+		},
+	}
+
+	// A decryption failure is replaced by a random session key.
+	want := bytes.Repeat([]byte{0x5a}, 16)
+	got, err := k.Decrypt(bytes.NewReader(want), []byte("ciphertext"),
+		&rsa.PKCS1v15DecryptOptions{SessionKeyLen: len(want)})
+	if err != nil {
+		t.Fatalf("couldn't decrypt: %v", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+
+	// Without a session key length, the failure is reported.
+	if _, err := k.Decrypt(rand.Reader, []byte("ciphertext"), &rsa.PKCS1v15DecryptOptions{}); err == nil {
+		t.Errorf("unexpectedly decrypted")
+	}
+}
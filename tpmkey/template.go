@@ -0,0 +1,252 @@
+package tpmkey
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-tpm/tpm2"
+	"gopkg.in/yaml.v2"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// extendsField is the name of the template field which identifies the
+// template it extends.
+const extendsField = "extends"
+
+// ParseTemplate parses a JSON- or YAML-encoded pgtpm.PublicTemplate and
+// returns the corresponding public area. A template which extends another
+// template may name a file relative to the current directory, or a built-in
+// template.
+func ParseTemplate(data []byte) (tpm2.Public, error) {
+	doc, err := resolveTemplate(data, ".", nil)
+	if err == nil {
+		doc, err = validateTemplate(doc)
+	}
+	if err != nil {
+		return tpm2.Public{}, fmt.Errorf("invalid template: %v", err)
+	}
+
+	return templateToPublic(doc)
+}
+
+// LoadTemplate reads and parses a JSON- or YAML-encoded
+// pgtpm.PublicTemplate from the named file or, if no such file exists, the
+// built-in template of that name. A template which extends another template
+// may name a file relative to its own directory, or a built-in template.
+func LoadTemplate(name string) (tpm2.Public, error) {
+	doc, err := loadTemplateDoc(name, ".", nil)
+	if err != nil {
+		return tpm2.Public{}, err
+	}
+
+	if doc, err = validateTemplate(doc); err != nil {
+		return tpm2.Public{}, fmt.Errorf("invalid template %s: %v", name, err)
+	}
+
+	return templateToPublic(doc)
+}
+
+// loadTemplateDoc reads, decodes and resolves the named template, relative
+// to the given directory. seen contains the templates which extend this
+// template, to detect cycles.
+func loadTemplateDoc(name, dir string, seen map[string]bool) (map[string]interface{}, error) {
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	key := path
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t, ok := LookupBuiltinTemplate(name)
+		if !ok || !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read template: %v", err)
+		}
+
+		key = "builtin:" + name
+		data = []byte(t.JSON)
+		dir = "."
+	} else {
+		if abs, err := filepath.Abs(path); err == nil {
+			key = abs
+		}
+		dir = filepath.Dir(path)
+	}
+
+	if seen[key] {
+		return nil, fmt.Errorf("invalid template %s: %s cycle", name, extendsField)
+	}
+
+	next := map[string]bool{key: true}
+	for k := range seen {
+		next[k] = true
+	}
+
+	doc, err := resolveTemplate(data, dir, next)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template %s: %v", name, err)
+	}
+
+	return doc, nil
+}
+
+// resolveTemplate decodes a template and, if it extends another template,
+// merges it over that template. Relative file names are resolved from the
+// given directory.
+func resolveTemplate(data []byte, dir string, seen map[string]bool) (map[string]interface{}, error) {
+	doc, err := decodeTemplate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := doc[extendsField]
+	if !ok {
+		return doc, nil
+	}
+	delete(doc, extendsField)
+
+	base, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected string, found %s", extendsField, valueType(v))
+	}
+
+	baseDoc, err := loadTemplateDoc(base, dir, seen)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", extendsField, err)
+	}
+
+	return mergeTemplate(baseDoc, doc), nil
+}
+
+// decodeTemplate decodes a JSON or YAML template into a generic document.
+// Documents beginning with an opening brace are decoded as JSON, so that
+// syntax errors are reported with JSON line numbers.
+func decodeTemplate(data []byte) (map[string]interface{}, error) {
+	var v interface{}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+
+		if err := dec.Decode(&v); err != nil {
+			var serr *json.SyntaxError
+			if errors.As(err, &serr) {
+				return nil, fmt.Errorf("line %d: %v", lineOf(data, serr.Offset), err)
+			}
+			return nil, err
+		}
+
+		if dec.More() {
+			return nil, errors.New("unexpected data after template")
+		}
+	} else {
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+
+		var err error
+		if v, err = normalizeYAML("", v); err != nil {
+			return nil, err
+		}
+	}
+
+	doc, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected object, found %s", valueType(v))
+	}
+
+	return doc, nil
+}
+
+// normalizeYAML converts the maps in a decoded YAML value to maps with
+// string keys, as decoded from JSON.
+func normalizeYAML(path string, v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{})
+		for k, e := range x {
+			s, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: field name %v is not a string", displayPath(path), k)
+			}
+
+			var err error
+			if m[s], err = normalizeYAML(fieldPath(path, s), e); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+
+	case []interface{}:
+		a := make([]interface{}, len(x))
+		for i, e := range x {
+			var err error
+			if a[i], err = normalizeYAML(fmt.Sprintf("%s[%d]", path, i), e); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	}
+
+	return v, nil
+}
+
+// mergeTemplate returns the template document which results from overriding
+// the fields of base with those of doc. Objects are merged field by field,
+// other values are replaced, and a null value removes the field.
+func mergeTemplate(base, doc map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	for k, v := range base {
+		out[k] = v
+	}
+
+	for k, v := range doc {
+		if v == nil {
+			delete(out, k)
+			continue
+		}
+
+		bm, bok := out[k].(map[string]interface{})
+		dm, dok := v.(map[string]interface{})
+		if bok && dok {
+			out[k] = mergeTemplate(bm, dm)
+		} else {
+			out[k] = v
+		}
+	}
+
+	return out
+}
+
+// templateToPublic returns the public area corresponding to a validated
+// template document.
+func templateToPublic(doc map[string]interface{}) (tpm2.Public, error) {
+	delete(doc, "$schema")
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return tpm2.Public{}, fmt.Errorf("failed to marshal template: %v", err)
+	}
+
+	var tmpl pgtpm.PublicTemplate
+	if err := json.Unmarshal(data, &tmpl); err != nil {
+		return tpm2.Public{}, fmt.Errorf("failed to unmarshal template: %v", err)
+	}
+
+	return tmpl.ToPublic(), nil
+}
+
+// lineOf returns the line number of the given byte offset in data.
+func lineOf(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
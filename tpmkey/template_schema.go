@@ -0,0 +1,516 @@
+package tpmkey
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// schemaKind is the kind of value described by a schema node.
+type schemaKind int
+
+// Schema node kinds.
+const (
+	schemaObject schemaKind = iota
+	schemaArray
+	schemaString
+	schemaInteger
+	schemaBigInteger
+	schemaBytes
+	schemaEnum
+)
+
+// schemaNode describes a value in a template. The same description is used
+// both to validate templates and to output the JSON Schema for them.
+type schemaNode struct {
+	kind        schemaKind
+	description string
+
+	// fields are the fields of an object, in order.
+	fields []schemaField
+
+	// items describes the elements of an array.
+	items *schemaNode
+
+	// noun names the type of the values of an enumeration, for messages.
+	noun   string
+	values []string
+
+	// ref is the name of the JSON Schema definition of the node, if it is
+	// shared between fields.
+	ref string
+
+	// max is the maximum value of an integer.
+	max uint64
+}
+
+// schemaField is a field of an object.
+type schemaField struct {
+	name     string
+	node     *schemaNode
+	required bool
+}
+
+// typeParameters are the template parameter fields required for each
+// object type. The parameter fields of other types are not permitted.
+var typeParameters = map[string]string{
+	"TPM2_ALG_RSA":       "rsa",
+	"TPM2_ALG_ECC":       "ecc",
+	"TPM2_ALG_SYMCIPHER": "sym_cipher",
+	"TPM2_ALG_KEYEDHASH": "keyed_hash",
+}
+
+// objectTypes returns the permitted object types, in order.
+func objectTypes() []string {
+	var types []string
+	for t := range typeParameters {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+// hashAlgorithms are the permitted values of hash algorithm fields.
+var hashAlgorithms = []pgtpm.Algorithm{
+	pgtpm.TPM2_ALG_SHA1,
+	pgtpm.TPM2_ALG_SHA256,
+	pgtpm.TPM2_ALG_SHA384,
+	pgtpm.TPM2_ALG_SHA512,
+	pgtpm.TPM2_ALG_SM3_256,
+	pgtpm.TPM2_ALG_SHA3_256,
+	pgtpm.TPM2_ALG_SHA3_384,
+	pgtpm.TPM2_ALG_SHA3_512,
+	pgtpm.TPM2_ALG_NULL,
+}
+
+// templateSchema describes a pgtpm.PublicTemplate.
+var templateSchema = newTemplateSchema()
+
+// newTemplateSchema returns the schema for a pgtpm.PublicTemplate.
+func newTemplateSchema() *schemaNode {
+	algs := enumNames(func(i int) json.Marshaler { return pgtpm.Algorithm(i) }, 0x100)
+	hashes := enumNames(func(i int) json.Marshaler { return hashAlgorithms[i] }, len(hashAlgorithms))
+	curves := enumNames(func(i int) json.Marshaler { return pgtpm.EllipticCurve(i) }, 0x100)
+
+	var attrs []string
+	for i := 0; i < 32; i++ {
+		attrs = append(attrs, enumNames(func(int) json.Marshaler { return pgtpm.ObjectAttribute(1 << i) }, 1)...)
+	}
+
+	types := objectTypes()
+
+	alg := func(desc string) *schemaNode {
+		return &schemaNode{kind: schemaEnum, description: desc, noun: "algorithm", values: algs, ref: "algorithm"}
+	}
+
+	hash := func(desc string) *schemaNode {
+		return &schemaNode{kind: schemaEnum, description: desc, noun: "hash algorithm", values: hashes, ref: "hash"}
+	}
+
+	symmetric := &schemaNode{kind: schemaObject, description: "symmetric algorithm for a storage parent or symmetric cipher key", fields: []schemaField{
+		{name: "algorithm", node: alg("symmetric algorithm, or TPM2_ALG_NULL"), required: true},
+		{name: "key_bits", node: &schemaNode{kind: schemaInteger, description: "symmetric key size in bits", max: math.MaxUint16}},
+		{name: "mode", node: alg("symmetric block cipher mode")},
+	}}
+
+	scheme := &schemaNode{kind: schemaObject, description: "signing or encryption scheme", fields: []schemaField{
+		{name: "algorithm", node: alg("scheme, or TPM2_ALG_NULL"), required: true},
+		{name: "hash", node: hash("scheme hash algorithm")},
+		{name: "count", node: &schemaNode{kind: schemaInteger, description: "ECDAA commit count", max: math.MaxUint32}},
+	}}
+
+	return &schemaNode{kind: schemaObject, description: "TPM public area template", fields: []schemaField{
+		{name: "$schema", node: &schemaNode{kind: schemaString, description: "URI of this schema"}},
+		{name: "extends", node: &schemaNode{kind: schemaString, description: "file or built-in name of a template whose fields this template overrides"}},
+		{name: "type", node: &schemaNode{kind: schemaEnum, description: "object type", noun: "object type", values: types}, required: true},
+		{name: "name_alg", node: hash("name algorithm"), required: true},
+		{name: "attributes", node: &schemaNode{kind: schemaArray, description: "object attributes",
+			items: &schemaNode{kind: schemaEnum, noun: "object attribute", values: attrs}}},
+		{name: "auth_policy", node: &schemaNode{kind: schemaBytes, description: "base64-encoded authorization policy digest"}},
+		{name: "rsa", node: &schemaNode{kind: schemaObject, description: "RSA parameters", fields: []schemaField{
+			{name: "symmetric", node: symmetric},
+			{name: "scheme", node: scheme},
+			{name: "key_bits", node: &schemaNode{kind: schemaInteger, description: "key size in bits", max: math.MaxUint16}, required: true},
+			{name: "exponent", node: &schemaNode{kind: schemaInteger, description: "public exponent, or 0 for the default", max: math.MaxUint32}},
+			{name: "modulus", node: &schemaNode{kind: schemaBigInteger, description: "unique identifier, such as 0 for an endorsement key"}},
+		}}},
+		{name: "ecc", node: &schemaNode{kind: schemaObject, description: "ECC parameters", fields: []schemaField{
+			{name: "symmetric", node: symmetric},
+			{name: "scheme", node: scheme},
+			{name: "elliptic_curve", node: &schemaNode{kind: schemaEnum, description: "elliptic curve", noun: "curve", values: curves}, required: true},
+			{name: "kdf", node: &schemaNode{kind: schemaObject, description: "key derivation function", fields: []schemaField{
+				{name: "algorithm", node: alg("key derivation function, or TPM2_ALG_NULL"), required: true},
+				{name: "hash", node: hash("key derivation function hash algorithm")},
+			}}},
+			{name: "point", node: &schemaNode{kind: schemaObject, description: "unique identifier, such as 0 and 0 for an endorsement key", fields: []schemaField{
+				{name: "x", node: &schemaNode{kind: schemaBigInteger, description: "x coordinate"}},
+				{name: "y", node: &schemaNode{kind: schemaBigInteger, description: "y coordinate"}},
+			}}},
+		}}},
+		{name: "sym_cipher", node: &schemaNode{kind: schemaObject, description: "symmetric cipher parameters", fields: []schemaField{
+			{name: "symmetric", node: symmetric, required: true},
+		}}},
+		{name: "keyed_hash", node: &schemaNode{kind: schemaObject, description: "keyed hash parameters", fields: []schemaField{
+			{name: "algorithm", node: alg("TPM2_ALG_HMAC, TPM2_ALG_XOR, or TPM2_ALG_NULL for sealed data"), required: true},
+			{name: "hash", node: hash("HMAC or XOR hash algorithm")},
+			{name: "kdf", node: alg("XOR key derivation function")},
+		}}},
+	}}
+}
+
+// enumNames returns the JSON names of the values of an enumeration, for
+// each value from zero up to but not including n which has a name.
+func enumNames(value func(int) json.Marshaler, n int) []string {
+	var names []string
+	for i := 0; i < n; i++ {
+		b, err := value(i).MarshalJSON()
+		if err != nil {
+			continue
+		}
+
+		var name string
+		if err := json.Unmarshal(b, &name); err == nil {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// validateTemplate validates a decoded template document, and returns it
+// with its integers normalized to json.Number values, ready to be
+// unmarshalled into a pgtpm.PublicTemplate. Errors identify the path of the
+// offending field.
+func validateTemplate(doc map[string]interface{}) (map[string]interface{}, error) {
+	v, err := templateSchema.validate("", doc)
+	if err != nil {
+		return nil, err
+	}
+	doc = v.(map[string]interface{})
+
+	typ := doc["type"].(string)
+	if _, ok := doc[typeParameters[typ]]; !ok {
+		return nil, fmt.Errorf("%s: missing required field for type %s", typeParameters[typ], typ)
+	}
+
+	for _, t := range objectTypes() {
+		if _, ok := doc[typeParameters[t]]; ok && t != typ {
+			return nil, fmt.Errorf("%s: not permitted for type %s", typeParameters[t], typ)
+		}
+	}
+
+	return doc, nil
+}
+
+// validate validates a value against the schema node, returning the value
+// with its integers normalized to json.Number values.
+func (n *schemaNode) validate(path string, v interface{}) (interface{}, error) {
+	switch n.kind {
+	case schemaObject:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: expected object, found %s", displayPath(path), valueType(v))
+		}
+
+		known := make(map[string]bool)
+		for _, f := range n.fields {
+			known[f.name] = true
+		}
+
+		var keys []string
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if !known[k] {
+				return nil, fmt.Errorf("%s: unknown field", fieldPath(path, k))
+			}
+		}
+
+		out := make(map[string]interface{})
+		for _, f := range n.fields {
+			fv, ok := m[f.name]
+			if !ok {
+				if f.required {
+					return nil, fmt.Errorf("%s: missing required field", fieldPath(path, f.name))
+				}
+				continue
+			}
+
+			nv, err := f.node.validate(fieldPath(path, f.name), fv)
+			if err != nil {
+				return nil, err
+			}
+			out[f.name] = nv
+		}
+
+		return out, nil
+
+	case schemaArray:
+		a, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: expected array, found %s", displayPath(path), valueType(v))
+		}
+
+		out := make([]interface{}, len(a))
+		for i, e := range a {
+			nv, err := n.items.validate(fmt.Sprintf("%s[%d]", path, i), e)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = nv
+		}
+
+		return out, nil
+
+	case schemaString, schemaBytes, schemaEnum:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected string, found %s", displayPath(path), valueType(v))
+		}
+
+		switch n.kind {
+		case schemaBytes:
+			if _, err := base64.StdEncoding.DecodeString(s); err != nil {
+				return nil, fmt.Errorf("%s: invalid base64: %v", displayPath(path), err)
+			}
+
+		case schemaEnum:
+			var found bool
+			for _, value := range n.values {
+				if s == value {
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				return nil, fmt.Errorf("%s: unknown %s %s", displayPath(path), n.noun, s)
+			}
+		}
+
+		return s, nil
+
+	case schemaInteger, schemaBigInteger:
+		i, err := integerValue(v, n.kind == schemaBigInteger)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", displayPath(path), err)
+		}
+
+		if i.Sign() < 0 || (n.kind == schemaInteger && i.Cmp(new(big.Int).SetUint64(n.max)) > 0) {
+			if n.kind == schemaBigInteger {
+				return nil, fmt.Errorf("%s: %s is negative", displayPath(path), i)
+			}
+			return nil, fmt.Errorf("%s: %s is out of range (0 to %d)", displayPath(path), i, n.max)
+		}
+
+		return json.Number(i.String()), nil
+	}
+
+	panic(fmt.Sprintf("unexpected schema kind: %d", n.kind))
+}
+
+// integerValue returns the value of a decoded JSON or YAML integer. Large
+// integers may also be given as strings, since YAML decodes integers which
+// do not fit in 64 bits as floating point numbers.
+func integerValue(v interface{}, allowString bool) (*big.Int, error) {
+	switch x := v.(type) {
+	case json.Number:
+		if i, ok := new(big.Int).SetString(string(x), 10); ok {
+			return i, nil
+		}
+
+	case int:
+		return big.NewInt(int64(x)), nil
+
+	case int64:
+		return big.NewInt(x), nil
+
+	case uint64:
+		return new(big.Int).SetUint64(x), nil
+
+	case float64:
+		if math.Abs(x) >= 1<<53 {
+			if allowString {
+				return nil, fmt.Errorf("integer is too large to be represented exactly, and should be quoted")
+			}
+			break
+		}
+
+		if x == math.Trunc(x) {
+			return big.NewInt(int64(x)), nil
+		}
+
+	case string:
+		if allowString {
+			if i, ok := new(big.Int).SetString(x, 0); ok {
+				return i, nil
+			}
+			return nil, fmt.Errorf("invalid integer %q", x)
+		}
+	}
+
+	return nil, fmt.Errorf("expected integer, found %s", valueType(v))
+}
+
+// fieldPath returns the path of a field of the object at the given path.
+func fieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+// displayPath returns the path of a value for use in messages.
+func displayPath(path string) string {
+	if path == "" {
+		return "template"
+	}
+
+	return path
+}
+
+// valueType returns a description of the type of a decoded value.
+func valueType(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case json.Number:
+		if _, ok := new(big.Int).SetString(string(x), 10); ok {
+			return "integer"
+		}
+		return "number"
+	case int, int64, uint64:
+		return "integer"
+	case float64:
+		return "number"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
+
+// TemplateSchema returns the JSON Schema for pgtpm.PublicTemplate templates,
+// as accepted by ParseTemplate and LoadTemplate.
+func TemplateSchema() ([]byte, error) {
+	defs := make(map[string]interface{})
+	schema := templateSchema.jsonSchema(defs)
+	schema["definitions"] = defs
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "tpmtool template"
+
+	// Require the parameters of the object type, and no others.
+	types := objectTypes()
+
+	var rules []interface{}
+	for _, t := range types {
+		var others []interface{}
+		for _, o := range types {
+			if o != t {
+				others = append(others, map[string]interface{}{"required": []string{typeParameters[o]}})
+			}
+		}
+
+		rules = append(rules, map[string]interface{}{
+			"if": map[string]interface{}{
+				"properties": map[string]interface{}{"type": map[string]interface{}{"const": t}},
+			},
+			"then": map[string]interface{}{
+				"required": []string{typeParameters[t]},
+				"not":      map[string]interface{}{"anyOf": others},
+			},
+		})
+	}
+	schema["allOf"] = rules
+
+	data, err := json.MarshalIndent(schema, "", "    ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schema: %v", err)
+	}
+
+	return append(data, '\n'), nil
+}
+
+// jsonSchema returns the JSON Schema for the schema node, adding the
+// definitions of shared nodes to defs.
+func (n *schemaNode) jsonSchema(defs map[string]interface{}) map[string]interface{} {
+	s := make(map[string]interface{})
+	if n.description != "" {
+		s["description"] = n.description
+	}
+
+	if n.ref != "" {
+		def := *n
+		def.description = ""
+		def.ref = ""
+		defs[n.ref] = def.jsonSchema(defs)
+
+		s["allOf"] = []interface{}{
+			map[string]interface{}{"$ref": "#/definitions/" + n.ref},
+		}
+		return s
+	}
+
+	switch n.kind {
+	case schemaObject:
+		props := make(map[string]interface{})
+		var required []string
+		for _, f := range n.fields {
+			props[f.name] = f.node.jsonSchema(defs)
+			if f.required {
+				required = append(required, f.name)
+			}
+		}
+
+		s["type"] = "object"
+		s["properties"] = props
+		s["additionalProperties"] = false
+		if len(required) > 0 {
+			s["required"] = required
+		}
+
+	case schemaArray:
+		s["type"] = "array"
+		s["items"] = n.items.jsonSchema(defs)
+
+	case schemaString:
+		s["type"] = "string"
+
+	case schemaBytes:
+		s["type"] = "string"
+		s["contentEncoding"] = "base64"
+
+	case schemaEnum:
+		s["type"] = "string"
+		s["enum"] = n.values
+
+	case schemaInteger:
+		s["type"] = "integer"
+		s["minimum"] = 0
+		s["maximum"] = n.max
+
+	case schemaBigInteger:
+		s["oneOf"] = []interface{}{
+			map[string]interface{}{"type": "integer", "minimum": 0},
+			map[string]interface{}{"type": "string", "pattern": "^(0[xX][0-9a-fA-F]+|[0-9]+)$"},
+		}
+	}
+
+	return s
+}
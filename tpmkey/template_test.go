@@ -0,0 +1,551 @@
+package tpmkey
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/paulgriffiths/pgtpm"
+)
+
+func TestBuiltinTemplates(t *testing.T) {
+	t.Parallel()
+
+	var testcases = []struct {
+		name string
+		file string
+	}{
+		{
+			name: "tcg-ek-rsa2048",
+			file: "rsa_ek.json",
+		},
+		{
+			name: "tcg-ek-ecc-p256",
+			file: "ecc_ek.json",
+		},
+	}
+
+	for _, tc := range testcases {
+		var tc = tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			want, err := LoadTemplate(filepath.Join("..", "testdata", tc.file))
+			if err != nil {
+				t.Fatalf("couldn't load template: %v", err)
+			}
+
+			got, err := LoadTemplate(tc.name)
+			if err != nil {
+				t.Fatalf("couldn't load template: %v", err)
+			}
+
+			if !got.MatchesTemplate(want) {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+// TestEKTemplates checks the name algorithm, symmetric algorithm and
+// authorization policy of the EK templates against the values in the TCG EK
+// Credential Profile. The low range templates use PolicyA, and the high range
+// templates use PolicyB.
+func TestEKTemplates(t *testing.T) {
+	t.Parallel()
+
+	var testcases = []struct {
+		name    string
+		nameAlg tpm2.Algorithm
+		symAlg  tpm2.Algorithm
+		symBits uint16
+		policy  string
+	}{
+		{
+			name:    "tcg-ek-rsa2048",
+			nameAlg: tpm2.AlgSHA256,
+			symAlg:  tpm2.AlgAES,
+			symBits: 128,
+			policy:  "837197674484b3f81a90cc8d46a5d724fd52d76e06520b64f2a1da1b331469aa",
+		},
+		{
+			name:    "tcg-ek-ecc-p256",
+			nameAlg: tpm2.AlgSHA256,
+			symAlg:  tpm2.AlgAES,
+			symBits: 128,
+			policy:  "837197674484b3f81a90cc8d46a5d724fd52d76e06520b64f2a1da1b331469aa",
+		},
+		{
+			name:    "tcg-ek-ecc-p384",
+			nameAlg: tpm2.AlgSHA384,
+			symAlg:  tpm2.AlgAES,
+			symBits: 256,
+			policy: "b26e7d28d11a50bc53d882bcf5fd3a1a074148bb35d3b4e4" +
+				"cb1c0ad9bde419cacb47ba09699646150f9fc000f3f80e12",
+		},
+		{
+			name:    "tcg-ek-ecc-p521",
+			nameAlg: tpm2.AlgSHA512,
+			symAlg:  tpm2.AlgAES,
+			symBits: 256,
+			policy: "b8221ca69e8550a4914de3faa6a18c072cc01208073a928d" +
+				"5d66d59ef79e49a429c41a6b269571d57edb25fbdb183842" +
+				"5608b413cd616a5f6db5b6071af99bea",
+		},
+		{
+			name:    "tcg-ek-ecc-sm2",
+			nameAlg: tpm2.Algorithm(pgtpm.TPM2_ALG_SM3_256),
+			symAlg:  tpm2.Algorithm(pgtpm.TPM2_ALG_SM4),
+			symBits: 128,
+			policy:  "167860a35f2c5c3567f9c927ac56c032f3b3a6462f8d037998e7a10f77fa454a",
+		},
+		{
+			name:    "tcg-ek-rsa3072",
+			nameAlg: tpm2.AlgSHA384,
+			symAlg:  tpm2.AlgAES,
+			symBits: 256,
+			policy: "b26e7d28d11a50bc53d882bcf5fd3a1a074148bb35d3b4e4" +
+				"cb1c0ad9bde419cacb47ba09699646150f9fc000f3f80e12",
+		},
+	}
+
+	for _, tc := range testcases {
+		var tc = tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := LoadTemplate(tc.name)
+			if err != nil {
+				t.Fatalf("couldn't load template: %v", err)
+			}
+
+			if got.NameAlg != tc.nameAlg {
+				t.Errorf("got name algorithm %v, want %v", got.NameAlg, tc.nameAlg)
+			}
+
+			var sym *tpm2.SymScheme
+			switch {
+			case got.RSAParameters != nil:
+				sym = got.RSAParameters.Symmetric
+			case got.ECCParameters != nil:
+				sym = got.ECCParameters.Symmetric
+			}
+
+			if sym == nil {
+				t.Fatalf("template has no symmetric scheme")
+			}
+
+			if sym.Alg != tc.symAlg || sym.KeyBits != tc.symBits {
+				t.Errorf("got symmetric algorithm %v-%d, want %v-%d",
+					sym.Alg, sym.KeyBits, tc.symAlg, tc.symBits)
+			}
+
+			want, err := hex.DecodeString(tc.policy)
+			if err != nil {
+				t.Fatalf("failed to decode hex: %v", err)
+			}
+
+			if !bytes.Equal(got.AuthPolicy, want) {
+				t.Errorf("got policy %x, want %x", got.AuthPolicy, want)
+			}
+		})
+	}
+
+	// Every EK template must be covered.
+	for _, tmpl := range BuiltinTemplates() {
+		if !strings.HasPrefix(tmpl.Name, "tcg-ek-") {
+			continue
+		}
+
+		var found bool
+		for _, tc := range testcases {
+			if tc.name == tmpl.Name {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			t.Errorf("no known values for template %s", tmpl.Name)
+		}
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	t.Parallel()
+
+	modulus, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+
+	var testcases = []struct {
+		name string
+		data string
+		want tpm2.Public
+	}{
+		{
+			name: "JSON",
+			data: `{
+    "type": "TPM2_ALG_KEYEDHASH",
+    "name_alg": "TPM2_ALG_SHA256",
+    "attributes": ["TPMA_OBJECT_FIXEDTPM", "TPMA_OBJECT_USERWITHAUTH"],
+    "auth_policy": "AAEC",
+    "keyed_hash": {"algorithm": "TPM2_ALG_NULL", "hash": "TPM2_ALG_NULL", "kdf": "TPM2_ALG_NULL"}
+}`,
+			want: tpm2.Public{
+				Type:       tpm2.AlgKeyedHash,
+				NameAlg:    tpm2.AlgSHA256,
+				Attributes: tpm2.FlagFixedTPM | tpm2.FlagUserWithAuth,
+				AuthPolicy: []byte{0, 1, 2},
+				KeyedHashParameters: &tpm2.KeyedHashParams{
+					Alg:  tpm2.AlgNull,
+					Hash: tpm2.AlgNull,
+					KDF:  tpm2.AlgNull,
+				},
+			},
+		},
+		{
+			// Integers which cannot be represented exactly as YAML numbers
+			// may be quoted.
+			name: "YAMLQuotedIntegers",
+			data: `
+type: TPM2_ALG_RSA
+name_alg: TPM2_ALG_SHA256
+attributes:
+  - TPMA_OBJECT_DECRYPT
+rsa:
+  key_bits: 2048
+  exponent: 65537
+  modulus: "123456789012345678901234567890"
+`,
+			want: tpm2.Public{
+				Type:       tpm2.AlgRSA,
+				NameAlg:    tpm2.AlgSHA256,
+				Attributes: tpm2.FlagDecrypt,
+				RSAParameters: &tpm2.RSAParams{
+					KeyBits:     2048,
+					ExponentRaw: 65537,
+				},
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		var tc = tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseTemplate([]byte(tc.data))
+			if err != nil {
+				t.Fatalf("couldn't parse template: %v", err)
+			}
+
+			if !got.MatchesTemplate(tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+
+			// The modulus is padded to the key size.
+			if got.RSAParameters != nil {
+				if m := new(big.Int).SetBytes(got.RSAParameters.ModulusRaw); m.Cmp(modulus) != 0 {
+					t.Errorf("got modulus %v, want %v", m, modulus)
+				}
+			}
+		})
+	}
+}
+
+func TestParseTemplateFailure(t *testing.T) {
+	t.Parallel()
+
+	var testcases = []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "UnknownCurve",
+			data: `
+type: TPM2_ALG_ECC
+name_alg: TPM2_ALG_SHA256
+ecc:
+  elliptic_curve: TPM2_ECC_NIST_P999
+`,
+			want: "ecc.elliptic_curve: unknown curve TPM2_ECC_NIST_P999",
+		},
+		{
+			name: "NameAlgorithmNotHash",
+			data: `
+type: TPM2_ALG_RSA
+name_alg: TPM2_ALG_ECC
+rsa: {key_bits: 2048}
+`,
+			want: "name_alg: unknown hash algorithm TPM2_ALG_ECC",
+		},
+		{
+			name: "SchemeHashNotHash",
+			data: `
+type: TPM2_ALG_RSA
+name_alg: TPM2_ALG_SHA256
+rsa:
+  key_bits: 2048
+  scheme: {algorithm: TPM2_ALG_RSASSA, hash: TPM2_ALG_AES}
+`,
+			want: "rsa.scheme.hash: unknown hash algorithm TPM2_ALG_AES",
+		},
+		{
+			name: "UnknownAttribute",
+			data: `
+type: TPM2_ALG_KEYEDHASH
+name_alg: TPM2_ALG_SHA256
+attributes: [TPMA_OBJECT_NOSUCHATTRIBUTE]
+keyed_hash: {algorithm: TPM2_ALG_NULL, hash: TPM2_ALG_NULL, kdf: TPM2_ALG_NULL}
+`,
+			want: "attributes[0]: unknown object attribute TPMA_OBJECT_NOSUCHATTRIBUTE",
+		},
+		{
+			name: "AttributeType",
+			data: `{
+    "type": "TPM2_ALG_KEYEDHASH",
+    "name_alg": "TPM2_ALG_SHA256",
+    "attributes": [1],
+    "keyed_hash": {"algorithm": "TPM2_ALG_NULL", "hash": "TPM2_ALG_NULL", "kdf": "TPM2_ALG_NULL"}
+}`,
+			want: "attributes[0]: expected string, found",
+		},
+		{
+			// Integers of 2^53 or more are decoded from YAML as floating
+			// point numbers, losing precision.
+			name: "YAMLLargeInteger",
+			data: `
+type: TPM2_ALG_RSA
+name_alg: TPM2_ALG_SHA256
+rsa:
+  key_bits: 2048
+  modulus: 123456789012345678901234567890
+`,
+			want: "rsa.modulus: integer is too large to be represented exactly, and should be quoted",
+		},
+		{
+			name: "OutOfRange",
+			data: `
+type: TPM2_ALG_RSA
+name_alg: TPM2_ALG_SHA256
+rsa:
+  key_bits: 65536
+`,
+			want: "rsa.key_bits: 65536 is out of range",
+		},
+		{
+			name: "UnknownField",
+			data: `
+type: TPM2_ALG_RSA
+name_alg: TPM2_ALG_SHA256
+rsa:
+  key_bits: 2048
+  key_size: 2048
+`,
+			want: "rsa.key_size: unknown field",
+		},
+		{
+			name: "MissingParameters",
+			data: `
+type: TPM2_ALG_RSA
+name_alg: TPM2_ALG_SHA256
+`,
+			want: "rsa: missing required field for type TPM2_ALG_RSA",
+		},
+		{
+			name: "OtherTypeParameters",
+			data: `
+type: TPM2_ALG_RSA
+name_alg: TPM2_ALG_SHA256
+rsa: {key_bits: 2048}
+ecc: {elliptic_curve: TPM2_ECC_NIST_P256}
+`,
+			want: "ecc: not permitted for type TPM2_ALG_RSA",
+		},
+		{
+			name: "JSONSyntax",
+			data: "{\n    \"type\": \"TPM2_ALG_RSA\",\n    \"name_alg\": ,\n}",
+			want: "line 3:",
+		},
+		{
+			name: "NotObject",
+			data: "- TPM2_ALG_RSA\n",
+			want: "expected object, found array",
+		},
+	}
+
+	for _, tc := range testcases {
+		var tc = tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ParseTemplate([]byte(tc.data))
+			if err == nil {
+				t.Fatalf("unexpectedly parsed template")
+			}
+
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got error %q, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadTemplateExtends(t *testing.T) {
+	t.Parallel()
+
+	dir := mustTempDir(t)
+
+	const base = "tcg-ek-rsa2048"
+
+	mustWriteFile(t, filepath.Join(dir, "ek.yaml"), `
+extends: `+base+`
+rsa:
+  key_bits: 3072
+`)
+
+	// A null value removes a field, and a file may extend another file
+	// relative to its own directory.
+	mustWriteFile(t, filepath.Join(dir, "nopolicy.yaml"), `
+extends: ek.yaml
+auth_policy: null
+`)
+
+	want, err := LoadTemplate(base)
+	if err != nil {
+		t.Fatalf("couldn't load template: %v", err)
+	}
+
+	if len(want.AuthPolicy) == 0 {
+		t.Fatalf("template %s unexpectedly has no authorization policy", base)
+	}
+	want.RSAParameters.KeyBits = 3072
+
+	got, err := LoadTemplate(filepath.Join(dir, "ek.yaml"))
+	if err != nil {
+		t.Fatalf("couldn't load template: %v", err)
+	}
+
+	if !got.MatchesTemplate(want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	got, err = LoadTemplate(filepath.Join(dir, "nopolicy.yaml"))
+	if err != nil {
+		t.Fatalf("couldn't load template: %v", err)
+	}
+
+	want.AuthPolicy = nil
+	if !got.MatchesTemplate(want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadTemplateExtendsFailure(t *testing.T) {
+	t.Parallel()
+
+	dir := mustTempDir(t)
+
+	mustWriteFile(t, filepath.Join(dir, "a.yaml"), "extends: b.yaml\n")
+	mustWriteFile(t, filepath.Join(dir, "b.yaml"), "extends: a.yaml\n")
+	mustWriteFile(t, filepath.Join(dir, "self.yaml"), "extends: self.yaml\n")
+	mustWriteFile(t, filepath.Join(dir, "missing.yaml"), "extends: nosuchtemplate.yaml\n")
+	mustWriteFile(t, filepath.Join(dir, "number.yaml"), "extends: 1\n")
+
+	var testcases = []struct {
+		name string
+		file string
+		want string
+	}{
+		{
+			name: "Cycle",
+			file: "a.yaml",
+			want: "extends cycle",
+		},
+		{
+			name: "SelfCycle",
+			file: "self.yaml",
+			want: "extends cycle",
+		},
+		{
+			name: "Missing",
+			file: "missing.yaml",
+			want: "failed to read template",
+		},
+		{
+			name: "NotString",
+			file: "number.yaml",
+			want: "extends: expected string, found",
+		},
+	}
+
+	for _, tc := range testcases {
+		var tc = tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := LoadTemplate(filepath.Join(dir, tc.file))
+			if err == nil {
+				t.Fatalf("unexpectedly loaded template")
+			}
+
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got error %q, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// TestTemplateSchema checks that the generated template schema file is up to
+// date. Run go generate in the repository root to update it.
+func TestTemplateSchema(t *testing.T) {
+	t.Parallel()
+
+	want, err := ioutil.ReadFile(filepath.Join("..", "template.schema.json"))
+	if err != nil {
+		t.Fatalf("failed to read schema: %v", err)
+	}
+
+	got, err := TemplateSchema()
+	if err != nil {
+		t.Fatalf("couldn't generate schema: %v", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("template.schema.json is out of date, run go generate")
+	}
+}
+
+// mustTempDir creates a temporary directory, which is removed when the test
+// and its subtests complete.
+func mustTempDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "tpmkey")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return dir
+}
+
+// mustWriteFile writes data to the named file.
+func mustWriteFile(t *testing.T, name, data string) {
+	t.Helper()
+
+	if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package tpmkey
+
+import (
+	"crypto/tls"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+// TLSSignatureSchemes returns the TLS signature schemes which the key is able
+// to produce, in order of preference. The result is suitable for use as the
+// SupportedSignatureAlgorithms field of a tls.Certificate, which ensures that
+// a TLS peer does not negotiate a scheme that the key's own signing scheme
+// would cause the TPM to reject. A nil slice is returned if the key cannot be
+// used for TLS.
+func (k *Key) TLSSignatureSchemes() []tls.SignatureScheme {
+	if k.pub.Attributes&tpm2.FlagSign == 0 {
+		return nil
+	}
+
+	var alg, hash tpm2.Algorithm
+	if k.scheme != nil && !k.scheme.Alg.IsNull() {
+		alg = k.scheme.Alg
+		hash = k.scheme.Hash
+	}
+
+	switch {
+	case k.pub.RSAParameters != nil:
+		pss := map[tpm2.Algorithm]tls.SignatureScheme{
+			tpm2.AlgSHA256: tls.PSSWithSHA256,
+			tpm2.AlgSHA384: tls.PSSWithSHA384,
+			tpm2.AlgSHA512: tls.PSSWithSHA512,
+		}
+		pkcs1 := map[tpm2.Algorithm]tls.SignatureScheme{
+			tpm2.AlgSHA1:   tls.PKCS1WithSHA1,
+			tpm2.AlgSHA256: tls.PKCS1WithSHA256,
+			tpm2.AlgSHA384: tls.PKCS1WithSHA384,
+			tpm2.AlgSHA512: tls.PKCS1WithSHA512,
+		}
+
+		switch alg {
+		case tpm2.AlgRSAPSS:
+			if s, ok := pss[hash]; ok {
+				return []tls.SignatureScheme{s}
+			}
+
+		case tpm2.AlgRSASSA:
+			if s, ok := pkcs1[hash]; ok {
+				return []tls.SignatureScheme{s}
+			}
+
+		case 0:
+			return []tls.SignatureScheme{
+				tls.PSSWithSHA256,
+				tls.PSSWithSHA384,
+				tls.PSSWithSHA512,
+				tls.PKCS1WithSHA256,
+				tls.PKCS1WithSHA384,
+				tls.PKCS1WithSHA512,
+			}
+		}
+
+	case k.pub.ECCParameters != nil:
+		// TLS 1.3 binds each ECDSA signature scheme to both a curve and a
+		// hash algorithm, so a key-specified hash algorithm must be the one
+		// paired with the key's curve, or SHA1, which is only used in TLS
+		// 1.2. Without a key-specified hash algorithm, the paired one is
+		// used.
+		if alg != 0 && alg != tpm2.AlgECDSA {
+			return nil
+		}
+
+		var curveHash tpm2.Algorithm
+		switch k.pub.ECCParameters.CurveID {
+		case tpm2.CurveNISTP256:
+			curveHash = tpm2.AlgSHA256
+
+		case tpm2.CurveNISTP384:
+			curveHash = tpm2.AlgSHA384
+
+		case tpm2.CurveNISTP521:
+			curveHash = tpm2.AlgSHA512
+		}
+
+		if hash == 0 {
+			hash = curveHash
+		} else if hash != curveHash && hash != tpm2.AlgSHA1 {
+			return nil
+		}
+
+		switch hash {
+		case tpm2.AlgSHA1:
+			return []tls.SignatureScheme{tls.ECDSAWithSHA1}
+
+		case tpm2.AlgSHA256:
+			return []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256}
+
+		case tpm2.AlgSHA384:
+			return []tls.SignatureScheme{tls.ECDSAWithP384AndSHA384}
+
+		case tpm2.AlgSHA512:
+			return []tls.SignatureScheme{tls.ECDSAWithP521AndSHA512}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package tpmkey
+
+import (
+	"crypto/tls"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+func TestTLSSignatureSchemes(t *testing.T) {
+	t.Parallel()
+
+	var testcases = []struct {
+		name string
+		pub  tpm2.Public
+		want []tls.SignatureScheme
+	}{
+		{
+			name: "RSA/Unrestricted",
+			pub: tpm2.Public{
+				Attributes:    tpm2.FlagSign,
+				RSAParameters: &tpm2.RSAParams{},
+			},
+			want: []tls.SignatureScheme{
+				tls.PSSWithSHA256,
+				tls.PSSWithSHA384,
+				tls.PSSWithSHA512,
+				tls.PKCS1WithSHA256,
+				tls.PKCS1WithSHA384,
+				tls.PKCS1WithSHA512,
+			},
+		},
+		{
+			name: "RSA/RSASSA-SHA384",
+			pub: tpm2.Public{
+				Attributes: tpm2.FlagSign,
+				RSAParameters: &tpm2.RSAParams{
+					Sign: &tpm2.SigScheme{Alg: tpm2.AlgRSASSA, Hash: tpm2.AlgSHA384},
+				},
+			},
+			want: []tls.SignatureScheme{tls.PKCS1WithSHA384},
+		},
+		{
+			name: "RSA/NotSigning",
+			pub: tpm2.Public{
+				Attributes:    tpm2.FlagDecrypt,
+				RSAParameters: &tpm2.RSAParams{},
+			},
+		},
+		{
+			name: "ECC/P384",
+			pub: tpm2.Public{
+				Attributes:    tpm2.FlagSign,
+				ECCParameters: &tpm2.ECCParams{CurveID: tpm2.CurveNISTP384},
+			},
+			want: []tls.SignatureScheme{tls.ECDSAWithP384AndSHA384},
+		},
+		{
+			name: "ECC/P256/ECDSA-SHA256",
+			pub: tpm2.Public{
+				Attributes: tpm2.FlagSign,
+				ECCParameters: &tpm2.ECCParams{
+					CurveID: tpm2.CurveNISTP256,
+					Sign:    &tpm2.SigScheme{Alg: tpm2.AlgECDSA, Hash: tpm2.AlgSHA256},
+				},
+			},
+			want: []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+		},
+		{
+			// TLS 1.3 pairs SHA384 with P384 only.
+			name: "ECC/P256/ECDSA-SHA384",
+			pub: tpm2.Public{
+				Attributes: tpm2.FlagSign,
+				ECCParameters: &tpm2.ECCParams{
+					CurveID: tpm2.CurveNISTP256,
+					Sign:    &tpm2.SigScheme{Alg: tpm2.AlgECDSA, Hash: tpm2.AlgSHA384},
+				},
+			},
+		},
+		{
+			name: "ECC/P256/ECDSA-SHA1",
+			pub: tpm2.Public{
+				Attributes: tpm2.FlagSign,
+				ECCParameters: &tpm2.ECCParams{
+					CurveID: tpm2.CurveNISTP256,
+					Sign:    &tpm2.SigScheme{Alg: tpm2.AlgECDSA, Hash: tpm2.AlgSHA1},
+				},
+			},
+			want: []tls.SignatureScheme{tls.ECDSAWithSHA1},
+		},
+		{
+			name: "ECC/ECDAA",
+			pub: tpm2.Public{
+				Attributes: tpm2.FlagSign,
+				ECCParameters: &tpm2.ECCParams{
+					CurveID: tpm2.CurveNISTP256,
+					Sign:    &tpm2.SigScheme{Alg: tpm2.AlgECDAA, Hash: tpm2.AlgSHA256},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		var tc = tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			k := &Key{pub: tc.pub}
+			switch {
+			case tc.pub.RSAParameters != nil:
+				k.scheme = tc.pub.RSAParameters.Sign
+			case tc.pub.ECCParameters != nil:
+				k.scheme = tc.pub.ECCParameters.Sign
+			}
+
+			if got := k.TLSSignatureSchemes(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/google/go-tpm/tpmutil"
+
+	"github.com/paulgriffiths/pgtpm"
+)
+
+// unseal unseals the data in a sealed data object.
+func unseal() (err error) {
+	err = ensureExactlyOnePassed(fUnsealSet, contextFlagName, handleFlagName)
+	if err != nil {
+		return err
+	}
+
+	auth, err := newEntityAuth(*fUnsealPassword, *fUnsealPolicy)
+	if err != nil {
+		return err
+	}
+
+	t, err := getTPM(*fUnsealTPM)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	handle, release, err := contextHandle(t, fUnsealHandle, *fUnsealContext)
+	if err != nil {
+		return err
+	}
+	defer release(&err)
+
+	authz, err := auth.authorize(t, pgtpm.TPM2_CC_Unseal)
+	if err != nil {
+		return fmt.Errorf("failed to authorize object: %v", err)
+	}
+	defer closeAuthorization(t, authz, &err)
+
+	_, resp, err := runAuthCommand(t, pgtpm.TPM2_CC_Unseal,
+		[]tpmutil.Handle{handle}, []authorization{authz}, 0, nil)
+	if err != nil {
+		return fmt.Errorf("failed to unseal object: %v", err)
+	}
+
+	var data tpmutil.U16Bytes
+	if _, err := tpmutil.Unpack(resp, &data); err != nil {
+		return fmt.Errorf("failed to decode unsealed data: %v", err)
+	}
+
+	if *fUnsealOut != "" {
+		if err := ioutil.WriteFile(*fUnsealOut, data, 0600); err != nil {
+			return fmt.Errorf("failed to write output file: %v", err)
+		}
+
+		return nil
+	}
+
+	os.Stdout.Write(data)
+
+	return nil
+}
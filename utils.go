@@ -15,6 +15,20 @@ func hexEncodeBytes(b []byte) string {
 	return string(dst)
 }
 
+// bigIntToFixedSizeBytes returns the big-endian representation of a big
+// integer, left-padded with zeros to the specified size.
+func bigIntToFixedSizeBytes(n *big.Int, size int) []byte {
+	b := n.Bytes()
+	if len(b) >= size {
+		return b
+	}
+
+	rv := make([]byte, size)
+	copy(rv[size-len(b):], b)
+
+	return rv
+}
+
 // outputBigInt outputs a big integer on multiple lines, with the label
 // only on the first line.
 func outputBigInt(label string, fw int, n *big.Int) {
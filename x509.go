@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// hashNames maps hash algorithm names to Go hash functions.
+var hashNames = map[string]crypto.Hash{
+	"sha1":   crypto.SHA1,
+	"sha256": crypto.SHA256,
+	"sha384": crypto.SHA384,
+	"sha512": crypto.SHA512,
+}
+
+// parseHash parses a hash algorithm name. An empty string yields zero.
+func parseHash(s string) (crypto.Hash, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	h, ok := hashNames[strings.ToLower(s)]
+	if !ok {
+		return 0, fmt.Errorf("unsupported hash algorithm: %s", s)
+	}
+
+	return h, nil
+}
+
+// parseSubject parses a distinguished name in the form "CN=name, O=org",
+// where commas within values may be escaped with a backslash.
+func parseSubject(s string) (pkix.Name, error) {
+	var name pkix.Name
+	var parts []string
+	var builder strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			builder.WriteByte(s[i])
+
+		case s[i] == ',':
+			parts = append(parts, builder.String())
+			builder.Reset()
+
+		default:
+			builder.WriteByte(s[i])
+		}
+	}
+	parts = append(parts, builder.String())
+
+	for _, part := range parts {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return pkix.Name{}, fmt.Errorf("invalid subject attribute: %q", strings.TrimSpace(part))
+		}
+
+		value := strings.TrimSpace(kv[1])
+
+		switch strings.ToUpper(strings.TrimSpace(kv[0])) {
+		case "CN":
+			name.CommonName = value
+
+		case "SERIALNUMBER":
+			name.SerialNumber = value
+
+		case "C":
+			name.Country = append(name.Country, value)
+
+		case "O":
+			name.Organization = append(name.Organization, value)
+
+		case "OU":
+			name.OrganizationalUnit = append(name.OrganizationalUnit, value)
+
+		case "L":
+			name.Locality = append(name.Locality, value)
+
+		case "ST":
+			name.Province = append(name.Province, value)
+
+		case "STREET":
+			name.StreetAddress = append(name.StreetAddress, value)
+
+		case "POSTALCODE":
+			name.PostalCode = append(name.PostalCode, value)
+
+		default:
+			return pkix.Name{}, fmt.Errorf("unsupported subject attribute: %s", strings.TrimSpace(kv[0]))
+		}
+	}
+
+	return name, nil
+}
+
+// sanValues contains parsed subject alternative names.
+type sanValues struct {
+	dnsNames       []string
+	emailAddresses []string
+	ipAddresses    []net.IP
+	uris           []*url.URL
+}
+
+// parseSANs parses subject alternative names in the form "type:value", where
+// type is one of dns, email, ip or uri.
+func parseSANs(sans []string) (sanValues, error) {
+	var rv sanValues
+
+	for _, san := range sans {
+		kv := strings.SplitN(san, ":", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return sanValues{}, fmt.Errorf("invalid subject alternative name: %q", san)
+		}
+
+		switch strings.ToLower(kv[0]) {
+		case "dns":
+			rv.dnsNames = append(rv.dnsNames, kv[1])
+
+		case "email":
+			rv.emailAddresses = append(rv.emailAddresses, kv[1])
+
+		case "ip":
+			ip := net.ParseIP(kv[1])
+			if ip == nil {
+				return sanValues{}, fmt.Errorf("invalid IP address: %s", kv[1])
+			}
+			rv.ipAddresses = append(rv.ipAddresses, ip)
+
+		case "uri":
+			u, err := url.Parse(kv[1])
+			if err != nil {
+				return sanValues{}, fmt.Errorf("invalid URI: %v", err)
+			}
+			rv.uris = append(rv.uris, u)
+
+		default:
+			return sanValues{}, fmt.Errorf("unsupported subject alternative name type: %s", kv[0])
+		}
+	}
+
+	return rv, nil
+}
+
+// randomSerialNumber returns a random, positive 128-bit certificate serial
+// number.
+func randomSerialNumber() (*big.Int, error) {
+	n, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+
+	return n.Add(n, big.NewInt(1)), nil
+}